@@ -0,0 +1,42 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package api provides typed structs and client methods for the endpoints of the inverter's REST API. They are generated from the
+// OpenAPI description in openapi.json, run "go generate ./api" after changing it. openapi.json is maintained by hand and describes
+// the endpoints which the library uses; the Swagger 2 description published by the web server of an inverter can
+// replace it unchanged to generate methods for all endpoints of its firmware. The requests are sent with the session of a
+// golrackpi.AuthClient:
+//
+//	client := golrackpi.NewWithParameter(golrackpi.AuthClient{Server: "192.168.1.10", Password: "secret"})
+//	client.Login()
+//	version, err := api.New(client).GetVersion(context.Background())
+package api
+
+//go:generate go run ../internal/apigen -in openapi.json -out api_gen.go -package api
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Doer sends requests to the inverter API, it's implemented by golrackpi.AuthClient
+type Doer interface {
+	Do(ctx context.Context, method string, path string, body interface{}, out interface{}) error
+}
+
+// Client provides the generated methods of all endpoints
+type Client struct {
+	Doer Doer
+}
+
+// New returns a Client instance which sends the requests with doer
+func New(doer Doer) *Client {
+	return &Client{Doer: doer}
+}
+
+// pathParam escapes a path parameter. Commas are kept, because they separate the ids of multiple process-data or settings.
+func pathParam(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "%2C", ",")
+}
@@ -0,0 +1,314 @@
+// Code generated by apigen from openapi.json; DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+)
+
+// AuthCreateSessionRequest specifies the AuthCreateSessionRequest schema
+type AuthCreateSessionRequest struct {
+	Iv            string `json:"iv"`
+	Payload       string `json:"payload"`
+	Tag           string `json:"tag"`
+	TransactionId string `json:"transactionId"`
+}
+
+// AuthCreateSessionResponse specifies the AuthCreateSessionResponse schema
+type AuthCreateSessionResponse struct {
+	SessionId string `json:"sessionId"`
+}
+
+// AuthFinishRequest specifies the AuthFinishRequest schema
+type AuthFinishRequest struct {
+	// Base64 encoded client proof
+	Proof         string `json:"proof"`
+	TransactionId string `json:"transactionId"`
+}
+
+// AuthFinishResponse specifies the AuthFinishResponse schema
+type AuthFinishResponse struct {
+	// Base64 encoded server signature
+	Signature string `json:"signature"`
+	Token     string `json:"token"`
+}
+
+// AuthStartRequest specifies the AuthStartRequest schema
+type AuthStartRequest struct {
+	// Base64 encoded client nonce
+	Nonce    string `json:"nonce"`
+	Username string `json:"username"`
+}
+
+// AuthStartResponse specifies the AuthStartResponse schema
+type AuthStartResponse struct {
+	// Server nonce, starts with the client nonce
+	Nonce  string `json:"nonce"`
+	Rounds int32  `json:"rounds"`
+	// Base64 encoded salt
+	Salt          string `json:"salt"`
+	TransactionId string `json:"transactionId"`
+}
+
+// Error specifies the Error schema: Error response
+type Error struct {
+	Message string `json:"message,omitempty"`
+}
+
+// Event specifies the Event schema: Event of the inverter
+type Event struct {
+	// info, warning or error
+	Category    string `json:"category,omitempty"`
+	Code        int    `json:"code,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Local time of the inverter without offset
+	EndTime         string `json:"end_time,omitempty"`
+	Group           string `json:"group,omitempty"`
+	IsActive        bool   `json:"is_active,omitempty"`
+	LongDescription string `json:"long_description,omitempty"`
+	// Local time of the inverter without offset
+	StartTime string `json:"start_time,omitempty"`
+}
+
+// EventsRequest specifies the EventsRequest schema
+type EventsRequest struct {
+	// Language of the descriptions, e.g. en-gb
+	Language string `json:"language,omitempty"`
+	// Maximum number of events
+	Max int `json:"max,omitempty"`
+}
+
+// LogDataRequest specifies the LogDataRequest schema
+type LogDataRequest struct {
+	Begin string `json:"begin"`
+	End   string `json:"end"`
+}
+
+// MeInfo specifies the MeInfo schema: Information about the current user
+type MeInfo struct {
+	Active        bool     `json:"active,omitempty"`
+	Anonymous     bool     `json:"anonymous,omitempty"`
+	Authenticated bool     `json:"authenticated,omitempty"`
+	Locked        bool     `json:"locked,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	// NONE, USER or INSTALLER
+	Role string `json:"role,omitempty"`
+}
+
+// ModuleInfo specifies the ModuleInfo schema: Module with its type
+type ModuleInfo struct {
+	Id   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// ModuleSettingValues specifies the ModuleSettingValues schema: Module with setting values
+type ModuleSettingValues struct {
+	Moduleid string         `json:"moduleid"`
+	Settings []SettingValue `json:"settings"`
+}
+
+// ModuleSettingsMeta specifies the ModuleSettingsMeta schema: Module with the description of its settings
+type ModuleSettingsMeta struct {
+	Moduleid string        `json:"moduleid,omitempty"`
+	Settings []SettingMeta `json:"settings,omitempty"`
+}
+
+// ProcessDataIds specifies the ProcessDataIds schema: Module with a list of process-data ids
+type ProcessDataIds struct {
+	Moduleid       string   `json:"moduleid"`
+	Processdataids []string `json:"processdataids"`
+}
+
+// ProcessDataModuleValues specifies the ProcessDataModuleValues schema: Module with process-data values
+type ProcessDataModuleValues struct {
+	Moduleid    string             `json:"moduleid,omitempty"`
+	Processdata []ProcessDataValue `json:"processdata,omitempty"`
+}
+
+// ProcessDataValue specifies the ProcessDataValue schema: Process-data value with its unit
+type ProcessDataValue struct {
+	Id    string  `json:"id,omitempty"`
+	Unit  string  `json:"unit,omitempty"`
+	Value float64 `json:"value,omitempty"`
+}
+
+// SettingIds specifies the SettingIds schema: Module with a list of setting ids
+type SettingIds struct {
+	Moduleid   string   `json:"moduleid"`
+	Settingids []string `json:"settingids"`
+}
+
+// SettingMeta specifies the SettingMeta schema: Description of a setting
+type SettingMeta struct {
+	// readonly or readwrite
+	Access  string `json:"access,omitempty"`
+	Default string `json:"default,omitempty"`
+	Id      string `json:"id,omitempty"`
+	Max     string `json:"max,omitempty"`
+	Min     string `json:"min,omitempty"`
+	// Data type, e.g. uint8, float or string
+	Type string `json:"type,omitempty"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// SettingValue specifies the SettingValue schema: Value of a setting
+type SettingValue struct {
+	Id    string `json:"id"`
+	Value string `json:"value"`
+}
+
+// VersionInfo specifies the VersionInfo schema: Information about the API
+type VersionInfo struct {
+	ApiVersion string `json:"api_version,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	Name       string `json:"name,omitempty"`
+	SwVersion  string `json:"sw_version,omitempty"`
+}
+
+// AuthCreateSession sends POST /api/v1/auth/create_session: Creates a session with the encrypted token
+func (c *Client) AuthCreateSession(ctx context.Context, body AuthCreateSessionRequest) (AuthCreateSessionResponse, error) {
+	var result AuthCreateSessionResponse
+	path := "/api/v1/auth/create_session"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// AuthFinish sends POST /api/v1/auth/finish: Sends the client proof and returns the server signature
+func (c *Client) AuthFinish(ctx context.Context, body AuthFinishRequest) (AuthFinishResponse, error) {
+	var result AuthFinishResponse
+	path := "/api/v1/auth/finish"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// AuthLogout sends POST /api/v1/auth/logout: Deletes the current session
+func (c *Client) AuthLogout(ctx context.Context) error {
+	path := "/api/v1/auth/logout"
+	return c.Doer.Do(ctx, "POST", path, nil, nil)
+}
+
+// GetMe sends GET /api/v1/auth/me: Returns information about the current user
+func (c *Client) GetMe(ctx context.Context) (MeInfo, error) {
+	var result MeInfo
+	path := "/api/v1/auth/me"
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// AuthStart sends POST /api/v1/auth/start: Starts the SCRAM authentication with the client nonce
+func (c *Client) AuthStart(ctx context.Context, body AuthStartRequest) (AuthStartResponse, error) {
+	var result AuthStartResponse
+	path := "/api/v1/auth/start"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// GetLatestEvents sends POST /api/v1/events/latest: Returns the latest events with localized descriptions
+func (c *Client) GetLatestEvents(ctx context.Context, body EventsRequest) ([]Event, error) {
+	var result []Event
+	path := "/api/v1/events/latest"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// GetVersion sends GET /api/v1/info/version: Returns information about the API
+func (c *Client) GetVersion(ctx context.Context) (VersionInfo, error) {
+	var result VersionInfo
+	path := "/api/v1/info/version"
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// DownloadLogData sends POST /api/v1/logdata/download: Returns the log data of a time range as tab separated values
+func (c *Client) DownloadLogData(ctx context.Context, body LogDataRequest) ([]byte, error) {
+	var result []byte
+	path := "/api/v1/logdata/download"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// GetModules sends GET /api/v1/modules: Returns the list of modules
+func (c *Client) GetModules(ctx context.Context) ([]ModuleInfo, error) {
+	var result []ModuleInfo
+	path := "/api/v1/modules"
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// GetProcessDataIds sends GET /api/v1/processdata: Returns the modules with their process-data identifiers
+func (c *Client) GetProcessDataIds(ctx context.Context) ([]ProcessDataIds, error) {
+	var result []ProcessDataIds
+	path := "/api/v1/processdata"
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// PostProcessData sends POST /api/v1/processdata: Returns the values of the requested process-data of several modules
+func (c *Client) PostProcessData(ctx context.Context, body []ProcessDataIds) ([]ProcessDataModuleValues, error) {
+	var result []ProcessDataModuleValues
+	path := "/api/v1/processdata"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// GetProcessDataModule sends GET /api/v1/processdata/{moduleid}: Returns the values of all process-data of a module
+// moduleid: Module id, e.g. devices:local
+func (c *Client) GetProcessDataModule(ctx context.Context, moduleid string) ([]ProcessDataModuleValues, error) {
+	var result []ProcessDataModuleValues
+	path := "/api/v1/processdata/" + pathParam(moduleid)
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// GetProcessDataValues sends GET /api/v1/processdata/{moduleid}/{processdataids}: Returns the values of process-data of a module
+// moduleid: Module id, e.g. devices:local
+// processdataids: Comma separated process-data ids
+func (c *Client) GetProcessDataValues(ctx context.Context, moduleid string, processdataids string) ([]ProcessDataModuleValues, error) {
+	var result []ProcessDataModuleValues
+	path := "/api/v1/processdata/" + pathParam(moduleid) + "/" + pathParam(processdataids)
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// GetSettingsMeta sends GET /api/v1/settings: Returns the modules with the description of their settings
+func (c *Client) GetSettingsMeta(ctx context.Context) ([]ModuleSettingsMeta, error) {
+	var result []ModuleSettingsMeta
+	path := "/api/v1/settings"
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// PutSettings sends PUT /api/v1/settings: Writes setting values of several modules
+func (c *Client) PutSettings(ctx context.Context, body []ModuleSettingValues) ([]ModuleSettingValues, error) {
+	var result []ModuleSettingValues
+	path := "/api/v1/settings"
+	err := c.Doer.Do(ctx, "PUT", path, body, &result)
+	return result, err
+}
+
+// PostSettings sends POST /api/v1/settings: Returns the values of the requested settings of several modules
+func (c *Client) PostSettings(ctx context.Context, body []SettingIds) ([]ModuleSettingValues, error) {
+	var result []ModuleSettingValues
+	path := "/api/v1/settings"
+	err := c.Doer.Do(ctx, "POST", path, body, &result)
+	return result, err
+}
+
+// GetSettingsModule sends GET /api/v1/settings/{moduleid}: Returns the values of all settings of a module
+// moduleid: Module id, e.g. devices:local
+func (c *Client) GetSettingsModule(ctx context.Context, moduleid string) ([]SettingValue, error) {
+	var result []SettingValue
+	path := "/api/v1/settings/" + pathParam(moduleid)
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
+
+// GetSettingsValues sends GET /api/v1/settings/{moduleid}/{settingids}: Returns the values of settings of a module
+// moduleid: Module id, e.g. devices:local
+// settingids: Comma separated setting ids
+func (c *Client) GetSettingsValues(ctx context.Context, moduleid string, settingids string) ([]SettingValue, error) {
+	var result []SettingValue
+	path := "/api/v1/settings/" + pathParam(moduleid) + "/" + pathParam(settingids)
+	err := c.Doer.Do(ctx, "GET", path, nil, &result)
+	return result, err
+}
@@ -6,20 +6,25 @@ package golrackpi
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	"errors"
 	"io"
+	"math"
+	"strings"
 
 	"crypto/sha256"
 	b64 "encoding/base64"
 	"encoding/json"
 	"fmt"
 
+	"github.com/geschke/golrackpi/api"
 	"github.com/geschke/golrackpi/internal/helper"
 
 	"net/http"
+	"time"
 )
 
 const (
@@ -28,6 +33,15 @@ const (
 	endpointAuthCreateSession string = "/api/v1/auth/create_session"
 )
 
+const (
+	// minRounds and maxRounds limit the PBKDF2 iterations requested by the server. Fewer rounds weaken the derived keys, more rounds
+	// let a misbehaving server block the client. Plenticore inverters use 29000 rounds.
+	minRounds = 1000
+	maxRounds = 1000000
+
+	clientNonceLength = 16 // random letters of the client nonce
+)
+
 // AuthStartRequestType defines the JSON structure of the first step in the authentication process
 type AuthStartRequestType struct {
 	Nonce    string `json:"nonce"`
@@ -48,12 +62,113 @@ type AuthCreateSessionType struct {
 	Payload       string `json:"payload"`
 }
 
+// authStartResponse specifies the JSON structure of the response to the first step in the authentication process
+type authStartResponse struct {
+	Nonce         string      `json:"nonce"`
+	TransactionId string      `json:"transactionId"`
+	Salt          string      `json:"salt"`
+	Rounds        json.Number `json:"rounds"`
+
+	salt   []byte // decoded salt
+	rounds int
+}
+
+// authFinishResponse specifies the JSON structure of the response to the second step in the authentication process
+type authFinishResponse struct {
+	Signature string `json:"signature"`
+	Token     string `json:"token"`
+}
+
+// parseAuthStartResponse returns the checked response to the first step in the authentication process. Malformed responses,
+// e.g. an error page of a proxy, return an error. The server nonce has to extend the client nonce as required by SCRAM.
+func parseAuthStartResponse(body []byte, clientNonce string) (authStartResponse, error) {
+	var result authStartResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, errors.New("authentication response has wrong format")
+	}
+	if result.Nonce == "" || result.Salt == "" || result.TransactionId == "" || result.Rounds == "" {
+		return result, errors.New("authentication response has wrong format")
+	}
+	if !isPrintable(result.Nonce) || !strings.HasPrefix(result.Nonce, clientNonce) || len(result.Nonce) <= len(clientNonce) {
+		return result, errors.New("authentication response has invalid nonce")
+	}
+	if !isPrintable(result.TransactionId) {
+		return result, errors.New("authentication response has invalid transaction id")
+	}
+	rounds, err := result.Rounds.Float64()
+	if err != nil || rounds != math.Trunc(rounds) {
+		return result, errors.New("authentication response has invalid number of rounds")
+	}
+	if rounds < minRounds || rounds > maxRounds {
+		return result, fmt.Errorf("authentication response has %v rounds, allowed are %d to %d", rounds, minRounds, maxRounds)
+	}
+	result.rounds = int(rounds)
+	if result.salt, err = b64.StdEncoding.DecodeString(result.Salt); err != nil || len(result.salt) == 0 {
+		return result, errors.New("authentication response has invalid salt")
+	}
+	return result, nil
+}
+
+// parseAuthFinishResponse returns the decoded server signature and the token of the response to the second step in the
+// authentication process
+func parseAuthFinishResponse(body []byte) ([]byte, string, error) {
+	var result authFinishResponse
+	// signature and token only set when login was successful
+	if err := json.Unmarshal(body, &result); err != nil || result.Signature == "" || result.Token == "" {
+		return nil, "", errors.New("authentication failed")
+	}
+	signature, err := b64.StdEncoding.DecodeString(result.Signature)
+	if err != nil || len(signature) != sha256.Size {
+		return nil, "", errors.New("signature check error")
+	}
+	return signature, result.Token, nil
+}
+
+// parseCreateSessionResponse returns the session id of the response to the last step in the authentication process
+func parseCreateSessionResponse(body []byte) (string, error) {
+	var result struct {
+		SessionId string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.SessionId == "" {
+		return "", errors.New("session id not available")
+	}
+	// the session id is sent in the authorization header, so it must not contain whitespace or control characters
+	if !isPrintable(result.SessionId) {
+		return "", errors.New("session id is invalid")
+	}
+	return result.SessionId, nil
+}
+
+// isPrintable returns true if s consists of printable ASCII characters except space and comma, which separates the attributes
+// of the SCRAM auth message
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e || s[i] == ',' {
+			return false
+		}
+	}
+	return true
+}
+
 // AuthClient is the library's instance, it contains the configuration settings with SessionId after successful authentication
 type AuthClient struct {
 	Scheme    string
 	Server    string
 	Password  string
 	SessionId string
+
+	// Location is used to interpret times which the inverter sends without time zone offset, e.g. the start and end time of events.
+	// If nil, the time zone configured on the inverter is used if available, otherwise UTC.
+	Location *time.Location
+
+	// HTTPClient is used for all requests to the inverter, e.g. with a custom transport for recording or replaying the traffic.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// inverterLocation is the time zone configured on the inverter. It's read after the first login and kept for later
+	// sessions; inverterLocationRead prevents another request if the inverter didn't return a time zone.
+	inverterLocation     *time.Location
+	inverterLocationRead bool
 }
 
 // New returns a blank AuthClient instance with default http scheme
@@ -76,9 +191,11 @@ func NewWithParameter(param AuthClient) *AuthClient {
 		param.Scheme = "http"
 	}
 	client := AuthClient{
-		Scheme:   param.Scheme,
-		Server:   param.Server,
-		Password: param.Password,
+		Scheme:     param.Scheme,
+		Server:     param.Server,
+		Password:   param.Password,
+		Location:   param.Location,
+		HTTPClient: param.HTTPClient,
 	}
 	return &client
 }
@@ -103,6 +220,30 @@ func (c *AuthClient) SetScheme(scheme string) {
 	c.Scheme = scheme
 }
 
+// SetLocation sets the location which is used to interpret times sent by the inverter without time zone offset
+func (c *AuthClient) SetLocation(loc *time.Location) {
+	c.Location = loc
+}
+
+// location returns the location to interpret times without time zone offset
+func (c *AuthClient) location() *time.Location {
+	if c.Location != nil {
+		return c.Location
+	}
+	if c.inverterLocation != nil {
+		return c.inverterLocation
+	}
+	return time.UTC
+}
+
+// httpClient returns the http client for requests to the inverter
+func (c *AuthClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
 // getUrl is a helper function which creates the API URL
 func (c *AuthClient) getUrl(request string) string {
 	return c.Scheme + "://" + c.Server + request
@@ -113,7 +254,10 @@ func (c *AuthClient) getUrl(request string) string {
 func (c *AuthClient) Login() (string, error) {
 
 	// prepare step 1 of authentication
-	randomString := helper.RandSeq(12)
+	randomString, err := helper.RandSeq(clientNonceLength)
+	if err != nil {
+		return "", errors.New("could not create nonce: " + err.Error())
+	}
 	base64String := b64.StdEncoding.EncodeToString([]byte(randomString))
 
 	userName := "user" // default user name of plant owner
@@ -127,7 +271,7 @@ func (c *AuthClient) Login() (string, error) {
 	body, _ := json.Marshal(startRequest)
 
 	// send step 1 authentication request
-	resp, err := http.Post(c.getUrl(endpointAuthStart), "application/json", bytes.NewBuffer(body))
+	resp, err := c.httpClient().Post(c.getUrl(endpointAuthStart), "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return "", errors.New("could not initiate authentication")
 	}
@@ -141,31 +285,19 @@ func (c *AuthClient) Login() (string, error) {
 		return "", errors.New("could not read authentication response")
 	}
 
-	responseReader := bytes.NewReader(responseBody)
-
-	var result map[string]interface{}
-	json.NewDecoder(responseReader).Decode(&result)
-
-	// expect a result with the following map entries, check existence
-	serverNonceResp, serverNonceOk := result["nonce"]
-	roundsResp, roundsOk := result["rounds"]
-	serverSaltResp, serverSaltOk := result["salt"]
-	transactionIdResp, transactionIdOk := result["transactionId"]
-
-	if !serverNonceOk || !roundsOk || !serverSaltOk || !transactionIdOk {
-		return "", errors.New("authentication response has wrong format")
+	startResponse, err := parseAuthStartResponse(responseBody, startRequest.Nonce)
+	if err != nil {
+		return "", err
 	}
-	serverNonce := serverNonceResp.(string)
-	rounds := int64(roundsResp.(float64))
-	serverSalt := serverSaltResp.(string)
-	transactionId := transactionIdResp.(string)
+	serverNonce := startResponse.Nonce
+	rounds := startResponse.rounds
+	serverSalt := startResponse.Salt
+	transactionId := startResponse.TransactionId
 
 	// do some magic crypto stuff
 	var saltedPassword, clientKey, serverKey, storedKey, clientSignature, serverSignature []byte
 
-	serverSaltDecoded, _ := b64.StdEncoding.DecodeString(serverSalt)
-
-	saltedPassword = helper.GetPBKDF2Hash(c.Password, string(serverSaltDecoded), int(rounds))
+	saltedPassword = helper.GetPBKDF2Hash(c.Password, string(startResponse.salt), rounds)
 	clientKey = helper.GetHMACSHA256(saltedPassword, "Client Key")
 	serverKey = helper.GetHMACSHA256(saltedPassword, "Server Key")
 	storedKey = helper.GetSHA256Hash(clientKey)
@@ -185,42 +317,29 @@ func (c *AuthClient) Login() (string, error) {
 
 	finishRequestBody, _ := json.Marshal(finishRequest)
 
-	respFinish, err := http.Post(c.getUrl(endpointAuthFinish), "application/json", bytes.NewBuffer(finishRequestBody))
+	respFinish, err := c.httpClient().Post(c.getUrl(endpointAuthFinish), "application/json", bytes.NewBuffer(finishRequestBody))
 
 	if err != nil {
 		return "", errors.New("could not initiate authentication finish request")
 	}
+	defer respFinish.Body.Close()
 	if respFinish.StatusCode != 200 {
 		return "", errors.New("request returned with http error " + respFinish.Status)
 	}
 
-	defer respFinish.Body.Close()
-
 	responseFinishBody, err := io.ReadAll(respFinish.Body)
 	if err != nil {
 		//Failed to read response.
 		return "", errors.New("could not read from authentication finish request")
 	}
 
-	responseFinishReader := bytes.NewReader(responseFinishBody)
-
-	var resultFinish map[string]interface{}
-	json.NewDecoder(responseFinishReader).Decode(&resultFinish)
-
-	// signature and token only set when login was successful
-	_, authOkSignature := resultFinish["signature"]
-	_, authOkToken := resultFinish["token"]
-	if !authOkSignature || !authOkToken {
-		return "", errors.New("authentication failed")
+	signature, token, err := parseAuthFinishResponse(responseFinishBody)
+	if err != nil {
+		return "", err
 	}
 
-	signatureStr := resultFinish["signature"].(string)
-	signature, _ := b64.StdEncoding.DecodeString(signatureStr)
-	token := resultFinish["token"].(string)
-
-	cmpBytes := bytes.Compare(signature, serverSignature)
-
-	if cmpBytes != 0 {
+	// constant time compare, so the response time doesn't reveal how much of the signature matched
+	if !hmac.Equal(signature, serverSignature) {
 		return "", errors.New("signature check error")
 	}
 
@@ -232,7 +351,10 @@ func (c *AuthClient) Login() (string, error) {
 
 	protocolKey := h.Sum(nil)
 
-	ivNonce, _ := helper.GenerateRandomBytes(16)
+	ivNonce, err := helper.GenerateRandomBytes(16)
+	if err != nil {
+		return "", errors.New("could not create iv: " + err.Error())
+	}
 
 	block, err := aes.NewCipher(protocolKey)
 	if err != nil {
@@ -264,33 +386,36 @@ func (c *AuthClient) Login() (string, error) {
 
 	createSessionRequestBody, _ := json.Marshal(createSessionRequest)
 
-	respCreateSession, err := http.Post(c.getUrl(endpointAuthCreateSession), "application/json", bytes.NewBuffer(createSessionRequestBody))
+	respCreateSession, err := c.httpClient().Post(c.getUrl(endpointAuthCreateSession), "application/json", bytes.NewBuffer(createSessionRequestBody))
 
 	if err != nil {
 		return "", errors.New("could not create session")
 
 	}
+	defer respCreateSession.Body.Close()
 	if respCreateSession.StatusCode != 200 {
 		return "", errors.New("request returned with http error " + respCreateSession.Status)
 	}
-	defer respCreateSession.Body.Close()
 
 	responseCreateSessionBody, err := io.ReadAll(respCreateSession.Body)
 	if err != nil {
 		return "", errors.New("could not read from create session request")
 	}
 
-	responseCreateSessionReader := bytes.NewReader(responseCreateSessionBody)
+	sessionId, err := parseCreateSessionResponse(responseCreateSessionBody)
+	if err != nil {
+		return "", err
+	}
 
-	var resultCreateSession map[string]interface{}
-	json.NewDecoder(responseCreateSessionReader).Decode(&resultCreateSession)
+	c.SessionId = sessionId
 
-	sessionId, sessionOk := resultCreateSession["sessionId"]
-	if !sessionOk {
-		return "", errors.New("session id not available")
+	if c.Location == nil && !c.inverterLocationRead {
+		c.inverterLocationRead = true
+		if loc, err := c.InverterLocation(); err == nil {
+			c.inverterLocation = loc
+		}
 	}
 
-	c.SessionId = sessionId.(string)
 	return c.SessionId, nil
 
 }
@@ -298,7 +423,7 @@ func (c *AuthClient) Login() (string, error) {
 // Logout deletes the current session
 func (c *AuthClient) Logout() (bool, error) {
 
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("POST", c.getUrl("/api/v1/auth/logout"), nil)
 	if err != nil {
@@ -319,38 +444,7 @@ func (c *AuthClient) Logout() (bool, error) {
 
 }
 
-// Me returns information about the current user
-func (c *AuthClient) Me() (map[string]interface{}, error) {
-	result := make(map[string]interface{})
-	client := http.Client{}
-
-	request, err := http.NewRequest("GET", c.getUrl("/api/v1/auth/me"), nil)
-	if err != nil {
-		return result, err
-	}
-
-	request.Header.Add("authorization", "Session "+c.SessionId)
-
-	response, err := client.Do(request)
-	if err != nil {
-		return result, err
-	}
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-	}
-	var jsonResult interface{}
-	err = json.Unmarshal(body, &jsonResult)
-	if err != nil {
-		return result, err
-	}
-
-	m, mOk := jsonResult.(map[string]interface{})
-
-	if !mOk {
-		return result, errors.New("could not read response")
-	}
-	return m, nil
-
+// Me returns information about the current user. Without session, the inverter returns the anonymous user.
+func (c *AuthClient) Me() (api.MeInfo, error) {
+	return api.New(c).GetMe(context.Background())
 }
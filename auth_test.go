@@ -0,0 +1,121 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthStartResponse(t *testing.T) {
+	tests := []struct {
+		body  string
+		fails bool
+	}{
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":29000}`},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":"29000"}`},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":29000.5}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":-1}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":100}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":2000000}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":1e300}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t","salt":"not base64!","rounds":29000}`, fails: true},
+		{body: `{"nonce":"abc","transactionId":"t","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `{"nonce":"xyzdef","transactionId":"t","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `{"nonce":"abc,i=1","transactionId":"t","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `{"nonce":"abcdef","transactionId":"t\r\n","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `{"nonce":1,"transactionId":"t","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `{"nonce":"abcdef","salt":"c2FsdA==","rounds":29000}`, fails: true},
+		{body: `<html><body>502 Bad Gateway</body></html>`, fails: true},
+		{body: `[]`, fails: true},
+		{body: ``, fails: true},
+	}
+	for _, test := range tests {
+		result, err := parseAuthStartResponse([]byte(test.body), "abc")
+		if test.fails != (err != nil) {
+			t.Errorf("%s: got error %v", test.body, err)
+		}
+		if err == nil && (result.rounds != 29000 || string(result.salt) != "salt") {
+			t.Errorf("%s: got rounds %d, salt %q", test.body, result.rounds, result.salt)
+		}
+	}
+}
+
+func TestParseAuthFinishResponse(t *testing.T) {
+	signature := b64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if _, _, err := parseAuthFinishResponse([]byte(`{"signature":"` + signature + `","token":"t"}`)); err != nil {
+		t.Errorf("valid response rejected: %v", err)
+	}
+	for _, body := range []string{`{"signature":"c2ln","token":"t"}`, `{"signature":"` + signature + `"}`, `{"signature":"!!","token":"t"}`} {
+		if _, _, err := parseAuthFinishResponse([]byte(body)); err == nil {
+			t.Errorf("%s: invalid response accepted", body)
+		}
+	}
+}
+
+func TestParseCreateSessionResponse(t *testing.T) {
+	if id, err := parseCreateSessionResponse([]byte(`{"sessionId":"abc123"}`)); err != nil || id != "abc123" {
+		t.Errorf("valid response: got %q, %v", id, err)
+	}
+	for _, body := range []string{`{"sessionId":"abc\r\nX-Injected: 1"}`, `{"sessionId":"a b"}`, `{"sessionId":""}`} {
+		if _, err := parseCreateSessionResponse([]byte(body)); err == nil {
+			t.Errorf("%s: invalid session id accepted", body)
+		}
+	}
+}
+
+func TestLoginWithMalformedResponses(t *testing.T) {
+	for _, body := range []string{`{"nonce":null,"rounds":true}`, `{"nonce":"","transactionId":"t","salt":"c2FsdA==","rounds":1000000000}`, `{"nonce":"a","transactionId":"t","salt":"c2FsdA==","rounds":{}}`, `Service Unavailable`} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		client := NewWithParameter(AuthClient{Server: strings.TrimPrefix(server.URL, "http://"), Password: "secret"})
+		if _, err := client.Login(); err == nil {
+			t.Errorf("%s: login succeeded", body)
+		}
+		server.Close()
+	}
+}
+
+func FuzzParseAuthStartResponse(f *testing.F) {
+	f.Add([]byte(`{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":29000}`))
+	f.Add([]byte(`{"nonce":"abcdef","transactionId":"t","salt":"c2FsdA==","rounds":2.9e4}`))
+	f.Add([]byte(`{"rounds":null}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		result, err := parseAuthStartResponse(body, "abc")
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(result.Nonce, "abc") || !isPrintable(result.Nonce) || result.TransactionId == "" || result.rounds < minRounds || result.rounds > maxRounds || len(result.salt) == 0 {
+			t.Fatalf("invalid response accepted: %s", body)
+		}
+	})
+}
+
+func FuzzParseAuthFinishResponse(f *testing.F) {
+	f.Add([]byte(`{"signature":"c2lnbmF0dXJlc2lnbmF0dXJlc2lnbmF0dXJlc2lnbmE=","token":"t"}`))
+	f.Add([]byte(`{"signature":1,"token":"t"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		signature, token, err := parseAuthFinishResponse(body)
+		if err == nil && (len(signature) != sha256.Size || token == "") {
+			t.Fatalf("invalid response accepted: %s", body)
+		}
+	})
+}
+
+func FuzzParseCreateSessionResponse(f *testing.F) {
+	f.Add([]byte(`{"sessionId":"abc"}`))
+	f.Add([]byte(`{"sessionId":[]}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		sessionId, err := parseCreateSessionResponse(body)
+		if err == nil && (sessionId == "" || !isPrintable(sessionId)) {
+			t.Fatalf("invalid session id accepted: %s", body)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SettingsBackupFormatVersion is the version of the backup document structure written by BackupSettings
+const SettingsBackupFormatVersion = 1
+
+// SettingsBackup specifies the structure of a backup document with all writable settings of an inverter
+type SettingsBackup struct {
+	FormatVersion int                    `json:"format_version"`
+	Created       time.Time              `json:"created"`
+	Serial        string                 `json:"serial"`
+	Firmware      string                 `json:"firmware"`
+	Modules       []SettingsBackupModule `json:"modules"`
+}
+
+// SettingsBackupModule specifies the settings of one module in a backup document
+type SettingsBackupModule struct {
+	ModuleId string                `json:"moduleid"`
+	Settings []SettingsBackupValue `json:"settings"`
+}
+
+// SettingsBackupValue specifies a setting in a backup document with its value and the default value reported by the inverter
+type SettingsBackupValue struct {
+	Id      string `json:"id"`
+	Value   string `json:"value"`
+	Default string `json:"default,omitempty"`
+	Unit    string `json:"unit,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// setting returns the metadata of the backup value, e.g. to compare values with EqualValues. The type is missing in backups
+// written by older versions, then the values are compared as strings.
+func (v SettingsBackupValue) setting() SettingsDataValues {
+	setting := SettingsDataValues{Id: v.Id, Default: v.Default, Unit: v.Unit}
+	if v.Type != "" {
+		setting.Type = v.Type
+	}
+	return setting
+}
+
+// RestoreStatus describes the result of restoring a single setting
+type RestoreStatus string
+
+const (
+	// RestorePending marks a setting which would be written, it's only used in dry run mode
+	RestorePending RestoreStatus = "pending"
+	// RestoreApplied marks a setting which was written and verified
+	RestoreApplied RestoreStatus = "applied"
+	// RestoreUnchanged marks a setting whose current value already equals the backup value
+	RestoreUnchanged RestoreStatus = "unchanged"
+	// RestoreReadOnly marks a setting which is not writable on the inverter
+	RestoreReadOnly RestoreStatus = "readonly"
+	// RestoreUnknown marks a setting which is not available on the inverter, e.g. after a firmware update
+	RestoreUnknown RestoreStatus = "unknown"
+	// RestoreInvalid marks a setting whose backup value is outside of the limits of the inverter
+	RestoreInvalid RestoreStatus = "invalid"
+	// RestoreFailed marks a setting which could not be written or was not applied
+	RestoreFailed RestoreStatus = "failed"
+)
+
+// RestoreResult specifies the result of restoring a single setting
+type RestoreResult struct {
+	ModuleId     string
+	Id           string
+	CurrentValue string
+	Value        string
+	Status       RestoreStatus
+	Err          error
+}
+
+// RestoreOptions specifies the options of RestoreSettings
+type RestoreOptions struct {
+	// Filter selects the settings to restore. If nil, all settings of the backup are restored.
+	Filter func(moduleId string, settingId string) bool
+	// DryRun only checks the settings without writing them
+	DryRun bool
+}
+
+// BackupSettings returns a backup document with the current values of all writable settings of all modules,
+// together with serial number and firmware version of the inverter.
+// Warning: The request of all settings returns a lot of data, so it takes some time.
+func (c *AuthClient) BackupSettings() (SettingsBackup, error) {
+	backup := SettingsBackup{
+		FormatVersion: SettingsBackupFormatVersion,
+		Created:       time.Now(),
+	}
+
+	version, err := c.Version()
+	if err != nil {
+		return backup, fmt.Errorf("could not read firmware version: %w", err)
+	}
+	backup.Firmware = version.SwVersion
+	serial, err := c.SerialNumber()
+	if err != nil {
+		return backup, fmt.Errorf("could not read serial number: %w", err)
+	}
+	backup.Serial = serial
+
+	settings, err := c.Settings()
+	if err != nil {
+		return backup, err
+	}
+
+	for _, module := range settings {
+		writable := make(map[string]SettingsDataValues)
+		for _, setting := range module.Settings {
+			if setting.IsWritable() {
+				writable[setting.Id] = setting
+			}
+		}
+		if len(writable) == 0 {
+			continue
+		}
+
+		values, err := c.SettingsModule(module.ModuleId)
+		if err != nil {
+			return backup, fmt.Errorf("could not read settings of module %s: %w", module.ModuleId, err)
+		}
+
+		backupModule := SettingsBackupModule{ModuleId: module.ModuleId}
+		for _, value := range values {
+			setting, ok := writable[value.Id]
+			if !ok {
+				continue
+			}
+			backupModule.Settings = append(backupModule.Settings, SettingsBackupValue{
+				Id:      value.Id,
+				Value:   value.Value,
+				Default: setting.Default,
+				Unit:    setting.Unit,
+				Type:    setting.TypeName(),
+			})
+		}
+		if len(backupModule.Settings) > 0 {
+			backup.Modules = append(backup.Modules, backupModule)
+		}
+	}
+
+	return backup, nil
+}
+
+// ReadSettingsBackup reads a backup document
+func ReadSettingsBackup(r io.Reader) (SettingsBackup, error) {
+	var backup SettingsBackup
+	err := json.NewDecoder(r).Decode(&backup)
+	if err != nil {
+		return backup, err
+	}
+	if backup.FormatVersion < 1 || backup.FormatVersion > SettingsBackupFormatVersion {
+		return backup, fmt.Errorf("unsupported backup format version %d", backup.FormatVersion)
+	}
+	return backup, nil
+}
+
+// Write writes the backup document as indented JSON
+func (b SettingsBackup) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// RestoreSettings writes the settings of a backup document to the inverter. Settings which are not writable or not available
+// on the inverter are skipped, values outside of the limits of the inverter are reported as invalid and not written.
+// It returns a RestoreResult for every selected setting of the backup.
+func (c *AuthClient) RestoreSettings(backup SettingsBackup, options RestoreOptions) ([]RestoreResult, error) {
+	var results []RestoreResult
+
+	settings, err := c.Settings()
+	if err != nil {
+		return results, err
+	}
+	meta := make(map[string]SettingsData)
+	for _, module := range settings {
+		meta[module.ModuleId] = module
+	}
+
+	for _, backupModule := range backup.Modules {
+		var selected []SettingsBackupValue
+		for _, value := range backupModule.Settings {
+			if options.Filter == nil || options.Filter(backupModule.ModuleId, value.Id) {
+				selected = append(selected, value)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		moduleMeta, moduleFound := meta[backupModule.ModuleId]
+		current := make(map[string]string)
+		if moduleFound {
+			values, err := c.SettingsModule(backupModule.ModuleId)
+			if err != nil {
+				return results, fmt.Errorf("could not read settings of module %s: %w", backupModule.ModuleId, err)
+			}
+			for _, value := range values {
+				current[value.Id] = value.Value
+			}
+		}
+
+		var moduleResults []RestoreResult
+		var changes []SettingsValues
+		for _, value := range selected {
+			result := RestoreResult{ModuleId: backupModule.ModuleId, Id: value.Id, Value: value.Value, CurrentValue: current[value.Id]}
+			setting, found := moduleMeta.Setting(value.Id)
+			switch {
+			case !found:
+				result.Status = RestoreUnknown
+			case !setting.IsWritable():
+				result.Status = RestoreReadOnly
+			case setting.EqualValues(result.CurrentValue, value.Value):
+				result.Status = RestoreUnchanged
+			default:
+				if err := setting.Validate(value.Value); err != nil {
+					result.Status = RestoreInvalid
+					result.Err = err
+				} else {
+					result.Status = RestorePending
+					changes = append(changes, SettingsValues{Id: value.Id, Value: value.Value})
+				}
+			}
+			moduleResults = append(moduleResults, result)
+		}
+
+		if !options.DryRun && len(changes) > 0 {
+			c.restoreModule(backupModule.ModuleId, moduleMeta, changes, moduleResults)
+		}
+		results = append(results, moduleResults...)
+	}
+
+	return results, nil
+}
+
+// restoreModule writes the changed settings of a module, reads them back and updates the status of the results
+func (c *AuthClient) restoreModule(moduleId string, moduleMeta SettingsData, changes []SettingsValues, results []RestoreResult) {
+	_, err := c.UpdateSettings([]ModuleSettings{{ModuleId: moduleId, Settings: changes}})
+
+	applied := make(map[string]string)
+	if err == nil {
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.Id)
+		}
+		var values []SettingsValues
+		values, err = c.SettingsModuleSettings(moduleId, ids...)
+		for _, value := range values {
+			applied[value.Id] = value.Value
+		}
+	}
+
+	for i := range results {
+		if results[i].Status != RestorePending {
+			continue
+		}
+		if err != nil {
+			results[i].Status = RestoreFailed
+			results[i].Err = err
+			continue
+		}
+		setting, _ := moduleMeta.Setting(results[i].Id)
+		if setting.EqualValues(applied[results[i].Id], results[i].Value) {
+			results[i].Status = RestoreApplied
+		} else {
+			results[i].Status = RestoreFailed
+			results[i].Err = errors.New("value was not applied, current value: " + applied[results[i].Id])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi_test
+
+import (
+	"testing"
+
+	"github.com/geschke/golrackpi/simulator"
+)
+
+func TestBackupSettings(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	client := sim.Client()
+
+	if _, err := client.BackupSettings(); err == nil {
+		t.Error("backup without session succeeded")
+	}
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Logout()
+
+	backup, err := client.BackupSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Serial != "SIM000000001" || backup.Firmware == "" || len(backup.Modules) == 0 {
+		t.Errorf("got serial %q, firmware %q, %d modules", backup.Serial, backup.Firmware, len(backup.Modules))
+	}
+}
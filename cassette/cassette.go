@@ -0,0 +1,122 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cassette records the HTTP traffic between client and inverter into a cassette file and replays it, e.g. to reproduce
+// bugs without access to the inverter. A cassette is a JSONL file with one request/response pair per line. Session ids and
+// the values of the authentication handshake are redacted, so cassettes can be shared without giving out access to the inverter.
+package cassette
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secret values in recorded interactions
+const Redacted = "REDACTED"
+
+// authPaths are the endpoints of the authentication handshake, whose bodies are redacted
+var authPaths = []string{"/api/v1/auth/start", "/api/v1/auth/finish", "/api/v1/auth/create_session"}
+
+// Interaction is a recorded request with its response
+type Interaction struct {
+	Time     time.Time `json:"time"`
+	Request  Request   `json:"request"`
+	Response Response  `json:"response"`
+}
+
+// Request specifies a recorded request. The URL contains path and query, but not scheme and host of the inverter.
+type Request struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Response specifies a recorded response
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Load reads the interactions of a cassette
+func Load(r io.Reader) ([]Interaction, error) {
+	var interactions []Interaction
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("invalid interaction in line %d: %w", line, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, scanner.Err()
+}
+
+// LoadFile reads the interactions of a cassette file
+func LoadFile(name string) ([]Interaction, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// isAuthPath returns true if the path belongs to the authentication handshake
+func isAuthPath(path string) bool {
+	for _, authPath := range authPaths {
+		if path == authPath {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody returns the body with all string values of the authentication handshake (except the user name) and all session
+// ids replaced by Redacted. Bodies which are no JSON objects are returned unchanged.
+func redactBody(path string, body string) string {
+	auth := isAuthPath(path)
+	if !auth && !strings.Contains(body, "sessionId") {
+		return body
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		if auth {
+			return Redacted
+		}
+		return body
+	}
+	for key, value := range object {
+		if _, isString := value.(string); isString && ((auth && key != "username") || key == "sessionId") {
+			object[key] = Redacted
+		}
+	}
+	redacted, err := json.Marshal(object)
+	if err != nil {
+		return Redacted
+	}
+	return string(redacted)
+}
+
+// readBody reads and closes the body and returns its content
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
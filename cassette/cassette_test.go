@@ -0,0 +1,128 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+// session runs the requests of a typical client session and returns the session id and the results
+func session(t *testing.T, client *golrackpi.AuthClient) (string, string, []golrackpi.ProcessDataValues) {
+	t.Helper()
+	sessionId, err := client.Login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := client.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := client.ProcessDataModuleValues("devices:local", "Dc_P", "Home_P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	return sessionId, version.SwVersion, values
+}
+
+// jsonFields returns the fields of a JSON object
+func jsonFields(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		t.Fatalf("invalid body %q: %v", body, err)
+	}
+	return fields
+}
+
+func TestRecordReplay(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	client := sim.Client()
+	client.HTTPClient = recorder.Client()
+	sessionId, version, values := session(t, client)
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if sessionId == "" || strings.Contains(buf.String(), sessionId) {
+		t.Error("session id is contained in the cassette")
+	}
+
+	interactions, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := map[string]bool{}
+	for _, interaction := range interactions {
+		if !isAuthPath(interaction.Request.URL) {
+			continue
+		}
+		request := jsonFields(t, interaction.Request.Body)
+		response := jsonFields(t, interaction.Response.Body)
+		for name, fields := range map[string]map[string]interface{}{"request": request, "response": response} {
+			for key, value := range fields {
+				if s, isString := value.(string); isString && key != "username" {
+					if s != Redacted {
+						t.Errorf("%s %s: %s not redacted", interaction.Request.URL, name, key)
+					}
+					redacted[key] = true
+				}
+			}
+		}
+		if username, ok := request["username"]; ok && username != "user" {
+			t.Errorf("%s: user name %v", interaction.Request.URL, username)
+		}
+	}
+	for _, key := range []string{"nonce", "transactionId", "proof", "signature", "token", "sessionId"} {
+		if !redacted[key] {
+			t.Errorf("%s not found in the authentication handshake", key)
+		}
+	}
+
+	replayer := NewReplayer(interactions)
+	replayClient := golrackpi.NewWithParameter(golrackpi.AuthClient{Scheme: "http", Server: "inverter.invalid", Password: ReplayPassword, HTTPClient: replayer.Client()})
+	_, replayedVersion, replayedValues := session(t, replayClient)
+	if replayedVersion != version || !reflect.DeepEqual(replayedValues, values) {
+		t.Errorf("replayed %q %v, recorded %q %v", replayedVersion, replayedValues, version, values)
+	}
+	if remaining := replayer.Remaining(); remaining != 0 {
+		t.Errorf("%d interactions not replayed", remaining)
+	}
+	if _, err := replayClient.Version(); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("request beyond the cassette: got %v", err)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		path, body, want string
+	}{
+		{"/api/v1/auth/start", `{"username":"user","nonce":"abc"}`, `{"nonce":"REDACTED","username":"user"}`},
+		{"/api/v1/auth/finish", `not json`, Redacted},
+		{"/api/v1/processdata", `[{"moduleid":"devices:local"}]`, `[{"moduleid":"devices:local"}]`},
+		{"/api/v1/auth/me", `{"authenticated":true,"sessionId":"secret"}`, `{"authenticated":true,"sessionId":"REDACTED"}`},
+	}
+	for _, test := range tests {
+		if got := redactBody(test.path, test.body); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Recorder is an http.RoundTripper which writes every request and response as redacted interaction to a cassette
+type Recorder struct {
+	// Transport sends the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder returns a Recorder instance which writes to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Client returns an http client which records its requests
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Err returns the first error which occurred while writing the cassette
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// RoundTrip sends the request and records it with its response. Requests which fail without response are not recorded.
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := readBody(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	path := request.URL.Path
+	url := request.URL.EscapedPath()
+	if request.URL.RawQuery != "" {
+		url += "?" + request.URL.RawQuery
+	}
+	r.write(Interaction{
+		Time: time.Now(),
+		Request: Request{
+			Method:      request.Method,
+			URL:         url,
+			ContentType: request.Header.Get("Content-Type"),
+			Body:        redactBody(path, string(requestBody)),
+		},
+		Response: Response{
+			Status:      response.StatusCode,
+			ContentType: response.Header.Get("Content-Type"),
+			Body:        redactBody(path, string(responseBody)),
+		},
+	})
+	return response, nil
+}
+
+// write appends the interaction as one line to the cassette
+func (r *Recorder) write(interaction Interaction) {
+	line, err := json.Marshal(interaction)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		_, err = r.w.Write(append(line, '\n'))
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
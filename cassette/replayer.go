@@ -0,0 +1,109 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/geschke/golrackpi/simulator"
+)
+
+// ReplayPassword is the password clients have to use with a Replayer
+const ReplayPassword = "replay"
+
+// ErrNoInteraction is returned for requests which are not contained in the cassette or whose interactions are already replayed
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// Replayer is an http.RoundTripper which answers requests with the responses of a cassette. Every interaction is replayed once,
+// in the recorded order of interactions with equal method, URL and body. Scheme and host of the requests are ignored.
+//
+// The authentication handshake can't be replayed, because it depends on random nonces and the redacted values. Instead, it is
+// answered like by an inverter with the password ReplayPassword.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+	auth         http.Handler
+}
+
+// NewReplayer returns a Replayer instance for the interactions
+func NewReplayer(interactions []Interaction) *Replayer {
+	return &Replayer{
+		interactions: interactions,
+		replayed:     make([]bool, len(interactions)),
+		auth:         simulator.New(simulator.Config{Password: ReplayPassword}),
+	}
+}
+
+// Client returns an http client which replays the cassette
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Remaining returns the number of interactions which are not replayed yet
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for i, interaction := range r.interactions {
+		if !r.replayed[i] && !isAuthPath(interaction.Request.URL) {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// RoundTrip answers the request with the next matching interaction
+func (r *Replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := readBody(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if isAuthPath(request.URL.Path) {
+		recorder := httptest.NewRecorder()
+		authRequest := request.Clone(request.Context())
+		authRequest.Body = io.NopCloser(bytes.NewReader(body))
+		r.auth.ServeHTTP(recorder, authRequest)
+		response := recorder.Result()
+		response.Request = request
+		return response, nil
+	}
+
+	url := request.URL.EscapedPath()
+	if request.URL.RawQuery != "" {
+		url += "?" + request.URL.RawQuery
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || interaction.Request.Method != request.Method || interaction.Request.URL != url || interaction.Request.Body != string(body) {
+			continue
+		}
+		r.replayed[i] = true
+		response := &http.Response{
+			Status:        strconv.Itoa(interaction.Response.Status) + " " + http.StatusText(interaction.Response.Status),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        make(http.Header),
+			Body:          io.NopCloser(bytes.NewReader([]byte(interaction.Response.Body))),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       request,
+		}
+		if interaction.Response.ContentType != "" {
+			response.Header.Set("Content-Type", interaction.Response.ContentType)
+		}
+		return response, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s", ErrNoInteraction, request.Method, url)
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreModules []string = []string{}
+	restoreIds     []string = []string{}
+)
+
+func init() {
+	settingsBackupCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write backup to file [filename] (default: stdout)")
+
+	settingsRestoreCmd.Flags().StringSliceVarP(&restoreModules, "module", "", []string{}, "Restore only modules matching this pattern, e.g. \"devices:local\" or \"scb:*\" (can be repeated)")
+	settingsRestoreCmd.Flags().StringSliceVarP(&restoreIds, "id", "", []string{}, "Restore only settings matching this pattern, e.g. \"Battery:*\" (can be repeated)")
+	settingsRestoreCmd.Flags().BoolVarP(&settingsYes, "yes", "y", false, "Restore settings without confirmation")
+	settingsRestoreCmd.Flags().BoolVarP(&settingsDryRun, "dry-run", "n", false, "Show and validate changes, but don't write them")
+
+	settingsCmd.AddCommand(settingsBackupCmd)
+	settingsCmd.AddCommand(settingsRestoreCmd)
+}
+
+var settingsBackupCmd = &cobra.Command{
+	Use: "backup",
+
+	Short: "Save all writable settings into a JSON backup file.",
+	Long: `Save the values of all writable settings of all modules into a JSON document, together with serial number and
+firmware version of the inverter and the time of the backup.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		backupSettings()
+	},
+}
+
+var settingsRestoreCmd = &cobra.Command{
+	Use: "restore <backupfile>",
+
+	Short: "Restore settings from a JSON backup file.",
+	Long: `Restore settings from a JSON backup file created by "settings backup".
+
+Read-only settings and settings which are not available on the inverter are skipped, values outside of the limits
+of the inverter are reported and not written. Use --module and --id with patterns (* and ? wildcards) for a selective restore.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		restoreSettings(args[0])
+	},
+}
+
+// backupSettings writes a backup document of all writable settings to stdout or to the file set by --output-file
+func backupSettings() {
+	if fleetMode() {
+		fmt.Fprintln(os.Stderr, "Please select a single inverter for a backup, e.g. with --inverter.")
+		return
+	}
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		backup, err := lib.BackupSettings()
+		if err != nil {
+			return err
+		}
+		return backup.Write(w)
+	})
+}
+
+// restoreSettings restores the settings of a backup file after showing the changes and confirmation
+func restoreSettings(fileName string) {
+	var outErr io.Writer = os.Stderr
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	backup, err := golrackpi.ReadSettingsBackup(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not read backup file:", err)
+		return
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	_, err = lib.Login()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer lib.Logout()
+
+	if serial, err := lib.SerialNumber(); err != nil {
+		fmt.Fprintln(outErr, "Warning: could not read the serial number of the inverter:", err)
+	} else if backup.Serial != "" && serial != backup.Serial {
+		fmt.Fprintf(outErr, "Warning: backup was created on inverter %s, but this inverter is %s.\n", backup.Serial, serial)
+	}
+
+	options := golrackpi.RestoreOptions{Filter: restoreFilter, DryRun: true}
+	results, err := lib.RestoreSettings(backup, options)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	pending := writeRestoreResults(results)
+
+	if pending == 0 {
+		fmt.Println("Nothing to restore.")
+		return
+	}
+	if settingsDryRun {
+		fmt.Printf("Dry run: %d setting(s) would be restored.\n", pending)
+		return
+	}
+	if !settingsYes && !confirm(fmt.Sprintf("Restore %d setting(s) to %s?", pending, lib.Server)) {
+		fmt.Println("Aborted.")
+		return
+	}
+
+	options.DryRun = false
+	results, err = lib.RestoreSettings(backup, options)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	fmt.Println()
+	writeRestoreResults(results)
+}
+
+// restoreFilter selects the settings according to the --module and --id patterns
+func restoreFilter(moduleId string, settingId string) bool {
+	return matchesAny(restoreModules, moduleId) && matchesAny(restoreIds, settingId)
+}
+
+// matchesAny returns true if value matches one of the patterns or if there are no patterns
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRestoreResults prints the result of a restore and returns the number of settings which are pending (dry run mode)
+func writeRestoreResults(results []golrackpi.RestoreResult) int {
+	pending := 0
+	fmt.Println("Module\tId\tCurrent\tBackup\tStatus")
+	for _, result := range results {
+		if result.Status == golrackpi.RestoreUnchanged {
+			continue
+		}
+		if result.Status == golrackpi.RestorePending {
+			pending++
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s", result.ModuleId, result.Id, result.CurrentValue, result.Value, result.Status)
+		if result.Err != nil {
+			fmt.Printf(" (%v)", result.Err)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	return pending
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/modbus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batteryPower     float64       = 0
+	batteryMinSoC    float64       = -1
+	batteryMaxSoC    float64       = -1
+	batteryKeepalive time.Duration = 5 * time.Second
+	batteryDuration  time.Duration = 0
+)
+
+func init() {
+	batteryCmd.PersistentFlags().StringVarP(&modbusAddress, "address", "", "", "Modbus TCP address host[:port] (default: host of --server or --inverter with port 1502)")
+	batteryCmd.PersistentFlags().Uint8VarP(&modbusUnitId, "unit-id", "", modbus.DefaultUnitId, "Modbus unit id")
+
+	batteryControlCmd.Flags().Float64VarP(&batteryPower, "power", "", 0, "DC power setpoint in W, negative values charge, positive values discharge the battery")
+	batteryControlCmd.Flags().Float64VarP(&batteryMinSoC, "min-soc", "", -1, "Set minimum SoC in % before starting (default: unchanged)")
+	batteryControlCmd.Flags().Float64VarP(&batteryMaxSoC, "max-soc", "", -1, "Set maximum SoC in % before starting (default: unchanged)")
+	batteryControlCmd.Flags().DurationVarP(&batteryKeepalive, "keepalive", "", 5*time.Second, "Interval to renew the setpoint, has to be shorter than the fallback timeout of the inverter")
+	batteryControlCmd.Flags().DurationVarP(&batteryDuration, "duration", "", 0, "Stop after this duration (default: run until interrupted)")
+	batteryControlCmd.MarkFlagRequired("power")
+
+	rootCmd.AddCommand(batteryCmd)
+	batteryCmd.AddCommand(batteryStatusCmd)
+	batteryCmd.AddCommand(batteryControlCmd)
+}
+
+var batteryCmd = &cobra.Command{
+	Use: "battery",
+
+	Short: "Control the battery by Modbus TCP",
+	Long: `Control the battery by Modbus TCP. External battery management via Modbus has to be enabled on the inverter
+(setting devices:local Battery:ExternControl).`,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		fmt.Println("\nUnknown or missing command.\nRun golrackpi battery --help to show available commands.")
+	},
+}
+
+var batteryStatusCmd = &cobra.Command{
+	Use: "status",
+
+	Short: "Show battery management mode, limits and state of charge",
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		showBatteryStatus()
+	},
+}
+
+var batteryControlCmd = &cobra.Command{
+	Use: "control",
+
+	Short: "Write a battery power setpoint and renew it until interrupted",
+	Long: `Write a battery power setpoint and renew it until interrupted. The setpoint is clamped to the power limits read from the inverter,
+charging stops at the maximum SoC and discharging at the minimum SoC. When the command ends, a setpoint of 0 W is written, and the
+inverter falls back to its internal battery management when its timeout expires.`,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		controlBattery()
+	},
+}
+
+// checkExternControlSetting checks the setting for external battery management by the REST API, if credentials are available
+func checkExternControlSetting() error {
+	if selectedInverter == "" && authData.Password == "" {
+		return nil
+	}
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	if _, err := client.Login(); err != nil {
+		return err
+	}
+	defer client.Logout()
+	return modbus.CheckExternControl(client)
+}
+
+// showBatteryStatus prints battery management mode, limits and state of charge
+func showBatteryStatus() {
+	client, err := newModbusClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	defer client.Close()
+
+	mode, err := client.BatteryManagementMode()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	limits, err := client.BatteryLimits()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	values, err := client.ProcessDataValues([]golrackpi.ProcessData{{ModuleId: "devices:local:battery", ProcessDataIds: []string{"SoC"}}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+
+	fmt.Println("Battery management mode:", mode, batteryModeName(mode))
+	for _, module := range values {
+		for _, value := range module.ProcessData {
+			fmt.Printf("SoC:\t\t\t%.1f %%\n", value.Value)
+		}
+	}
+	fmt.Printf("Max. charge power:\t%.0f W\n", limits.MaxChargePower)
+	fmt.Printf("Max. discharge power:\t%.0f W\n", limits.MaxDischargePower)
+	fmt.Printf("Min. SoC:\t\t%.1f %%\n", limits.MinSoC)
+	fmt.Printf("Max. SoC:\t\t%.1f %%\n", limits.MaxSoC)
+}
+
+// batteryModeName returns the name of a battery management mode
+func batteryModeName(mode int) string {
+	switch mode {
+	case 0:
+		return "(internal)"
+	case 1:
+		return "(external via digital I/O)"
+	case modbus.BatteryManagementModbus:
+		return "(external via Modbus)"
+	}
+	return "(unknown)"
+}
+
+// controlBattery writes the power setpoint with keepalives until interrupted or until --duration has passed
+func controlBattery() {
+	if batteryKeepalive <= 0 {
+		fmt.Fprintln(os.Stderr, "An error occurred: keepalive interval has to be positive")
+		return
+	}
+	if err := checkExternControlSetting(); err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+
+	client, err := newModbusClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	defer client.Close()
+
+	mode, err := client.BatteryManagementMode()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	if mode != modbus.BatteryManagementModbus {
+		fmt.Fprintf(os.Stderr, "An error occurred: %v, battery management mode is %d %s\n", modbus.ErrExternControlDisabled, mode, batteryModeName(mode))
+		return
+	}
+
+	if batteryMinSoC >= 0 || batteryMaxSoC >= 0 {
+		limits, err := client.BatteryLimits()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "An error occurred:", err)
+			return
+		}
+		if batteryMinSoC >= 0 {
+			limits.MinSoC = batteryMinSoC
+		}
+		if batteryMaxSoC >= 0 {
+			limits.MaxSoC = batteryMaxSoC
+		}
+		if err := client.SetBatterySoCLimits(limits.MinSoC, limits.MaxSoC); err != nil {
+			fmt.Fprintln(os.Stderr, "An error occurred:", err)
+			return
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if batteryDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, batteryDuration)
+		defer cancel()
+	}
+
+	controller := modbus.NewBatteryController(client, batteryPower)
+	controller.Interval = batteryKeepalive
+	controller.OnApply = func(status modbus.BatteryStatus) {
+		fmt.Printf("%s\tSoC %.1f %%\tsetpoint %.0f W", status.Time.Format(time.RFC3339), status.SoC, status.Applied)
+		if status.Reason != "" {
+			fmt.Printf(" (requested %.0f W, %s)", status.Requested, status.Reason)
+		}
+		fmt.Println()
+	}
+	controller.OnError = func(err error) {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+	}
+	if err := controller.Run(ctx); err != nil {
+		if errors.Is(err, modbus.ErrExternControlDisabled) {
+			err = fmt.Errorf("%w, please set the battery management to external via Modbus", err)
+		}
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	fmt.Println("Stopped, the setpoint was reset to 0 W. The inverter falls back to its internal battery management after its timeout.")
+}
@@ -0,0 +1,458 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/modbus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	bridgeMappingFile string        = ""
+	bridgeListen      string        = ":5020"
+	bridgeInterval    time.Duration = 10 * time.Second
+	bridgeMaxFailures int           = 3
+	bridgeAllowWrite  []string      = []string{}
+)
+
+func init() {
+	bridgeCmd.Flags().StringVarP(&bridgeMappingFile, "mapping", "", "", "YAML file with the register mapping (required)")
+	bridgeCmd.Flags().StringVarP(&bridgeListen, "listen", "", ":5020", "Address of the Modbus TCP server")
+	bridgeCmd.Flags().DurationVarP(&bridgeInterval, "interval", "", 10*time.Second, "Polling interval")
+	bridgeCmd.Flags().IntVarP(&bridgeMaxFailures, "max-failures", "", 3, "Number of failed polls after which reads are answered with an exception instead of the last values (0: never)")
+	bridgeCmd.Flags().StringArrayVarP(&bridgeAllowWrite, "allow-write", "", []string{}, "Allow writes to a setting mapped with write: true, in the format moduleid|settingid (can be repeated)")
+	bridgeCmd.MarkFlagRequired("mapping")
+
+	rootCmd.AddCommand(bridgeCmd)
+}
+
+var bridgeCmd = &cobra.Command{
+	Use: "modbus-bridge",
+
+	Short: "Serve process-data and settings as Modbus TCP registers",
+	Long: `Poll process-data and settings through the REST API and serve them as holding and input registers by Modbus TCP.
+The register layout is defined by a YAML mapping:
+
+  unit_id: 1            # 0 or omitted: answer all unit ids
+  byte_order: big       # word order of 32 bit values, big (ABCD, default) or little (CDAB)
+  registers:
+    - module: devices:local
+      id: Dc_P
+      address: 0
+      type: float32     # u16, s16, u32, s32 or float32
+    - module: devices:local:battery
+      id: SoC
+      address: 2
+      type: u16
+      scale: 10         # register value = value * scale
+    - module: devices:local
+      setting: Battery:MinSoc
+      address: 10
+      type: u16
+      write: true       # write-through to the setting, only if allowed by --allow-write
+
+Writes to settings are validated against the setting's type and range before they are sent to the inverter.
+
+Registers between the mapped registers read as 0, so a block of registers can be read at once. Mapped registers without value, e.g.
+before the first poll, are answered with an illegal address exception. After --max-failures failed polls in a row, all reads are
+answered with a gateway target failed exception (0x0B) until the next successful poll, so clients don't process outdated values.`,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runBridge()
+	},
+}
+
+// bridgeRegister specifies an entry of the register mapping, either a process-data value (id) or a setting
+type bridgeRegister struct {
+	Module  string  `yaml:"module"`
+	Id      string  `yaml:"id"`
+	Setting string  `yaml:"setting"`
+	Address uint16  `yaml:"address"`
+	Type    string  `yaml:"type"`
+	Scale   float64 `yaml:"scale"`
+	Write   bool    `yaml:"write"`
+
+	dataType modbus.DataType
+	writable bool
+	setting  golrackpi.SettingsDataValues
+}
+
+// bridgeMapping specifies the structure of the mapping file
+type bridgeMapping struct {
+	UnitId    uint8            `yaml:"unit_id"`
+	ByteOrder string           `yaml:"byte_order"`
+	Registers []bridgeRegister `yaml:"registers"`
+}
+
+// name returns the moduleid|id name of the register
+func (r *bridgeRegister) name() string {
+	if r.Setting != "" {
+		return r.Module + "|" + r.Setting
+	}
+	return r.Module + "|" + r.Id
+}
+
+// length returns the number of registers of the entry
+func (r *bridgeRegister) length() uint16 {
+	return r.dataType.Words()
+}
+
+// modbusBridge answers Modbus requests with the values polled through the REST API
+type modbusBridge struct {
+	registers   []*bridgeRegister
+	order       modbus.ByteOrder
+	session     *golrackpi.Session
+	memory      *modbus.Memory
+	maxFailures int
+
+	mu       sync.Mutex
+	failures int // number of failed polls in a row
+}
+
+// loadBridgeMapping reads and checks the mapping file
+func loadBridgeMapping(fileName string) (bridgeMapping, modbus.ByteOrder, error) {
+	var mapping bridgeMapping
+	f, err := os.Open(fileName)
+	if err != nil {
+		return mapping, modbus.BigEndian, fmt.Errorf("could not read mapping file: %w", err)
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&mapping); err != nil {
+		return mapping, modbus.BigEndian, fmt.Errorf("could not parse mapping file %s: %w", fileName, err)
+	}
+
+	order := modbus.BigEndian
+	switch strings.ToLower(mapping.ByteOrder) {
+	case "", "big", "abcd":
+	case "little", "cdab":
+		order = modbus.LittleEndian
+	default:
+		return mapping, order, fmt.Errorf("unknown byte order %q, please use big or little", mapping.ByteOrder)
+	}
+
+	if len(mapping.Registers) == 0 {
+		return mapping, order, errors.New("mapping file contains no registers")
+	}
+	for i := range mapping.Registers {
+		r := &mapping.Registers[i]
+		if r.Module == "" || (r.Id == "") == (r.Setting == "") {
+			return mapping, order, fmt.Errorf("register %d: please set module and either id or setting", r.Address)
+		}
+		if r.Write && r.Setting == "" {
+			return mapping, order, fmt.Errorf("register %d (%s): only settings can be written", r.Address, r.name())
+		}
+		if r.dataType, err = modbus.ParseDataType(r.Type); err != nil || r.dataType == modbus.String {
+			return mapping, order, fmt.Errorf("register %d (%s): unsupported type %q, please use u16, s16, u32, s32 or float32", r.Address, r.name(), r.Type)
+		}
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+		if uint32(r.Address)+uint32(r.length()) > 0x10000 {
+			return mapping, order, fmt.Errorf("register %d (%s): exceeds the address space", r.Address, r.name())
+		}
+	}
+
+	// check overlapping registers
+	sorted := make([]*bridgeRegister, len(mapping.Registers))
+	for i := range mapping.Registers {
+		sorted[i] = &mapping.Registers[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Address < sorted[j].Address })
+	for i := 1; i < len(sorted); i++ {
+		if uint32(sorted[i-1].Address)+uint32(sorted[i-1].length()) > uint32(sorted[i].Address) {
+			return mapping, order, fmt.Errorf("register %d (%s) overlaps register %d (%s)", sorted[i].Address, sorted[i].name(), sorted[i-1].Address, sorted[i-1].name())
+		}
+	}
+	return mapping, order, nil
+}
+
+// allowWrites marks the settings of the allowlist as writable and reads their metadata for the validation of written values.
+// Every entry of the allowlist has to be mapped with write: true.
+func (b *modbusBridge) allowWrites(allowlist []string) error {
+	if len(allowlist) == 0 {
+		return nil
+	}
+	var settings []golrackpi.SettingsData
+	err := b.session.Do(func(client *golrackpi.AuthClient) error {
+		var err error
+		settings, err = client.Settings()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, allowed := range allowlist {
+		found := false
+		for _, r := range b.registers {
+			if !r.Write || r.name() != allowed {
+				continue
+			}
+			found = true
+			setting, ok := settingMetadata(settings, r.Module, r.Setting)
+			if !ok {
+				return fmt.Errorf("setting %s not found", allowed)
+			}
+			if !setting.IsWritable() {
+				return fmt.Errorf("setting %s is not writable", allowed)
+			}
+			r.setting = setting
+			r.writable = true
+		}
+		if !found {
+			return fmt.Errorf("setting %s of --allow-write is not mapped with write: true", allowed)
+		}
+	}
+	return nil
+}
+
+// settingMetadata returns the metadata of a setting
+func settingMetadata(settings []golrackpi.SettingsData, moduleId string, id string) (golrackpi.SettingsDataValues, bool) {
+	for _, module := range settings {
+		if module.ModuleId == moduleId {
+			return module.Setting(id)
+		}
+	}
+	return golrackpi.SettingsDataValues{}, false
+}
+
+// run polls the values every interval until ctx is cancelled
+func (b *modbusBridge) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.pollResult(b.poll())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollResult prints the error of a poll and counts the failed polls in a row
+func (b *modbusBridge) pollResult(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	fmt.Fprintln(os.Stderr, "An error occurred:", err)
+	b.failures++
+	if b.failures == b.maxFailures {
+		fmt.Fprintf(os.Stderr, "%d polls failed in a row, reads are answered with an exception until the next successful poll.\n", b.failures)
+	}
+}
+
+// poll requests the mapped process-data and settings and updates the registers. Values which are missing in the response keep
+// their last value; registers without value are answered with an illegal address exception.
+func (b *modbusBridge) poll() error {
+	var selectors []golrackpi.ProcessData
+	settingIds := make(map[string][]string)
+	var settingModules []string
+	for _, r := range b.registers {
+		if r.Setting != "" {
+			if _, found := settingIds[r.Module]; !found {
+				settingModules = append(settingModules, r.Module)
+			}
+			settingIds[r.Module] = append(settingIds[r.Module], r.Setting)
+			continue
+		}
+		selectors = mergeSelectors(selectors, []golrackpi.ProcessData{{ModuleId: r.Module, ProcessDataIds: []string{r.Id}}})
+	}
+
+	values := make(map[string]float64)
+	err := b.session.Do(func(client *golrackpi.AuthClient) error {
+		if len(selectors) > 0 {
+			processData, err := client.ProcessDataValues(selectors)
+			if err != nil {
+				return err
+			}
+			for _, module := range processData {
+				for _, value := range module.ProcessData {
+					if f, ok := numericValue(value.Value); ok {
+						values[module.ModuleId+"|"+value.Id] = f
+					}
+				}
+			}
+		}
+		for _, moduleId := range settingModules {
+			settings, err := client.SettingsModuleSettings(moduleId, settingIds[moduleId]...)
+			if err != nil {
+				return err
+			}
+			for _, setting := range settings {
+				if f, err := strconv.ParseFloat(setting.Value, 64); err == nil {
+					values[moduleId+"|"+setting.Id] = f
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range b.registers {
+		value, found := values[r.name()]
+		if !found {
+			continue
+		}
+		registers, err := modbus.Encode(value*r.Scale, r.dataType, b.order)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not encode %s for register %d: %v\n", r.name(), r.Address, err)
+			continue
+		}
+		b.memory.Set(r.Address, registers...)
+	}
+	return nil
+}
+
+// fillGaps sets the registers between the mapped registers to 0, so reads of a block aren't rejected because of unmapped addresses
+func (b *modbusBridge) fillGaps() {
+	sorted := append([]*bridgeRegister(nil), b.registers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Address < sorted[j].Address })
+	for i := 1; i < len(sorted); i++ {
+		end := uint32(sorted[i-1].Address) + uint32(sorted[i-1].length())
+		if gap := uint32(sorted[i].Address) - end; gap > 0 {
+			b.memory.Set(uint16(end), make([]uint16, gap)...)
+		}
+	}
+}
+
+// ReadRegisters answers read requests of holding and input registers with the polled values. After maxFailures failed polls in a
+// row, the values are outdated and the requests are answered with an exception.
+func (b *modbusBridge) ReadRegisters(function byte, address uint16, count uint16) ([]uint16, error) {
+	b.mu.Lock()
+	stale := b.maxFailures > 0 && b.failures >= b.maxFailures
+	b.mu.Unlock()
+	if stale {
+		return nil, modbus.ExceptionError{Function: function, Code: modbus.ExceptionGatewayTargetFailed}
+	}
+	return b.memory.ReadRegisters(function, address, count)
+}
+
+// WriteRegisters writes a setting mapped with write: true and allowed by --allow-write. The write has to cover exactly the registers
+// of the setting.
+func (b *modbusBridge) WriteRegisters(address uint16, values []uint16) error {
+	var r *bridgeRegister
+	for _, register := range b.registers {
+		if register.Address == address {
+			r = register
+		}
+	}
+	if r == nil || !r.writable || int(r.length()) != len(values) {
+		return modbus.ExceptionError{Code: modbus.ExceptionIllegalAddress}
+	}
+
+	decoded, err := modbus.Decode(values, r.dataType, b.order)
+	if err != nil {
+		return modbus.ExceptionError{Code: modbus.ExceptionIllegalValue}
+	}
+	bitSize := 64
+	if r.dataType == modbus.Float32 {
+		bitSize = 32
+	}
+	value := strconv.FormatFloat(decoded.(float64)/r.Scale, 'f', -1, bitSize)
+	if err := r.setting.Validate(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Rejected write of %s: %v\n", r.name(), err)
+		return modbus.ExceptionError{Code: modbus.ExceptionIllegalValue}
+	}
+
+	err = b.session.Do(func(client *golrackpi.AuthClient) error {
+		_, err := client.UpdateSettings([]golrackpi.ModuleSettings{{ModuleId: r.Module, Settings: []golrackpi.SettingsValues{{Id: r.Setting, Value: value}}}})
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write %s: %v\n", r.name(), err)
+		return err
+	}
+	fmt.Printf("Wrote %s = %s\n", r.name(), value)
+	b.memory.Set(address, values...)
+	return nil
+}
+
+// runBridge starts the Modbus TCP server and polls the mapped values until interrupted
+func runBridge() {
+	var outErr io.Writer = os.Stderr
+
+	if bridgeInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit a polling interval of at least one second.")
+		return
+	}
+	if bridgeMaxFailures < 0 {
+		fmt.Fprintln(outErr, "Please submit a non-negative number of failures.")
+		return
+	}
+	if fleetMode() {
+		fmt.Fprintln(outErr, "Please select a single inverter, the bridge serves the values of one inverter.")
+		return
+	}
+	mapping, order, err := loadBridgeMapping(bridgeMappingFile)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	b := &modbusBridge{order: order, session: golrackpi.NewSession(lib), memory: modbus.NewMemory(), maxFailures: bridgeMaxFailures}
+	defer b.session.Close()
+	for i := range mapping.Registers {
+		b.registers = append(b.registers, &mapping.Registers[i])
+	}
+	b.fillGaps()
+	if err := b.allowWrites(bridgeAllowWrite); err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	for _, r := range b.registers {
+		if r.Write && !r.writable {
+			fmt.Fprintf(outErr, "Writes to %s are rejected, it is not allowed by --allow-write.\n", r.name())
+		}
+	}
+
+	listener, err := net.Listen("tcp", bridgeListen)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	server := modbus.NewServer(mapping.UnitId, b)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go b.run(ctx, bridgeInterval)
+
+	fmt.Printf("Serving %d register(s) of %s on %s (byte order %s)\n", len(b.registers), lib.Server, listener.Addr(), order)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, modbus.ErrServerClosed) {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+	}
+}
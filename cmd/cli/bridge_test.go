@@ -0,0 +1,74 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/modbus"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+// bridgeException returns the code of a Modbus exception, 0 for other errors
+func bridgeException(err error) byte {
+	var exception modbus.ExceptionError
+	if errors.As(err, &exception) {
+		return exception.Code
+	}
+	return 0
+}
+
+func TestModbusBridge(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &modbusBridge{
+		registers: []*bridgeRegister{
+			{Module: "devices:local:battery", Id: "SoC", Address: 0, dataType: modbus.U16, Scale: 10},
+			{Module: "devices:local", Id: "Home_P", Address: 4, dataType: modbus.Float32, Scale: 1},
+			{Module: "devices:local", Id: "Dc_P", Address: 8, dataType: modbus.U16, Scale: 1},
+		},
+		order:       modbus.BigEndian,
+		session:     golrackpi.NewSession(sim.Client()),
+		memory:      modbus.NewMemory(),
+		maxFailures: 2,
+	}
+	defer b.session.Close()
+	b.fillGaps()
+
+	if _, err := b.ReadRegisters(modbus.FuncReadHoldingRegisters, 0, 1); bridgeException(err) != modbus.ExceptionIllegalAddress {
+		t.Errorf("read before the first poll: got %v", err)
+	}
+	b.pollResult(b.poll())
+
+	// the gaps between the registers read as 0
+	registers, err := b.ReadRegisters(modbus.FuncReadHoldingRegisters, 0, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registers[0] > 1000 || registers[1] != 0 || registers[2] != 0 || registers[3] != 0 || registers[6] != 0 || registers[7] != 0 {
+		t.Errorf("got %v", registers)
+	}
+	if _, err := b.ReadRegisters(modbus.FuncReadHoldingRegisters, 9, 1); bridgeException(err) != modbus.ExceptionIllegalAddress {
+		t.Errorf("read beyond the mapping: got %v", err)
+	}
+
+	// after maxFailures failed polls, the values are outdated
+	sim.Close()
+	for i := 1; i <= 2; i++ {
+		b.pollResult(b.poll())
+		_, err := b.ReadRegisters(modbus.FuncReadHoldingRegisters, 0, 1)
+		if stale := bridgeException(err) == modbus.ExceptionGatewayTargetFailed; stale != (i == 2) {
+			t.Errorf("after %d failed polls: got %v", i, err)
+		}
+	}
+	b.pollResult(nil)
+	if _, err := b.ReadRegisters(modbus.FuncReadHoldingRegisters, 0, 1); err != nil {
+		t.Errorf("after successful poll: got %v", err)
+	}
+}
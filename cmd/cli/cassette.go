@@ -0,0 +1,77 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/geschke/golrackpi/cassette"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recordFile string = ""
+	replayFile string = ""
+
+	// trafficClient is the http client of all inverter clients if --record or --replay is set
+	trafficClient *http.Client
+	recorder      *cassette.Recorder
+	recordOut     *os.File
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&recordFile, "record", "", "", "Record the HTTP traffic with the inverter into this cassette file, with session ids and authentication values redacted")
+	rootCmd.PersistentFlags().StringVarP(&replayFile, "replay", "", "", "Answer all requests with the responses recorded in this cassette file instead of connecting to an inverter")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return openCassette()
+	}
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		closeCassette()
+	}
+}
+
+// openCassette prepares recording or replaying of the HTTP traffic. When replaying, server and password are not required.
+func openCassette() error {
+	switch {
+	case recordFile != "" && replayFile != "":
+		return errors.New("--record and --replay can't be used together")
+	case recordFile != "":
+		f, err := os.Create(recordFile)
+		if err != nil {
+			return err
+		}
+		recordOut = f
+		recorder = cassette.NewRecorder(f)
+		trafficClient = recorder.Client()
+	case replayFile != "":
+		interactions, err := cassette.LoadFile(replayFile)
+		if err != nil {
+			return fmt.Errorf("could not read cassette: %w", err)
+		}
+		trafficClient = cassette.NewReplayer(interactions).Client()
+		if authData.Server == "" {
+			authData.Server = "cassette"
+		}
+		authData.Password = cassette.ReplayPassword
+	}
+	return nil
+}
+
+// closeCassette closes the recorded cassette file
+func closeCassette() {
+	if recordOut == nil {
+		return
+	}
+	if err := recorder.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not record the HTTP traffic:", err)
+	}
+	if err := recordOut.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not close the cassette file:", err)
+	}
+}
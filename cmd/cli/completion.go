@@ -0,0 +1,285 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+// completionCacheTTL defines how long the identifiers fetched from the inverter are reused by the
+// shell completion functions before a new login is performed.
+const completionCacheTTL = 24 * time.Hour
+
+// completionCache is the structure of the cache file which stores the processdata and settings identifiers of one inverter.
+type completionCache struct {
+	ProcessDataCreated time.Time               `json:"processdata_created"`
+	ProcessData        []golrackpi.ProcessData `json:"processdata"`
+	SettingsCreated    time.Time               `json:"settings_created"`
+	Settings           map[string][]string     `json:"settings"`
+}
+
+func init() {
+	processdataModuleCmd.ValidArgsFunction = completeProcessdataModule
+	processdataGetCmd.ValidArgsFunction = completeProcessdataGet
+	processdataMultCmd.ValidArgsFunction = completeProcessdataMult
+
+	settingsModuleCmd.ValidArgsFunction = completeSettingsModule
+	settingsModuleSettingCmd.ValidArgsFunction = completeSettingsModuleSetting
+	settingsModuleSettingsCmd.ValidArgsFunction = completeSettingsModuleSettings
+}
+
+// completionCacheFile returns the path of the cache file for the currently selected inverter.
+func completionCacheFile() (string, error) {
+	lib, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(lib.Server)
+	return filepath.Join(dir, "golrackpi", "completion-"+name+".json"), nil
+}
+
+// readCompletionCache reads the cache file of the currently selected inverter. A missing or unreadable file results in an empty cache.
+func readCompletionCache() completionCache {
+	cache := completionCache{}
+	fileName, err := completionCacheFile()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return cache
+	}
+	json.Unmarshal(data, &cache)
+	return cache
+}
+
+// writeCompletionCache stores the cache of the currently selected inverter. Errors are ignored, because shell completion should never fail
+// just because the cache directory is not writable.
+func writeCompletionCache(cache completionCache) {
+	fileName, err := completionCacheFile()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	os.WriteFile(fileName, data, 0600)
+}
+
+// completionClient returns a logged in client, or nil if the connection settings are missing or the login fails.
+func completionClient() *golrackpi.AuthClient {
+	lib, err := newClient()
+	if err != nil {
+		return nil
+	}
+	if _, err := lib.Login(); err != nil {
+		return nil
+	}
+	return lib
+}
+
+// cachedProcessData returns the list of modules with their processdata ids, read from the cache or from the inverter.
+func cachedProcessData() []golrackpi.ProcessData {
+	cache := readCompletionCache()
+	if len(cache.ProcessData) > 0 && time.Since(cache.ProcessDataCreated) < completionCacheTTL {
+		return cache.ProcessData
+	}
+
+	lib := completionClient()
+	if lib == nil {
+		return cache.ProcessData
+	}
+	defer lib.Logout()
+
+	processData, err := lib.ProcessData()
+	if err != nil {
+		return cache.ProcessData
+	}
+	cache.ProcessData = processData
+	cache.ProcessDataCreated = time.Now()
+	writeCompletionCache(cache)
+	return processData
+}
+
+// cachedSettings returns a map of module ids with their setting ids, read from the cache or from the inverter.
+func cachedSettings() map[string][]string {
+	cache := readCompletionCache()
+	if len(cache.Settings) > 0 && time.Since(cache.SettingsCreated) < completionCacheTTL {
+		return cache.Settings
+	}
+
+	lib := completionClient()
+	if lib == nil {
+		return cache.Settings
+	}
+	defer lib.Logout()
+
+	settings, err := lib.Settings()
+	if err != nil {
+		return cache.Settings
+	}
+	cache.Settings = make(map[string][]string)
+	for _, s := range settings {
+		ids := make([]string, 0, len(s.Settings))
+		for _, data := range s.Settings {
+			ids = append(ids, data.Id)
+		}
+		cache.Settings[s.ModuleId] = ids
+	}
+	cache.SettingsCreated = time.Now()
+	writeCompletionCache(cache)
+	return cache.Settings
+}
+
+// processdataModuleIds returns all module ids which contain processdata
+func processdataModuleIds() []string {
+	var result []string
+	for _, pd := range cachedProcessData() {
+		result = append(result, pd.ModuleId)
+	}
+	return result
+}
+
+// processdataIds returns the processdata ids of a module
+func processdataIds(moduleId string) []string {
+	for _, pd := range cachedProcessData() {
+		if pd.ModuleId == moduleId {
+			return pd.ProcessDataIds
+		}
+	}
+	return nil
+}
+
+// settingsModuleIds returns all module ids which contain settings
+func settingsModuleIds() []string {
+	var result []string
+	for moduleId := range cachedSettings() {
+		result = append(result, moduleId)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// settingsIds returns the setting ids of a module
+func settingsIds(moduleId string) []string {
+	return cachedSettings()[moduleId]
+}
+
+// withoutUsed removes the identifiers which are already part of the command line
+func withoutUsed(ids []string, used []string) []string {
+	var result []string
+	for _, id := range ids {
+		found := false
+		for _, u := range used {
+			if u == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// completeList completes a comma-separated list of identifiers. The part before the last comma is kept as prefix of every suggestion.
+func completeList(ids []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+	used := strings.Split(prefix, ",")
+	var result []string
+	for _, id := range withoutUsed(ids, used) {
+		result = append(result, prefix+id)
+	}
+	return result, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeProcessdataModule completes the moduleid argument of "processdata module"
+func completeProcessdataModule(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return processdataModuleIds(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProcessdataGet completes the moduleid and processdataid arguments of "processdata get"
+func completeProcessdataGet(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return processdataModuleIds(), cobra.ShellCompDirectiveNoFileComp
+	}
+	return withoutUsed(processdataIds(args[0]), args[1:]), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProcessdataMult completes both formats of "processdata mult", i.e. "moduleid processdataids" and "moduleid|processdataids ..."
+func completeProcessdataMult(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if i := strings.Index(toComplete, "|"); i >= 0 {
+		moduleId := toComplete[:i]
+		suggestions, directive := completeList(processdataIds(moduleId), toComplete[i+1:])
+		for j := range suggestions {
+			suggestions[j] = moduleId + "|" + suggestions[j]
+		}
+		return suggestions, directive
+	}
+	if len(args) == 0 {
+		return processdataModuleIds(), cobra.ShellCompDirectiveNoFileComp
+	}
+	if len(args) == 1 && !strings.Contains(args[0], "|") {
+		return completeList(processdataIds(args[0]), toComplete)
+	}
+	if strings.Contains(args[0], "|") {
+		var result []string
+		for _, moduleId := range processdataModuleIds() {
+			result = append(result, moduleId+"|")
+		}
+		return result, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSettingsModule completes the moduleid argument of "settings module"
+func completeSettingsModule(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return settingsModuleIds(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSettingsModuleSetting completes the moduleid and settingid arguments of "settings setting"
+func completeSettingsModuleSetting(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return settingsModuleIds(), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return settingsIds(args[0]), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSettingsModuleSettings completes the moduleid and settingid arguments of "settings settings"
+func completeSettingsModuleSettings(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return settingsModuleIds(), cobra.ShellCompDirectiveNoFileComp
+	}
+	return withoutUsed(settingsIds(args[0]), args[1:]), cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var outputJSON bool = false
+
+func init() {
+	settingsDiffCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "Set output to JSON format")
+	settingsDiffCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write output to file [filename]")
+
+	settingsCmd.AddCommand(settingsDiffCmd)
+}
+
+var settingsDiffCmd = &cobra.Command{
+	Use: "diff <source> <source>",
+
+	Short: "Compare the settings of two inverters or backup files.",
+	Long: `Compare the writable settings of two sources. A source is one of
+  live        the inverter selected by --server/--password or --inverter
+  @<name>     the inverter with this name from the configuration file
+  <filename>  a backup file created by "settings backup"
+
+Changed settings are marked with "~", settings which exist only in the first source with "-" and
+settings which exist only in the second source with "+". Values which differ from the default value are marked with "*".`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		diffSettings(args[0], args[1])
+	},
+}
+
+// settingsSource specifies a loaded source of a settings comparison
+type settingsSource struct {
+	Label    string    `json:"source"`
+	Serial   string    `json:"serial"`
+	Firmware string    `json:"firmware"`
+	Created  time.Time `json:"created"`
+
+	backup golrackpi.SettingsBackup
+}
+
+// loadSettingsSource loads the settings of a live inverter, an inverter of the configuration file or a backup file
+func loadSettingsSource(source string) (settingsSource, error) {
+	result := settingsSource{Label: source}
+	var lib *golrackpi.AuthClient
+	var err error
+
+	switch {
+	case source == "live":
+		lib, err = newClient()
+		if err != nil {
+			return result, err
+		}
+	case strings.HasPrefix(source, "@"):
+		inverter, err := configInverter(strings.TrimPrefix(source, "@"))
+		if err != nil {
+			return result, err
+		}
+		if lib, err = clientFromConfig(inverter); err != nil {
+			return result, err
+		}
+	default:
+		f, err := os.Open(source)
+		if err != nil {
+			return result, err
+		}
+		defer f.Close()
+		result.backup, err = golrackpi.ReadSettingsBackup(f)
+		if err != nil {
+			return result, fmt.Errorf("could not read backup file %s: %w", source, err)
+		}
+	}
+
+	if lib != nil {
+		if _, err := lib.Login(); err != nil {
+			return result, fmt.Errorf("%s: %w", source, err)
+		}
+		defer lib.Logout()
+		result.backup, err = lib.BackupSettings()
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", source, err)
+		}
+	}
+
+	result.Serial = result.backup.Serial
+	result.Firmware = result.backup.Firmware
+	result.Created = result.backup.Created
+	return result, nil
+}
+
+// diffSettings prints the differences between the settings of two sources
+func diffSettings(sourceA string, sourceB string) {
+	var outErr io.Writer = os.Stderr
+	var w io.Writer
+
+	// load both sources concurrently, because reading all settings of an inverter takes some time
+	type loaded struct {
+		source settingsSource
+		err    error
+	}
+	chA := make(chan loaded)
+	chB := make(chan loaded)
+	go func() { s, err := loadSettingsSource(sourceA); chA <- loaded{s, err} }()
+	go func() { s, err := loadSettingsSource(sourceB); chB <- loaded{s, err} }()
+	a, b := <-chA, <-chB
+	for _, l := range []loaded{a, b} {
+		if l.err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", l.err)
+			return
+		}
+	}
+
+	f, err := getOutFile()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not open file ", outputFile)
+		return
+	}
+	if f != nil {
+		w = f
+		defer closeOutFile(f)
+	} else {
+		w = os.Stdout
+	}
+
+	diffs := golrackpi.DiffSettings(a.source.backup, b.source.backup)
+
+	if outputJSON {
+		result := struct {
+			A           settingsSource           `json:"a"`
+			B           settingsSource           `json:"b"`
+			Differences []golrackpi.SettingsDiff `json:"differences"`
+		}{a.source, b.source, diffs}
+		if result.Differences == nil {
+			result.Differences = []golrackpi.SettingsDiff{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
+	}
+
+	fmt.Fprintf(w, "--- %s (serial %s, firmware %s, %s)\n", a.source.Label, a.source.Serial, a.source.Firmware, a.source.Created.Format(time.RFC3339))
+	fmt.Fprintf(w, "+++ %s (serial %s, firmware %s, %s)\n", b.source.Label, b.source.Serial, b.source.Firmware, b.source.Created.Format(time.RFC3339))
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "\nNo differences.")
+		return
+	}
+
+	moduleId := ""
+	for _, diff := range diffs {
+		if diff.ModuleId != moduleId {
+			moduleId = diff.ModuleId
+			fmt.Fprintf(w, "\n[%s]\n", moduleId)
+		}
+		switch diff.Kind {
+		case golrackpi.SettingsChanged:
+			fmt.Fprintf(w, "  ~ %s: %s -> %s", diff.Id, markDefault(diff.ValueA, diff.Unit, diff.NonDefaultA), markDefault(diff.ValueB, diff.Unit, diff.NonDefaultB))
+		case golrackpi.SettingsRemoved:
+			fmt.Fprintf(w, "  - %s: %s", diff.Id, markDefault(diff.ValueA, diff.Unit, diff.NonDefaultA))
+		case golrackpi.SettingsAdded:
+			fmt.Fprintf(w, "  + %s: %s", diff.Id, markDefault(diff.ValueB, diff.Unit, diff.NonDefaultB))
+		}
+		if diff.Default != "" {
+			fmt.Fprintf(w, " (default %s)", diff.Default)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// markDefault returns the value with its unit and appends "*" to a value which differs from the default value
+func markDefault(value string, unit string, nonDefault bool) string {
+	value += unitSuffix(unit)
+	if nonDefault {
+		return value + "*"
+	}
+	return value
+}
@@ -6,6 +6,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/geschke/golrackpi"
 	"github.com/spf13/cobra"
@@ -14,7 +17,18 @@ import (
 var language string
 var max int
 
+var (
+	eventsMinSeverity string = ""
+	eventsSort        string = ""
+	eventsCatalogFile string = ""
+)
+
 func init() {
+	for _, cmd := range []*cobra.Command{eventsCustomCmd, eventsLatestCmd, eventsHistoryCmd} {
+		cmd.Flags().StringVarP(&eventsMinSeverity, "severity", "", "", "Show only events with at least this severity (info, warning, error)")
+		cmd.Flags().StringVarP(&eventsSort, "sort", "", "", "Sort events by \"time\", \"severity\" or \"code\" (default: order of the inverter)")
+		cmd.Flags().StringVarP(&eventsCatalogFile, "catalog", "", "", "Event catalog file (JSON) which extends the embedded catalog")
+	}
 
 	eventsCustomCmd.Flags().StringVarP(&language, "language", "l", "", "Language identifier, e.g. en-gb, de-de, fr-fr, ...")
 	eventsCustomCmd.Flags().IntVarP(&max, "max", "x", 0, "Maximum number of events to return (default: 10)")
@@ -69,74 +83,106 @@ var eventsCustomCmd = &cobra.Command{
 // latestCustomEvents prints the latest events with customized setting of language identifier (default: en-gb) and maximum number of
 // events (default: 10)
 func latestCustomEvents() {
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		events, err := lib.EventsWithParam(language, max)
+		if err != nil {
+			return err
+		}
+		return writeEvents(w, events)
+	})
+}
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+// latestEvents prints the latest events returned by the default "events" request
+func latestEvents() {
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		events, err := lib.Events()
+		if err != nil {
+			return err
+		}
+		return writeEvents(w, events)
 	})
+}
 
-	_, err := lib.Login()
+// eventCatalog returns the embedded event catalog, extended by the catalog file set by --catalog
+func eventCatalog() (*golrackpi.EventCatalog, error) {
+	catalog := golrackpi.DefaultEventCatalog()
+	if eventsCatalogFile == "" {
+		return catalog, nil
+	}
+	f, err := os.Open(eventsCatalogFile)
 	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
+		return nil, err
 	}
-	defer lib.Logout()
+	defer f.Close()
+	fileCatalog, err := golrackpi.LoadEventCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read event catalog %s: %w", eventsCatalogFile, err)
+	}
+	return catalog.Merge(fileCatalog), nil
+}
 
-	events, err := lib.EventsWithParam(language, max)
+// catalogEvent specifies an event together with its catalog entry
+type catalogEvent struct {
+	golrackpi.EventData
+	entry golrackpi.EventCatalogEntry
+}
 
+// prepareEvents looks up the events in the catalog, filters them by --severity and sorts them by --sort
+func prepareEvents(events []golrackpi.EventData) ([]catalogEvent, error) {
+	catalog, err := eventCatalog()
 	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
+		return nil, err
 	}
-
-	if outputCSV {
-		fmt.Printf("Description%sCategory%sLongDescription%sStartTime%sGroup%sEndTime%sCode%sIsActive\n", delimiter, delimiter, delimiter, delimiter, delimiter, delimiter, delimiter)
-		for _, event := range events {
-			fmt.Printf("%s%s%s%s%s%s%s%s%s%s%s%s%d%s%t\n", event.Description, delimiter, event.Category, delimiter, event.LongDescription, delimiter, event.StartTime, delimiter, event.Group, delimiter, event.EndTime, delimiter, event.Code, delimiter, event.IsActive)
-		}
-	} else {
-		fmt.Println("Description\tCategory\tLongDescription\tStartTime\tGroup\tEndTime\tCode\tIsActive")
-		for _, event := range events {
-			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\n", event.Description, event.Category, event.LongDescription, event.StartTime, event.Group, event.EndTime, event.Code, event.IsActive)
+	minSeverity := golrackpi.SeverityUnknown
+	if eventsMinSeverity != "" {
+		minSeverity, err = golrackpi.ParseEventSeverity(eventsMinSeverity)
+		if err != nil {
+			return nil, err
 		}
-
 	}
-}
-
-// latestEvents prints the latest events returned by the default "events" request
-func latestEvents() {
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
+	var result []catalogEvent
+	for _, event := range events {
+		entry, _ := catalog.Lookup(event)
+		if entry.Severity < minSeverity {
+			continue
+		}
+		result = append(result, catalogEvent{EventData: event, entry: entry})
+	}
 
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
+	switch eventsSort {
+	case "":
+	case "time":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].StartTime.Before(result[j].StartTime.Time) })
+	case "severity":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].entry.Severity > result[j].entry.Severity })
+	case "code":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", eventsSort)
 	}
-	defer lib.Logout()
+	return result, nil
+}
 
-	events, err := lib.Events()
+// writeEvents is a helper function to print a slice of events with their severity
+func writeEvents(w io.Writer, events []golrackpi.EventData) error {
+	prepared, err := prepareEvents(events)
 	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
+		return err
 	}
 
 	if outputCSV {
-		fmt.Printf("Description%sCategory%sLongDescription%sStartTime%sGroup%sEndTime%sCode%sIsActive\n", delimiter, delimiter, delimiter, delimiter, delimiter, delimiter, delimiter)
-		for _, event := range events {
-			fmt.Printf("%s%s%s%s%s%s%s%s%s%s%s%s%d%s%t\n", event.Description, delimiter, event.Category, delimiter, event.LongDescription, delimiter, event.StartTime, delimiter, event.Group, delimiter, event.EndTime, delimiter, event.Code, delimiter, event.IsActive)
+		fmt.Fprintf(w, "Description%sCategory%sLongDescription%sStartTime%sGroup%sEndTime%sCode%sIsActive%sSeverity%sAction\n", delimiter, delimiter, delimiter, delimiter, delimiter, delimiter, delimiter, delimiter, delimiter)
+		for _, event := range prepared {
+			fmt.Fprintf(w, "%s%s%s%s%s%s%s%s%s%s%s%s%d%s%t%s%s%s%s\n", event.Description, delimiter, event.Category, delimiter, event.LongDescription, delimiter, event.StartTime, delimiter, event.Group, delimiter, event.EndTime, delimiter, event.Code, delimiter, event.IsActive, delimiter, event.entry.Severity, delimiter, event.entry.Action)
 		}
 	} else {
-		fmt.Println("Description\tCategory\tLongDescription\tStartTime\tGroup\tEndTime\tCode\tIsActive")
-		for _, event := range events {
-			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\n", event.Description, event.Category, event.LongDescription, event.StartTime, event.Group, event.EndTime, event.Code, event.IsActive)
+		fmt.Fprintln(w, "Description\tCategory\tLongDescription\tStartTime\tGroup\tEndTime\tCode\tIsActive\tSeverity\tAction")
+		for _, event := range prepared {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\t%s\t%s\n", event.Description, event.Category, event.LongDescription, event.StartTime, event.Group, event.EndTime, event.Code, event.IsActive, event.entry.Severity, event.entry.Action)
 		}
 	}
+	return nil
 }
 
 // Handle events-related commands
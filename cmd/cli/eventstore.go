@@ -0,0 +1,171 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	eventStoreFile  string   = ""
+	historySince    string   = ""
+	historyUntil    string   = ""
+	historyCodes    []int    = []int{}
+	historyCategory []string = []string{}
+)
+
+func init() {
+	eventsCollectCmd.Flags().StringVarP(&eventStoreFile, "store", "", "", "Event store file (default: ~/.local/share/golrackpi/events.jsonl)")
+	eventsCollectCmd.Flags().StringVarP(&language, "language", "l", "", "Language identifier, e.g. en-gb, de-de, fr-fr, ...")
+	eventsCollectCmd.Flags().IntVarP(&max, "max", "x", 0, "Maximum number of events to request (default: 10)")
+
+	eventsWatchCmd.Flags().StringVarP(&eventStoreFile, "store", "", "", "Merge the polled events into this event store file")
+
+	eventsHistoryCmd.Flags().StringVarP(&eventStoreFile, "store", "", "", "Event store file (default: ~/.local/share/golrackpi/events.jsonl)")
+	eventsHistoryCmd.Flags().StringVarP(&historySince, "since", "", "", "Show events active since this time (e.g. 2024-01-31, 2024-01-31T12:00:00+01:00 or 30d, 12h ago)")
+	eventsHistoryCmd.Flags().StringVarP(&historyUntil, "until", "", "", "Show events started until this time (same formats as --since)")
+	eventsHistoryCmd.Flags().IntSliceVarP(&historyCodes, "code", "", []int{}, "Show only events with this code (can be repeated)")
+	eventsHistoryCmd.Flags().StringSliceVarP(&historyCategory, "category", "", []string{}, "Show only events of this category (can be repeated)")
+	eventsHistoryCmd.Flags().BoolVarP(&outputCSV, "csv", "c", false, "Set output to CSV format")
+	eventsHistoryCmd.Flags().StringVarP(&delimiter, "delimiter", "d", ",", "Set CSV delimiter (default \",\")")
+
+	eventsCmd.AddCommand(eventsCollectCmd)
+	eventsCmd.AddCommand(eventsHistoryCmd)
+}
+
+var eventsCollectCmd = &cobra.Command{
+	Use: "collect",
+
+	Short: "Merge the latest events into the local event store",
+	Long: `Request the latest events and merge them into the local event store. New events are added, events whose state or end time
+changed are updated. Run this command regularly (e.g. by cron) or use "events watch --store" to keep a history of events.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		collectEvents()
+	},
+}
+
+var eventsHistoryCmd = &cobra.Command{
+	Use: "history",
+
+	Short: "Query the local event store",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		eventsHistory()
+	},
+}
+
+// eventStoreFileName returns the name of the event store file
+func eventStoreFileName() (string, error) {
+	if eventStoreFile != "" {
+		return eventStoreFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "golrackpi", "events.jsonl"), nil
+}
+
+// openEventStore opens the event store file set by --store or the default file
+func openEventStore() (*golrackpi.EventStore, error) {
+	fileName, err := eventStoreFileName()
+	if err != nil {
+		return nil, err
+	}
+	return golrackpi.OpenEventStore(fileName)
+}
+
+// collectEvents merges the latest events into the event store
+func collectEvents() {
+	var outErr io.Writer = os.Stderr
+
+	if fleetMode() {
+		fmt.Fprintln(outErr, "Please select a single inverter and use a separate event store file per inverter.")
+		return
+	}
+
+	store, err := openEventStore()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		events, err := lib.EventsWithParam(language, max)
+		if err != nil {
+			return err
+		}
+		added, updated, err := store.Merge(events)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d event(s) added, %d event(s) updated.\n", added, updated)
+		return nil
+	})
+}
+
+// eventsHistory prints the events of the event store which match the filter flags
+func eventsHistory() {
+	var outErr io.Writer = os.Stderr
+
+	query := golrackpi.EventQuery{Codes: historyCodes, Categories: historyCategory}
+	var err error
+	if query.Since, err = parseTimeArg(historySince); err != nil {
+		fmt.Fprintln(outErr, "Wrong format of --since:", err)
+		return
+	}
+	if query.Until, err = parseTimeArg(historyUntil); err != nil {
+		fmt.Fprintln(outErr, "Wrong format of --until:", err)
+		return
+	}
+
+	store, err := openEventStore()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	if err := writeEvents(os.Stdout, store.Query(query)); err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+	}
+}
+
+// parseTimeArg parses a time argument, which is either a date, a RFC3339 timestamp or a duration before now
+// like "12h" or "30d". An empty string returns the zero time.
+func parseTimeArg(value string) (time.Time, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "ago"))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date, a timestamp nor a duration", value)
+	}
+	return time.Now().Add(-d), nil
+}
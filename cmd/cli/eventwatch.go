@@ -0,0 +1,227 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration = 30 * time.Second
+	watchExec     string        = ""
+	watchWebhook  string        = ""
+)
+
+func init() {
+	eventsWatchCmd.Flags().StringVarP(&language, "language", "l", "", "Language identifier, e.g. en-gb, de-de, fr-fr, ...")
+	eventsWatchCmd.Flags().IntVarP(&max, "max", "x", 0, "Maximum number of events to request (default: 10)")
+	eventsWatchCmd.Flags().DurationVarP(&watchInterval, "interval", "", 30*time.Second, "Polling interval")
+	eventsWatchCmd.Flags().StringVarP(&watchExec, "exec", "e", "", "Command to run for every transition, the event is submitted in GOLRACKPI_* environment variables")
+	eventsWatchCmd.Flags().StringVarP(&watchWebhook, "webhook", "w", "", "URL to send a JSON body with every transition to (HTTP POST)")
+	eventsWatchCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "Print transitions as JSON lines")
+	eventsWatchCmd.Flags().StringVarP(&eventsCatalogFile, "catalog", "", "", "Event catalog file (JSON) which extends the embedded catalog")
+
+	eventsCmd.AddCommand(eventsWatchCmd)
+}
+
+var eventsWatchCmd = &cobra.Command{
+	Use: "watch",
+
+	Short: "Watch events and report raised and cleared events",
+	Long: `Poll the latest events and report a transition when an event is raised or cleared. An event is identified by its code and start time.
+
+For every transition, the command set by --exec is run with the following environment variables:
+  GOLRACKPI_INVERTER, GOLRACKPI_TRANSITION, GOLRACKPI_EVENT_CODE, GOLRACKPI_EVENT_CATEGORY, GOLRACKPI_EVENT_GROUP,
+  GOLRACKPI_EVENT_DESCRIPTION, GOLRACKPI_EVENT_LONG_DESCRIPTION, GOLRACKPI_EVENT_START_TIME, GOLRACKPI_EVENT_END_TIME,
+  GOLRACKPI_EVENT_IS_ACTIVE, GOLRACKPI_EVENT_SEVERITY
+and the URL set by --webhook receives a POST request with a JSON body containing inverter, transition and event.
+The severity is looked up in the embedded event catalog, extended by --catalog.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		watchEvents()
+	},
+}
+
+// webhookPayload specifies the JSON body sent to the webhook
+type webhookPayload struct {
+	Inverter string `json:"inverter"`
+	golrackpi.EventTransition
+}
+
+// watchEvents polls the events until the process is interrupted and handles the transitions
+func watchEvents() {
+	var outErr io.Writer = os.Stderr
+
+	if watchInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit an interval of at least one second.")
+		return
+	}
+	if fleetMode() {
+		fmt.Fprintln(outErr, "Please select a single inverter, events are watched on one inverter.")
+		return
+	}
+	catalog, err := eventCatalog()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	var store *golrackpi.EventStore
+	if eventStoreFile != "" {
+		store, err = golrackpi.OpenEventStore(eventStoreFile)
+		if err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", err)
+			return
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tracker := golrackpi.NewEventTracker()
+	loggedIn := false
+	defer func() {
+		if loggedIn {
+			lib.Logout()
+		}
+	}()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		if !loggedIn {
+			if _, err := lib.Login(); err != nil {
+				fmt.Fprintln(outErr, "An error occurred:", err)
+			} else {
+				loggedIn = true
+			}
+		}
+		if loggedIn {
+			events, err := lib.EventsWithParam(language, max)
+			if err != nil {
+				// the session may be expired, so log in again at the next poll
+				fmt.Fprintln(outErr, "An error occurred:", err)
+				loggedIn = false
+			} else {
+				for _, transition := range tracker.Update(events) {
+					handleTransition(lib.Server, catalog, transition)
+				}
+				if store != nil {
+					if _, _, err := store.Merge(events); err != nil {
+						fmt.Fprintln(outErr, "Could not write event store:", err)
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleTransition prints a transition and runs the hooks
+func handleTransition(inverter string, catalog *golrackpi.EventCatalog, transition golrackpi.EventTransition) {
+	var outErr io.Writer = os.Stderr
+	event := transition.Event
+
+	if outputJSON {
+		b, _ := json.Marshal(webhookPayload{Inverter: inverter, EventTransition: transition})
+		fmt.Println(string(b))
+	} else {
+		fmt.Printf("%s\t%s\t%d\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), transition.Kind, event.Code, event.Category, event.StartTime.Format(time.RFC3339), event.Description)
+	}
+
+	if watchExec != "" {
+		if err := runExecHook(inverter, catalog, transition); err != nil {
+			fmt.Fprintln(outErr, "Hook error:", err)
+		}
+	}
+	if watchWebhook != "" {
+		if err := runWebhook(inverter, transition); err != nil {
+			fmt.Fprintln(outErr, "Webhook error:", err)
+		}
+	}
+}
+
+// runExecHook runs the --exec command with the transition in environment variables
+func runExecHook(inverter string, catalog *golrackpi.EventCatalog, transition golrackpi.EventTransition) error {
+	event := transition.Event
+	entry, _ := catalog.Lookup(event)
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", watchExec)
+	} else {
+		cmd = exec.Command("sh", "-c", watchExec)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GOLRACKPI_INVERTER="+inverter,
+		"GOLRACKPI_TRANSITION="+string(transition.Kind),
+		"GOLRACKPI_EVENT_CODE="+strconv.Itoa(event.Code),
+		"GOLRACKPI_EVENT_CATEGORY="+string(event.Category),
+		"GOLRACKPI_EVENT_GROUP="+string(event.Group),
+		"GOLRACKPI_EVENT_DESCRIPTION="+event.Description,
+		"GOLRACKPI_EVENT_LONG_DESCRIPTION="+event.LongDescription,
+		"GOLRACKPI_EVENT_START_TIME="+formatEventTime(event.StartTime.Time),
+		"GOLRACKPI_EVENT_END_TIME="+formatEventTime(event.EndTime.Time),
+		"GOLRACKPI_EVENT_IS_ACTIVE="+strconv.FormatBool(event.IsActive),
+		"GOLRACKPI_EVENT_SEVERITY="+entry.Severity.String(),
+	)
+	return cmd.Run()
+}
+
+// runWebhook sends the transition as JSON body to the --webhook URL
+func runWebhook(inverter string, transition golrackpi.EventTransition) error {
+	b, err := json.Marshal(webhookPayload{Inverter: inverter, EventTransition: transition})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Post(watchWebhook, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New("webhook returned with http error " + response.Status)
+	}
+	return nil
+}
+
+// formatEventTime returns the time in RFC3339 format, or an empty string if it's not set
+func formatEventTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,387 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exporterListen   string        = ":9678"
+	exporterMode     string        = "scrape"
+	exporterInterval time.Duration = 30 * time.Second
+)
+
+func init() {
+	exporterCmd.Flags().StringVarP(&exporterListen, "listen", "", ":9678", "Address to serve the /metrics endpoint on")
+	exporterCmd.Flags().StringArrayVarP(&pollIds, "ids", "", []string{}, "Process-data ids to export in the format moduleid|processdataid,processdataid (can be repeated, default: all process-data)")
+	exporterCmd.Flags().BoolVarP(&pollStatistics, "statistics", "", true, "Export the counters of "+statisticModule)
+	exporterCmd.Flags().BoolVarP(&pollEvents, "events", "", true, "Export the number of active events per category")
+	exporterCmd.Flags().StringVarP(&exporterMode, "mode", "", "scrape", "Collect the values on every scrape (\"scrape\") or poll them in the background and serve the latest values (\"cached\")")
+	exporterCmd.Flags().DurationVarP(&exporterInterval, "interval", "", 30*time.Second, "Polling interval in cached mode")
+
+	rootCmd.AddCommand(exporterCmd)
+}
+
+var exporterCmd = &cobra.Command{
+	Use: "exporter",
+
+	Short: "Serve the inverter values as Prometheus metrics",
+	Long: `Serve a /metrics endpoint in the Prometheus text format. The configured process-data values, the counters of the energy flow statistics
+and the number of active events are requested through one long-lived session per inverter.
+
+Metric names are built from the process-data id and the unit, e.g. the id "P" of module "devices:local:ac" with unit "W" becomes
+golrackpi_p_watts{inverter="...",module="devices:local:ac"}. The ":Total" values of the statistics are exported as counters.
+With --fleet or --tag, all selected inverters are exported with their name as inverter label.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runExporter()
+	},
+}
+
+// unitSuffixes maps the units returned by the inverter to the base unit suffixes of Prometheus metric names
+var unitSuffixes = map[string]string{
+	"W":   "watts",
+	"Wh":  "watt_hours",
+	"kWh": "kilowatt_hours",
+	"VA":  "volt_amperes",
+	"var": "volt_amperes_reactive",
+	"V":   "volts",
+	"A":   "amperes",
+	"Ah":  "ampere_hours",
+	"Hz":  "hertz",
+	"%":   "percent",
+	"°C":  "celsius",
+	"s":   "seconds",
+	"min": "minutes",
+	"h":   "hours",
+	"g":   "grams",
+	"kg":  "kilograms",
+}
+
+// metricSample specifies a single value of a metric
+type metricSample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels [][2]string
+	Value  float64
+}
+
+// exporterTarget specifies an inverter which is exported with the latest collected samples in cached mode
+type exporterTarget struct {
+	*pollTarget
+
+	mu     sync.Mutex
+	cached []metricSample
+}
+
+// runExporter serves the metrics endpoint until the process is interrupted
+func runExporter() {
+	var outErr io.Writer = os.Stderr
+
+	if exporterMode != "scrape" && exporterMode != "cached" {
+		fmt.Fprintln(outErr, "Please submit \"scrape\" or \"cached\" as mode.")
+		return
+	}
+	if exporterMode == "cached" && exporterInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit an interval of at least one second.")
+		return
+	}
+
+	inverters, err := pollTargets()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	var targets []*exporterTarget
+	for _, inverter := range inverters {
+		targets = append(targets, &exporterTarget{pollTarget: inverter})
+		defer inverter.Session.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if exporterMode == "cached" {
+		for _, target := range targets {
+			go target.poll(ctx)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var samples []metricSample
+		if exporterMode == "cached" {
+			for _, target := range targets {
+				samples = append(samples, target.latest()...)
+			}
+		} else {
+			samples = collectTargets(targets)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, samples)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `<html><head><title>golrackpi exporter</title></head><body><a href="/metrics">Metrics</a></body></html>`)
+	})
+
+	server := &http.Server{Addr: exporterListen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintln(outErr, "Serving metrics on", exporterListen+"/metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+	}
+}
+
+// collectTargets collects the samples of all targets concurrently
+func collectTargets(targets []*exporterTarget) []metricSample {
+	results := make([][]metricSample, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *exporterTarget) {
+			defer wg.Done()
+			results[i] = target.collect()
+		}(i, target)
+	}
+	wg.Wait()
+
+	var samples []metricSample
+	for _, result := range results {
+		samples = append(samples, result...)
+	}
+	return samples
+}
+
+// poll collects the samples of the target in the background until ctx is cancelled
+func (t *exporterTarget) poll(ctx context.Context) {
+	ticker := time.NewTicker(exporterInterval)
+	defer ticker.Stop()
+	for {
+		samples := t.collect()
+		t.mu.Lock()
+		t.cached = samples
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// latest returns the samples of the last poll
+func (t *exporterTarget) latest() []metricSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cached
+}
+
+// collect requests all values of the target and returns them as samples, including the up and duration samples
+func (t *exporterTarget) collect() []metricSample {
+	start := time.Now()
+	var samples []metricSample
+	err := t.Session.Do(func(client *golrackpi.AuthClient) error {
+		var err error
+		samples, err = t.collectValues(client)
+		return err
+	})
+	up := 1.0
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] An error occurred: %v\n", t.Name, err)
+		samples = nil
+		up = 0
+	}
+
+	labels := [][2]string{{"inverter", t.Name}}
+	return append(samples,
+		metricSample{Name: "golrackpi_up", Help: "Whether the last collection of the inverter values was successful.", Type: "gauge", Labels: labels, Value: up},
+		metricSample{Name: "golrackpi_collect_duration_seconds", Help: "Duration of the last collection of the inverter values.", Type: "gauge", Labels: labels, Value: time.Since(start).Seconds()},
+	)
+}
+
+// collectValues requests the process-data values, statistics and events with a logged in client
+func (t *exporterTarget) collectValues(client *golrackpi.AuthClient) ([]metricSample, error) {
+	ids, err := t.processDataIds(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []metricSample
+	values, err := requestValues(client, ids, pollStatistics)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range values {
+		for _, value := range module.ProcessData {
+			if sample, ok := processDataSample(t.Name, module.ModuleId, value); ok {
+				samples = append(samples, sample)
+			}
+		}
+	}
+
+	if pollEvents {
+		events, err := client.Events()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, eventSamples(t.Name, events)...)
+	}
+	return samples, nil
+}
+
+// processDataSample returns the sample of a process-data value. The second return value is false for non-numeric values.
+func processDataSample(inverter string, moduleId string, value golrackpi.ProcessDataValue) (metricSample, bool) {
+	number, ok := numericValue(value.Value)
+	if !ok {
+		return metricSample{}, false
+	}
+
+	name := metricName(value.Id, value.Unit)
+	metricType := "gauge"
+	if moduleId == statisticModule && strings.HasSuffix(value.Id, ":Total") {
+		name += "_total"
+		metricType = "counter"
+	}
+	help := "Process-data value " + value.Id
+	if value.Unit != "" {
+		help += " in " + value.Unit
+	}
+	return metricSample{
+		Name:   name,
+		Help:   help + ".",
+		Type:   metricType,
+		Labels: [][2]string{{"inverter", inverter}, {"module", moduleId}},
+		Value:  number,
+	}, true
+}
+
+// eventSamples returns the number of active events per category. The known categories are always exported, so the series don't disappear.
+func eventSamples(inverter string, events []golrackpi.EventData) []metricSample {
+	counts := map[golrackpi.EventCategory]int{
+		golrackpi.EventCategoryInfo:    0,
+		golrackpi.EventCategoryWarning: 0,
+		golrackpi.EventCategoryError:   0,
+	}
+	for _, event := range events {
+		if event.IsActive {
+			counts[event.Category.Normalize()]++
+		}
+	}
+
+	var samples []metricSample
+	for category, count := range counts {
+		samples = append(samples, metricSample{
+			Name:   "golrackpi_events_active",
+			Help:   "Number of active events per category.",
+			Type:   "gauge",
+			Labels: [][2]string{{"inverter", inverter}, {"category", string(category)}},
+			Value:  float64(count),
+		})
+	}
+	return samples
+}
+
+// metricName returns the Prometheus metric name of a process-data id with the unit as suffix
+func metricName(id string, unit string) string {
+	name := "golrackpi_" + sanitizeMetricName(id)
+	if unit == "" {
+		return name
+	}
+	suffix, found := unitSuffixes[unit]
+	if !found {
+		suffix = sanitizeMetricName(unit)
+	}
+	if suffix == "" || strings.HasSuffix(name, "_"+suffix) {
+		return name
+	}
+	return name + "_" + suffix
+}
+
+// sanitizeMetricName converts a string to lower case and replaces all characters which are not allowed in metric names by underscores
+func sanitizeMetricName(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// writeMetrics writes the samples in the Prometheus text format, grouped by metric name
+func writeMetrics(w io.Writer, samples []metricSample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return formatLabels(samples[i].Labels) < formatLabels(samples[j].Labels)
+	})
+
+	lastName := ""
+	for _, sample := range samples {
+		if sample.Name != lastName {
+			fmt.Fprintf(w, "# HELP %s %s\n", sample.Name, escapeHelp(sample.Help))
+			fmt.Fprintf(w, "# TYPE %s %s\n", sample.Name, sample.Type)
+			lastName = sample.Name
+		}
+		fmt.Fprintf(w, "%s%s %s\n", sample.Name, formatLabels(sample.Labels), strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	}
+}
+
+// formatLabels returns the labels in the Prometheus text format
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = label[0] + `="` + escapeLabelValue(label[1]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds of a label value
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// escapeHelp escapes backslashes and line feeds of a help text
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,267 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/cassette"
+)
+
+// inverterConfig specifies an inverter entry of the configuration file
+type inverterConfig struct {
+	Name     string   `json:"name"`
+	Server   string   `json:"server"`
+	Scheme   string   `json:"scheme"`
+	Password string   `json:"password"`
+	Tags     []string `json:"tags"`
+	TimeZone string   `json:"timezone"`
+}
+
+// cliConfig specifies the structure of the configuration file
+type cliConfig struct {
+	Inverters     []inverterConfig `json:"inverters"`
+	MaxConcurrent int              `json:"max_concurrent"`
+}
+
+var (
+	configFile       string   = ""
+	selectFleet      bool     = false
+	selectTags       []string = []string{}
+	selectedInverter string   = ""
+	inverterTimeZone string   = ""
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "", "", "Configuration file with the list of inverters (default: $XDG_CONFIG_HOME/golrackpi/config.json)")
+	rootCmd.PersistentFlags().BoolVarP(&selectFleet, "fleet", "", false, "Run command against all inverters of the configuration file")
+	rootCmd.PersistentFlags().StringSliceVarP(&selectTags, "tag", "", []string{}, "Run command against all inverters of the configuration file with this tag (can be repeated)")
+	rootCmd.PersistentFlags().StringVarP(&inverterTimeZone, "timezone", "", "", "Time zone of the inverter's times, e.g. Europe/Berlin, Local or UTC+01:00 (default: time zone configured on the inverter, otherwise UTC)")
+	rootCmd.PersistentFlags().StringVarP(&selectedInverter, "inverter", "i", "", "Use the inverter with this name from the configuration file instead of --server and --password")
+}
+
+// configFileName returns the name of the configuration file
+func configFileName() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "golrackpi", "config.json"), nil
+}
+
+// loadConfig reads the configuration file
+func loadConfig() (cliConfig, error) {
+	var config cliConfig
+	fileName, err := configFileName()
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return config, fmt.Errorf("could not read configuration file: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("could not parse configuration file %s: %w", fileName, err)
+	}
+	return config, nil
+}
+
+// clientFromConfig returns a new client instance with the connection settings of an inverter entry.
+// The --timezone flag takes precedence over the time zone of the entry. An invalid time zone returns an error.
+func clientFromConfig(inverter inverterConfig) (*golrackpi.AuthClient, error) {
+	client := golrackpi.NewWithParameter(golrackpi.AuthClient{
+		Scheme:   inverter.Scheme,
+		Server:   inverter.Server,
+		Password: inverter.Password,
+	})
+	if trafficClient != nil {
+		client.HTTPClient = trafficClient
+		if replayFile != "" {
+			client.Password = cassette.ReplayPassword
+		}
+	}
+	if inverterTimeZone != "" {
+		loc, err := golrackpi.ParseTimeZone(inverterTimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --timezone: %w", err)
+		}
+		client.SetLocation(loc)
+	} else if inverter.TimeZone != "" {
+		loc, err := golrackpi.ParseTimeZone(inverter.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone of inverter %s in configuration file: %w", inverter.Name, err)
+		}
+		client.SetLocation(loc)
+	}
+	return client, nil
+}
+
+// configInverter returns the inverter entry of the configuration file with the submitted name
+func configInverter(name string) (inverterConfig, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return inverterConfig{}, err
+	}
+	for _, inverter := range config.Inverters {
+		if inverter.Name == name {
+			return inverter, nil
+		}
+	}
+	return inverterConfig{}, fmt.Errorf("inverter %q not found in configuration file", name)
+}
+
+// fleetMode returns true if the command should be executed against several inverters of the configuration file
+func fleetMode() bool {
+	return selectFleet || len(selectTags) > 0
+}
+
+// loadFleet returns a fleet of all inverters from the configuration file which match the --fleet and --tag selectors
+func loadFleet() (*golrackpi.Fleet, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	fleet := golrackpi.NewFleet()
+	fleet.MaxConcurrent = config.MaxConcurrent
+	for _, inverter := range config.Inverters {
+		if inverter.Name == "" {
+			return nil, errors.New("configuration file contains an inverter without name")
+		}
+		if _, found := fleet.Inverter(inverter.Name); found {
+			return nil, fmt.Errorf("inverter name %q is not unique in configuration file", inverter.Name)
+		}
+		client, err := clientFromConfig(inverter)
+		if err != nil {
+			return nil, err
+		}
+		fleet.Add(inverter.Name, client, inverter.Tags...)
+	}
+	fleet = fleet.Select(selectTags...)
+	if len(fleet.Inverters) == 0 {
+		return nil, errors.New("no inverter matches the selection")
+	}
+	return fleet, nil
+}
+
+// newClient returns a client instance for a single inverter, either selected by --inverter from the configuration file or
+// defined by the --server, --password and --scheme flags.
+func newClient() (*golrackpi.AuthClient, error) {
+	if selectedInverter != "" {
+		inverter, err := configInverter(selectedInverter)
+		if err != nil {
+			return nil, err
+		}
+		return clientFromConfig(inverter)
+	}
+	if authData.Server == "" || authData.Password == "" {
+		return nil, errors.New("required flag(s) \"password\", \"server\" not set (or use --inverter, --fleet or --tag with a configuration file)")
+	}
+	return clientFromConfig(inverterConfig{
+		Name:     authData.Server,
+		Scheme:   authData.Scheme,
+		Server:   authData.Server,
+		Password: authData.Password,
+	})
+}
+
+// runRead executes a read command. In single inverter mode, fn is called with a logged in client and the output writer
+// (os.Stdout or the file set by --output-file). In fleet mode, fn is called concurrently for every selected inverter and the output
+// is written labelled per inverter after all requests are finished.
+func runRead(fn func(lib *golrackpi.AuthClient, w io.Writer) error) {
+	var outErr io.Writer = os.Stderr
+	var w io.Writer
+
+	f, err := getOutFile()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not open file ", outputFile)
+		return
+	}
+	if f != nil {
+		w = f
+		defer closeOutFile(f)
+	} else {
+		w = os.Stdout
+	}
+
+	if !fleetMode() {
+		lib, err := newClient()
+		if err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", err)
+			return
+		}
+		_, err = lib.Login()
+		if err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", err)
+			return
+		}
+		defer lib.Logout()
+
+		if err := fn(lib, w); err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", err)
+		}
+		return
+	}
+
+	fleet, err := loadFleet()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	outputs := make(map[string]*bytes.Buffer)
+	for _, name := range fleet.Names() {
+		outputs[name] = &bytes.Buffer{}
+	}
+	results := fleet.Run(func(name string, client *golrackpi.AuthClient) error {
+		return fn(client, outputs[name])
+	})
+
+	headerWritten := false
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(outErr, "[%s] An error occurred: %v\n", result.Name, result.Err)
+			continue
+		}
+		writeLabelled(w, result.Name, outputs[result.Name], headerWritten)
+		headerWritten = true
+	}
+}
+
+// writeLabelled writes the output of one inverter. In CSV mode, every line is prefixed with the inverter name as additional column and
+// the headline is written only once. Otherwise, the output is written as block below a line with the inverter name.
+func writeLabelled(w io.Writer, name string, output io.Reader, headerWritten bool) {
+	if !outputCSV {
+		fmt.Fprintf(w, "==> %s <==\n", name)
+		io.Copy(w, output)
+		fmt.Fprintln(w)
+		return
+	}
+
+	scanner := bufio.NewScanner(output)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first && !outputNoHeaders {
+			first = false
+			if !headerWritten {
+				fmt.Fprintf(w, "Inverter%s%s\n", delimiter, line)
+			}
+			continue
+		}
+		first = false
+		fmt.Fprintf(w, "%s%s%s\n", name, delimiter, line)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestClientFromConfig(t *testing.T) {
+	saved := inverterTimeZone
+	defer func() { inverterTimeZone = saved }()
+
+	tests := []struct {
+		flag, entry string
+		fails       bool
+	}{
+		{"", "", false},
+		{"", "Europe/Berlin", false},
+		{"UTC+01:00", "Invalid/Zone", false},
+		{"", "Invalid/Zone", true},
+		{"Invalid/Zone", "Europe/Berlin", true},
+	}
+	for _, test := range tests {
+		inverterTimeZone = test.flag
+		client, err := clientFromConfig(inverterConfig{Name: "roof", Server: "192.168.1.10", TimeZone: test.entry})
+		if (err != nil) != test.fails {
+			t.Errorf("--timezone %q, entry %q: got %v", test.flag, test.entry, err)
+		}
+		if err == nil && client.Server != "192.168.1.10" {
+			t.Errorf("wrong server %q", client.Server)
+		}
+	}
+}
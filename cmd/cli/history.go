@@ -0,0 +1,359 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyDatabase  string        = ""
+	recordInterval   time.Duration = 30 * time.Second
+	retentionRaw     string        = "7d"
+	retentionMinute  string        = "30d"
+	retentionQuarter string        = "365d"
+	retentionDaily   string        = "0"
+	queryInverter    string        = ""
+	queryModule      string        = ""
+	queryId          string        = ""
+	queryResolution  string        = "raw"
+	querySummary     bool          = false
+)
+
+// maintainInterval is the interval to calculate the aggregates and delete old samples while recording
+const maintainInterval = 5 * time.Minute
+
+func init() {
+	recordCmd.Flags().StringVarP(&historyDatabase, "db", "", "", "SQLite database file (default: ~/.local/share/golrackpi/history.db)")
+	recordCmd.Flags().DurationVarP(&recordInterval, "interval", "", 30*time.Second, "Polling interval")
+	recordCmd.Flags().StringVarP(&retentionRaw, "retention-raw", "", "7d", "Retention of the raw samples, e.g. 7d or 48h (0: keep forever)")
+	recordCmd.Flags().StringVarP(&retentionMinute, "retention-1m", "", "30d", "Retention of the 1-minute aggregates (0: keep forever)")
+	recordCmd.Flags().StringVarP(&retentionQuarter, "retention-15m", "", "365d", "Retention of the 15-minute aggregates (0: keep forever)")
+	recordCmd.Flags().StringVarP(&retentionDaily, "retention-1d", "", "0", "Retention of the daily aggregates (0: keep forever)")
+	recordCmd.Flags().StringArrayVarP(&pollIds, "ids", "", []string{}, "Process-data ids to record in the format moduleid|processdataid,processdataid (can be repeated, default: all process-data)")
+	recordCmd.Flags().BoolVarP(&pollStatistics, "statistics", "", true, "Record the values of "+statisticModule)
+
+	queryCmd.Flags().StringVarP(&historyDatabase, "db", "", "", "SQLite database file (default: ~/.local/share/golrackpi/history.db)")
+	queryCmd.Flags().StringVarP(&queryInverter, "inverter-name", "", "", "Pattern of the inverter name, e.g. roof-*")
+	queryCmd.Flags().StringVarP(&queryModule, "module", "", "", "Pattern of the module id, e.g. devices:local:*")
+	queryCmd.Flags().StringVarP(&queryId, "id", "", "", "Pattern of the process-data id, e.g. Statistic:Yield:*")
+	queryCmd.Flags().StringVarP(&historySince, "since", "", "", "Return samples since this time (e.g. 2024-01-31, 2024-01-31T12:00:00+01:00 or 30d, 12h ago)")
+	queryCmd.Flags().StringVarP(&historyUntil, "until", "", "", "Return samples until this time (same formats as --since)")
+	queryCmd.Flags().StringVarP(&queryResolution, "resolution", "r", "raw", "Resolution of the samples: raw, 1m, 15m or 1d")
+	queryCmd.Flags().BoolVarP(&querySummary, "summary", "", false, "Return one aggregate (min, max, avg, count) per series for the whole range")
+	queryCmd.Flags().BoolVarP(&outputCSV, "csv", "c", false, "Set output to CSV format")
+	queryCmd.Flags().StringVarP(&delimiter, "delimiter", "d", ",", "Set CSV delimiter (default \",\")")
+	queryCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "Set output to JSON format")
+	queryCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write output to file [filename]")
+
+	rootCmd.AddCommand(recordCmd)
+	rootCmd.AddCommand(queryCmd)
+}
+
+var recordCmd = &cobra.Command{
+	Use: "record",
+
+	Short: "Record process data in a local SQLite database",
+	Long: `Poll the process-data values and the energy flow statistics and store them in a local SQLite database. Every few minutes,
+the raw samples are downsampled to 1-minute, 15-minute and daily aggregates (min, max, avg, count), and samples which are older
+than the retention of their resolution are deleted. The days start at midnight in the local time zone or the time zone set by
+--timezone. Use "golrackpi query" to read the samples.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		recordHistory()
+	},
+}
+
+var queryCmd = &cobra.Command{
+	Use: "query",
+
+	Short: "Query the samples of the local SQLite database",
+	Long: `Return the samples recorded by "golrackpi record" in the selected range and resolution. With --summary, one aggregate per series
+is returned for the whole range, e.g. the maximum power of the last month:
+
+  golrackpi query --module devices:local --id Dc_P --since 30d --resolution 15m --summary`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		queryHistory()
+	},
+}
+
+// historyDatabaseName returns the name of the database file set by --db or the default file
+func historyDatabaseName() (string, error) {
+	if historyDatabase != "" {
+		return historyDatabase, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".local", "share", "golrackpi")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// openHistory opens the history database. Its daily aggregates start at midnight in the time zone set by --timezone,
+// otherwise in the local time zone.
+func openHistory(fileName string) (*history.Store, error) {
+	var loc *time.Location
+	if inverterTimeZone != "" {
+		var err error
+		if loc, err = golrackpi.ParseTimeZone(inverterTimeZone); err != nil {
+			return nil, err
+		}
+	}
+	store, err := history.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if loc != nil {
+		store.SetLocation(loc)
+	}
+	return store, nil
+}
+
+// parseRetention parses a retention like "7d", "48h" or "0"
+func parseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("wrong format of retention %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("wrong format of retention %q", value)
+	}
+	return d, nil
+}
+
+// retentionPolicy returns the retention policy set by the flags
+func retentionPolicy() (history.RetentionPolicy, error) {
+	var policy history.RetentionPolicy
+	var err error
+	if policy.Raw, err = parseRetention(retentionRaw); err != nil {
+		return policy, err
+	}
+	if policy.Minute, err = parseRetention(retentionMinute); err != nil {
+		return policy, err
+	}
+	if policy.Quarter, err = parseRetention(retentionQuarter); err != nil {
+		return policy, err
+	}
+	if policy.Daily, err = parseRetention(retentionDaily); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// recordHistory polls the values and stores them until the process is interrupted
+func recordHistory() {
+	var outErr io.Writer = os.Stderr
+
+	if recordInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit an interval of at least one second.")
+		return
+	}
+	policy, err := retentionPolicy()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	fileName, err := historyDatabaseName()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	store, err := openHistory(fileName)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer store.Close()
+
+	targets, err := pollTargets()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	for _, target := range targets {
+		defer target.Session.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(recordInterval)
+	defer ticker.Stop()
+	lastMaintenance := time.Time{}
+	for {
+		recordTargets(store, targets)
+		if time.Since(lastMaintenance) >= maintainInterval {
+			if err := store.Maintain(time.Now(), policy); err != nil {
+				fmt.Fprintln(outErr, "An error occurred:", err)
+			}
+			lastMaintenance = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordTargets polls the values of all targets concurrently and stores them
+func recordTargets(store *history.Store, targets []*pollTarget) {
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *pollTarget) {
+			defer wg.Done()
+			var values []golrackpi.ProcessDataValues
+			err := target.Session.Do(func(client *golrackpi.AuthClient) error {
+				ids, err := target.processDataIds(client)
+				if err != nil {
+					return err
+				}
+				values, err = requestValues(client, ids, pollStatistics)
+				return err
+			})
+			if err == nil {
+				err = store.Insert(target.Name, time.Now(), values)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] An error occurred: %v\n", target.Name, err)
+			}
+		}(target)
+	}
+	wg.Wait()
+}
+
+// queryHistory prints the samples which match the query flags
+func queryHistory() {
+	var outErr io.Writer = os.Stderr
+
+	resolution, err := history.ParseResolution(queryResolution)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	query := history.Query{Inverter: queryInverter, ModuleId: queryModule, Id: queryId, Resolution: resolution}
+	if query.From, err = parseTimeArg(historySince); err != nil {
+		fmt.Fprintln(outErr, "Wrong format of --since:", err)
+		return
+	}
+	if query.To, err = parseTimeArg(historyUntil); err != nil {
+		fmt.Fprintln(outErr, "Wrong format of --until:", err)
+		return
+	}
+
+	fileName, err := historyDatabaseName()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	store, err := openHistory(fileName)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer store.Close()
+
+	samples, err := store.Query(query)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	if querySummary {
+		samples = history.Summarize(samples)
+	}
+
+	var w io.Writer = os.Stdout
+	f, err := getOutFile()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not open file ", outputFile)
+		return
+	}
+	if f != nil {
+		w = f
+		defer closeOutFile(f)
+	}
+	if err := writeSamples(w, samples); err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+	}
+}
+
+// writeSamples writes the samples in the output format set by the flags
+func writeSamples(w io.Writer, samples []history.Sample) error {
+	if outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(samples)
+	}
+
+	if outputCSV {
+		if !outputNoHeaders {
+			fmt.Fprintln(w, strings.Join([]string{"Time", "Inverter", "Module", "Processdata Id", "Unit", "Min", "Max", "Avg", "Count"}, delimiter))
+		}
+		for _, sample := range samples {
+			fmt.Fprintln(w, strings.Join([]string{
+				sample.Time.Format(time.RFC3339), sample.Inverter, sample.ModuleId, sample.Id, sample.Unit,
+				formatSampleValue(sample.Min), formatSampleValue(sample.Max), formatSampleValue(sample.Avg), strconv.FormatInt(sample.Count, 10),
+			}, delimiter))
+		}
+		return nil
+	}
+
+	var last history.Series
+	for i, sample := range samples {
+		if i == 0 || sample.Series != last {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s %s %s (%s)\n", sample.Inverter, sample.ModuleId, sample.Id, sample.Unit)
+			fmt.Fprintln(w, "Time\t\t\t\tMin\tMax\tAvg\tCount")
+			last = sample.Series
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", sample.Time.Format(time.RFC3339), formatSampleValue(sample.Min), formatSampleValue(sample.Max), formatSampleValue(sample.Avg), sample.Count)
+	}
+	return nil
+}
+
+// formatSampleValue returns the value with at most three decimals
+func formatSampleValue(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
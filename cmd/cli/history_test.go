@@ -0,0 +1,45 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/history"
+)
+
+func TestOpenHistory(t *testing.T) {
+	saved := inverterTimeZone
+	defer func() { inverterTimeZone = saved }()
+
+	inverterTimeZone = "Invalid/Zone"
+	if store, err := openHistory(filepath.Join(t.TempDir(), "history.db")); err == nil {
+		store.Close()
+		t.Error("invalid --timezone accepted")
+	}
+
+	inverterTimeZone = "Europe/Berlin"
+	store, err := openHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Unix(time.Now().Unix(), 0)
+	values := []golrackpi.ProcessDataValues{{ModuleId: "devices:local", ProcessData: []golrackpi.ProcessDataValue{{Id: "Dc_P", Unit: "W", Value: 1500.0}}}}
+	if err := store.Insert("roof", now, values); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := store.Query(history.Query{Resolution: history.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Id != "Dc_P" || samples[0].Avg != 1500 || !samples[0].Time.Equal(now) {
+		t.Errorf("got %+v", samples)
+	}
+}
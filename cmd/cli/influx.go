@@ -0,0 +1,209 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/influx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	influxConfig        influx.Config = influx.Config{}
+	influxInterval      time.Duration = 30 * time.Second
+	influxFlushInterval time.Duration = time.Minute
+	influxOnce          bool          = false
+)
+
+func init() {
+	influxWriteFlags(influxCmd)
+	influxCmd.Flags().DurationVarP(&influxInterval, "interval", "", 30*time.Second, "Polling interval")
+	influxCmd.Flags().DurationVarP(&influxFlushInterval, "flush-interval", "", time.Minute, "Interval to write the collected lines to the server")
+	influxCmd.Flags().BoolVarP(&influxOnce, "once", "", false, "Poll the values only once and exit, e.g. when called by cron")
+	influxCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write line protocol to file [filename] instead of stdout (without --url)")
+	influxCmd.Flags().BoolVarP(&outputAppend, "append", "a", false, "Append output to file (default: overwrite content)")
+	influxCmd.Flags().StringArrayVarP(&pollIds, "ids", "", []string{}, "Process-data ids to write in the format moduleid|processdataid,processdataid (can be repeated, default: all process-data)")
+	influxCmd.Flags().BoolVarP(&pollStatistics, "statistics", "", true, "Write the values of "+statisticModule)
+
+	rootCmd.AddCommand(influxCmd)
+}
+
+// influxWriteFlags adds the flags of the InfluxDB write endpoint to the command
+func influxWriteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&influxConfig.URL, "url", "", "", "Base URL of the InfluxDB server, e.g. http://localhost:8086 (default: write line protocol to stdout or --output-file)")
+	cmd.Flags().IntVarP(&influxConfig.Version, "api-version", "", 2, "API version of the InfluxDB server (1 or 2)")
+	cmd.Flags().StringVarP(&influxConfig.Database, "database", "", "", "Database (InfluxDB 1.x)")
+	cmd.Flags().StringVarP(&influxConfig.RetentionPolicy, "retention-policy", "", "", "Retention policy (InfluxDB 1.x)")
+	cmd.Flags().StringVarP(&influxConfig.Username, "influx-username", "", "", "Username (InfluxDB 1.x)")
+	cmd.Flags().StringVarP(&influxConfig.Password, "influx-password", "", "", "Password (InfluxDB 1.x)")
+	cmd.Flags().StringVarP(&influxConfig.Org, "org", "", "", "Organization (InfluxDB 2.x)")
+	cmd.Flags().StringVarP(&influxConfig.Bucket, "bucket", "", "", "Bucket (InfluxDB 2.x)")
+	cmd.Flags().StringVarP(&influxConfig.Token, "token", "", "", "API token (InfluxDB 2.x, default: $INFLUX_TOKEN)")
+	cmd.Flags().IntVarP(&influxConfig.BatchSize, "batch-size", "", 5000, "Maximum number of lines per write request")
+	cmd.Flags().IntVarP(&influxConfig.MaxRetries, "retries", "", 3, "Number of retries of a failed write request, with exponential backoff")
+	cmd.Flags().StringVarP(&influxConfig.BufferFile, "buffer", "", "", "File to keep the lines in while the server is unreachable or refuses the requests (default: drop them)")
+}
+
+var influxCmd = &cobra.Command{
+	Use: "influx",
+
+	Short: "Write process data in InfluxDB line protocol",
+	Long: `Poll the process-data values and the energy flow statistics and write them in InfluxDB line protocol. The module id is used as
+measurement, the process-data ids as fields, name and serial number of the inverter as tags, with a timestamp in nanoseconds.
+
+Without --url, the lines are written to stdout or the file set by --output-file. With --url, the lines are collected and sent in
+batches to the write endpoint of InfluxDB 1.x (--api-version 1 --database ...) or 2.x (--org ... --bucket ... --token ...).
+Failed requests are retried; if the server is still unreachable or refuses the requests, e.g. because of a wrong token, the lines are
+kept in the --buffer file and sent later. Lines rejected as invalid are dropped.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runInflux()
+	},
+}
+
+// runInflux polls the values and writes them to the sink until the process is interrupted
+func runInflux() {
+	var outErr io.Writer = os.Stderr
+
+	if influxInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit an interval of at least one second.")
+		return
+	}
+
+	sink, err := newInfluxSink()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintln(outErr, "Write error:", err)
+		}
+	}()
+
+	targets, err := pollTargets()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	for _, target := range targets {
+		defer target.Session.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pollTicker := time.NewTicker(influxInterval)
+	defer pollTicker.Stop()
+	flushTicker := time.NewTicker(influxFlushInterval)
+	defer flushTicker.Stop()
+	for {
+		if err := sink.Write(influxPoints(targets)); err != nil {
+			fmt.Fprintln(outErr, "Write error:", err)
+		}
+		if influxOnce {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushTicker.C:
+			if err := sink.Flush(); err != nil {
+				fmt.Fprintln(outErr, "Write error:", err)
+			}
+		case <-pollTicker.C:
+		}
+	}
+}
+
+// newInfluxSink returns the sink set by the flags, i.e. the write endpoint of InfluxDB or stdout or a file
+func newInfluxSink() (influx.Sink, error) {
+	if influxConfig.URL != "" {
+		config := influxConfig
+		if config.Token == "" {
+			config.Token = os.Getenv("INFLUX_TOKEN")
+		}
+		if config.MaxRetries == 0 {
+			config.MaxRetries = -1
+		}
+		return influx.NewWriter(config)
+	}
+
+	f, err := getOutFile()
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		return influx.NewLineWriter(f), nil
+	}
+	return influx.NewLineWriter(os.Stdout), nil
+}
+
+// influxPoints polls the values of all targets concurrently and returns them as points. Errors are printed per inverter.
+func influxPoints(targets []*pollTarget) []influx.Point {
+	results := make([][]influx.Point, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *pollTarget) {
+			defer wg.Done()
+			points, err := target.points()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] An error occurred: %v\n", target.Name, err)
+			}
+			results[i] = points
+		}(i, target)
+	}
+	wg.Wait()
+
+	var points []influx.Point
+	for _, result := range results {
+		points = append(points, result...)
+	}
+	return points
+}
+
+// points requests the values of the target and returns one point per module
+func (t *pollTarget) points() ([]influx.Point, error) {
+	var values []golrackpi.ProcessDataValues
+	err := t.Session.Do(func(client *golrackpi.AuthClient) error {
+		t.deviceInfo(client)
+		ids, err := t.processDataIds(client)
+		if err != nil {
+			return err
+		}
+		values, err = requestValues(client, ids, pollStatistics)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	serial, _ := t.device()
+	tags := map[string]string{"inverter": t.Name, "serial": serial}
+	var points []influx.Point
+	for _, module := range values {
+		point := influx.Point{Measurement: module.ModuleId, Tags: tags, Fields: make(map[string]interface{}), Time: now}
+		for _, value := range module.ProcessData {
+			point.Fields[value.Id] = value.Value
+		}
+		if len(point.Fields) > 0 {
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
@@ -6,8 +6,11 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/api"
 	"github.com/spf13/cobra"
 )
 
@@ -69,68 +72,39 @@ var checkLoginLogoutCmd = &cobra.Command{
 
 // infoVersion prints information about the API (i.e. hostname, api version...)
 func infoVersion() {
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		info, err := lib.Version()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "name: %s\nhostname: %s\nsw_version: %s\napi_version: %s\n", info.Name, info.Hostname, info.SwVersion, info.ApiVersion)
+		return nil
 	})
-
-	_, err := lib.Login()
-
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	info, err := lib.Version()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-
-	for k, v := range info {
-		fmt.Printf("%s: %v\n", k, v)
-	}
-
 }
 
 // infoMe prints information about the user
 func infoMe() {
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		info, err := lib.Me()
+		if err != nil {
+			return err
+		}
+
+		printMe(w, info)
+		return nil
 	})
+}
 
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	info, err := lib.Me()
+// checkLoginLogout checks login and logout process. It prints information from the "me" request with values about the user after login and logout.
+func checkLoginLogout() {
+	lib, err := newClient()
 	if err != nil {
 		fmt.Println("An error occurred:", err)
 		return
 	}
 
-	for k, v := range info {
-		fmt.Printf("%s: %v\n", k, v)
-	}
-
-}
-
-// checkLoginLogout checks login and logout process. It prints information from the "me" request with values about the user after login and logout.
-func checkLoginLogout() {
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
-
-	_, err := lib.Login()
+	_, err = lib.Login()
 
 	if err != nil {
 		fmt.Println("An error occurred:", err)
@@ -145,9 +119,7 @@ func checkLoginLogout() {
 		return
 	}
 
-	for k, v := range info {
-		fmt.Printf("%s: %v\n", k, v)
-	}
+	printMe(os.Stdout, info)
 
 	_, err = lib.Logout()
 
@@ -163,10 +135,13 @@ func checkLoginLogout() {
 		return
 	}
 
-	for k, v := range info {
-		fmt.Printf("%s: %v\n", k, v)
-	}
+	printMe(os.Stdout, info)
+
+}
 
+// printMe prints the information about the user
+func printMe(w io.Writer, info api.MeInfo) {
+	fmt.Fprintf(w, "authenticated: %v\nanonymous: %v\nrole: %s\nactive: %v\nlocked: %v\npermissions: %v\n", info.Authenticated, info.Anonymous, info.Role, info.Active, info.Locked, info.Permissions)
 }
 
 // Handle info-related commands
@@ -0,0 +1,281 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/history"
+	"github.com/geschke/golrackpi/influx"
+	"github.com/spf13/cobra"
+)
+
+// logDataModule is used as module id of the log data columns in the history database and as measurement in InfluxDB
+const logDataModule = "logdata"
+
+var (
+	logDataSince   string = ""
+	logDataUntil   string = ""
+	logDataFormat  string = "csv"
+	logDataHistory bool   = false
+)
+
+func init() {
+	logDataExportCmd.Flags().StringVarP(&logDataSince, "since", "", "", "First day of the log data (e.g. 2024-01-31 or 30d)")
+	logDataExportCmd.Flags().StringVarP(&logDataUntil, "until", "", "", "Last day of the log data (same formats as --since, default: today)")
+	logDataExportCmd.Flags().StringVarP(&logDataFormat, "format", "f", "csv", "Output format: csv, jsonl or influx (InfluxDB line protocol)")
+	logDataExportCmd.Flags().StringVarP(&delimiter, "delimiter", "d", ",", "Set CSV delimiter (default \",\")")
+	logDataExportCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write output to file [filename]")
+	logDataExportCmd.Flags().BoolVarP(&outputAppend, "append", "a", false, "Append output to file (default: overwrite content)")
+	logDataExportCmd.Flags().BoolVarP(&logDataHistory, "history", "", false, "Store the values in the local SQLite database instead of writing them (together with --format: in addition)")
+	logDataExportCmd.Flags().StringVarP(&historyDatabase, "db", "", "", "SQLite database file for --history (default: ~/.local/share/golrackpi/history.db)")
+	influxWriteFlags(logDataExportCmd)
+	logDataExportCmd.MarkFlagRequired("since")
+
+	rootCmd.AddCommand(logDataCmd)
+	logDataCmd.AddCommand(logDataExportCmd)
+}
+
+var logDataCmd = &cobra.Command{
+	Use: "logdata",
+
+	Short: "Export the log data of the inverter",
+	//Long:  ``,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		handleLogData()
+	},
+}
+
+var logDataExportCmd = &cobra.Command{
+	Use: "export",
+
+	Short: "Download the log data of a range of days and write them as CSV, JSONL or InfluxDB line protocol",
+	Long: `Download the log data of the inverter, which contain the values of the DC inputs, AC phases, home consumption and battery
+in 5-minute resolution, for the days from --since to --until. The inverter keeps the log data for a limited time only.
+
+The values are written as CSV with one column per value and the unit in the headline, as JSONL with one line per value,
+or in InfluxDB line protocol with the measurement "logdata" (with --url to the write endpoint of InfluxDB, see "golrackpi influx").
+With --history, the values are stored in the local SQLite database of "golrackpi record" with the module id "logdata",
+so the history from before the recording started can be recovered:
+
+  golrackpi logdata export --since 2024-01-01 --until 2024-01-31 --history`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		exportLogData(cmd.Flags().Changed("format"))
+	},
+}
+
+// exportLogData downloads the log data and writes them in the selected format and into the history database
+func exportLogData(formatSet bool) {
+	var outErr io.Writer = os.Stderr
+
+	if fleetMode() {
+		fmt.Fprintln(outErr, "Please select a single inverter for the log data export, e.g. with --inverter.")
+		return
+	}
+	if logDataFormat != "csv" && logDataFormat != "jsonl" && logDataFormat != "influx" {
+		fmt.Fprintf(outErr, "Unknown format %q, please use csv, jsonl or influx.\n", logDataFormat)
+		return
+	}
+	since, err := parseTimeArg(logDataSince)
+	if err != nil {
+		fmt.Fprintln(outErr, "Wrong format of --since:", err)
+		return
+	}
+	until := time.Now()
+	if logDataUntil != "" {
+		if until, err = parseTimeArg(logDataUntil); err != nil {
+			fmt.Fprintln(outErr, "Wrong format of --until:", err)
+			return
+		}
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	_, err = lib.Login()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer lib.Logout()
+
+	data, err := lib.LogData(since, until)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	name := selectedInverter
+	if name == "" {
+		name = lib.Server
+	}
+
+	if logDataHistory {
+		if err := backfillLogData(name, data); err != nil {
+			fmt.Fprintln(outErr, "An error occurred:", err)
+			return
+		}
+		if !formatSet {
+			return
+		}
+	}
+
+	if logDataFormat == "influx" {
+		serial, _ := lib.SerialNumber()
+		if err := writeLogDataInflux(name, serial, data); err != nil {
+			fmt.Fprintln(outErr, "Write error:", err)
+		}
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	f, err := getOutFile()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not open file ", outputFile)
+		return
+	}
+	if f != nil {
+		w = f
+		defer closeOutFile(f)
+	}
+	if logDataFormat == "jsonl" {
+		err = writeLogDataJSONL(w, data)
+	} else {
+		writeLogDataCSV(w, data)
+	}
+	if err != nil {
+		fmt.Fprintln(outErr, "Write error:", err)
+	}
+}
+
+// writeLogDataCSV writes one line per record with the time and the values of all columns, missing values are empty
+func writeLogDataCSV(w io.Writer, data golrackpi.LogData) {
+	if !outputNoHeaders {
+		headline := []string{"Time"}
+		for _, column := range data.Columns {
+			if column.Unit != "" {
+				headline = append(headline, column.Name+" ["+column.Unit+"]")
+			} else {
+				headline = append(headline, column.Name)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(headline, delimiter))
+	}
+	for _, record := range data.Records {
+		line := []string{record.Time.Format(time.RFC3339)}
+		for _, column := range data.Columns {
+			value, found := record.Values[column.Name]
+			if !found {
+				line = append(line, "")
+				continue
+			}
+			line = append(line, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		fmt.Fprintln(w, strings.Join(line, delimiter))
+	}
+}
+
+// writeLogDataJSONL writes one JSON object per value with time, column name, unit and value
+func writeLogDataJSONL(w io.Writer, data golrackpi.LogData) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range data.Records {
+		for _, column := range data.Columns {
+			value, found := record.Values[column.Name]
+			if !found {
+				continue
+			}
+			err := encoder.Encode(struct {
+				Time   time.Time `json:"time"`
+				Column string    `json:"column"`
+				Unit   string    `json:"unit"`
+				Value  float64   `json:"value"`
+			}{record.Time, column.Name, column.Unit, value})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeLogDataInflux writes one point per record to the sink set by the InfluxDB flags
+func writeLogDataInflux(name string, serial string, data golrackpi.LogData) error {
+	sink, err := newInfluxSink()
+	if err != nil {
+		return err
+	}
+	tags := map[string]string{"inverter": name, "serial": serial}
+	var points []influx.Point
+	for _, record := range data.Records {
+		point := influx.Point{Measurement: logDataModule, Tags: tags, Fields: make(map[string]interface{}), Time: record.Time}
+		for column, value := range record.Values {
+			point.Fields[column] = value
+		}
+		if len(point.Fields) > 0 {
+			points = append(points, point)
+		}
+	}
+	if err := sink.Write(points); err != nil {
+		sink.Close()
+		return err
+	}
+	return sink.Close()
+}
+
+// backfillLogData stores the values in the history database and calculates the aggregates. Samples which were recorded before are kept.
+// The retention policy is not applied, so no samples are deleted.
+func backfillLogData(name string, data golrackpi.LogData) error {
+	fileName, err := historyDatabaseName()
+	if err != nil {
+		return err
+	}
+	store, err := openHistory(fileName)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var samples []history.Sample
+	for _, record := range data.Records {
+		for _, column := range data.Columns {
+			value, found := record.Values[column.Name]
+			if !found {
+				continue
+			}
+			samples = append(samples, history.Sample{
+				Series: history.Series{Inverter: name, ModuleId: logDataModule, Id: column.Name, Unit: column.Unit},
+				Time:   record.Time,
+				Min:    value,
+				Max:    value,
+				Avg:    value,
+				Count:  1,
+			})
+		}
+	}
+	if err := store.Backfill(samples); err != nil {
+		return err
+	}
+	if err := store.Maintain(time.Now(), history.RetentionPolicy{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Stored %d values of %d records in %s.\n", len(samples), len(data.Records), fileName)
+	return nil
+}
+
+// Handle logdata-related commands
+func handleLogData() {
+	fmt.Println("\nUnknown or missing command.\nRun golrackpi logdata --help to show available commands.")
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/modbus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	modbusAddress string = ""
+	modbusUnitId  uint8  = modbus.DefaultUnitId
+)
+
+func init() {
+	modbusCmd.PersistentFlags().StringVarP(&modbusAddress, "address", "", "", "Modbus TCP address host[:port] (default: host of --server or --inverter with port 1502)")
+	modbusCmd.PersistentFlags().Uint8VarP(&modbusUnitId, "unit-id", "", modbus.DefaultUnitId, "Modbus unit id")
+
+	modbusReadCmd.Flags().BoolVarP(&outputCSV, "csv", "c", false, "Set output to CSV format")
+	modbusReadCmd.Flags().StringVarP(&delimiter, "delimiter", "d", ",", "Set CSV delimiter (default \",\")")
+	modbusReadCmd.Flags().StringVarP(&outputFile, "output-file", "o", "", "Write output to file [filename]")
+	modbusReadCmd.Flags().BoolVarP(&outputTimestamp, "timestamp", "t", false, "Add timestamp to output")
+	modbusReadCmd.Flags().BoolVarP(&outputAppend, "append", "a", false, "Append output to file (default: overwrite content)")
+	modbusReadCmd.Flags().BoolVarP(&outputNoHeaders, "no-headers", "", false, "Omit headline in CSV output")
+
+	rootCmd.AddCommand(modbusCmd)
+	modbusCmd.AddCommand(modbusListCmd)
+	modbusCmd.AddCommand(modbusReadCmd)
+	modbusCmd.AddCommand(modbusSunSpecCmd)
+}
+
+var modbusCmd = &cobra.Command{
+	Use: "modbus",
+
+	Short: "Read values by Modbus TCP instead of the REST API",
+	Long: `Read values by Modbus TCP instead of the REST API. Modbus has to be enabled on the inverter, no password is needed.
+Values with an equivalent in the REST API are returned with its module and processdata id, all others with "modbus:*" modules.`,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		fmt.Println("\nUnknown or missing command.\nRun golrackpi modbus --help to show available commands.")
+	},
+}
+
+var modbusListCmd = &cobra.Command{
+	Use: "list",
+
+	Short: "List all modules and processdata identifiers of the Modbus register map",
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		listModbusRegisters()
+	},
+}
+
+var modbusReadCmd = &cobra.Command{
+	Use: "read [moduleid|processdataid(s)] ...",
+
+	Short: "Read all registers or the registers of the submitted modules and processdata ids",
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		readModbus(args)
+	},
+}
+
+var modbusSunSpecCmd = &cobra.Command{
+	Use: "sunspec",
+
+	Short: "List the SunSpec models and read the common and inverter models",
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		readSunSpec()
+	},
+}
+
+// modbusTarget returns the Modbus TCP address, either set by --address or derived from the inverter host
+func modbusTarget() (string, error) {
+	address := modbusAddress
+	if address == "" {
+		server := authData.Server
+		if selectedInverter != "" {
+			inverter, err := configInverter(selectedInverter)
+			if err != nil {
+				return "", err
+			}
+			server = inverter.Server
+		}
+		if server == "" {
+			return "", errors.New("required flag \"address\" not set (or use --server or --inverter)")
+		}
+		if host, _, err := net.SplitHostPort(server); err == nil {
+			server = host
+		}
+		address = server
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(modbus.DefaultPort))
+	}
+	return address, nil
+}
+
+// newModbusClient returns a Modbus client with the byte order detected from the inverter
+func newModbusClient() (*modbus.Client, error) {
+	address, err := modbusTarget()
+	if err != nil {
+		return nil, err
+	}
+	client := modbus.NewClient(address, modbusUnitId)
+	if _, err := client.DetectByteOrder(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// listModbusRegisters prints the modules and processdata ids of the register map
+func listModbusRegisters() {
+	for _, module := range modbus.ProcessData() {
+		fmt.Println("ModuleId:", module.ModuleId)
+		fmt.Println("ProcessDataIds:")
+		for _, id := range module.ProcessDataIds {
+			fmt.Println("\t", id)
+		}
+	}
+}
+
+// readModbus prints the values of the submitted registers, or of all registers without arguments
+func readModbus(args []string) {
+	var outErr io.Writer = os.Stderr
+
+	var processData []golrackpi.ProcessData
+	for _, arg := range args {
+		moduleId, ids, found := strings.Cut(arg, "|")
+		module := golrackpi.ProcessData{ModuleId: moduleId}
+		if found && ids != "" {
+			module.ProcessDataIds = strings.Split(ids, ",")
+		}
+		processData = append(processData, module)
+	}
+	if len(processData) == 0 {
+		processData = modbus.ProcessData()
+	}
+
+	client, err := newModbusClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer client.Close()
+
+	values, err := client.ProcessDataValues(processData)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	f, err := getOutFile()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not open file ", outputFile)
+		return
+	}
+	var w io.Writer = os.Stdout
+	if f != nil {
+		w = f
+		defer closeOutFile(f)
+	}
+	writeProcessDataValues(w, values)
+}
+
+// readSunSpec prints the SunSpec models and the values of the common and inverter models
+func readSunSpec() {
+	var outErr io.Writer = os.Stderr
+
+	client, err := newModbusClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer client.Close()
+
+	models, err := client.DiscoverSunSpec()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	for _, model := range models {
+		fmt.Printf("Model %d (%s) at %d, length %d\n", model.Id, model.Name(), model.Address, model.Length)
+	}
+	for _, model := range models {
+		switch {
+		case model.Id == 1:
+			common, err := client.ReadCommon(model)
+			if err != nil {
+				fmt.Fprintln(outErr, "An error occurred:", err)
+				continue
+			}
+			fmt.Println()
+			fmt.Println("Manufacturer:", common.Manufacturer)
+			fmt.Println("Model:", common.Model)
+			fmt.Println("Version:", common.Version)
+			fmt.Println("Serial number:", common.SerialNumber)
+		case model.Id >= 101 && model.Id <= 103:
+			inverter, err := client.ReadInverter(model)
+			if err != nil {
+				fmt.Fprintln(outErr, "An error occurred:", err)
+				continue
+			}
+			fmt.Println()
+			writeProcessDataValues(os.Stdout, []golrackpi.ProcessDataValues{inverter.Values(model)})
+		}
+	}
+}
@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/geschke/golrackpi"
 	"github.com/spf13/cobra"
@@ -45,40 +46,29 @@ var modulesListCmd = &cobra.Command{
 
 // listModules prints a list of modules with its corresponding type
 func listModules() {
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
-
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	modules, err := lib.Modules()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		modules, err := lib.Modules()
+		if err != nil {
+			return err
+		}
 
-	if outputCSV {
-		fmt.Printf("ModuleId%sType\n", delimiter)
-		for _, module := range modules {
-			fmt.Printf("%s%s%s\n", module.Id, delimiter, module.Type)
+		if outputCSV {
+			fmt.Fprintf(w, "ModuleId%sType\n", delimiter)
+			for _, module := range modules {
+				fmt.Fprintf(w, "%s%s%s\n", module.Id, delimiter, module.Type)
 
-		}
+			}
 
-	} else {
+		} else {
 
-		fmt.Println("Moduleid\tType")
-		for _, module := range modules {
-			fmt.Printf("%s\t%s\n", module.Id, module.Type)
+			fmt.Fprintln(w, "Moduleid\tType")
+			for _, module := range modules {
+				fmt.Fprintf(w, "%s\t%s\n", module.Id, module.Type)
 
+			}
 		}
-	}
+		return nil
+	})
 }
 
 // Handle modules-related commands
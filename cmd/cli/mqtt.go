@@ -0,0 +1,421 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+// mqttTimeout is the maximum time to wait for the broker to acknowledge a connection or a message
+const mqttTimeout = 10 * time.Second
+
+var (
+	mqttBroker            string        = "tcp://localhost:1883"
+	mqttUsername          string        = ""
+	mqttPassword          string        = ""
+	mqttClientId          string        = "golrackpi"
+	mqttTopic             string        = "golrackpi/{inverter}/{module}/{id}"
+	mqttEventsTopic       string        = "golrackpi/{inverter}/events"
+	mqttAvailabilityTopic string        = "golrackpi/status"
+	mqttQos               int           = 0
+	mqttRetain            bool          = false
+	mqttInterval          time.Duration = 30 * time.Second
+	mqttHomeAssistant     bool          = false
+	mqttDiscoveryPrefix   string        = "homeassistant"
+)
+
+func init() {
+	mqttCmd.Flags().StringVarP(&mqttBroker, "broker", "", "tcp://localhost:1883", "URL of the MQTT broker, e.g. tcp://localhost:1883, ssl://broker:8883 or ws://broker:9001")
+	mqttCmd.Flags().StringVarP(&mqttUsername, "mqtt-username", "", "", "Username for the MQTT broker")
+	mqttCmd.Flags().StringVarP(&mqttPassword, "mqtt-password", "", "", "Password for the MQTT broker")
+	mqttCmd.Flags().StringVarP(&mqttClientId, "client-id", "", "golrackpi", "MQTT client id")
+	mqttCmd.Flags().StringVarP(&mqttTopic, "topic", "", "golrackpi/{inverter}/{module}/{id}", "Topic template of the process-data values, with the placeholders {inverter}, {module} and {id}")
+	mqttCmd.Flags().StringVarP(&mqttEventsTopic, "events-topic", "", "golrackpi/{inverter}/events", "Topic template of the active events, with the placeholder {inverter}")
+	mqttCmd.Flags().StringVarP(&mqttAvailabilityTopic, "availability-topic", "", "golrackpi/status", "Topic of the availability (\"online\" or \"offline\" as last will)")
+	mqttCmd.Flags().IntVarP(&mqttQos, "qos", "", 0, "QoS level of the published messages (0, 1 or 2)")
+	mqttCmd.Flags().BoolVarP(&mqttRetain, "retain", "", false, "Publish the values as retained messages")
+	mqttCmd.Flags().DurationVarP(&mqttInterval, "interval", "", 30*time.Second, "Polling interval")
+	mqttCmd.Flags().BoolVarP(&mqttHomeAssistant, "homeassistant", "", false, "Publish Home Assistant MQTT discovery configs")
+	mqttCmd.Flags().StringVarP(&mqttDiscoveryPrefix, "discovery-prefix", "", "homeassistant", "Topic prefix of the Home Assistant MQTT discovery")
+	mqttCmd.Flags().StringArrayVarP(&pollIds, "ids", "", []string{}, "Process-data ids to publish in the format moduleid|processdataid,processdataid (can be repeated, default: all process-data)")
+	mqttCmd.Flags().BoolVarP(&pollStatistics, "statistics", "", true, "Publish the values of "+statisticModule)
+	mqttCmd.Flags().BoolVarP(&pollEvents, "events", "", true, "Publish the active events")
+
+	rootCmd.AddCommand(mqttCmd)
+}
+
+var mqttCmd = &cobra.Command{
+	Use: "mqtt",
+
+	Short: "Publish process data, statistics and events to an MQTT broker",
+	Long: `Poll the process-data values, the energy flow statistics and the active events through one long-lived session per inverter
+and publish them to an MQTT broker. Every value is published to its own topic, built from the --topic template. The active events
+are published as JSON document to the --events-topic. The availability topic is set to "online" after the connection and to "offline"
+as last will, if the connection is lost.
+
+With --homeassistant, MQTT discovery configs are published, so the values appear as sensors in Home Assistant, with device class,
+state class and unit as needed by the energy dashboard.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runMqtt()
+	},
+}
+
+// mqttTarget specifies an inverter which is published, with the discovery configs already sent
+type mqttTarget struct {
+	*pollTarget
+
+	discovered map[string]bool
+}
+
+// mqttEvents specifies the JSON document published to the events topic
+type mqttEvents struct {
+	Active  int                   `json:"active"`
+	Info    int                   `json:"info"`
+	Warning int                   `json:"warning"`
+	Error   int                   `json:"error"`
+	Events  []golrackpi.EventData `json:"events"`
+}
+
+// haDevice specifies the device of a Home Assistant discovery config
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	SwVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haSensorConfig specifies the Home Assistant discovery config of a sensor
+type haSensorConfig struct {
+	Name              string   `json:"name"`
+	UniqueId          string   `json:"unique_id"`
+	ObjectId          string   `json:"object_id"`
+	StateTopic        string   `json:"state_topic"`
+	ValueTemplate     string   `json:"value_template,omitempty"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	AvailabilityTopic string   `json:"availability_topic,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// runMqtt connects to the broker and publishes the polled values until the process is interrupted
+func runMqtt() {
+	var outErr io.Writer = os.Stderr
+
+	if mqttInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit an interval of at least one second.")
+		return
+	}
+	if mqttQos < 0 || mqttQos > 2 {
+		fmt.Fprintln(outErr, "Please submit 0, 1 or 2 as QoS level.")
+		return
+	}
+
+	inverters, err := pollTargets()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	client, err := connectMqtt()
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not connect to MQTT broker:", err)
+		return
+	}
+	defer func() {
+		if mqttAvailabilityTopic != "" {
+			publishMqtt(client, mqttAvailabilityTopic, true, "offline")
+		}
+		client.Disconnect(250)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, inverter := range inverters {
+		defer inverter.Session.Close()
+		target := &mqttTarget{pollTarget: inverter, discovered: make(map[string]bool)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target.poll(ctx, client)
+		}()
+	}
+	wg.Wait()
+}
+
+// connectMqtt connects to the broker with the availability topic as last will
+func connectMqtt() (mqtt.Client, error) {
+	options := mqtt.NewClientOptions().
+		AddBroker(mqttBroker).
+		SetClientID(mqttClientId).
+		SetUsername(mqttUsername).
+		SetPassword(mqttPassword).
+		SetAutoReconnect(true).
+		SetConnectTimeout(mqttTimeout)
+	if mqttAvailabilityTopic != "" {
+		options.SetWill(mqttAvailabilityTopic, "offline", byte(mqttQos), true)
+		// the availability is published on every connect, so it is set again after a reconnect
+		options.SetOnConnectHandler(func(client mqtt.Client) {
+			if err := publishMqtt(client, mqttAvailabilityTopic, true, "online"); err != nil {
+				fmt.Fprintln(os.Stderr, "Could not publish availability:", err)
+			}
+		})
+	}
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		return nil, errors.New("timeout")
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// publishMqtt publishes a message with the configured QoS level and waits for the acknowledgement
+func publishMqtt(client mqtt.Client, topic string, retain bool, payload interface{}) error {
+	token := client.Publish(topic, byte(mqttQos), retain, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		return errors.New("timeout publishing to " + topic)
+	}
+	return token.Error()
+}
+
+// poll requests and publishes the values of the target until ctx is cancelled
+func (t *mqttTarget) poll(ctx context.Context, client mqtt.Client) {
+	ticker := time.NewTicker(mqttInterval)
+	defer ticker.Stop()
+	for {
+		if err := t.publish(client); err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] An error occurred: %v\n", t.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish requests the values of the target and publishes them, together with the discovery configs of new values
+func (t *mqttTarget) publish(client mqtt.Client) error {
+	var values []golrackpi.ProcessDataValues
+	var events []golrackpi.EventData
+	err := t.Session.Do(func(lib *golrackpi.AuthClient) error {
+		t.deviceInfo(lib)
+
+		ids, err := t.processDataIds(lib)
+		if err != nil {
+			return err
+		}
+		if values, err = requestValues(lib, ids, pollStatistics); err != nil {
+			return err
+		}
+		if pollEvents {
+			if events, err = lib.Events(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, module := range values {
+		for _, value := range module.ProcessData {
+			topic := expandTopic(mqttTopic, t.Name, module.ModuleId, value.Id)
+			if mqttHomeAssistant {
+				if err := t.discover(client, module.ModuleId, value, topic); err != nil {
+					return err
+				}
+			}
+			if err := publishMqtt(client, topic, mqttRetain, formatMqttValue(value.Value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pollEvents {
+		topic := expandTopic(mqttEventsTopic, t.Name, "", "")
+		if mqttHomeAssistant {
+			if err := t.discoverEvents(client, topic); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(activeEvents(events))
+		if err != nil {
+			return err
+		}
+		if err := publishMqtt(client, topic, mqttRetain, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeEvents returns the document with the active events and their number per category
+func activeEvents(events []golrackpi.EventData) mqttEvents {
+	result := mqttEvents{Events: []golrackpi.EventData{}}
+	for _, event := range events {
+		if !event.IsActive {
+			continue
+		}
+		result.Active++
+		result.Events = append(result.Events, event)
+		switch event.Category.Normalize() {
+		case golrackpi.EventCategoryInfo:
+			result.Info++
+		case golrackpi.EventCategoryWarning:
+			result.Warning++
+		case golrackpi.EventCategoryError:
+			result.Error++
+		}
+	}
+	return result
+}
+
+// discover publishes the Home Assistant discovery config of a process-data value, if it was not published yet
+func (t *mqttTarget) discover(client mqtt.Client, moduleId string, value golrackpi.ProcessDataValue, stateTopic string) error {
+	key := moduleId + "/" + value.Id
+	if t.discovered[key] {
+		return nil
+	}
+
+	config := haSensorConfig{
+		Name:              moduleId + " " + value.Id,
+		StateTopic:        stateTopic,
+		AvailabilityTopic: mqttAvailabilityTopic,
+	}
+	if _, numeric := numericValue(value.Value); numeric {
+		config.UnitOfMeasurement = value.Unit
+		config.DeviceClass, config.StateClass = haSensorClasses(value.Id, value.Unit)
+	}
+	if err := t.publishDiscovery(client, moduleId+"_"+value.Id, config); err != nil {
+		return err
+	}
+	t.discovered[key] = true
+	return nil
+}
+
+// discoverEvents publishes the Home Assistant discovery config of the number of active events, if it was not published yet
+func (t *mqttTarget) discoverEvents(client mqtt.Client, stateTopic string) error {
+	if t.discovered["events"] {
+		return nil
+	}
+	config := haSensorConfig{
+		Name:              "Active events",
+		StateTopic:        stateTopic,
+		ValueTemplate:     "{{ value_json.active }}",
+		StateClass:        "measurement",
+		AvailabilityTopic: mqttAvailabilityTopic,
+	}
+	if err := t.publishDiscovery(client, "events_active", config); err != nil {
+		return err
+	}
+	t.discovered["events"] = true
+	return nil
+}
+
+// publishDiscovery completes the discovery config with ids and device and publishes it as retained message
+func (t *mqttTarget) publishDiscovery(client mqtt.Client, name string, config haSensorConfig) error {
+	deviceId, firmware := t.device()
+	if deviceId == "" {
+		deviceId = t.Name
+	}
+	nodeId := sanitizeMetricName(deviceId)
+	config.UniqueId = "golrackpi_" + nodeId + "_" + sanitizeMetricName(name)
+	config.ObjectId = "golrackpi_" + sanitizeMetricName(t.Name) + "_" + sanitizeMetricName(name)
+	config.Device = haDevice{
+		Identifiers:  []string{"golrackpi_" + nodeId},
+		Name:         t.Name,
+		Manufacturer: "KOSTAL",
+		SwVersion:    firmware,
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	topic := mqttDiscoveryPrefix + "/sensor/golrackpi_" + nodeId + "/" + sanitizeMetricName(name) + "/config"
+	return publishMqtt(client, topic, true, b)
+}
+
+// haSensorClasses returns the Home Assistant device class and state class of a process-data value derived from its unit.
+// Energy values are total_increasing, so Home Assistant detects the daily, monthly and yearly resets of the statistics.
+func haSensorClasses(id string, unit string) (string, string) {
+	switch unit {
+	case "W":
+		return "power", "measurement"
+	case "Wh", "kWh":
+		return "energy", "total_increasing"
+	case "VA":
+		return "apparent_power", "measurement"
+	case "var":
+		return "reactive_power", "measurement"
+	case "V":
+		return "voltage", "measurement"
+	case "A":
+		return "current", "measurement"
+	case "Hz":
+		return "frequency", "measurement"
+	case "°C":
+		return "temperature", "measurement"
+	case "%":
+		if strings.EqualFold(id, "SoC") {
+			return "battery", "measurement"
+		}
+		return "", "measurement"
+	}
+	return "", "measurement"
+}
+
+// expandTopic replaces the placeholders of a topic template. Characters which are not allowed in topic names are replaced by underscores.
+func expandTopic(template string, inverter string, moduleId string, id string) string {
+	clean := strings.NewReplacer("/", "_", "+", "_", "#", "_")
+	return strings.NewReplacer(
+		"{inverter}", clean.Replace(inverter),
+		"{module}", clean.Replace(moduleId),
+		"{id}", clean.Replace(id),
+	).Replace(template)
+}
+
+// formatMqttValue returns the payload of a process-data value
+func formatMqttValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+// testMessage is a message received by the test broker
+type testMessage struct {
+	Topic   string
+	Payload string
+	Qos     byte
+	Retain  bool
+}
+
+// testBroker is a minimal MQTT 3.1.1 broker which records the last will and the published messages of its clients.
+// It supports CONNECT, PUBLISH with QoS 0 and 1, PINGREQ and DISCONNECT, which is all the mqtt command uses.
+type testBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	will     *testMessage
+	messages []testMessage
+}
+
+// startTestBroker starts a broker on a free local port
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return b
+}
+
+// serve handles the packets of a client connection
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return
+		}
+
+		var response []byte
+		switch header >> 4 {
+		case 1: // CONNECT
+			will, err := parseConnect(packet)
+			if err != nil {
+				conn.Write([]byte{0x20, 2, 0, 2}) // identifier rejected
+				return
+			}
+			b.mu.Lock()
+			b.will = will
+			b.mu.Unlock()
+			response = []byte{0x20, 2, 0, 0}
+		case 3: // PUBLISH
+			message := testMessage{Qos: header >> 1 & 3, Retain: header&1 == 1}
+			topic, rest, err := readMqttString(packet)
+			if err != nil {
+				return
+			}
+			message.Topic = topic
+			if message.Qos > 0 {
+				if len(rest) < 2 {
+					return
+				}
+				response = []byte{0x40, 2, rest[0], rest[1]}
+				rest = rest[2:]
+			}
+			message.Payload = string(rest)
+			b.mu.Lock()
+			b.messages = append(b.messages, message)
+			b.mu.Unlock()
+		case 12: // PINGREQ
+			response = []byte{0xD0, 0}
+		case 14: // DISCONNECT
+			return
+		default:
+			return
+		}
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// parseConnect returns the last will of a CONNECT packet, nil if the client didn't set one
+func parseConnect(packet []byte) (*testMessage, error) {
+	protocol, rest, err := readMqttString(packet)
+	if err != nil || protocol != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		return nil, errors.New("unsupported protocol")
+	}
+	flags := rest[1]
+	_, rest, err = readMqttString(rest[4:]) // client id
+	if err != nil || flags&0x04 == 0 {
+		return nil, err
+	}
+	will := &testMessage{Qos: flags >> 3 & 3, Retain: flags&0x20 != 0}
+	if will.Topic, rest, err = readMqttString(rest); err != nil {
+		return nil, err
+	}
+	if will.Payload, _, err = readMqttString(rest); err != nil {
+		return nil, err
+	}
+	return will, nil
+}
+
+// readMqttString returns the length-prefixed string at the start of the data and the remaining data
+func readMqttString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(data[2 : 2+n]), data[2+n:], nil
+}
+
+// received returns the messages published to the topic, waiting up to two seconds for the first one
+func (b *testBroker) received(topic string) []testMessage {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var result []testMessage
+		b.mu.Lock()
+		for _, message := range b.messages {
+			if message.Topic == topic {
+				result = append(result, message)
+			}
+		}
+		b.mu.Unlock()
+		if len(result) > 0 || time.Now().After(deadline) {
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// setMqttFlags sets the flags of the mqtt command for a test and restores them afterwards
+func setMqttFlags(t *testing.T, broker string, qos int, retain bool) {
+	saved := []interface{}{mqttBroker, mqttClientId, mqttTopic, mqttEventsTopic, mqttAvailabilityTopic, mqttQos, mqttRetain, mqttHomeAssistant, mqttDiscoveryPrefix, pollStatistics, pollEvents}
+	t.Cleanup(func() {
+		mqttBroker, mqttClientId, mqttTopic, mqttEventsTopic = saved[0].(string), saved[1].(string), saved[2].(string), saved[3].(string)
+		mqttAvailabilityTopic, mqttQos, mqttRetain, mqttHomeAssistant = saved[4].(string), saved[5].(int), saved[6].(bool), saved[7].(bool)
+		mqttDiscoveryPrefix, pollStatistics, pollEvents = saved[8].(string), saved[9].(bool), saved[10].(bool)
+	})
+	mqttBroker = broker
+	mqttClientId = "golrackpi-test"
+	mqttTopic = "solar/{inverter}/{module}/{id}"
+	mqttEventsTopic = "solar/{inverter}/events"
+	mqttAvailabilityTopic = "solar/status"
+	mqttQos = qos
+	mqttRetain = retain
+	mqttHomeAssistant = true
+	mqttDiscoveryPrefix = "homeassistant"
+	pollStatistics = true
+	pollEvents = true
+}
+
+func TestMqttPublish(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	broker := startTestBroker(t)
+	setMqttFlags(t, "tcp://"+broker.listener.Addr().String(), 1, true)
+
+	client, err := connectMqtt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(250)
+
+	broker.mu.Lock()
+	will := broker.will
+	broker.mu.Unlock()
+	if want := (testMessage{Topic: "solar/status", Payload: "offline", Qos: 1, Retain: true}); will == nil || *will != want {
+		t.Errorf("wrong last will: got %+v, want %+v", will, want)
+	}
+	if online := broker.received("solar/status"); len(online) != 1 || online[0].Payload != "online" || !online[0].Retain {
+		t.Errorf("wrong availability: %+v", online)
+	}
+
+	target := &mqttTarget{
+		pollTarget: &pollTarget{Name: "Roof/East", Session: golrackpi.NewSession(sim.Client()), ids: []golrackpi.ProcessData{
+			{ModuleId: "devices:local", ProcessDataIds: []string{"Home_P", "Inverter:State"}},
+			{ModuleId: "devices:local:battery", ProcessDataIds: []string{"SoC"}},
+		}},
+		discovered: make(map[string]bool),
+	}
+	defer target.Session.Close()
+	for i := 0; i < 2; i++ {
+		if err := target.publish(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, topic := range []string{
+		"solar/Roof_East/devices:local/Home_P",
+		"solar/Roof_East/devices:local/Inverter:State",
+		"solar/Roof_East/devices:local:battery/SoC",
+		"solar/Roof_East/scb:statistic:EnergyFlow/Statistic:Yield:Day",
+		"solar/Roof_East/events",
+	} {
+		messages := broker.received(topic)
+		if len(messages) != 2 {
+			t.Errorf("%s: got %d messages, want 2", topic, len(messages))
+			continue
+		}
+		if messages[0].Qos != 1 || !messages[0].Retain || messages[0].Payload == "" {
+			t.Errorf("%s: wrong message %+v", topic, messages[0])
+		}
+	}
+	var events mqttEvents
+	if messages := broker.received("solar/Roof_East/events"); len(messages) == 0 || json.Unmarshal([]byte(messages[0].Payload), &events) != nil || events.Events == nil {
+		t.Errorf("wrong events document %+v", messages)
+	}
+
+	tests := []struct {
+		topic                                     string
+		stateTopic, deviceClass, stateClass, unit string
+	}{
+		{"homeassistant/sensor/golrackpi_sim000000001/devices_local_home_p/config", "solar/Roof_East/devices:local/Home_P", "power", "measurement", "W"},
+		{"homeassistant/sensor/golrackpi_sim000000001/devices_local_battery_soc/config", "solar/Roof_East/devices:local:battery/SoC", "battery", "measurement", "%"},
+		{"homeassistant/sensor/golrackpi_sim000000001/scb_statistic_energyflow_statistic_yield_day/config", "solar/Roof_East/scb:statistic:EnergyFlow/Statistic:Yield:Day", "energy", "total_increasing", "Wh"},
+		{"homeassistant/sensor/golrackpi_sim000000001/devices_local_inverter_state/config", "solar/Roof_East/devices:local/Inverter:State", "", "measurement", ""},
+		{"homeassistant/sensor/golrackpi_sim000000001/events_active/config", "solar/Roof_East/events", "", "measurement", ""},
+	}
+	for _, test := range tests {
+		messages := broker.received(test.topic)
+		if len(messages) != 1 {
+			t.Errorf("%s: got %d discovery configs, want 1", test.topic, len(messages))
+			continue
+		}
+		if !messages[0].Retain {
+			t.Errorf("%s: discovery config not retained", test.topic)
+		}
+		var config haSensorConfig
+		if err := json.Unmarshal([]byte(messages[0].Payload), &config); err != nil {
+			t.Errorf("%s: %v", test.topic, err)
+			continue
+		}
+		if config.StateTopic != test.stateTopic || config.DeviceClass != test.deviceClass || config.StateClass != test.stateClass || config.UnitOfMeasurement != test.unit {
+			t.Errorf("%s: wrong config %+v", test.topic, config)
+		}
+		if config.AvailabilityTopic != "solar/status" || config.Device.Name != "Roof/East" || len(config.Device.Identifiers) != 1 || config.Device.Identifiers[0] != "golrackpi_sim000000001" {
+			t.Errorf("%s: wrong availability or device %+v", test.topic, config)
+		}
+	}
+}
+
+func TestExpandTopic(t *testing.T) {
+	if got := expandTopic("a/{inverter}/{module}/{id}", "x/+#", "devices:local", "Home_P"); got != "a/x___/devices:local/Home_P" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/geschke/golrackpi"
+)
+
+var (
+	pollIds        []string = []string{}
+	pollStatistics bool     = true
+	pollEvents     bool     = true
+)
+
+// pollTarget specifies an inverter which is polled by a long-running command through a long-lived session
+type pollTarget struct {
+	Name    string
+	Session *golrackpi.Session
+
+	idsMu sync.Mutex
+	ids   []golrackpi.ProcessData
+
+	deviceMu sync.Mutex
+	serial   string
+	firmware string
+}
+
+// pollTargets returns the inverters to poll, i.e. the single inverter or all inverters selected by --fleet or --tag.
+// The process-data set by --ids are polled from every inverter, without --ids all process-data of the inverter.
+func pollTargets() ([]*pollTarget, error) {
+	var ids []golrackpi.ProcessData
+	if len(pollIds) > 0 {
+		var err error
+		ids, err = parseProcessdataArgs(pollIds)
+		if err != nil {
+			return nil, fmt.Errorf("wrong format of --ids: %w", err)
+		}
+	}
+
+	if !fleetMode() {
+		lib, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		name := selectedInverter
+		if name == "" {
+			name = lib.Server
+		}
+		return []*pollTarget{{Name: name, Session: golrackpi.NewSession(lib), ids: ids}}, nil
+	}
+
+	fleet, err := loadFleet()
+	if err != nil {
+		return nil, err
+	}
+	var targets []*pollTarget
+	for _, inverter := range fleet.Inverters {
+		targets = append(targets, &pollTarget{Name: inverter.Name, Session: golrackpi.NewSession(inverter.Client), ids: ids})
+	}
+	return targets, nil
+}
+
+// processDataIds returns the process-data to poll. If no process-data were submitted, the list of all process-data is requested once.
+func (t *pollTarget) processDataIds(client *golrackpi.AuthClient) ([]golrackpi.ProcessData, error) {
+	t.idsMu.Lock()
+	ids := t.ids
+	t.idsMu.Unlock()
+	if len(ids) > 0 {
+		return ids, nil
+	}
+
+	ids, err := client.ProcessData()
+	if err != nil {
+		return nil, err
+	}
+	t.idsMu.Lock()
+	t.ids = ids
+	t.idsMu.Unlock()
+	return ids, nil
+}
+
+// deviceInfo requests serial number and firmware version of the inverter until both were read. They are optional, so errors
+// are ignored and the request is repeated with the next poll.
+func (t *pollTarget) deviceInfo(client *golrackpi.AuthClient) {
+	t.deviceMu.Lock()
+	defer t.deviceMu.Unlock()
+	if t.serial == "" {
+		t.serial, _ = client.SerialNumber()
+	}
+	if t.firmware == "" {
+		if version, err := client.Version(); err == nil {
+			t.firmware = version.SwVersion
+		}
+	}
+}
+
+// device returns serial number and firmware version of the inverter, empty if they couldn't be read yet
+func (t *pollTarget) device() (string, string) {
+	t.deviceMu.Lock()
+	defer t.deviceMu.Unlock()
+	return t.serial, t.firmware
+}
+
+// numericValue returns the value of a process-data as number. The second return value is false for non-numeric values.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+func TestPollTargetDeviceInfo(t *testing.T) {
+	unreachable, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable.Close()
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	target := &pollTarget{Name: "roof", Session: golrackpi.NewSession(sim.Client())}
+	defer target.Session.Close()
+
+	// a failed lookup is repeated with the next poll
+	target.deviceInfo(unreachable.Client())
+	if serial, firmware := target.device(); serial != "" || firmware != "" {
+		t.Errorf("unreachable inverter: got %q, %q", serial, firmware)
+	}
+	err = target.Session.Do(func(client *golrackpi.AuthClient) error {
+		target.deviceInfo(client)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial, firmware := target.device(); serial != "SIM000000001" || firmware == "" {
+		t.Errorf("got %q, %q", serial, firmware)
+	}
+}
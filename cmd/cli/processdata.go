@@ -5,6 +5,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -106,67 +107,40 @@ var processdataGetCmd = &cobra.Command{
 	},
 }
 
+// listProcessdata prints all modules with their processdata ids
 func listProcessdata() {
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
-
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-
-	defer lib.Logout()
-
-	processData, err := lib.ProcessData()
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return
-	}
-
-	for _, pdItem := range processData {
-		fmt.Println("ModuleId:", pdItem.ModuleId)
-		if len(pdItem.ProcessDataIds) > 0 {
-			fmt.Println("ProcessDataIds:")
-			for _, pdId := range pdItem.ProcessDataIds {
-				fmt.Println("\t", pdId)
-			}
-		} else {
-			fmt.Println("No ProcessDataId found.")
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		processData, err := lib.ProcessData()
+		if err != nil {
+			return err
 		}
 
-	}
+		for _, pdItem := range processData {
+			fmt.Fprintln(w, "ModuleId:", pdItem.ModuleId)
+			if len(pdItem.ProcessDataIds) > 0 {
+				fmt.Fprintln(w, "ProcessDataIds:")
+				for _, pdId := range pdItem.ProcessDataIds {
+					fmt.Fprintln(w, "\t", pdId)
+				}
+			} else {
+				fmt.Fprintln(w, "No ProcessDataId found.")
+			}
 
+		}
+		return nil
+	})
 }
 
-func getMultProcessdata(args []string) {
-
-	// check format of submitted arguments
+// parseProcessdataArgs converts the arguments of the "mult" command into a slice of ProcessData. The arguments are either
+// a moduleid and a comma-separated list of processdataids or one or more values in the "moduleid|processdataid,processdataid" format.
+func parseProcessdataArgs(args []string) ([]golrackpi.ProcessData, error) {
 	var requestProcessData []golrackpi.ProcessData
-	var outErr io.Writer = os.Stderr
-	var w io.Writer
-
-	f, err := getOutFile()
-	if err != nil {
-		fmt.Fprintln(outErr, "Could not open file ", outputFile)
-		return
-	}
-	if f != nil {
-		w = f
-		defer closeOutFile(f)
-	} else {
-		w = os.Stdout
-	}
 
-	if strings.Contains(args[0], "|") { // search "|"" separator to request one or more modules with their processdataids
+	if len(args) > 0 && strings.Contains(args[0], "|") { // search "|"" separator to request one or more modules with their processdataids
 		for _, argModuleProcessdata := range args {
 			moduleProcessdata := strings.Split(argModuleProcessdata, "|")
 			if len(moduleProcessdata) != 2 {
-				fmt.Fprintln(outErr, "Wrong format of moduleid and processdataid values.")
-				return
+				return requestProcessData, errors.New("wrong format of moduleid and processdataid values")
 			}
 			argModuleId := moduleProcessdata[0]
 			processdataIds := strings.Split(moduleProcessdata[1], ",")
@@ -180,187 +154,99 @@ func getMultProcessdata(args []string) {
 		processdataIds := strings.Split(args[1], ",")
 
 		if len(moduleIds) > 1 {
-			fmt.Fprintln(outErr, "Please enter only one moduleid.")
-			return
+			return requestProcessData, errors.New("please enter only one moduleid")
 		}
 		v := golrackpi.ProcessData{ModuleId: moduleIds[0], ProcessDataIds: processdataIds}
 		requestProcessData = append(requestProcessData, v)
 
 	} else {
-		fmt.Fprintln(outErr, "Please submit module and processdata in an appropriate format.")
-		return
+		return requestProcessData, errors.New("please submit module and processdata in an appropriate format")
 	}
+	return requestProcessData, nil
+}
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
-
-	_, err = lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
+// statisticModule is the module of the energy flow statistics
+const statisticModule = "scb:statistic:EnergyFlow"
 
-		return
-	}
-	defer lib.Logout()
-
-	processDataValues, err := lib.ProcessDataValues(requestProcessData)
+// requestValues requests the values of the submitted process-data and, if statistics is true, all values of the energy flow statistics
+func requestValues(client *golrackpi.AuthClient, ids []golrackpi.ProcessData, statistics bool) ([]golrackpi.ProcessDataValues, error) {
+	values, err := client.ProcessDataValues(ids)
 	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
+		return nil, err
 	}
-
-	if outputCSV {
-		if !outputNoHeaders {
-			if outputTimestamp {
-				fmt.Fprintf(w, "Timestamp%s", delimiter)
-			}
-			fmt.Fprintf(w, "Module%sProcessdata Id%sProcessdata Unit%sProcessdata Value\n", delimiter, delimiter, delimiter)
+	if statistics && !containsModule(ids, statisticModule) {
+		statisticValues, err := client.ProcessDataModule(statisticModule)
+		if err != nil {
+			return nil, err
 		}
-		for _, pdv := range processDataValues {
-			for _, pd := range pdv.ProcessData {
-
-				if outputTimestamp {
-					fmt.Fprintf(w, "%s%s", time.Now().Format(time.RFC3339), delimiter)
-				}
-				fmt.Fprintf(w, "%s%s%s%s%s%s%v\n", pdv.ModuleId, delimiter, pd.Id, delimiter, pd.Unit, delimiter, pd.Value)
+		values = append(values, statisticValues...)
+	}
+	return values, nil
+}
 
-			}
+// containsModule returns true if the module is part of the submitted process-data
+func containsModule(processData []golrackpi.ProcessData, moduleId string) bool {
+	for _, module := range processData {
+		if module.ModuleId == moduleId {
+			return true
 		}
-
-	} else {
-		if outputTimestamp {
-			fmt.Fprintf(w, "Timestamp:\t")
-		}
-		for _, pdv := range processDataValues {
-			if outputTimestamp {
-				fmt.Fprintf(w, "%s\n", time.Now().Format(time.RFC3339))
-			}
-			fmt.Fprintln(w, "Module:", pdv.ModuleId)
-			for _, pd := range pdv.ProcessData {
-				fmt.Fprintln(w, pd.Id, "\t", pd.Unit, "\t", pd.Value)
-			}
-			fmt.Fprintln(w)
-		}
-
 	}
+	return false
 }
 
-func getProcessdata(args []string) {
+// getMultProcessdata prints the values of one or more modules with their processdata ids
+func getMultProcessdata(args []string) {
 	var outErr io.Writer = os.Stderr
-	var w io.Writer
-
-	f, err := getOutFile()
-	if err != nil {
-		fmt.Fprintln(outErr, "Could not open file ", outputFile)
-		return
-	}
-	if f != nil {
-		w = f
-		defer closeOutFile(f)
-	} else {
-		w = os.Stdout
-	}
-	// submitted values: moduleid pdid pdid2 pdid3...
-
-	moduleId := args[0]
-	processDataIds := args[1:]
-
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
 
-	_, err = lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-
-		return
-	}
-	defer lib.Logout()
-
-	processDataValues, err := lib.ProcessDataModuleValues(moduleId, processDataIds...)
+	// check format of submitted arguments
+	requestProcessData, err := parseProcessdataArgs(args)
 	if err != nil {
 		fmt.Fprintln(outErr, "An error occurred:", err)
 		return
 	}
 
-	if outputCSV {
-		if !outputNoHeaders {
-			if outputTimestamp {
-				fmt.Fprintf(w, "Timestamp%s", delimiter)
-			}
-			fmt.Fprintf(w, "Module%sProcessdata Id%sProcessdata Unit%sProcessdata Value\n", delimiter, delimiter, delimiter)
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		processDataValues, err := lib.ProcessDataValues(requestProcessData)
+		if err != nil {
+			return err
 		}
-		for _, pdv := range processDataValues {
-			for _, pd := range pdv.ProcessData {
-				if outputTimestamp {
-					fmt.Fprintf(w, "%s%s", time.Now().Format(time.RFC3339), delimiter)
-				}
-				fmt.Fprintf(w, "%s%s%s%s%s%s%v\n", pdv.ModuleId, delimiter, pd.Id, delimiter, pd.Unit, delimiter, pd.Value)
+		writeProcessDataValues(w, processDataValues)
+		return nil
+	})
+}
 
-			}
-		}
+// getProcessdata prints one or more processdata values of a module
+func getProcessdata(args []string) {
+	// submitted values: moduleid pdid pdid2 pdid3...
+	moduleId := args[0]
+	processDataIds := args[1:]
 
-	} else {
-		if outputTimestamp {
-			fmt.Fprintf(w, "Timestamp:\t")
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		processDataValues, err := lib.ProcessDataModuleValues(moduleId, processDataIds...)
+		if err != nil {
+			return err
 		}
-		for _, pdv := range processDataValues {
-			if outputTimestamp {
-				fmt.Fprintf(w, "%s\n", time.Now().Format(time.RFC3339))
-			}
-			fmt.Fprintln(w, "Module:", pdv.ModuleId)
-			for _, pd := range pdv.ProcessData {
-				fmt.Fprintln(w, pd.Id, "\t", pd.Unit, "\t", pd.Value)
-			}
-			fmt.Fprintln(w)
-		}
-
-	}
+		writeProcessDataValues(w, processDataValues)
+		return nil
+	})
 }
 
+// getModuleProcessdata prints all processdata values of a module
 func getModuleProcessdata(args []string) {
-	var outErr io.Writer = os.Stderr
-	var w io.Writer
-
-	f, err := getOutFile()
-	if err != nil {
-		fmt.Fprintln(outErr, "Could not open file ", outputFile)
-		return
-	}
-	if f != nil {
-		w = f
-		defer closeOutFile(f)
-	} else {
-		w = os.Stdout
-	}
-	// submitted values: moduleid pdid pdid2 pdid3...
-
 	moduleId := args[0]
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		processDataValues, err := lib.ProcessDataModule(moduleId)
+		if err != nil {
+			return err
+		}
+		writeProcessDataValues(w, processDataValues)
+		return nil
 	})
+}
 
-	_, err = lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-
-		return
-	}
-	defer lib.Logout()
-
-	processDataValues, err := lib.ProcessDataModule(moduleId)
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-
+// writeProcessDataValues is a helper function to print a slice of modules with their processdata values
+func writeProcessDataValues(w io.Writer, processDataValues []golrackpi.ProcessDataValues) {
 	if outputCSV {
 		if !outputNoHeaders {
 			if outputTimestamp {
@@ -0,0 +1,433 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/gorilla/websocket"
+)
+
+// pushMessage specifies a message sent to the subscribers of the push endpoints
+type pushMessage struct {
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	Modules []gatewayModule `json:"modules,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// pushSubscription specifies the selectors and the throttle of a subscriber, as sent by WebSocket clients to change their subscription
+type pushSubscription struct {
+	Select   []string `json:"select"`
+	Throttle string   `json:"throttle"`
+}
+
+// pushSubscriber specifies a client of the push endpoints. The latest message is kept in a channel with capacity one,
+// so slow clients skip messages instead of blocking the poller.
+type pushSubscriber struct {
+	messages chan pushMessage
+
+	mu        sync.Mutex
+	selectors []golrackpi.ProcessData
+	throttle  time.Duration
+	lastSent  time.Time
+}
+
+// pushHub polls the process-data selected by all subscribers with one shared request and distributes the values.
+// Selectors are checked against the process-data of the inverter when subscribing, so an unknown id of one subscriber
+// can't fail the shared request.
+type pushHub struct {
+	session  *golrackpi.Session
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[*pushSubscriber]struct{}
+	processData []golrackpi.ProcessData
+}
+
+// newPushHub returns a pushHub instance which polls through the session
+func newPushHub(session *golrackpi.Session, interval time.Duration) *pushHub {
+	return &pushHub{session: session, interval: interval, subscribers: make(map[*pushSubscriber]struct{})}
+}
+
+// run polls the inverter every interval while there are subscribers, until ctx is cancelled
+func (h *pushHub) run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.poll()
+	}
+}
+
+// poll requests the union of all selectors and sends every subscriber its values
+func (h *pushHub) poll() {
+	h.mu.Lock()
+	subscribers := make([]*pushSubscriber, 0, len(h.subscribers))
+	for subscriber := range h.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	h.mu.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	var selectors []golrackpi.ProcessData
+	for _, subscriber := range subscribers {
+		selectors = mergeSelectors(selectors, subscriber.selection())
+	}
+	if len(selectors) == 0 {
+		return
+	}
+
+	var values []golrackpi.ProcessDataValues
+	err := h.session.Do(func(client *golrackpi.AuthClient) error {
+		var err error
+		values, err = client.ProcessDataValues(selectors)
+		return err
+	})
+	now := time.Now()
+	for _, subscriber := range subscribers {
+		if err != nil {
+			subscriber.send(pushMessage{Type: "error", Time: now, Error: err.Error()}, now, true)
+			continue
+		}
+		modules := gatewayModules(filterValues(values, subscriber.selection()))
+		subscriber.send(pushMessage{Type: "processdata", Time: now, Modules: modules}, now, false)
+	}
+}
+
+// checkSelectors returns an error if a selector contains a module or process-data id which is unknown to the inverter.
+// The list of process-data is requested once and kept for the lifetime of the hub.
+func (h *pushHub) checkSelectors(selectors []golrackpi.ProcessData) error {
+	h.mu.Lock()
+	processData := h.processData
+	h.mu.Unlock()
+	if processData == nil {
+		err := h.session.Do(func(client *golrackpi.AuthClient) error {
+			var err error
+			processData, err = client.ProcessData()
+			return err
+		})
+		if err != nil {
+			return gatewayError{http.StatusBadGateway, err}
+		}
+		h.mu.Lock()
+		h.processData = processData
+		h.mu.Unlock()
+	}
+
+	for _, selector := range selectors {
+		var ids []string
+		found := false
+		for _, module := range processData {
+			if module.ModuleId == selector.ModuleId {
+				ids, found = module.ProcessDataIds, true
+				break
+			}
+		}
+		if !found {
+			return gatewayError{http.StatusBadRequest, fmt.Errorf("unknown module %q", selector.ModuleId)}
+		}
+		for _, id := range selector.ProcessDataIds {
+			if !containsId(ids, id) {
+				return gatewayError{http.StatusBadRequest, fmt.Errorf("unknown process-data %q of module %q", id, selector.ModuleId)}
+			}
+		}
+	}
+	return nil
+}
+
+// subscription returns the selectors and the throttle of a subscription, after checking the selectors against the inverter
+func (h *pushHub) subscription(subscription pushSubscription) ([]golrackpi.ProcessData, time.Duration, error) {
+	selectors, throttle, err := parseSubscription(subscription)
+	if err != nil {
+		return nil, 0, gatewayError{http.StatusBadRequest, err}
+	}
+	if err := h.checkSelectors(selectors); err != nil {
+		return nil, 0, err
+	}
+	return selectors, throttle, nil
+}
+
+// subscribe adds a subscriber
+func (h *pushHub) subscribe(selectors []golrackpi.ProcessData, throttle time.Duration) *pushSubscriber {
+	subscriber := &pushSubscriber{messages: make(chan pushMessage, 1), selectors: selectors, throttle: throttle}
+	h.mu.Lock()
+	h.subscribers[subscriber] = struct{}{}
+	h.mu.Unlock()
+	return subscriber
+}
+
+// unsubscribe removes a subscriber
+func (h *pushHub) unsubscribe(subscriber *pushSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, subscriber)
+	h.mu.Unlock()
+}
+
+// selection returns the current selectors of the subscriber
+func (s *pushSubscriber) selection() []golrackpi.ProcessData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selectors
+}
+
+// update replaces selectors and throttle of the subscriber
+func (s *pushSubscriber) update(selectors []golrackpi.ProcessData, throttle time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.selectors = selectors
+	s.throttle = throttle
+	s.lastSent = time.Time{}
+}
+
+// send queues the message, unless the last message was sent within the throttle of the subscriber.
+// A message which was not fetched yet is replaced by the newer one.
+func (s *pushSubscriber) send(message pushMessage, now time.Time, ignoreThrottle bool) {
+	s.mu.Lock()
+	if !ignoreThrottle && now.Sub(s.lastSent) < s.throttle {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSent = now
+	s.mu.Unlock()
+
+	for {
+		select {
+		case s.messages <- message:
+			return
+		default:
+		}
+		select {
+		case <-s.messages:
+		default:
+		}
+	}
+}
+
+// mergeSelectors returns the union of the process-data of a and b
+func mergeSelectors(a []golrackpi.ProcessData, b []golrackpi.ProcessData) []golrackpi.ProcessData {
+	merged := make([]golrackpi.ProcessData, 0, len(a)+len(b))
+	index := make(map[string]int)
+	for _, selectors := range [][]golrackpi.ProcessData{a, b} {
+		for _, selector := range selectors {
+			i, found := index[selector.ModuleId]
+			if !found {
+				index[selector.ModuleId] = len(merged)
+				merged = append(merged, golrackpi.ProcessData{ModuleId: selector.ModuleId})
+				i = len(merged) - 1
+			}
+			for _, id := range selector.ProcessDataIds {
+				if !containsId(merged[i].ProcessDataIds, id) {
+					merged[i].ProcessDataIds = append(merged[i].ProcessDataIds, id)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// filterValues returns the values which are selected by the selectors
+func filterValues(values []golrackpi.ProcessDataValues, selectors []golrackpi.ProcessData) []golrackpi.ProcessDataValues {
+	var filtered []golrackpi.ProcessDataValues
+	for _, module := range values {
+		for _, selector := range selectors {
+			if selector.ModuleId != module.ModuleId {
+				continue
+			}
+			m := golrackpi.ProcessDataValues{ModuleId: module.ModuleId}
+			for _, value := range module.ProcessData {
+				if containsId(selector.ProcessDataIds, value.Id) {
+					m.ProcessData = append(m.ProcessData, value)
+				}
+			}
+			if len(m.ProcessData) > 0 {
+				filtered = append(filtered, m)
+			}
+		}
+	}
+	return filtered
+}
+
+// containsId returns true if the id is part of the list
+func containsId(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSubscription returns the selectors and the throttle of a subscription
+func parseSubscription(subscription pushSubscription) ([]golrackpi.ProcessData, time.Duration, error) {
+	if len(subscription.Select) == 0 {
+		return nil, 0, errors.New("please select process-data in the format moduleid|processdataid,processdataid")
+	}
+	for _, selector := range subscription.Select {
+		if !strings.Contains(selector, "|") {
+			return nil, 0, fmt.Errorf("wrong format of selector %q, please use moduleid|processdataid,processdataid", selector)
+		}
+	}
+	selectors, err := parseProcessdataArgs(subscription.Select)
+	if err != nil {
+		return nil, 0, err
+	}
+	var throttle time.Duration
+	if subscription.Throttle != "" {
+		if throttle, err = time.ParseDuration(subscription.Throttle); err != nil || throttle < 0 {
+			return nil, 0, fmt.Errorf("wrong format of throttle %q", subscription.Throttle)
+		}
+	}
+	return mergeSelectors(nil, selectors), throttle, nil
+}
+
+// allowedOrigin returns true if the origin of a browser request is allowed by --allow-origin. Requests without origin and
+// requests from the same host are always allowed.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "http://"+r.Host || origin == "https://"+r.Host {
+		return true
+	}
+	for _, allowed := range serveAllowOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// handleStream handles GET /stream?select=...&throttle=... and sends the values as server-sent events
+func (h *pushHub) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeGatewayError(w, gatewayError{http.StatusMethodNotAllowed, errors.New("method not allowed")})
+		return
+	}
+	if !allowedOrigin(r) {
+		writeGatewayError(w, gatewayError{http.StatusForbidden, errors.New("origin not allowed")})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeGatewayError(w, errors.New("streaming not supported"))
+		return
+	}
+	query := r.URL.Query()
+	selectors, throttle, err := h.subscription(pushSubscription{Select: query["select"], Throttle: query.Get("throttle")})
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	subscriber := h.subscribe(selectors, throttle)
+	defer h.unsubscribe(subscriber)
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case message := <-subscriber.messages:
+			b, err := json.Marshal(message)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, b)
+		}
+		flusher.Flush()
+	}
+}
+
+// handleWebSocket handles GET /ws. The subscription is set by the query parameters select and throttle and can be changed by
+// sending a JSON object {"select": [...], "throttle": "5s"}.
+func (h *pushHub) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: allowedOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	query := r.URL.Query()
+	var subscriber *pushSubscriber
+	if selectors, throttle, err := h.subscription(pushSubscription{Select: query["select"], Throttle: query.Get("throttle")}); err == nil {
+		subscriber = h.subscribe(selectors, throttle)
+	} else {
+		subscriber = h.subscribe(nil, 0)
+		if len(query["select"]) > 0 {
+			subscriber.send(pushMessage{Type: "error", Time: time.Now(), Error: err.Error()}, time.Now(), true)
+		}
+	}
+	defer h.unsubscribe(subscriber)
+
+	// read subscription changes until the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var subscription pushSubscription
+			if err := conn.ReadJSON(&subscription); err != nil {
+				var syntaxErr *json.SyntaxError
+				if errors.As(err, &syntaxErr) {
+					subscriber.send(pushMessage{Type: "error", Time: time.Now(), Error: err.Error()}, time.Now(), true)
+					continue
+				}
+				return
+			}
+			selectors, throttle, err := h.subscription(subscription)
+			if err != nil {
+				subscriber.send(pushMessage{Type: "error", Time: time.Now(), Error: err.Error()}, time.Now(), true)
+				continue
+			}
+			subscriber.update(selectors, throttle)
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case message := <-subscriber.messages:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(message); err != nil {
+				fmt.Fprintln(os.Stderr, "WebSocket error:", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+func TestMergeSelectors(t *testing.T) {
+	a := []golrackpi.ProcessData{
+		{ModuleId: "devices:local", ProcessDataIds: []string{"Dc_P", "Home_P"}},
+	}
+	b := []golrackpi.ProcessData{
+		{ModuleId: "devices:local:battery", ProcessDataIds: []string{"SoC"}},
+		{ModuleId: "devices:local", ProcessDataIds: []string{"Home_P", "Grid_P"}},
+	}
+	want := []golrackpi.ProcessData{
+		{ModuleId: "devices:local", ProcessDataIds: []string{"Dc_P", "Home_P", "Grid_P"}},
+		{ModuleId: "devices:local:battery", ProcessDataIds: []string{"SoC"}},
+	}
+	if got := mergeSelectors(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := mergeSelectors(nil, nil); len(got) != 0 {
+		t.Errorf("empty selectors: got %+v", got)
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	values := []golrackpi.ProcessDataValues{
+		{ModuleId: "devices:local", ProcessData: []golrackpi.ProcessDataValue{{Id: "Dc_P", Value: 1.0}, {Id: "Home_P", Value: 2.0}}},
+		{ModuleId: "devices:local:battery", ProcessData: []golrackpi.ProcessDataValue{{Id: "SoC", Value: 3.0}}},
+	}
+	tests := []struct {
+		selectors []golrackpi.ProcessData
+		want      []golrackpi.ProcessDataValues
+	}{
+		{
+			[]golrackpi.ProcessData{{ModuleId: "devices:local", ProcessDataIds: []string{"Home_P"}}},
+			[]golrackpi.ProcessDataValues{{ModuleId: "devices:local", ProcessData: []golrackpi.ProcessDataValue{{Id: "Home_P", Value: 2.0}}}},
+		},
+		{
+			[]golrackpi.ProcessData{{ModuleId: "devices:local:battery", ProcessDataIds: []string{"SoC"}}, {ModuleId: "devices:local", ProcessDataIds: []string{"Dc_P"}}},
+			[]golrackpi.ProcessDataValues{
+				{ModuleId: "devices:local", ProcessData: []golrackpi.ProcessDataValue{{Id: "Dc_P", Value: 1.0}}},
+				{ModuleId: "devices:local:battery", ProcessData: []golrackpi.ProcessDataValue{{Id: "SoC", Value: 3.0}}},
+			},
+		},
+		{
+			[]golrackpi.ProcessData{{ModuleId: "devices:local", ProcessDataIds: []string{"Grid_P"}}},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		if got := filterValues(values, test.selectors); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("selectors %+v: got %+v, want %+v", test.selectors, got, test.want)
+		}
+	}
+}
+
+func TestPushSubscriberSend(t *testing.T) {
+	subscriber := &pushSubscriber{messages: make(chan pushMessage, 1), throttle: 10 * time.Second}
+	start := time.Now()
+
+	subscriber.send(pushMessage{Type: "processdata", Time: start}, start, false)
+	subscriber.send(pushMessage{Type: "processdata", Time: start.Add(5 * time.Second)}, start.Add(5*time.Second), false)
+	if message := <-subscriber.messages; !message.Time.Equal(start) {
+		t.Errorf("message within throttle sent: got %v", message.Time)
+	}
+
+	// errors ignore the throttle, an unread message is replaced by the newer one
+	subscriber.send(pushMessage{Type: "error", Time: start.Add(6 * time.Second)}, start.Add(6*time.Second), true)
+	subscriber.send(pushMessage{Type: "processdata", Time: start.Add(16 * time.Second)}, start.Add(16*time.Second), false)
+	if message := <-subscriber.messages; message.Type != "processdata" || !message.Time.Equal(start.Add(16*time.Second)) {
+		t.Errorf("got %+v", message)
+	}
+	select {
+	case message := <-subscriber.messages:
+		t.Errorf("unexpected message %+v", message)
+	default:
+	}
+
+	// a new subscription resets the throttle
+	subscriber.update(nil, 10*time.Second)
+	subscriber.send(pushMessage{Type: "processdata", Time: start.Add(17 * time.Second)}, start.Add(17*time.Second), false)
+	if len(subscriber.messages) != 1 {
+		t.Error("message after update not sent")
+	}
+}
+
+func TestPushHubSubscription(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	hub := newPushHub(golrackpi.NewSession(sim.Client()), time.Second)
+	defer hub.session.Close()
+
+	tests := []struct {
+		selectors []string
+		status    int
+	}{
+		{[]string{"devices:local|Dc_P,Home_P"}, 0},
+		{[]string{"devices:local|Dc_P", "unknown|Dc_P"}, http.StatusBadRequest},
+		{[]string{"devices:local|Unknown"}, http.StatusBadRequest},
+		{[]string{"devices:local"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		_, _, err := hub.subscription(pushSubscription{Select: test.selectors})
+		var gwErr gatewayError
+		if test.status == 0 && err != nil || test.status != 0 && (!errors.As(err, &gwErr) || gwErr.status != test.status) {
+			t.Errorf("%v: got %v, want status %d", test.selectors, err, test.status)
+		}
+	}
+
+	// subscribers with checked selectors receive their values
+	selectors, _, err := hub.subscription(pushSubscription{Select: []string{"devices:local|Dc_P"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber := hub.subscribe(selectors, 0)
+	hub.poll()
+	if message := <-subscriber.messages; message.Type != "processdata" || len(message.Modules) != 1 {
+		t.Errorf("got %+v", message)
+	}
+}
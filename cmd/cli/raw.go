@@ -0,0 +1,94 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rawCompact bool = false
+	rawYes     bool = false
+)
+
+func init() {
+	rawCmd.Flags().BoolVarP(&rawCompact, "compact", "", false, "Print the response as sent by the inverter instead of indented JSON")
+	rawCmd.Flags().BoolVarP(&rawYes, "yes", "y", false, "Send requests other than GET to all inverters selected by --fleet or --tag")
+
+	rootCmd.AddCommand(rawCmd)
+}
+
+var rawCmd = &cobra.Command{
+	Use: "raw <method> <path> [body]",
+
+	Short: "Send a request to any endpoint of the inverter API",
+	Long: `Send a request to any endpoint of the inverter API and print the response, e.g.
+
+  golrackpi raw GET /api/v1/info/version
+  golrackpi raw PUT /api/v1/settings '[{"moduleid":"devices:local","settings":[{"id":"Battery:MinSoc","value":"10"}]}]'
+
+The request is sent after login with the session of the client. A body of "-" is read from stdin.
+JSON responses are printed indented unless --compact is set. With --fleet or --tag, GET requests are sent to every selected inverter;
+other methods, which may change the inverters, additionally require --yes.`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		rawRequest(args)
+	},
+}
+
+// rawRequest sends the request defined by method, path and optional body and prints the response
+func rawRequest(args []string) {
+	method := strings.ToUpper(args[0])
+	if method == "" {
+		method = http.MethodGet
+	}
+	if fleetMode() && method != http.MethodGet && method != http.MethodHead && !rawYes {
+		fmt.Fprintf(os.Stderr, "Please select a single inverter or add --yes to send the %s request to all selected inverters.\n", method)
+		return
+	}
+
+	var body interface{}
+	if len(args) == 3 {
+		if args[2] == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "An error occurred:", err)
+				return
+			}
+			body = data
+		} else {
+			body = []byte(args[2])
+		}
+	}
+
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		var response []byte
+		if err := lib.Do(context.Background(), method, args[1], body, &response); err != nil {
+			return err
+		}
+		if !rawCompact {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, response, "", "  "); err == nil {
+				response = indented.Bytes()
+			}
+		}
+		w.Write(response)
+		if len(response) > 0 && response[len(response)-1] != '\n' {
+			fmt.Fprintln(w)
+		}
+		return nil
+	})
+}
@@ -33,11 +33,9 @@ var (
 
 // init sets the global flags and their options.
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&authData.Password, "password", "p", "", "Password (required)")
-	rootCmd.PersistentFlags().StringVarP(&authData.Server, "server", "s", "", "Server (e.g. inverter IP address) (required)")
+	rootCmd.PersistentFlags().StringVarP(&authData.Password, "password", "p", "", "Password (required without --inverter, --fleet or --tag)")
+	rootCmd.PersistentFlags().StringVarP(&authData.Server, "server", "s", "", "Server (e.g. inverter IP address) (required without --inverter, --fleet or --tag)")
 	rootCmd.PersistentFlags().StringVarP(&authData.Scheme, "scheme", "m", "", "Scheme (http or https, default http)")
-	rootCmd.MarkPersistentFlagRequired("password")
-	rootCmd.MarkPersistentFlagRequired("server")
 
 }
 
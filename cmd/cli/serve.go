@@ -0,0 +1,499 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/spf13/cobra"
+)
+
+// gatewayCacheSize is the maximum number of cached responses
+const gatewayCacheSize = 1000
+
+var (
+	serveListen       string        = "127.0.0.1:8680"
+	serveTokens       []string      = []string{}
+	serveNoAuth       bool          = false
+	serveAllowWrite   bool          = false
+	serveCacheTTL     time.Duration = 5 * time.Second
+	servePushInterval time.Duration = 5 * time.Second
+	serveAllowOrigins []string      = []string{}
+)
+
+func init() {
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "", "127.0.0.1:8680", "Address to serve the API on")
+	serveCmd.Flags().StringSliceVarP(&serveTokens, "token", "", []string{}, "Token which clients have to send as \"Authorization: Bearer <token>\" (can be repeated, default: $GOLRACKPI_SERVE_TOKEN)")
+	serveCmd.Flags().BoolVarP(&serveNoAuth, "no-auth", "", false, "Serve the API without token authentication")
+	serveCmd.Flags().BoolVarP(&serveAllowWrite, "allow-write", "", false, "Allow to change settings with PUT /settings/{module} (default: read-only)")
+	serveCmd.Flags().DurationVarP(&serveCacheTTL, "cache-ttl", "", 5*time.Second, "Time to serve responses from the cache before the inverter is requested again")
+	serveCmd.Flags().DurationVarP(&servePushInterval, "push-interval", "", 5*time.Second, "Polling interval of the process-data subscribed by /stream and /ws clients")
+	serveCmd.Flags().StringSliceVarP(&serveAllowOrigins, "allow-origin", "", []string{}, "Origin of browser dashboards allowed to use /stream and /ws, or * for all (can be repeated, default: same origin)")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use: "serve",
+
+	Short: "Serve a local REST API which shares one inverter session",
+	Long: `Serve a simplified JSON API for other services, so they don't need to log in to the inverter themselves. All requests are sent
+through one long-lived session. Responses are cached for --cache-ttl (at most 1000 responses), and identical concurrent requests are combined into one inverter call.
+
+Endpoints:
+  GET /powerflow                           current power flow between PV generator, battery, grid and home
+  GET /processdata/{moduleid}/{ids}        process-data values, ids separated by comma
+  GET /events?language=en-gb&max=10        latest events
+  GET /statistics                          values of scb:statistic:EnergyFlow
+  PUT /settings/{moduleid}                 change settings with a JSON object {"id": "value"} (only with --allow-write)
+  GET /stream?select=...&throttle=2s       server-sent events with the values of the selected process-data
+  GET /ws?select=...&throttle=2s           WebSocket messages with the values of the selected process-data
+
+The process-data subscribed by /stream and /ws clients are polled by one shared request every --push-interval. Every client selects
+process-data with one or more select parameters in the format moduleid|processdataid,processdataid and limits the rate of its
+messages with throttle. WebSocket clients can change their subscription by sending {"select": [...], "throttle": "2s"}.
+
+Clients have to send one of the tokens set by --token as "Authorization: Bearer <token>" header or, e.g. for EventSource in browsers,
+as token query parameter.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runServe()
+	},
+}
+
+// gatewayValue specifies a process-data value in the responses of the gateway
+type gatewayValue struct {
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit,omitempty"`
+}
+
+// gatewayModule specifies the values of a module in the responses of the gateway
+type gatewayModule struct {
+	ModuleId string                  `json:"moduleid"`
+	Values   map[string]gatewayValue `json:"values"`
+}
+
+// gatewayResponse specifies a cached response
+type gatewayResponse struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// gatewayCall specifies a request to the inverter which is in progress. Identical requests wait for it instead of sending their own.
+type gatewayCall struct {
+	done     chan struct{}
+	response gatewayResponse
+	err      error
+}
+
+// gateway shares one session between all API requests and caches the responses
+type gateway struct {
+	session *golrackpi.Session
+	ttl     time.Duration
+	tokens  []string
+
+	mu    sync.Mutex
+	cache map[string]gatewayResponse
+	calls map[string]*gatewayCall
+}
+
+// gatewayError specifies an error with the HTTP status returned to the client
+type gatewayError struct {
+	status int
+	err    error
+}
+
+func (e gatewayError) Error() string {
+	return e.err.Error()
+}
+
+// runServe serves the API until the process is interrupted
+func runServe() {
+	var outErr io.Writer = os.Stderr
+
+	if servePushInterval < time.Second {
+		fmt.Fprintln(outErr, "Please submit a push interval of at least one second.")
+		return
+	}
+	if fleetMode() {
+		fmt.Fprintln(outErr, "Please select a single inverter, the gateway serves the API of one inverter.")
+		return
+	}
+
+	tokens := serveTokens
+	if len(tokens) == 0 && os.Getenv("GOLRACKPI_SERVE_TOKEN") != "" {
+		tokens = []string{os.Getenv("GOLRACKPI_SERVE_TOKEN")}
+	}
+	if len(tokens) == 0 && !serveNoAuth {
+		fmt.Fprintln(outErr, "Please submit a token with --token or use --no-auth to serve the API without authentication.")
+		return
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	g := &gateway{
+		session: golrackpi.NewSession(lib),
+		ttl:     serveCacheTTL,
+		tokens:  tokens,
+		cache:   make(map[string]gatewayResponse),
+		calls:   make(map[string]*gatewayCall),
+	}
+	defer g.session.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/powerflow", g.handle(g.powerFlow))
+	mux.HandleFunc("/processdata/", g.handle(g.processData))
+	mux.HandleFunc("/events", g.handle(g.events))
+	mux.HandleFunc("/statistics", g.handle(g.statistics))
+	mux.HandleFunc("/settings/", g.authorize(g.updateSettings))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hub := newPushHub(g.session, servePushInterval)
+	go hub.run(ctx)
+	mux.HandleFunc("/stream", g.authorize(hub.handleStream))
+	mux.HandleFunc("/ws", g.authorize(hub.handleWebSocket))
+
+	// the streams of /stream and /ws end with the context of the server
+	server := &http.Server{Addr: serveListen, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	mode := "read-only"
+	if serveAllowWrite {
+		mode = "read-write"
+	}
+	fmt.Fprintf(outErr, "Serving %s API on %s\n", mode, serveListen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+	}
+}
+
+// authorize returns a handler which calls next only for requests with a valid token
+func (g *gateway) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(g.tokens) > 0 {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found && r.URL.Query().Has("token") {
+				// browsers can't set headers for EventSource and WebSocket requests
+				token, found = r.URL.Query().Get("token"), true
+			}
+			valid := false
+			for _, t := range g.tokens {
+				if found && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					valid = true
+				}
+			}
+			if !valid {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeGatewayError(w, gatewayError{http.StatusUnauthorized, errors.New("missing or invalid token")})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// handle returns a handler for GET requests, which answers with the cached or coalesced result of fn.
+// fn returns the cache key of the request and the function to request the inverter.
+func (g *gateway) handle(fn func(r *http.Request) (string, func(client *golrackpi.AuthClient) (interface{}, error), error)) http.HandlerFunc {
+	return g.authorize(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeGatewayError(w, gatewayError{http.StatusMethodNotAllowed, errors.New("method not allowed")})
+			return
+		}
+		key, request, err := fn(r)
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+		response, err := g.get(key, request)
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+
+		maxAge := int(time.Until(response.expires).Seconds())
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+		w.Header().Set("ETag", response.etag)
+		if r.Header.Get("If-None-Match") == response.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response.body)
+	})
+}
+
+// get returns the cached response of key. Otherwise the inverter is requested, and concurrent calls with the same key wait for this request.
+func (g *gateway) get(key string, request func(client *golrackpi.AuthClient) (interface{}, error)) (gatewayResponse, error) {
+	g.mu.Lock()
+	if response, found := g.cache[key]; found && time.Now().Before(response.expires) {
+		g.mu.Unlock()
+		return response, nil
+	}
+	if call, found := g.calls[key]; found {
+		g.mu.Unlock()
+		<-call.done
+		return call.response, call.err
+	}
+	call := &gatewayCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.response, call.err = g.request(request)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	if call.err == nil {
+		g.store(key, call.response)
+	}
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.response, call.err
+}
+
+// store adds a response to the cache. The cache keys contain the request parameters of the clients, so the number of entries is
+// limited: if the cache is full, the expired entries are removed, and if it is still full, the entry which expires first.
+// g.mu must be held.
+func (g *gateway) store(key string, response gatewayResponse) {
+	if _, found := g.cache[key]; !found && len(g.cache) >= gatewayCacheSize {
+		now := time.Now()
+		oldest := ""
+		for k, cached := range g.cache {
+			if !now.Before(cached.expires) {
+				delete(g.cache, k)
+			} else if oldest == "" || cached.expires.Before(g.cache[oldest].expires) {
+				oldest = k
+			}
+		}
+		if len(g.cache) >= gatewayCacheSize {
+			delete(g.cache, oldest)
+		}
+	}
+	g.cache[key] = response
+}
+
+// request requests the inverter and returns the JSON encoded result
+func (g *gateway) request(request func(client *golrackpi.AuthClient) (interface{}, error)) (gatewayResponse, error) {
+	var result interface{}
+	err := g.session.Do(func(client *golrackpi.AuthClient) error {
+		var err error
+		result, err = request(client)
+		return err
+	})
+	if err != nil {
+		return gatewayResponse{}, gatewayError{http.StatusBadGateway, err}
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return gatewayResponse{}, err
+	}
+	sum := sha256.Sum256(body)
+	return gatewayResponse{
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+		expires: time.Now().Add(g.ttl),
+	}, nil
+}
+
+// powerFlow handles GET /powerflow
+func (g *gateway) powerFlow(r *http.Request) (string, func(client *golrackpi.AuthClient) (interface{}, error), error) {
+	return "powerflow", func(client *golrackpi.AuthClient) (interface{}, error) {
+		return client.PowerFlow()
+	}, nil
+}
+
+// processData handles GET /processdata/{moduleid}/{ids}
+func (g *gateway) processData(r *http.Request) (string, func(client *golrackpi.AuthClient) (interface{}, error), error) {
+	moduleId, ids, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/processdata/"), "/")
+	if moduleId == "" || ids == "" || strings.Contains(ids, "/") {
+		return "", nil, gatewayError{http.StatusNotFound, errors.New("please request /processdata/{moduleid}/{ids}")}
+	}
+	processDataIds := strings.Split(ids, ",")
+	return "processdata/" + moduleId + "/" + ids, func(client *golrackpi.AuthClient) (interface{}, error) {
+		values, err := client.ProcessDataModuleValues(moduleId, processDataIds...)
+		if err != nil {
+			return nil, err
+		}
+		return gatewayModules(values), nil
+	}, nil
+}
+
+// events handles GET /events with the optional query parameters language and max
+func (g *gateway) events(r *http.Request) (string, func(client *golrackpi.AuthClient) (interface{}, error), error) {
+	language := r.URL.Query().Get("language")
+	max := 0
+	if value := r.URL.Query().Get("max"); value != "" {
+		var err error
+		if max, err = strconv.Atoi(value); err != nil || max < 0 {
+			return "", nil, gatewayError{http.StatusBadRequest, errors.New("max must be a positive number")}
+		}
+	}
+	return "events/" + language + "/" + strconv.Itoa(max), func(client *golrackpi.AuthClient) (interface{}, error) {
+		return client.EventsWithParam(language, max)
+	}, nil
+}
+
+// statistics handles GET /statistics
+func (g *gateway) statistics(r *http.Request) (string, func(client *golrackpi.AuthClient) (interface{}, error), error) {
+	return "statistics", func(client *golrackpi.AuthClient) (interface{}, error) {
+		values, err := client.ProcessDataModule(statisticModule)
+		if err != nil {
+			return nil, err
+		}
+		modules := gatewayModules(values)
+		if len(modules) == 0 {
+			return gatewayModule{ModuleId: statisticModule, Values: map[string]gatewayValue{}}, nil
+		}
+		return modules[0], nil
+	}, nil
+}
+
+// updateSettings handles PUT /settings/{moduleid} with a JSON object of setting ids and values
+func (g *gateway) updateSettings(w http.ResponseWriter, r *http.Request) {
+	if !serveAllowWrite {
+		writeGatewayError(w, gatewayError{http.StatusForbidden, errors.New("the gateway is read-only")})
+		return
+	}
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", "PUT")
+		writeGatewayError(w, gatewayError{http.StatusMethodNotAllowed, errors.New("method not allowed")})
+		return
+	}
+	moduleId := strings.TrimPrefix(r.URL.Path, "/settings/")
+	if moduleId == "" || strings.Contains(moduleId, "/") {
+		writeGatewayError(w, gatewayError{http.StatusNotFound, errors.New("please request /settings/{moduleid}")})
+		return
+	}
+
+	var values map[string]string
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&values); err != nil || len(values) == 0 {
+		writeGatewayError(w, gatewayError{http.StatusBadRequest, errors.New("please submit a JSON object with setting ids and values")})
+		return
+	}
+
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var result []golrackpi.ModuleSettings
+	err := g.session.Do(func(client *golrackpi.AuthClient) error {
+		settings, err := client.Settings()
+		if err != nil {
+			return err
+		}
+		meta, found := golrackpi.SettingsData{}, false
+		for _, s := range settings {
+			if s.ModuleId == moduleId {
+				meta, found = s, true
+				break
+			}
+		}
+		if !found {
+			return gatewayError{http.StatusNotFound, fmt.Errorf("module %s not found", moduleId)}
+		}
+
+		// nothing is written if one of the values is rejected
+		module := golrackpi.ModuleSettings{ModuleId: moduleId}
+		var invalid []string
+		for _, id := range ids {
+			setting, found := meta.Setting(id)
+			if !found {
+				invalid = append(invalid, fmt.Sprintf("setting %s not found", id))
+				continue
+			}
+			if err := setting.Validate(values[id]); err != nil {
+				invalid = append(invalid, err.Error())
+				continue
+			}
+			module.Settings = append(module.Settings, golrackpi.SettingsValues{Id: id, Value: values[id]})
+		}
+		if len(invalid) > 0 {
+			return gatewayError{http.StatusBadRequest, fmt.Errorf("invalid settings: %s", strings.Join(invalid, "; "))}
+		}
+
+		result, err = client.UpdateSettings([]golrackpi.ModuleSettings{module})
+		return err
+	})
+	var gwErr gatewayError
+	if errors.As(err, &gwErr) {
+		writeGatewayError(w, gwErr)
+		return
+	}
+	if err != nil {
+		writeGatewayError(w, gatewayError{http.StatusBadGateway, err})
+		return
+	}
+
+	// cached responses may contain the old values
+	g.mu.Lock()
+	g.cache = make(map[string]gatewayResponse)
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// gatewayModules converts process-data values to the response format of the gateway
+func gatewayModules(values []golrackpi.ProcessDataValues) []gatewayModule {
+	modules := []gatewayModule{}
+	for _, module := range values {
+		m := gatewayModule{ModuleId: module.ModuleId, Values: make(map[string]gatewayValue)}
+		for _, value := range module.ProcessData {
+			m.Values[value.Id] = gatewayValue{Value: value.Value, Unit: value.Unit}
+		}
+		modules = append(modules, m)
+	}
+	return modules
+}
+
+// writeGatewayError writes an error as JSON object with the HTTP status of the error
+func writeGatewayError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var gwErr gatewayError
+	if errors.As(err, &gwErr) {
+		status = gwErr.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
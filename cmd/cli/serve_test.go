@@ -0,0 +1,128 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+func TestGatewayCache(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	g := &gateway{
+		session: golrackpi.NewSession(sim.Client()),
+		ttl:     time.Minute,
+		cache:   make(map[string]gatewayResponse),
+		calls:   make(map[string]*gatewayCall),
+	}
+	defer g.session.Close()
+
+	requests := 0
+	request := func(client *golrackpi.AuthClient) (interface{}, error) {
+		requests++
+		return requests, nil
+	}
+	first, err := g.get("a", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := g.get("a", request); requests != 1 || string(cached.body) != string(first.body) {
+		t.Errorf("response not cached: %d requests", requests)
+	}
+
+	// expired entries are removed when the cache is full, then the entry which expires first
+	now := time.Now()
+	g.cache["expired"] = gatewayResponse{expires: now.Add(-time.Second)}
+	for i := len(g.cache); i < gatewayCacheSize-1; i++ {
+		g.cache[strconv.Itoa(i)] = gatewayResponse{expires: now.Add(time.Duration(i) * time.Second)}
+	}
+	g.cache["first"] = gatewayResponse{expires: now.Add(500 * time.Millisecond)}
+	if _, err := g.get("b", request); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := g.cache["expired"]; found || len(g.cache) != gatewayCacheSize {
+		t.Errorf("expired entry not removed, %d entries", len(g.cache))
+	}
+	if _, err := g.get("c", request); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := g.cache["first"]; found || len(g.cache) != gatewayCacheSize {
+		t.Errorf("entry which expires first not removed, %d entries", len(g.cache))
+	}
+	if _, found := g.cache["a"]; !found {
+		t.Error("valid entry removed")
+	}
+}
+
+func TestGatewayUpdateSettings(t *testing.T) {
+	saved := serveAllowWrite
+	defer func() { serveAllowWrite = saved }()
+	serveAllowWrite = true
+
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	g := &gateway{
+		session: golrackpi.NewSession(sim.Client()),
+		ttl:     time.Minute,
+		cache:   make(map[string]gatewayResponse),
+		calls:   make(map[string]*gatewayCall),
+	}
+	defer g.session.Close()
+
+	tests := []struct {
+		path, body string
+		status     int
+		failing    []string
+	}{
+		{"/settings/devices:local", `{"Battery:MinSoc":"150","Inverter:MaxApparentPower":"1","Unknown":"1","Battery:MinHomeComsumption":"100"}`, http.StatusBadRequest, []string{"Battery:MinSoc", "Inverter:MaxApparentPower", "Unknown"}},
+		{"/settings/unknown", `{"Battery:MinSoc":"20"}`, http.StatusNotFound, nil},
+		{"/settings/devices:local", `{"Battery:MinSoc":"20"}`, http.StatusOK, nil},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		g.updateSettings(w, httptest.NewRequest(http.MethodPut, test.path, strings.NewReader(test.body)))
+		if w.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.path, test.body, w.Code, test.status)
+		}
+		var response map[string]string
+		json.NewDecoder(w.Body).Decode(&response)
+		for _, id := range test.failing {
+			if !strings.Contains(response["error"], id) {
+				t.Errorf("%s: %s missing in %q", test.body, id, response["error"])
+			}
+		}
+	}
+
+	// the rejected request didn't write the valid value
+	var values []golrackpi.SettingsValues
+	err = g.session.Do(func(client *golrackpi.AuthClient) error {
+		var err error
+		values, err = client.SettingsModuleSettings("devices:local", "Battery:MinSoc", "Battery:MinHomeComsumption")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range values {
+		if value.Id == "Battery:MinSoc" && value.Value != "20" || value.Id == "Battery:MinHomeComsumption" && value.Value == "100" {
+			t.Errorf("got %+v", values)
+		}
+	}
+}
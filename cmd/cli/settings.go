@@ -5,15 +5,22 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/geschke/golrackpi"
 	"github.com/spf13/cobra"
 )
 
+var (
+	settingsYes    bool = false
+	settingsDryRun bool = false
+)
+
 func init() {
 
 	settingsModuleCmd.Flags().BoolVarP(&outputCSV, "csv", "c", false, "Set output to CSV format")
@@ -37,11 +44,15 @@ func init() {
 	settingsModuleSettingsCmd.Flags().BoolVarP(&outputAppend, "append", "a", false, "Append output to file (default: overwrite content)")
 	settingsModuleSettingsCmd.Flags().BoolVarP(&outputNoHeaders, "no-headers", "", false, "Omit headline in CSV output")
 
+	settingsSetCmd.Flags().BoolVarP(&settingsYes, "yes", "y", false, "Apply changes without confirmation")
+	settingsSetCmd.Flags().BoolVarP(&settingsDryRun, "dry-run", "n", false, "Show and validate changes, but don't write them")
+
 	rootCmd.AddCommand(settingsCmd)
 	settingsCmd.AddCommand(settingsListCmd)
 	settingsCmd.AddCommand(settingsModuleCmd)
 	settingsCmd.AddCommand(settingsModuleSettingCmd)
 	settingsCmd.AddCommand(settingsModuleSettingsCmd)
+	settingsCmd.AddCommand(settingsSetCmd)
 
 }
 
@@ -104,37 +115,37 @@ var settingsModuleSettingsCmd = &cobra.Command{
 	},
 }
 
-// listSettings prints a (huge) list of module ids with their corresponding setting ids
-func listSettings() {
-	var outErr io.Writer = os.Stderr
+var settingsSetCmd = &cobra.Command{
+	Use: "set <moduleid> <settingid>=<value> [<settingid>=<value> ...]",
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
-	})
-
-	_, err := lib.Login()
-	defer lib.Logout()
+	Short: "Write module setting values.",
+	Long: `Write one or more setting values of a module.
 
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-
-	settings, err := lib.Settings()
+The current values are read first and shown together with the new values. The new values are validated against
+type, access mode and min and max limits of the setting. After confirmation (or with --yes), the values are written and read
+back to verify that they were applied. With --dry-run, the changes are only shown and validated.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		setSettings(args)
+	},
+}
 
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	for _, s := range settings {
-		fmt.Println(s.ModuleId)
-		for _, data := range s.Settings {
-			fmt.Println("\t", data.Id)
+// listSettings prints a (huge) list of module ids with their corresponding setting ids
+func listSettings() {
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		settings, err := lib.Settings()
+		if err != nil {
+			return err
 		}
-	}
-
+		for _, s := range settings {
+			fmt.Fprintln(w, s.ModuleId)
+			for _, data := range s.Settings {
+				fmt.Fprintln(w, "\t", data.Id)
+			}
+		}
+		return nil
+	})
 }
 
 // getSettingsModule takes a module id as argument and prints setting ids and their current values
@@ -151,26 +162,14 @@ func getSettingsModule(args []string) {
 
 	moduleId := args[0]
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		values, err := lib.SettingsModule(moduleId)
+		if err != nil {
+			return err
+		}
+		writeSettingsValues(w, values)
+		return nil
 	})
-
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	values, err := lib.SettingsModule(moduleId)
-
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	writeSettingsValues(values)
 }
 
 // getSettingsModuleSetting takes a module id and a setting id as arguments and prints setting ids and their current value
@@ -188,28 +187,14 @@ func getSettingsModuleSetting(args []string) {
 	moduleId := args[0]
 	settingId := args[1]
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		values, err := lib.SettingsModuleSetting(moduleId, settingId)
+		if err != nil {
+			return err
+		}
+		writeSettingsValues(w, values)
+		return nil
 	})
-
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	values, err := lib.SettingsModuleSetting(moduleId, settingId)
-
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-
-	writeSettingsValues(values)
-
 }
 
 // getSettingsModuleSettings takes a module id and one or more setting ids as arguments and prints setting ids and their current value
@@ -224,47 +209,18 @@ func getSettingsModuleSettings(args []string) {
 	settingIds := args[1:]
 	moduleId := args[0]
 
-	lib := golrackpi.NewWithParameter(golrackpi.AuthClient{
-		Scheme:   authData.Scheme,
-		Server:   authData.Server,
-		Password: authData.Password,
+	runRead(func(lib *golrackpi.AuthClient, w io.Writer) error {
+		values, err := lib.SettingsModuleSettings(moduleId, settingIds...)
+		if err != nil {
+			return err
+		}
+		writeSettingsValues(w, values)
+		return nil
 	})
-
-	_, err := lib.Login()
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	defer lib.Logout()
-
-	values, err := lib.SettingsModuleSettings(moduleId, settingIds...)
-
-	if err != nil {
-		fmt.Fprintln(outErr, "An error occurred:", err)
-		return
-	}
-	writeSettingsValues(values)
-
 }
 
 // writeSettingValues is a helper function to print a slice of setting ids and their value
-func writeSettingsValues(values []golrackpi.SettingsValues) {
-
-	var outErr io.Writer = os.Stderr
-	var w io.Writer
-
-	f, err := getOutFile()
-	if err != nil {
-		fmt.Fprintln(outErr, "Could not open file ", outputFile)
-		return
-	}
-	if f != nil {
-		w = f
-		defer closeOutFile(f)
-	} else {
-		w = os.Stdout
-	}
-
+func writeSettingsValues(w io.Writer, values []golrackpi.SettingsValues) {
 	if outputCSV {
 		if !outputNoHeaders {
 			if outputTimestamp {
@@ -296,6 +252,178 @@ func writeSettingsValues(values []golrackpi.SettingsValues) {
 
 }
 
+// setSettings takes a module id and one or more "settingid=value" pairs as arguments. It shows the current and new values,
+// validates and writes them after confirmation and checks the result by reading them back.
+func setSettings(args []string) {
+	var outErr io.Writer = os.Stderr
+
+	moduleId := args[0]
+	newValues, settingIds, err := parseSettingAssignments(args[1:])
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	lib, err := newClient()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	_, err = lib.Login()
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	defer lib.Logout()
+
+	meta, err := settingsMeta(lib, moduleId)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	current, err := lib.SettingsModuleSettings(moduleId, settingIds...)
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+	currentValues := make(map[string]string)
+	for _, v := range current {
+		currentValues[v.Id] = v.Value
+	}
+
+	valid := true
+	var changes []golrackpi.SettingsValues
+	fmt.Println("Id\tCurrent\tNew")
+	for _, id := range settingIds {
+		setting, found := meta.Setting(id)
+		if !found {
+			fmt.Fprintf(outErr, "Setting %s not found in module %s.\n", id, moduleId)
+			valid = false
+			continue
+		}
+		currentValue, found := currentValues[id]
+		if !found {
+			fmt.Fprintf(outErr, "Could not read current value of setting %s.\n", id)
+			valid = false
+			continue
+		}
+		if setting.EqualValues(currentValue, newValues[id]) {
+			fmt.Printf("%s\t%s\t(unchanged)\n", id, currentValue)
+			continue
+		}
+		fmt.Printf("%s\t%s%s\t%s%s\n", id, currentValue, unitSuffix(setting.Unit), newValues[id], unitSuffix(setting.Unit))
+		if err := setting.Validate(newValues[id]); err != nil {
+			fmt.Fprintln(outErr, "Invalid value:", err)
+			valid = false
+			continue
+		}
+		changes = append(changes, golrackpi.SettingsValues{Id: id, Value: newValues[id]})
+	}
+	fmt.Println()
+
+	if !valid {
+		fmt.Fprintln(outErr, "No changes written.")
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing to change.")
+		return
+	}
+	if settingsDryRun {
+		fmt.Printf("Dry run: %d setting(s) would be changed.\n", len(changes))
+		return
+	}
+	if !settingsYes && !confirm(fmt.Sprintf("Write %d setting(s) of module %s to %s?", len(changes), moduleId, lib.Server)) {
+		fmt.Println("Aborted.")
+		return
+	}
+
+	_, err = lib.UpdateSettings([]golrackpi.ModuleSettings{{ModuleId: moduleId, Settings: changes}})
+	if err != nil {
+		fmt.Fprintln(outErr, "An error occurred:", err)
+		return
+	}
+
+	// read back the values to verify that they were applied
+	changedIds := make([]string, 0, len(changes))
+	for _, change := range changes {
+		changedIds = append(changedIds, change.Id)
+	}
+	readBack, err := lib.SettingsModuleSettings(moduleId, changedIds...)
+	if err != nil {
+		fmt.Fprintln(outErr, "Could not read back settings:", err)
+		return
+	}
+	applied := make(map[string]string)
+	for _, v := range readBack {
+		applied[v.Id] = v.Value
+	}
+	failed := 0
+	for _, change := range changes {
+		setting, _ := meta.Setting(change.Id)
+		if !setting.EqualValues(applied[change.Id], change.Value) {
+			fmt.Fprintf(outErr, "Setting %s was not applied, current value: %s\n", change.Id, applied[change.Id])
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Printf("%d setting(s) written and verified.\n", len(changes))
+	}
+}
+
+// parseSettingAssignments converts "settingid=value" arguments into a map of values and the list of setting ids in the submitted order
+func parseSettingAssignments(args []string) (map[string]string, []string, error) {
+	values := make(map[string]string)
+	var ids []string
+	for _, arg := range args {
+		id, value, found := strings.Cut(arg, "=")
+		id = strings.TrimSpace(id)
+		if !found || id == "" {
+			return values, ids, fmt.Errorf("wrong format of %q, please use <settingid>=<value>", arg)
+		}
+		if _, exists := values[id]; exists {
+			return values, ids, fmt.Errorf("setting %s submitted more than once", id)
+		}
+		values[id] = value
+		ids = append(ids, id)
+	}
+	return values, ids, nil
+}
+
+// settingsMeta returns the setting definitions (type, access, limits...) of a module
+func settingsMeta(lib *golrackpi.AuthClient, moduleId string) (golrackpi.SettingsData, error) {
+	settings, err := lib.Settings()
+	if err != nil {
+		return golrackpi.SettingsData{}, err
+	}
+	for _, s := range settings {
+		if s.ModuleId == moduleId {
+			return s, nil
+		}
+	}
+	return golrackpi.SettingsData{}, fmt.Errorf("module %s not found", moduleId)
+}
+
+// unitSuffix returns the unit with a leading space, or an empty string if there is no unit
+func unitSuffix(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	return " " + unit
+}
+
+// confirm asks a yes/no question on stdin and returns true if the answer is yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 /*
 * Handle settings-related commands
  */
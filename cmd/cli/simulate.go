@@ -0,0 +1,145 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/simulator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	simulateListen          string   = "127.0.0.1:8480"
+	simulateSpeed           float64  = 1
+	simulateStart           string   = ""
+	simulatePeakPower       float64  = 10000
+	simulateBatteryCapacity float64  = 10000
+	simulateBaseLoad        float64  = 300
+	simulateSeed            int64    = 0
+	simulateFaults          []string = []string{}
+	simulateEvents          []string = []string{}
+)
+
+func init() {
+	simulateCmd.Flags().StringVarP(&simulateListen, "listen", "", "127.0.0.1:8480", "Address to serve the simulated REST API on")
+	simulateCmd.Flags().Float64VarP(&simulateSpeed, "speed", "", 1, "Time acceleration factor, e.g. 60 to simulate one hour per minute")
+	simulateCmd.Flags().StringVarP(&simulateStart, "start", "", "", "Simulated start time in RFC3339 format or as date 2006-01-02 (default: now)")
+	simulateCmd.Flags().Float64VarP(&simulatePeakPower, "peak-power", "", 10000, "Peak power of the PV generator in W")
+	simulateCmd.Flags().Float64VarP(&simulateBatteryCapacity, "battery-capacity", "", 10000, "Battery capacity in Wh, 0 for an inverter without battery")
+	simulateCmd.Flags().Float64VarP(&simulateBaseLoad, "base-load", "", 300, "Base load of the home in W")
+	simulateCmd.Flags().Int64VarP(&simulateSeed, "seed", "", 0, "Seed of the weather and load variation")
+	simulateCmd.Flags().StringArrayVarP(&simulateFaults, "fault", "", []string{}, "Inject a fault, e.g. \"path=/api/v1/processdata,status=503,rate=0.1,after=1h,for=10m\" (can be repeated)")
+	simulateCmd.Flags().StringArrayVarP(&simulateEvents, "event", "", []string{}, "Raise an event, e.g. \"code=5014,category=error,description=Grid fault,after=2h,for=30m\" (can be repeated)")
+
+	rootCmd.AddCommand(simulateCmd)
+}
+
+var simulateCmd = &cobra.Command{
+	Use: "simulate",
+
+	Short: "Run a local server which simulates the REST API of an inverter",
+	Long: `Run a local HTTP server which behaves like the REST API of a Plenticore inverter, including the SCRAM login, modules,
+process-data, settings (including writes), events and version. The process-data follow PV, battery and home consumption curves over
+a simulated day, which can run faster than real time with --speed.
+
+The password is set with --password (default: "simulator"), the time zone of the simulated inverter with --timezone. Faults
+are specified as comma separated key=value pairs with the keys path (prefix), status, delay, rate, expire-session, after and for,
+events with the keys code, category, group, description, long-description, after and for. The durations after and for are
+measured in simulated time since start.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command,
+		args []string) {
+		runSimulator()
+	},
+}
+
+// simulatorConfig returns the simulator configuration of the command line flags
+func simulatorConfig() (simulator.Config, error) {
+	config := simulator.Config{
+		Password:        authData.Password,
+		Speed:           simulateSpeed,
+		PeakPower:       simulatePeakPower,
+		BatteryCapacity: simulateBatteryCapacity,
+		BaseLoad:        simulateBaseLoad,
+		Seed:            simulateSeed,
+	}
+	if simulateSpeed <= 0 {
+		return config, errors.New("speed has to be positive")
+	}
+	if simulateBatteryCapacity <= 0 {
+		config.BatteryCapacity = -1
+	}
+	if inverterTimeZone != "" {
+		loc, err := golrackpi.ParseTimeZone(inverterTimeZone)
+		if err != nil {
+			return config, err
+		}
+		config.Location = loc
+	}
+	if simulateStart != "" {
+		loc := config.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		start, err := time.Parse(time.RFC3339, simulateStart)
+		if err != nil {
+			start, err = time.ParseInLocation("2006-01-02", simulateStart, loc)
+		}
+		if err != nil {
+			return config, fmt.Errorf("invalid start time %q, please use RFC3339 format or 2006-01-02", simulateStart)
+		}
+		config.Start = start
+	}
+	for _, spec := range simulateFaults {
+		fault, err := simulator.ParseFault(spec)
+		if err != nil {
+			return config, err
+		}
+		config.Faults = append(config.Faults, fault)
+	}
+	for _, spec := range simulateEvents {
+		event, err := simulator.ParseEvent(spec)
+		if err != nil {
+			return config, err
+		}
+		config.Events = append(config.Events, event)
+	}
+	return config, nil
+}
+
+// runSimulator serves the simulated REST API until interrupted
+func runSimulator() {
+	config, err := simulatorConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+		return
+	}
+	sim := simulator.New(config)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: simulateListen, Handler: sim}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Simulating inverter on %s (password %q), simulated time %s, speed %gx\n", simulateListen, sim.Password(), sim.Now().Format(time.RFC3339), simulateSpeed)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "An error occurred:", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"sort"
+)
+
+// SettingsDiffKind describes the kind of difference of a setting between two backup documents
+type SettingsDiffKind string
+
+const (
+	// SettingsChanged marks a setting with different values in both documents
+	SettingsChanged SettingsDiffKind = "changed"
+	// SettingsAdded marks a setting which exists only in the second document
+	SettingsAdded SettingsDiffKind = "added"
+	// SettingsRemoved marks a setting which exists only in the first document
+	SettingsRemoved SettingsDiffKind = "removed"
+)
+
+// SettingsDiff specifies a difference of a setting between two backup documents. NonDefaultA and NonDefaultB are true
+// if the value differs from the default value reported by the inverter.
+type SettingsDiff struct {
+	ModuleId    string           `json:"moduleid"`
+	Id          string           `json:"id"`
+	Kind        SettingsDiffKind `json:"kind"`
+	ValueA      string           `json:"value_a"`
+	ValueB      string           `json:"value_b"`
+	Default     string           `json:"default,omitempty"`
+	Unit        string           `json:"unit,omitempty"`
+	NonDefaultA bool             `json:"non_default_a"`
+	NonDefaultB bool             `json:"non_default_b"`
+}
+
+// DiffSettings compares two backup documents, e.g. of two inverters or of one inverter at different times.
+// It returns the changed, added and removed settings sorted by module id and setting id.
+func DiffSettings(a SettingsBackup, b SettingsBackup) []SettingsDiff {
+	valuesA := backupValues(a)
+	valuesB := backupValues(b)
+
+	var result []SettingsDiff
+	for key, valueA := range valuesA {
+		diff := SettingsDiff{ModuleId: key.moduleId, Id: key.id, ValueA: valueA.Value, Default: valueA.Default, Unit: valueA.Unit}
+		valueB, found := valuesB[key]
+		setting := valueA.setting()
+		if found && valueA.Type == "" {
+			setting = valueB.setting()
+		}
+		if !found {
+			diff.Kind = SettingsRemoved
+		} else if !setting.EqualValues(valueA.Value, valueB.Value) {
+			diff.Kind = SettingsChanged
+			diff.ValueB = valueB.Value
+			if diff.Default == "" {
+				diff.Default = valueB.Default
+			}
+		} else {
+			continue
+		}
+		diff.NonDefaultA = isNonDefault(setting, diff.ValueA, diff.Default)
+		diff.NonDefaultB = diff.Kind == SettingsChanged && isNonDefault(setting, diff.ValueB, diff.Default)
+		result = append(result, diff)
+	}
+	for key, valueB := range valuesB {
+		if _, found := valuesA[key]; found {
+			continue
+		}
+		result = append(result, SettingsDiff{
+			ModuleId:    key.moduleId,
+			Id:          key.id,
+			Kind:        SettingsAdded,
+			ValueB:      valueB.Value,
+			Default:     valueB.Default,
+			Unit:        valueB.Unit,
+			NonDefaultB: isNonDefault(valueB.setting(), valueB.Value, valueB.Default),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ModuleId != result[j].ModuleId {
+			return result[i].ModuleId < result[j].ModuleId
+		}
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// settingKey identifies a setting by module id and setting id
+type settingKey struct {
+	moduleId string
+	id       string
+}
+
+// backupValues returns all settings of a backup document as map
+func backupValues(backup SettingsBackup) map[settingKey]SettingsBackupValue {
+	values := make(map[settingKey]SettingsBackupValue)
+	for _, module := range backup.Modules {
+		for _, value := range module.Settings {
+			values[settingKey{moduleId: module.ModuleId, id: value.Id}] = value
+		}
+	}
+	return values
+}
+
+// isNonDefault returns true if a default value is known and the value differs from it according to the data type of the setting
+func isNonDefault(setting SettingsDataValues, value string, defaultValue string) bool {
+	return defaultValue != "" && !setting.EqualValues(value, defaultValue)
+}
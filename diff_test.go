@@ -0,0 +1,54 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffSettings(t *testing.T) {
+	a := SettingsBackup{Modules: []SettingsBackupModule{
+		{ModuleId: "devices:local", Settings: []SettingsBackupValue{
+			{Id: "Battery:MinSoc", Value: "5.0", Default: "5", Type: "byte"},
+			{Id: "Battery:MinHomeComsumption", Value: "50", Default: "50", Type: "float"},
+			{Id: "Removed", Value: "1"},
+		}},
+		{ModuleId: "scb:network", Settings: []SettingsBackupValue{
+			{Id: "Hostname", Value: "01", Default: "scb", Type: "string"},
+		}},
+	}}
+	b := SettingsBackup{Modules: []SettingsBackupModule{
+		{ModuleId: "devices:local", Settings: []SettingsBackupValue{
+			{Id: "Battery:MinSoc", Value: "5", Default: "5", Type: "byte"},
+			{Id: "Battery:MinHomeComsumption", Value: "200", Default: "50", Type: "float"},
+			{Id: "Added", Value: "x", Default: "y"},
+		}},
+		{ModuleId: "scb:network", Settings: []SettingsBackupValue{
+			{Id: "Hostname", Value: "1", Default: "scb", Type: "string"},
+		}},
+	}}
+
+	want := []SettingsDiff{
+		{ModuleId: "devices:local", Id: "Added", Kind: SettingsAdded, ValueB: "x", Default: "y", NonDefaultB: true},
+		{ModuleId: "devices:local", Id: "Battery:MinHomeComsumption", Kind: SettingsChanged, ValueA: "50", ValueB: "200", Default: "50", NonDefaultB: true},
+		{ModuleId: "devices:local", Id: "Removed", Kind: SettingsRemoved, ValueA: "1"},
+		{ModuleId: "scb:network", Id: "Hostname", Kind: SettingsChanged, ValueA: "01", ValueB: "1", Default: "scb", NonDefaultA: true, NonDefaultB: true},
+	}
+	if got := DiffSettings(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// empty values are kept in JSON, e.g. a string setting changed from an empty value
+	data, err := json.Marshal(SettingsDiff{ModuleId: "scb:network", Id: "Hostname", Kind: SettingsChanged, ValueB: "scb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"value_a":""`) {
+		t.Errorf("empty value missing in %s", data)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// EventCategory specifies the category of an event as returned by the inverter
+type EventCategory string
+
+const (
+	EventCategoryInfo    EventCategory = "info"
+	EventCategoryWarning EventCategory = "warning"
+	EventCategoryError   EventCategory = "error"
+)
+
+// Normalize returns the category in lower case, so categories can be compared regardless of the spelling of the inverter
+func (c EventCategory) Normalize() EventCategory {
+	return EventCategory(strings.ToLower(strings.TrimSpace(string(c))))
+}
+
+// EventGroup specifies the group of an event, i.e. the affected component. The inverter returns the group as localized text
+// according to the requested language; Normalize maps the known texts to the constants below.
+type EventGroup string
+
+const (
+	EventGroupInverter      EventGroup = "inverter"
+	EventGroupGenerator     EventGroup = "generator"
+	EventGroupGrid          EventGroup = "grid"
+	EventGroupBattery       EventGroup = "battery"
+	EventGroupEnergyMeter   EventGroup = "energy-meter"
+	EventGroupCommunication EventGroup = "communication"
+	EventGroupInformation   EventGroup = "information"
+)
+
+// eventGroupNames maps words of the localized group texts (English and German) to the groups, the first match wins. German
+// compounds like "Netzüberwachung" match by prefix, so "netzwerk" has to be checked before "netz".
+var eventGroupNames = []struct {
+	word  string
+	group EventGroup
+}{
+	{"network", EventGroupCommunication},
+	{"netzwerk", EventGroupCommunication},
+	{"meter", EventGroupEnergyMeter},
+	{"energiezähler", EventGroupEnergyMeter},
+	{"battery", EventGroupBattery},
+	{"batterie", EventGroupBattery},
+	{"grid", EventGroupGrid},
+	{"netz", EventGroupGrid},
+	{"generator", EventGroupGenerator},
+	{"pv", EventGroupGenerator},
+	{"dc", EventGroupGenerator},
+	{"communication", EventGroupCommunication},
+	{"kommunikation", EventGroupCommunication},
+	{"inverter", EventGroupInverter},
+	{"wechselrichter", EventGroupInverter},
+	{"information", EventGroupInformation},
+}
+
+// Normalize returns the group constant of a localized group text, e.g. EventGroupBattery for "Batterie". Unknown texts are
+// returned trimmed, but otherwise unchanged.
+func (g EventGroup) Normalize() EventGroup {
+	words := strings.FieldsFunc(strings.ToLower(string(g)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, name := range eventGroupNames {
+		for _, word := range words {
+			if word == name.word || (len(name.word) > 3 && strings.HasPrefix(word, name.word)) {
+				return name.group
+			}
+		}
+	}
+	return EventGroup(strings.TrimSpace(string(g)))
+}
+
+// EventSeverity specifies the severity of an event. Higher values are more severe, so severities can be compared and sorted.
+type EventSeverity int
+
+const (
+	SeverityUnknown EventSeverity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the name of the severity
+func (s EventSeverity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// ParseEventSeverity returns the severity with the submitted name (info, warning or error)
+func ParseEventSeverity(name string) (EventSeverity, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	case "unknown":
+		return SeverityUnknown, nil
+	}
+	return SeverityUnknown, fmt.Errorf("unknown severity %q", name)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (s EventSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface
+func (s *EventSeverity) UnmarshalText(text []byte) error {
+	severity, err := ParseEventSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = severity
+	return nil
+}
+
+// EventCatalogEntry specifies the information of the catalog about an event code
+type EventCatalogEntry struct {
+	Code     int           `json:"code"`
+	Group    EventGroup    `json:"group,omitempty"`
+	Severity EventSeverity `json:"severity"`
+	Summary  string        `json:"summary"`
+	Action   string        `json:"action"`
+}
+
+// EventCatalog maps event codes to severity, a short summary and a suggested action
+type EventCatalog struct {
+	entries map[int]EventCatalogEntry
+}
+
+//go:embed eventcatalog.json
+var embeddedEventCatalog []byte
+
+var (
+	defaultEventCatalog     *EventCatalog
+	defaultEventCatalogOnce sync.Once
+)
+
+// DefaultEventCatalog returns the event catalog embedded in the library
+func DefaultEventCatalog() *EventCatalog {
+	defaultEventCatalogOnce.Do(func() {
+		var entries []EventCatalogEntry
+		if err := json.Unmarshal(embeddedEventCatalog, &entries); err != nil {
+			panic("golrackpi: invalid embedded event catalog: " + err.Error())
+		}
+		defaultEventCatalog = newEventCatalog(entries)
+	})
+	return defaultEventCatalog
+}
+
+// LoadEventCatalog reads an event catalog from a JSON array of EventCatalogEntry elements
+func LoadEventCatalog(r io.Reader) (*EventCatalog, error) {
+	var entries []EventCatalogEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return newEventCatalog(entries), nil
+}
+
+// newEventCatalog returns a catalog with the submitted entries
+func newEventCatalog(entries []EventCatalogEntry) *EventCatalog {
+	catalog := &EventCatalog{entries: make(map[int]EventCatalogEntry)}
+	for _, entry := range entries {
+		catalog.entries[entry.Code] = entry
+	}
+	return catalog
+}
+
+// Merge returns a new catalog with the entries of both catalogs. Entries of other replace entries with the same code.
+func (c *EventCatalog) Merge(other *EventCatalog) *EventCatalog {
+	merged := &EventCatalog{entries: make(map[int]EventCatalogEntry)}
+	for code, entry := range c.entries {
+		merged.entries[code] = entry
+	}
+	for code, entry := range other.entries {
+		merged.entries[code] = entry
+	}
+	return merged
+}
+
+// Lookup returns the catalog entry of the event code. Unknown codes fall back to an entry with the severity derived from the
+// category of the event, the normalized group and the description as summary. The second return value is false for unknown codes.
+func (c *EventCatalog) Lookup(event EventData) (EventCatalogEntry, bool) {
+	if entry, found := c.entries[event.Code]; found {
+		if entry.Group == "" {
+			entry.Group = event.Group.Normalize()
+		}
+		if entry.Severity == SeverityUnknown {
+			entry.Severity = severityFromCategory(event.Category)
+		}
+		if entry.Summary == "" {
+			entry.Summary = event.Description
+		}
+		return entry, true
+	}
+	return EventCatalogEntry{
+		Code:     event.Code,
+		Group:    event.Group.Normalize(),
+		Severity: severityFromCategory(event.Category),
+		Summary:  event.Description,
+	}, false
+}
+
+// severityFromCategory derives the severity from the category of an event
+func severityFromCategory(category EventCategory) EventSeverity {
+	switch category.Normalize() {
+	case EventCategoryInfo:
+		return SeverityInfo
+	case EventCategoryWarning:
+		return SeverityWarning
+	case EventCategoryError:
+		return SeverityError
+	}
+	return SeverityUnknown
+}
+
+// Severity returns the severity of the event according to the default event catalog
+func (e EventData) Severity() EventSeverity {
+	entry, _ := DefaultEventCatalog().Lookup(e)
+	return entry.Severity
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultEventCatalog(t *testing.T) {
+	catalog := DefaultEventCatalog()
+	if len(catalog.entries) == 0 {
+		t.Fatal("embedded event catalog is empty")
+	}
+	for code, entry := range catalog.entries {
+		if entry.Severity == SeverityUnknown || entry.Summary == "" || entry.Group == "" {
+			t.Errorf("incomplete entry of code %d: %+v", code, entry)
+		}
+		if entry.Group.Normalize() != entry.Group {
+			t.Errorf("code %d: group %q is not normalized", code, entry.Group)
+		}
+	}
+}
+
+func TestEventCatalogLookup(t *testing.T) {
+	catalog := DefaultEventCatalog()
+
+	entry, found := catalog.Lookup(EventData{Code: 5012, Category: "info", Description: "Isolationsfehler"})
+	if !found {
+		t.Fatal("code 5012 not found")
+	}
+	if entry.Severity != SeverityError || entry.Group != EventGroupGenerator || entry.Summary == "Isolationsfehler" || entry.Action == "" {
+		t.Errorf("wrong entry of known code: %+v", entry)
+	}
+
+	entry, found = catalog.Lookup(EventData{Code: 9999, Category: " Warning ", Group: "Batteriesystem", Description: "Unknown event"})
+	if found {
+		t.Error("unknown code found")
+	}
+	want := EventCatalogEntry{Code: 9999, Group: EventGroupBattery, Severity: SeverityWarning, Summary: "Unknown event"}
+	if entry != want {
+		t.Errorf("wrong fallback: got %+v, want %+v", entry, want)
+	}
+	if severity := (EventData{Code: 9999, Category: "strange"}).Severity(); severity != SeverityUnknown {
+		t.Errorf("got severity %s of unknown category", severity)
+	}
+
+	file, err := LoadEventCatalog(strings.NewReader(`[{"code": 9999, "severity": "error", "summary": "Custom"}, {"code": 5012, "severity": "info"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := catalog.Merge(file)
+	if entry, found := merged.Lookup(EventData{Code: 9999, Group: "Grid"}); !found || entry.Severity != SeverityError || entry.Group != EventGroupGrid {
+		t.Errorf("wrong entry of added code: %+v", entry)
+	}
+	if entry, _ := merged.Lookup(EventData{Code: 5012, Description: "Isolationsfehler"}); entry.Severity != SeverityInfo || entry.Summary != "Isolationsfehler" {
+		t.Errorf("wrong entry of replaced code: %+v", entry)
+	}
+}
+
+func TestEventGroupNormalize(t *testing.T) {
+	tests := map[EventGroup]EventGroup{
+		"Battery":               EventGroupBattery,
+		"Batterie":              EventGroupBattery,
+		"Netzüberwachung":       EventGroupGrid,
+		"Grid monitoring":       EventGroupGrid,
+		"Netzwerk":              EventGroupCommunication,
+		"PV generator":          EventGroupGenerator,
+		"DC-Eingang":            EventGroupGenerator,
+		"Energy meter":          EventGroupEnergyMeter,
+		"Wechselrichter":        EventGroupInverter,
+		"Information":           EventGroupInformation,
+		" Something else ":      "Something else",
+		EventGroupEnergyMeter:   EventGroupEnergyMeter,
+		EventGroupCommunication: EventGroupCommunication,
+	}
+	for group, want := range tests {
+		if got := group.Normalize(); got != want {
+			t.Errorf("%q: got %q, want %q", group, got, want)
+		}
+	}
+}
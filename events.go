@@ -17,10 +17,10 @@ import (
 // EventData specifies the structure of the response returned by a request to the "events" endpoint
 type EventData struct {
 	Description     string               `json:"description"`
-	Category        string               `json:"category"`
+	Category        EventCategory        `json:"category"`
 	LongDescription string               `json:"long_description"`
 	StartTime       timefix.InverterTime `json:"start_time"`
-	Group           string               `json:"group"`
+	Group           EventGroup           `json:"group"`
 	EndTime         timefix.InverterTime `json:"end_time"`
 	Code            int                  `json:"code"`
 	IsActive        bool                 `json:"is_active"`
@@ -52,7 +52,7 @@ func (c *AuthClient) EventsWithParam(language string, max int) ([]EventData, err
 		return jsonResult, err
 	}
 
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("POST", c.getUrl("/api/v1/events/latest"), bytes.NewBuffer(b))
 	if err != nil {
@@ -67,6 +67,9 @@ func (c *AuthClient) EventsWithParam(language string, max int) ([]EventData, err
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return jsonResult, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -77,14 +80,14 @@ func (c *AuthClient) EventsWithParam(language string, max int) ([]EventData, err
 	if err != nil {
 		return jsonResult, err
 	}
-	return jsonResult, nil
+	return c.localizeEvents(jsonResult), nil
 }
 
 // Events returns the latest events as a slice of EventData type
 func (c *AuthClient) Events() ([]EventData, error) {
 	jsonResult := []EventData{}
 
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/events/latest"), nil)
 	if err != nil {
@@ -98,6 +101,9 @@ func (c *AuthClient) Events() ([]EventData, error) {
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return jsonResult, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -109,5 +115,15 @@ func (c *AuthClient) Events() ([]EventData, error) {
 		return jsonResult, err
 	}
 
-	return jsonResult, nil
+	return c.localizeEvents(jsonResult), nil
+}
+
+// localizeEvents interprets the start and end times of events, which the inverter sends without time zone offset, in the client's location
+func (c *AuthClient) localizeEvents(events []EventData) []EventData {
+	loc := c.location()
+	for i := range events {
+		events[i].StartTime = events[i].StartTime.WithLocation(loc)
+		events[i].EndTime = events[i].EndTime.WithLocation(loc)
+	}
+	return events
 }
@@ -0,0 +1,184 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventRecord specifies a line of the event store file with the time the event was recorded
+type EventRecord struct {
+	Recorded time.Time `json:"recorded"`
+	Event    EventData `json:"event"`
+}
+
+// EventQuery specifies the filter of an event store query. Zero values are ignored.
+type EventQuery struct {
+	Since      time.Time
+	Until      time.Time
+	Codes      []int
+	Categories []string
+}
+
+// EventStore is an append-only store of events in a JSON lines file. Every poll of the inverter's latest events can be merged
+// into the store, so the history of events is kept longer than the inverter does.
+type EventStore struct {
+	fileName string
+	events   map[string]EventData
+	mu       sync.Mutex
+}
+
+// OpenEventStore opens the event store file and reads its events. If the file doesn't exist, it's created by the first Merge.
+// If an event was recorded several times, e.g. when it was active first and cleared later, the last record wins.
+func OpenEventStore(fileName string) (*EventStore, error) {
+	store := &EventStore{fileName: fileName, events: make(map[string]EventData)}
+
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record EventRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("could not read line %d of event store %s: %w", line, fileName, err)
+		}
+		store.events[record.Event.Key()] = record.Event
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Merge adds new events to the store and updates events whose state or end time changed. Unchanged events are skipped, so
+// the same events can be merged repeatedly. It returns the number of added and updated events.
+func (s *EventStore) Merge(events []EventData) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []EventRecord
+	added, updated := 0, 0
+	now := time.Now()
+	for _, event := range events {
+		key := event.Key()
+		stored, found := s.events[key]
+		if found && stored.IsActive == event.IsActive && stored.EndTime.Equal(event.EndTime.Time) {
+			continue
+		}
+		if found {
+			updated++
+		} else {
+			added++
+		}
+		records = append(records, EventRecord{Recorded: now, Event: event})
+	}
+	if len(records) == 0 {
+		return 0, 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.fileName), 0755); err != nil {
+		return 0, 0, err
+	}
+	f, err := os.OpenFile(s.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			f.Close()
+			return 0, 0, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return 0, 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, record := range records {
+		s.events[record.Event.Key()] = record.Event
+	}
+	return added, updated, nil
+}
+
+// Query returns the events of the store which match the query, sorted by start time. An event matches the time range
+// if it was active at any time between Since and Until.
+func (s *EventStore) Query(q EventQuery) []EventData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []EventData
+	for _, event := range s.events {
+		if !q.Until.IsZero() && event.StartTime.After(q.Until) {
+			continue
+		}
+		if !q.Since.IsZero() && !event.EndTime.IsZero() && event.EndTime.Before(q.Since) {
+			continue
+		}
+		if !q.Since.IsZero() && event.EndTime.IsZero() && !event.IsActive && event.StartTime.Before(q.Since) {
+			continue
+		}
+		if len(q.Codes) > 0 && !containsInt(q.Codes, event.Code) {
+			continue
+		}
+		if len(q.Categories) > 0 && !containsString(q.Categories, string(event.Category)) {
+			continue
+		}
+		result = append(result, event)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartTime.Equal(result[j].StartTime.Time) {
+			return result[i].Code < result[j].Code
+		}
+		return result[i].StartTime.Before(result[j].StartTime.Time)
+	})
+	return result
+}
+
+// containsInt returns true if the slice contains the value
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if the slice contains the value, ignoring case
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventStoreMerge(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events", "events.jsonl")
+	store, err := OpenEventStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		events         []EventData
+		added, updated int
+	}{
+		{[]EventData{testEvent(1, 1, 0), testEvent(2, 2, 3)}, 2, 0},
+		// events with the same key are stored once
+		{[]EventData{testEvent(1, 1, 0), testEvent(2, 2, 3)}, 0, 0},
+		// the end time of an event collected again is updated
+		{[]EventData{testEvent(1, 1, 4), testEvent(2, 2, 3), testEvent(1, 5, 0)}, 1, 1},
+	}
+	for i, test := range tests {
+		added, updated, err := store.Merge(test.events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != test.added || updated != test.updated {
+			t.Errorf("merge %d: got %d added, %d updated, want %d, %d", i+1, added, updated, test.added, test.updated)
+		}
+	}
+
+	// the last record of an event wins when the file is read again
+	reopened, err := OpenEventStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := reopened.Query(EventQuery{})
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if events[0].Code != 1 || events[0].IsActive || !events[0].EndTime.Equal(testEvent(1, 1, 4).EndTime.Time) {
+		t.Errorf("end time not updated: %+v", events[0])
+	}
+}
+
+func TestEventStoreQuery(t *testing.T) {
+	store, err := OpenEventStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warning := testEvent(3, 20, 0)
+	warning.Category = "warning"
+	if _, _, err := store.Merge([]EventData{testEvent(1, 1, 5), testEvent(2, 10, 15), warning}); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	minute := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+
+	tests := []struct {
+		name  string
+		query EventQuery
+		want  []int
+	}{
+		{"all events", EventQuery{}, []int{1, 2, 3}},
+		{"since", EventQuery{Since: minute(6)}, []int{2, 3}},
+		{"since end time", EventQuery{Since: minute(15)}, []int{2, 3}},
+		{"until", EventQuery{Until: minute(9)}, []int{1}},
+		{"since and until", EventQuery{Since: minute(12), Until: minute(18)}, []int{2}},
+		{"active event", EventQuery{Since: minute(100)}, []int{3}},
+		{"codes", EventQuery{Codes: []int{1, 3}}, []int{1, 3}},
+		{"categories", EventQuery{Categories: []string{"Warning"}}, []int{3}},
+		{"codes and time range", EventQuery{Codes: []int{1, 3}, Until: minute(9)}, []int{1}},
+	}
+	for _, test := range tests {
+		var got []int
+		for _, event := range store.Query(test.query) {
+			got = append(got, event.Code)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"strconv"
+	"time"
+)
+
+// EventTransitionKind describes the kind of change of an event
+type EventTransitionKind string
+
+const (
+	// EventRaised marks an event which occurred since the last update
+	EventRaised EventTransitionKind = "raised"
+	// EventCleared marks an event which is not active anymore
+	EventCleared EventTransitionKind = "cleared"
+)
+
+// EventTransition specifies a change of an event detected by EventTracker
+type EventTransition struct {
+	Kind  EventTransitionKind `json:"transition"`
+	Event EventData           `json:"event"`
+}
+
+// Key returns the identity of an event, which consists of its code and start time
+func (e EventData) Key() string {
+	return strconv.Itoa(e.Code) + "@" + e.StartTime.UTC().Format(time.RFC3339Nano)
+}
+
+// isCleared returns true if the event is not active anymore
+func (e EventData) isCleared() bool {
+	return !e.IsActive || !e.EndTime.IsZero()
+}
+
+// EventTracker detects raised and cleared events by comparing the results of consecutive event requests.
+type EventTracker struct {
+	known       map[string]EventData
+	initialized bool
+}
+
+// NewEventTracker returns a new EventTracker instance
+func NewEventTracker() *EventTracker {
+	return &EventTracker{known: make(map[string]EventData)}
+}
+
+// Update takes the latest events and returns the transitions since the last update. On the first update, all active events
+// are reported as raised. An event which occurred and cleared between two updates is reported as raised and cleared.
+// Events which disappear from the list of latest events are forgotten without a transition.
+func (t *EventTracker) Update(events []EventData) []EventTransition {
+	var transitions []EventTransition
+	current := make(map[string]EventData)
+
+	for _, event := range events {
+		key := event.Key()
+		current[key] = event
+
+		previous, found := t.known[key]
+		if !found {
+			if !t.initialized && event.isCleared() {
+				continue
+			}
+			transitions = append(transitions, EventTransition{Kind: EventRaised, Event: event})
+			if event.isCleared() {
+				transitions = append(transitions, EventTransition{Kind: EventCleared, Event: event})
+			}
+			continue
+		}
+		if !previous.isCleared() && event.isCleared() {
+			transitions = append(transitions, EventTransition{Kind: EventCleared, Event: event})
+		}
+	}
+
+	t.known = current
+	t.initialized = true
+	return transitions
+}
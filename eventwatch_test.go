@@ -0,0 +1,70 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/geschke/golrackpi/internal/timefix"
+)
+
+// testEvent returns an event with the code, started at the minute start. An end minute of 0 marks an active event.
+func testEvent(code int, start int, end int) EventData {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := EventData{Code: code, StartTime: timefix.InverterTime{Time: base.Add(time.Duration(start) * time.Minute)}, IsActive: end == 0}
+	if end != 0 {
+		event.EndTime = timefix.InverterTime{Time: base.Add(time.Duration(end) * time.Minute)}
+	}
+	return event
+}
+
+func TestEventTrackerUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		polls [][]EventData
+		want  []string
+	}{
+		{
+			name:  "first poll reports active events only",
+			polls: [][]EventData{{testEvent(1, 1, 0), testEvent(2, 1, 2)}},
+			want:  []string{"raised 1"},
+		},
+		{
+			name:  "raised and cleared within one poll",
+			polls: [][]EventData{{}, {testEvent(1, 1, 2)}},
+			want:  []string{"raised 1", "cleared 1"},
+		},
+		{
+			name:  "cleared in a later poll",
+			polls: [][]EventData{{testEvent(1, 1, 0)}, {testEvent(1, 1, 3)}, {testEvent(1, 1, 3)}},
+			want:  []string{"raised 1", "cleared 1"},
+		},
+		{
+			name:  "active events are reported once",
+			polls: [][]EventData{{testEvent(1, 1, 0)}, {testEvent(1, 1, 0), testEvent(2, 2, 0)}, {testEvent(1, 1, 0), testEvent(2, 2, 0)}},
+			want:  []string{"raised 1", "raised 2"},
+		},
+		{
+			name:  "same code with a new start time is a new event",
+			polls: [][]EventData{{testEvent(1, 1, 2)}, {testEvent(1, 5, 0), testEvent(1, 1, 2)}},
+			want:  []string{"raised 1"},
+		},
+	}
+	for _, test := range tests {
+		tracker := NewEventTracker()
+		var got []string
+		for _, poll := range test.polls {
+			for _, transition := range tracker.Update(poll) {
+				got = append(got, string(transition.Kind)+" "+strconv.Itoa(transition.Event.Code))
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
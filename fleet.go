@@ -0,0 +1,143 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"errors"
+	"sync"
+)
+
+// FleetInverter defines a named inverter of a fleet with its tags and client instance
+type FleetInverter struct {
+	Name   string
+	Tags   []string
+	Client *AuthClient
+}
+
+// HasTag returns true if the inverter is labelled with the tag
+func (i FleetInverter) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// FleetResult specifies the result of a function executed for one inverter of a fleet. Err is nil in case of success.
+type FleetResult struct {
+	Name string
+	Err  error
+}
+
+// Fleet manages a list of inverters, so it's possible to run requests against several inverters concurrently.
+type Fleet struct {
+	Inverters []FleetInverter
+
+	// MaxConcurrent limits the number of inverters which are requested at the same time. Values <= 0 mean no limit.
+	MaxConcurrent int
+}
+
+// NewFleet returns an empty Fleet instance
+func NewFleet() *Fleet {
+	return &Fleet{}
+}
+
+// Add adds an inverter with its name and optional tags to the fleet
+func (f *Fleet) Add(name string, client *AuthClient, tags ...string) {
+	f.Inverters = append(f.Inverters, FleetInverter{Name: name, Tags: tags, Client: client})
+}
+
+// Inverter returns the inverter with the submitted name
+func (f *Fleet) Inverter(name string) (FleetInverter, bool) {
+	for _, inverter := range f.Inverters {
+		if inverter.Name == name {
+			return inverter, true
+		}
+	}
+	return FleetInverter{}, false
+}
+
+// Names returns the names of all inverters of the fleet
+func (f *Fleet) Names() []string {
+	names := make([]string, 0, len(f.Inverters))
+	for _, inverter := range f.Inverters {
+		names = append(names, inverter.Name)
+	}
+	return names
+}
+
+// Select returns a new Fleet with all inverters which are labelled with at least one of the submitted tags.
+// Without tags, it returns a copy of the complete fleet.
+func (f *Fleet) Select(tags ...string) *Fleet {
+	selected := &Fleet{MaxConcurrent: f.MaxConcurrent}
+	for _, inverter := range f.Inverters {
+		if len(tags) == 0 {
+			selected.Inverters = append(selected.Inverters, inverter)
+			continue
+		}
+		for _, tag := range tags {
+			if inverter.HasTag(tag) {
+				selected.Inverters = append(selected.Inverters, inverter)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// Run executes fn concurrently for every inverter of the fleet. Before fn is called, the client is logged in, afterwards it's logged out again.
+// It returns a slice of FleetResult in the order of the fleet's inverters, so errors can be reported per inverter.
+func (f *Fleet) Run(fn func(name string, client *AuthClient) error) []FleetResult {
+	return f.run(func(inverter FleetInverter) error {
+		if _, err := inverter.Client.Login(); err != nil {
+			return err
+		}
+		defer inverter.Client.Logout()
+		return fn(inverter.Name, inverter.Client)
+	})
+}
+
+// run is the helper function which executes fn concurrently and collects the results
+func (f *Fleet) run(fn func(inverter FleetInverter) error) []FleetResult {
+	results := make([]FleetResult, len(f.Inverters))
+
+	var sem chan struct{}
+	if f.MaxConcurrent > 0 {
+		sem = make(chan struct{}, f.MaxConcurrent)
+	}
+
+	var wg sync.WaitGroup
+	for i, inverter := range f.Inverters {
+		wg.Add(1)
+		go func(i int, inverter FleetInverter) {
+			defer wg.Done()
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+			results[i] = FleetResult{Name: inverter.Name}
+			if inverter.Client == nil {
+				results[i].Err = errors.New("no client configured")
+				return
+			}
+			results[i].Err = fn(inverter)
+		}(i, inverter)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// FailedResults returns the failed results of a fleet run
+func FailedResults(results []FleetResult) []FleetResult {
+	var failed []FleetResult
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
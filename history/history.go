@@ -0,0 +1,593 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package history stores polled process-data values in a local SQLite database, with retention policies and
+// downsampling to 1-minute, 15-minute and daily aggregates. Daily aggregates start at midnight in the location of the store.
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	_ "modernc.org/sqlite"
+)
+
+// Resolution specifies the interval of samples in seconds. Raw samples have the resolution 0.
+type Resolution int64
+
+const (
+	Raw     Resolution = 0
+	Minute  Resolution = 60
+	Quarter Resolution = 15 * 60
+	Daily   Resolution = 24 * 60 * 60
+)
+
+// aggregateResolutions are the resolutions of the aggregates, each calculated from the previous one
+var aggregateResolutions = []Resolution{Minute, Quarter, Daily}
+
+// String returns the name of the resolution
+func (r Resolution) String() string {
+	switch r {
+	case Raw:
+		return "raw"
+	case Minute:
+		return "1m"
+	case Quarter:
+		return "15m"
+	case Daily:
+		return "1d"
+	}
+	return fmt.Sprintf("%ds", int64(r))
+}
+
+// ParseResolution returns the resolution with the submitted name (raw, 1m, 15m or 1d)
+func ParseResolution(name string) (Resolution, error) {
+	for _, r := range append([]Resolution{Raw}, aggregateResolutions...) {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return Raw, fmt.Errorf("unknown resolution %q, please use raw, 1m, 15m or 1d", name)
+}
+
+// RetentionPolicy specifies how long samples are kept per resolution. A zero duration keeps the samples forever.
+type RetentionPolicy struct {
+	Raw     time.Duration
+	Minute  time.Duration
+	Quarter time.Duration
+	Daily   time.Duration
+}
+
+// duration returns the retention of a resolution
+func (p RetentionPolicy) duration(r Resolution) time.Duration {
+	switch r {
+	case Raw:
+		return p.Raw
+	case Minute:
+		return p.Minute
+	case Quarter:
+		return p.Quarter
+	case Daily:
+		return p.Daily
+	}
+	return 0
+}
+
+// Series specifies a process-data value of an inverter
+type Series struct {
+	Inverter string `json:"inverter"`
+	ModuleId string `json:"moduleid"`
+	Id       string `json:"id"`
+	Unit     string `json:"unit"`
+}
+
+// Sample specifies a value of a series. Raw samples have the same value for Min, Max and Avg and a Count of 1.
+type Sample struct {
+	Series
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Count int64     `json:"count"`
+}
+
+// Query specifies the samples to return. Inverter, ModuleId and Id are path.Match patterns, empty patterns match all values.
+// A zero From or To time doesn't limit the range.
+type Query struct {
+	Inverter   string
+	ModuleId   string
+	Id         string
+	From       time.Time
+	To         time.Time
+	Resolution Resolution
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS series (
+	id INTEGER PRIMARY KEY,
+	inverter TEXT NOT NULL,
+	moduleid TEXT NOT NULL,
+	processdataid TEXT NOT NULL,
+	unit TEXT NOT NULL DEFAULT '',
+	UNIQUE (inverter, moduleid, processdataid)
+);
+CREATE TABLE IF NOT EXISTS samples (
+	series_id INTEGER NOT NULL,
+	ts INTEGER NOT NULL,
+	value REAL NOT NULL,
+	PRIMARY KEY (series_id, ts)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS aggregates (
+	series_id INTEGER NOT NULL,
+	resolution INTEGER NOT NULL,
+	ts INTEGER NOT NULL,
+	min REAL NOT NULL,
+	max REAL NOT NULL,
+	avg REAL NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (series_id, resolution, ts)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS aggregates_ts ON aggregates (resolution, ts);
+CREATE TABLE IF NOT EXISTS downsampled (
+	resolution INTEGER PRIMARY KEY,
+	until INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS pruned (
+	resolution INTEGER PRIMARY KEY,
+	until INTEGER NOT NULL
+);
+`
+
+// Store is a SQLite database with the samples of process-data values
+type Store struct {
+	db  *sql.DB
+	loc *time.Location
+
+	mu     sync.Mutex
+	series map[Series]int64
+}
+
+// Open opens or creates the database file. The daily aggregates are calculated in the local time zone, see SetLocation.
+func Open(fileName string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+fileName+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer, so all requests use the same connection
+	db.SetMaxOpenConns(1)
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('samples', 'pruned')").Scan(&tables); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create schema: %w", err)
+	}
+	if tables == 1 {
+		// databases of older versions don't contain the pruning times, so the oldest samples could have been pruned
+		_, err := db.Exec(`INSERT OR IGNORE INTO pruned (resolution, until) SELECT 0, MIN(ts) FROM samples HAVING COUNT(*) > 0;
+			INSERT OR IGNORE INTO pruned (resolution, until) SELECT resolution, MIN(ts) FROM aggregates GROUP BY resolution`)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("could not update schema: %w", err)
+		}
+	}
+	return &Store{db: db, loc: time.Local, series: make(map[Series]int64)}, nil
+}
+
+// SetLocation sets the location of the daily aggregates, which start at midnight in this location. It should be set before the
+// first call of Maintain and not be changed later, otherwise the days of older and newer aggregates are shifted.
+func (s *Store) SetLocation(loc *time.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc == nil {
+		loc = time.Local
+	}
+	s.loc = loc
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Insert stores the numeric process-data values of an inverter with the submitted time. Non-numeric values are skipped.
+func (s *Store) Insert(inverter string, t time.Time, values []golrackpi.ProcessDataValues) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, module := range values {
+		for _, value := range module.ProcessData {
+			number, ok := value.Value.(float64)
+			if !ok {
+				continue
+			}
+			id, err := s.seriesId(tx, Series{Inverter: inverter, ModuleId: module.ModuleId, Id: value.Id, Unit: value.Unit})
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("INSERT OR REPLACE INTO samples (series_id, ts, value) VALUES (?, ?, ?)", id, t.Unix(), number); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// seriesId returns the id of the series and creates the series if it doesn't exist yet
+func (s *Store) seriesId(tx *sql.Tx, series Series) (int64, error) {
+	if id, found := s.series[series]; found {
+		return id, nil
+	}
+	_, err := tx.Exec(`INSERT INTO series (inverter, moduleid, processdataid, unit) VALUES (?, ?, ?, ?)
+		ON CONFLICT (inverter, moduleid, processdataid) DO UPDATE SET unit = excluded.unit`,
+		series.Inverter, series.ModuleId, series.Id, series.Unit)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRow("SELECT id FROM series WHERE inverter = ? AND moduleid = ? AND processdataid = ?",
+		series.Inverter, series.ModuleId, series.Id).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	s.series[series] = id
+	return id, nil
+}
+
+// Maintain calculates the aggregates of all complete intervals before now and deletes the samples which are older than the
+// retention of their resolution. Daily aggregates start at midnight in the location of the store.
+func (s *Store) Maintain(now time.Time, policy RetentionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source := Raw
+	for _, resolution := range aggregateResolutions {
+		if err := s.downsample(source, resolution, now); err != nil {
+			return fmt.Errorf("could not calculate %s aggregates: %w", resolution, err)
+		}
+		source = resolution
+	}
+
+	for _, resolution := range append([]Resolution{Raw}, aggregateResolutions...) {
+		before := int64(0)
+		if retention := policy.duration(resolution); retention > 0 {
+			before = now.Add(-retention).Unix()
+		}
+		var err error
+		if resolution == Raw {
+			_, err = s.db.Exec("DELETE FROM samples WHERE ts < ?", before)
+		} else {
+			_, err = s.db.Exec("DELETE FROM aggregates WHERE resolution = ? AND ts < ?", resolution, before)
+		}
+		if err == nil {
+			// Backfill needs to know which samples are incomplete, so the time is kept even if nothing was deleted
+			_, err = s.db.Exec(`INSERT INTO pruned (resolution, until) VALUES (?, ?)
+				ON CONFLICT (resolution) DO UPDATE SET until = MAX(until, excluded.until)`, resolution, before)
+		}
+		if err != nil {
+			return fmt.Errorf("could not delete %s samples: %w", resolution, err)
+		}
+	}
+	return nil
+}
+
+// prunedUntil returns the time before which the samples of the resolution were deleted by Maintain, 0 if none were deleted
+func prunedUntil(tx *sql.Tx, resolution Resolution) (int64, error) {
+	var until int64
+	err := tx.QueryRow("SELECT until FROM pruned WHERE resolution = ?", resolution).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return until, err
+}
+
+// downsample calculates the aggregates of the resolution from the samples of the source resolution, for all complete intervals
+// since the last call.
+func (s *Store) downsample(source Resolution, resolution Resolution, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var from int64
+	err = tx.QueryRow("SELECT until FROM downsampled WHERE resolution = ?", resolution).Scan(&from)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	until := s.floor(resolution, now.Unix())
+	if until <= from {
+		return nil
+	}
+
+	if err := s.aggregate(tx, source, resolution, from, until, "REPLACE"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO downsampled (resolution, until) VALUES (?, ?)", resolution, until); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// floor returns the start of the interval of the resolution which contains ts. Minute and quarter intervals are aligned in UTC,
+// which matches the local time of all time zones with whole quarters of an hour as offset. Daily intervals start at midnight
+// in the location of the store, so their length differs on days with daylight saving time changes.
+func (s *Store) floor(resolution Resolution, ts int64) int64 {
+	if resolution != Daily {
+		return ts - ts%int64(resolution)
+	}
+	t := time.Unix(ts, 0).In(s.loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc).Unix()
+}
+
+// next returns the start of the interval of the resolution which follows the interval starting at start
+func (s *Store) next(resolution Resolution, start int64) int64 {
+	if resolution != Daily {
+		return start + int64(resolution)
+	}
+	t := time.Unix(start, 0).In(s.loc)
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc).Unix()
+}
+
+// aggregate calculates the aggregates of the resolution from the samples of the source resolution in the intervals from the
+// interval containing from until the interval starting at until. conflict is the conflict resolution of SQLite for existing
+// aggregates, i.e. REPLACE or IGNORE.
+func (s *Store) aggregate(tx *sql.Tx, source Resolution, resolution Resolution, from int64, until int64, conflict string) error {
+	if resolution != Daily {
+		return aggregateRange(tx, source, resolution, "ts - ts % ?1", s.floor(resolution, from), until, conflict)
+	}
+	// the days differ in length, so every day with samples is calculated on its own
+	for start := from; start < until; {
+		var first sql.NullInt64
+		var err error
+		if source == Raw {
+			err = tx.QueryRow("SELECT MIN(ts) FROM samples WHERE ts >= ? AND ts < ?", start, until).Scan(&first)
+		} else {
+			err = tx.QueryRow("SELECT MIN(ts) FROM aggregates WHERE resolution = ? AND ts >= ? AND ts < ?", source, start, until).Scan(&first)
+		}
+		if err != nil || !first.Valid {
+			return err
+		}
+		day := s.floor(resolution, first.Int64)
+		end := s.next(resolution, day)
+		if end > until {
+			return nil
+		}
+		if err := aggregateRange(tx, source, resolution, "?2", day, end, conflict); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// aggregateRange calculates the aggregates of the samples of the source resolution in the range [from, until). bucket is the
+// SQL expression of the interval start of a sample, with the parameters ?1 (resolution) and ?2 (from).
+func aggregateRange(tx *sql.Tx, source Resolution, resolution Resolution, bucket string, from int64, until int64, conflict string) error {
+	var err error
+	if source == Raw {
+		_, err = tx.Exec(`INSERT OR `+conflict+` INTO aggregates (series_id, resolution, ts, min, max, avg, count)
+			SELECT series_id, ?1, `+bucket+`, MIN(value), MAX(value), AVG(value), COUNT(*)
+			FROM samples WHERE ts >= ?2 AND ts < ?3 GROUP BY series_id, `+bucket,
+			resolution, from, until)
+	} else {
+		_, err = tx.Exec(`INSERT OR `+conflict+` INTO aggregates (series_id, resolution, ts, min, max, avg, count)
+			SELECT series_id, ?1, `+bucket+`, MIN(min), MAX(max), SUM(avg * count) / SUM(count), SUM(count)
+			FROM aggregates WHERE resolution = ?4 AND ts >= ?2 AND ts < ?3 GROUP BY series_id, `+bucket,
+			resolution, from, until, source)
+	}
+	return err
+}
+
+// Backfill stores samples of past values in one transaction, e.g. from the log data of the inverter. The Avg value of a sample is
+// stored. Existing samples are kept, so recorded values take precedence over backfilled values. The aggregates of the intervals
+// with backfilled samples are recalculated if they were already downsampled; later intervals are calculated by Maintain.
+// Aggregates of intervals whose source samples were partly deleted by the retention policy can't be recalculated, so they are
+// only added if they don't exist yet.
+func (s *Store) Backfill(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pruned := make(map[Resolution]int64)
+	for _, resolution := range append([]Resolution{Raw}, aggregateResolutions...) {
+		if pruned[resolution], err = prunedUntil(tx, resolution); err != nil {
+			return err
+		}
+	}
+
+	first, last := samples[0].Time.Unix(), samples[0].Time.Unix()
+	for _, sample := range samples {
+		id, err := s.seriesId(tx, sample.Series)
+		if err != nil {
+			return err
+		}
+		ts := sample.Time.Unix()
+		if _, err := tx.Exec("INSERT OR IGNORE INTO samples (series_id, ts, value) VALUES (?, ?, ?)", id, ts, sample.Avg); err != nil {
+			return err
+		}
+		if ts < first {
+			first = ts
+		}
+		if ts > last {
+			last = ts
+		}
+	}
+
+	source := Raw
+	for _, resolution := range aggregateResolutions {
+		var downsampled int64
+		err := tx.QueryRow("SELECT until FROM downsampled WHERE resolution = ?", resolution).Scan(&downsampled)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		from := s.floor(resolution, first)
+		until := s.next(resolution, s.floor(resolution, last))
+		if until > downsampled {
+			until = downsampled
+		}
+		// intervals which start before the pruning time of the source are incomplete
+		complete := s.floor(resolution, pruned[source])
+		if complete < pruned[source] {
+			complete = s.next(resolution, complete)
+		}
+		if complete < from {
+			complete = from
+		}
+		if complete > until {
+			complete = until
+		}
+		if from < complete {
+			if err := s.aggregate(tx, source, resolution, from, complete, "IGNORE"); err != nil {
+				return fmt.Errorf("could not calculate %s aggregates: %w", resolution, err)
+			}
+		}
+		if complete < until {
+			if err := s.aggregate(tx, source, resolution, complete, until, "REPLACE"); err != nil {
+				return fmt.Errorf("could not calculate %s aggregates: %w", resolution, err)
+			}
+		}
+		source = resolution
+	}
+	return tx.Commit()
+}
+
+// Query returns the samples which match the query, ordered by series and time
+func (s *Store) Query(q Query) ([]Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pattern := range []string{q.Inverter, q.ModuleId, q.Id} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("wrong pattern %q: %w", pattern, err)
+		}
+	}
+
+	from := int64(0)
+	if !q.From.IsZero() {
+		from = q.From.Unix()
+	}
+	to := int64(1<<63 - 1)
+	if !q.To.IsZero() {
+		to = q.To.Unix()
+	}
+
+	ids, err := s.matchingSeries(q)
+	if err != nil || len(ids) == 0 {
+		return []Sample{}, err
+	}
+	seriesIds := strings.Join(ids, ",")
+
+	var rows *sql.Rows
+	if q.Resolution == Raw {
+		rows, err = s.db.Query(`SELECT se.inverter, se.moduleid, se.processdataid, se.unit, sa.ts, sa.value, sa.value, sa.value, 1
+			FROM samples sa JOIN series se ON se.id = sa.series_id
+			WHERE sa.series_id IN (`+seriesIds+`) AND sa.ts >= ? AND sa.ts <= ? ORDER BY se.inverter, se.moduleid, se.processdataid, sa.ts`, from, to)
+	} else {
+		rows, err = s.db.Query(`SELECT se.inverter, se.moduleid, se.processdataid, se.unit, a.ts, a.min, a.max, a.avg, a.count
+			FROM aggregates a JOIN series se ON se.id = a.series_id
+			WHERE a.series_id IN (`+seriesIds+`) AND a.resolution = ? AND a.ts >= ? AND a.ts <= ? ORDER BY se.inverter, se.moduleid, se.processdataid, a.ts`, q.Resolution, from, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		var sample Sample
+		var ts int64
+		if err := rows.Scan(&sample.Inverter, &sample.ModuleId, &sample.Id, &sample.Unit, &ts, &sample.Min, &sample.Max, &sample.Avg, &sample.Count); err != nil {
+			return nil, err
+		}
+		sample.Time = time.Unix(ts, 0)
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// matchingSeries returns the ids of the series which match the patterns of the query, formatted for an SQL IN list
+func (s *Store) matchingSeries(q Query) ([]string, error) {
+	rows, err := s.db.Query("SELECT id, inverter, moduleid, processdataid FROM series")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id int64
+		var series Series
+		if err := rows.Scan(&id, &series.Inverter, &series.ModuleId, &series.Id); err != nil {
+			return nil, err
+		}
+		if matchPattern(q.Inverter, series.Inverter) && matchPattern(q.ModuleId, series.ModuleId) && matchPattern(q.Id, series.Id) {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+	}
+	return ids, rows.Err()
+}
+
+// Summarize returns one sample per series with minimum, maximum, weighted average and count of the samples.
+// The time of a summary is the time of the first sample.
+func Summarize(samples []Sample) []Sample {
+	var summaries []Sample
+	index := make(map[Series]int)
+	for _, sample := range samples {
+		i, found := index[sample.Series]
+		if !found {
+			index[sample.Series] = len(summaries)
+			summaries = append(summaries, sample)
+			summaries[len(summaries)-1].Avg = sample.Avg * float64(sample.Count)
+			continue
+		}
+		summary := &summaries[i]
+		if sample.Min < summary.Min {
+			summary.Min = sample.Min
+		}
+		if sample.Max > summary.Max {
+			summary.Max = sample.Max
+		}
+		summary.Avg += sample.Avg * float64(sample.Count)
+		summary.Count += sample.Count
+	}
+	for i := range summaries {
+		if summaries[i].Count > 0 {
+			summaries[i].Avg /= float64(summaries[i].Count)
+		}
+	}
+	return summaries
+}
+
+// matchPattern returns true if the pattern is empty or matches the value
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
@@ -0,0 +1,300 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/geschke/golrackpi"
+)
+
+// openTestStore opens a store in a temporary directory with the location Europe/Berlin
+func openTestStore(t *testing.T) (*Store, *time.Location) {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetLocation(loc)
+	return store, loc
+}
+
+// power returns process-data values with the power of the DC input and a non-numeric state
+func power(value float64) []golrackpi.ProcessDataValues {
+	return []golrackpi.ProcessDataValues{{
+		ModuleId: "devices:local",
+		ProcessData: []golrackpi.ProcessDataValue{
+			{Id: "Dc_P", Unit: "W", Value: value},
+			{Id: "State", Value: "Feed-in"},
+		},
+	}}
+}
+
+func TestStoreInsertQuery(t *testing.T) {
+	store, loc := openTestStore(t)
+	start := time.Date(2024, 6, 21, 12, 0, 0, 0, loc)
+	for i, value := range []float64{100, 200, 300} {
+		if err := store.Insert("roof", start.Add(time.Duration(i)*10*time.Second), power(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Insert("garage", start, power(50)); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := store.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("got %d samples, want 4 (non-numeric values have to be skipped)", len(samples))
+	}
+	if samples[0].Inverter != "garage" || samples[0].Unit != "W" || samples[0].Count != 1 || samples[0].Min != 50 || samples[0].Max != 50 {
+		t.Errorf("wrong first sample %+v", samples[0])
+	}
+
+	samples, err = store.Query(Query{Inverter: "ro*", Id: "Dc_*", From: start.Add(5 * time.Second), To: start.Add(20 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].Avg != 200 || samples[1].Avg != 300 || !samples[0].Time.Equal(start.Add(10*time.Second)) {
+		t.Errorf("wrong samples of range %+v", samples)
+	}
+
+	samples, err = store.Query(Query{Inverter: "unknown"})
+	if err != nil || samples == nil || len(samples) != 0 {
+		t.Errorf("unknown inverter: got %+v, %v", samples, err)
+	}
+
+	if _, err := store.Query(Query{ModuleId: "[devices"}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestStoreMaintain(t *testing.T) {
+	store, loc := openTestStore(t)
+
+	// 23:50 and 00:10 in Berlin are on different local days, but on the same day in UTC
+	times := []time.Time{
+		time.Date(2024, 6, 20, 23, 50, 0, 0, loc),
+		time.Date(2024, 6, 20, 23, 50, 30, 0, loc),
+		time.Date(2024, 6, 21, 0, 10, 0, 0, loc),
+	}
+	for i, t0 := range times {
+		if err := store.Insert("roof", t0, power(float64(100*(i+1)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2024, 6, 22, 0, 5, 0, 0, loc)
+	if err := store.Maintain(now, RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	minutes, err := store.Query(Query{Resolution: Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minutes) != 2 || minutes[0].Count != 2 || minutes[0].Min != 100 || minutes[0].Max != 200 || minutes[0].Avg != 150 {
+		t.Errorf("wrong minute aggregates %+v", minutes)
+	}
+
+	days, err := store.Query(Query{Resolution: Daily})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("got %d daily aggregates, want 2: %+v", len(days), days)
+	}
+	if !days[0].Time.Equal(time.Date(2024, 6, 20, 0, 0, 0, 0, loc)) || days[0].Count != 2 || days[0].Avg != 150 {
+		t.Errorf("wrong first day %+v", days[0])
+	}
+	if !days[1].Time.Equal(time.Date(2024, 6, 21, 0, 0, 0, 0, loc)) || days[1].Count != 1 || days[1].Avg != 300 {
+		t.Errorf("wrong second day %+v", days[1])
+	}
+
+	// a later sample of a downsampled interval is only included after the next complete interval
+	if err := store.Insert("roof", time.Date(2024, 6, 22, 0, 6, 0, 0, loc), power(400)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Maintain(now.Add(time.Minute), RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if days, _ := store.Query(Query{Resolution: Daily}); len(days) != 2 {
+		t.Errorf("incomplete day was aggregated: %+v", days)
+	}
+}
+
+func TestStoreDaylightSavingTime(t *testing.T) {
+	store, loc := openTestStore(t)
+
+	// the 31st of March 2024 has 23 hours in Berlin
+	for _, t0 := range []time.Time{
+		time.Date(2024, 3, 31, 0, 30, 0, 0, loc),
+		time.Date(2024, 3, 31, 23, 30, 0, 0, loc),
+		time.Date(2024, 4, 1, 0, 30, 0, 0, loc),
+	} {
+		if err := store.Insert("roof", t0, power(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Maintain(time.Date(2024, 4, 2, 0, 0, 0, 0, loc), RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	days, err := store.Query(Query{Resolution: Daily})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Count != 2 || days[1].Count != 1 || !days[1].Time.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, loc)) {
+		t.Errorf("wrong daily aggregates %+v", days)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	store, loc := openTestStore(t)
+	now := time.Date(2024, 6, 21, 12, 0, 0, 0, loc)
+	for _, age := range []time.Duration{3 * time.Hour, 30 * time.Minute} {
+		if err := store.Insert("roof", now.Add(-age), power(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Maintain(now, RetentionPolicy{Raw: time.Hour, Minute: 2 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := store.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 1 || !raw[0].Time.Equal(now.Add(-30*time.Minute)) {
+		t.Errorf("wrong raw samples after retention %+v", raw)
+	}
+	minutes, _ := store.Query(Query{Resolution: Minute})
+	if len(minutes) != 1 {
+		t.Errorf("wrong minute aggregates after retention %+v", minutes)
+	}
+	quarters, _ := store.Query(Query{Resolution: Quarter})
+	if len(quarters) != 2 {
+		t.Errorf("aggregates without retention were deleted %+v", quarters)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	series := Series{Inverter: "roof", ModuleId: "devices:local", Id: "Dc_P"}
+	summaries := Summarize([]Sample{
+		{Series: series, Min: 10, Max: 20, Avg: 15, Count: 1},
+		{Series: series, Min: 5, Max: 30, Avg: 20, Count: 3},
+	})
+	if len(summaries) != 1 || summaries[0].Min != 5 || summaries[0].Max != 30 || summaries[0].Avg != 18.75 || summaries[0].Count != 4 {
+		t.Errorf("wrong summary %+v", summaries)
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	for _, r := range []Resolution{Raw, Minute, Quarter, Daily} {
+		if parsed, err := ParseResolution(r.String()); err != nil || parsed != r {
+			t.Errorf("%s: got %v, %v", r, parsed, err)
+		}
+	}
+	if _, err := ParseResolution("1h"); err == nil {
+		t.Error("unknown resolution accepted")
+	}
+}
+
+// backfillSample returns a sample of the DC power with the submitted value
+func backfillSample(t0 time.Time, value float64) Sample {
+	return Sample{
+		Series: Series{Inverter: "roof", ModuleId: "devices:local", Id: "Dc_P", Unit: "W"},
+		Time:   t0, Min: value, Max: value, Avg: value, Count: 1,
+	}
+}
+
+// queryOne returns the only sample of the resolution at the time
+func queryOne(t *testing.T, store *Store, resolution Resolution, t0 time.Time) Sample {
+	t.Helper()
+	samples, err := store.Query(Query{Resolution: resolution, From: t0, To: t0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("got %d %s samples at %v, want 1", len(samples), resolution, t0)
+	}
+	return samples[0]
+}
+
+func TestStoreBackfill(t *testing.T) {
+	store, loc := openTestStore(t)
+
+	// recording started at 10:30, the backfilled values cover 10:00 to 10:30
+	start := time.Date(2024, 6, 21, 10, 30, 0, 0, loc)
+	for i := 0; i < 30; i++ {
+		if err := store.Insert("roof", start.Add(time.Duration(i)*30*time.Second), power(1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Maintain(time.Date(2024, 6, 22, 0, 5, 0, 0, loc), RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	var samples []Sample
+	for t0 := start.Add(-30 * time.Minute); !t0.After(start); t0 = t0.Add(5 * time.Minute) {
+		samples = append(samples, backfillSample(t0, 400))
+	}
+	if err := store.Backfill(samples); err != nil {
+		t.Fatal(err)
+	}
+
+	if sample := queryOne(t, store, Raw, start); sample.Avg != 1000 {
+		t.Errorf("recorded sample was replaced: %+v", sample)
+	}
+	if quarter := queryOne(t, store, Quarter, start.Add(-30*time.Minute)); quarter.Count != 3 || quarter.Avg != 400 {
+		t.Errorf("wrong backfilled quarter %+v", quarter)
+	}
+	if quarter := queryOne(t, store, Quarter, start); quarter.Count != 30 || quarter.Avg != 1000 {
+		t.Errorf("wrong recorded quarter %+v", quarter)
+	}
+	day := queryOne(t, store, Daily, time.Date(2024, 6, 21, 0, 0, 0, 0, loc))
+	if day.Count != 36 || day.Min != 400 || day.Max != 1000 || day.Avg != 900 {
+		t.Errorf("day wasn't recalculated: %+v", day)
+	}
+}
+
+func TestStoreBackfillPruned(t *testing.T) {
+	store, loc := openTestStore(t)
+
+	noon := time.Date(2024, 6, 21, 12, 0, 0, 0, loc)
+	if err := store.Insert("roof", noon, power(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Maintain(time.Date(2024, 6, 22, 0, 5, 0, 0, loc), RetentionPolicy{Raw: 6 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := store.Query(Query{}); len(raw) != 0 {
+		t.Fatalf("raw samples weren't deleted: %+v", raw)
+	}
+
+	// the raw sample of 12:00 was deleted, so its minute can't be recalculated, but the quarter can from the minutes
+	if err := store.Backfill([]Sample{backfillSample(noon, 900), backfillSample(noon.Add(5*time.Minute), 500)}); err != nil {
+		t.Fatal(err)
+	}
+	if minute := queryOne(t, store, Minute, noon); minute.Avg != 100 {
+		t.Errorf("aggregate of pruned samples was replaced: %+v", minute)
+	}
+	if minute := queryOne(t, store, Minute, noon.Add(5*time.Minute)); minute.Avg != 500 {
+		t.Errorf("wrong backfilled minute %+v", minute)
+	}
+	if quarter := queryOne(t, store, Quarter, noon); quarter.Count != 2 || quarter.Avg != 300 {
+		t.Errorf("wrong quarter %+v", quarter)
+	}
+	if day := queryOne(t, store, Daily, time.Date(2024, 6, 21, 0, 0, 0, 0, loc)); day.Count != 2 || day.Avg != 300 {
+		t.Errorf("wrong day %+v", day)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package influx writes samples in the InfluxDB line protocol, either to a file or to the write endpoint of InfluxDB 1.x or 2.x.
+package influx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point specifies a sample in the line protocol with measurement, tags, fields and timestamp
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// Sink is implemented by the outputs of points
+type Sink interface {
+	// Write writes the points or adds them to the current batch
+	Write(points []Point) error
+	// Flush writes the current batch
+	Flush() error
+	// Close flushes the current batch and releases the resources of the sink
+	Close() error
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Line returns the point in the line protocol without trailing line feed. Tags and fields are sorted by key.
+// An error is returned if the point has no measurement or no field with a supported value.
+func (p Point) Line() (string, error) {
+	if p.Measurement == "" {
+		return "", fmt.Errorf("point without measurement")
+	}
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	for _, key := range sortedKeys(p.Tags) {
+		value := p.Tags[key]
+		if key == "" || value == "" {
+			// empty tag values are not allowed by the line protocol
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(key))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(value))
+	}
+
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for key := range p.Fields {
+		fieldKeys = append(fieldKeys, key)
+	}
+	sort.Strings(fieldKeys)
+
+	fields := 0
+	for _, key := range fieldKeys {
+		value, ok := formatField(p.Fields[key])
+		if !ok || key == "" {
+			continue
+		}
+		if fields == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(key))
+		b.WriteByte('=')
+		b.WriteString(value)
+		fields++
+	}
+	if fields == 0 {
+		return "", fmt.Errorf("point %s without valid field", p.Measurement)
+	}
+
+	if !p.Time.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+	}
+	return b.String(), nil
+}
+
+// formatField returns the field value in the line protocol. The second return value is false for unsupported types.
+func formatField(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v) + "i", true
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	}
+	return "", false
+}
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeLines returns the points in the line protocol, one line per point. Invalid points are skipped and returned as error.
+func encodeLines(points []Point) ([]string, error) {
+	lines := make([]string, 0, len(points))
+	var invalid []string
+	for _, point := range points {
+		line, err := point.Line()
+		if err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(invalid) > 0 {
+		return lines, fmt.Errorf("skipped invalid points: %s", strings.Join(invalid, "; "))
+	}
+	return lines, nil
+}
+
+// LineWriter is a Sink which writes the points immediately to an io.Writer, e.g. os.Stdout or a file
+type LineWriter struct {
+	w io.Writer
+}
+
+// NewLineWriter returns a LineWriter instance which writes to w
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: w}
+}
+
+// Write writes the points, one line per point
+func (l *LineWriter) Write(points []Point) error {
+	lines, encodeErr := encodeLines(points)
+	for _, line := range lines {
+		if _, err := io.WriteString(l.w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return encodeErr
+}
+
+// Flush does nothing, because the points are written immediately
+func (l *LineWriter) Flush() error {
+	return nil
+}
+
+// Close closes the underlying writer, if it implements io.Closer
+func (l *LineWriter) Close() error {
+	if closer, ok := l.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPointLine(t *testing.T) {
+	ts := time.Unix(1706700000, 5)
+	tests := []struct {
+		point Point
+		want  string
+	}{
+		{
+			Point{Measurement: "devices:local:ac", Tags: map[string]string{"inverter": "192.168.1.10", "serial": "90x"}, Fields: map[string]interface{}{"P": 2873.5, "Frequency": 50.01}, Time: ts},
+			"devices:local:ac,inverter=192.168.1.10,serial=90x Frequency=50.01,P=2873.5 1706700000000000005",
+		},
+		{
+			Point{Measurement: "my measurement,1", Tags: map[string]string{"in verter": "roof=east,1", "empty": ""}, Fields: map[string]interface{}{"a=b c": int64(3)}},
+			`my\ measurement\,1,in\ verter=roof\=east\,1 a\=b\ c=3i`,
+		},
+		{
+			Point{Measurement: "m", Fields: map[string]interface{}{"s": `say "hi" \o/`, "b": true, "i": 7, "f": float32(0.5), "u": uint8(1)}},
+			`m b=true,f=0.5,i=7i,s="say \"hi\" \\o/"`,
+		},
+	}
+	for _, test := range tests {
+		line, err := test.point.Line()
+		if err != nil {
+			t.Errorf("%s: %v", test.point.Measurement, err)
+			continue
+		}
+		if line != test.want {
+			t.Errorf("got %s, want %s", line, test.want)
+		}
+	}
+
+	for _, point := range []Point{{Fields: map[string]interface{}{"a": 1.0}}, {Measurement: "m", Fields: map[string]interface{}{"a": nil}}} {
+		if line, err := point.Line(); err == nil {
+			t.Errorf("invalid point accepted as %s", line)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewLineWriter(&b)
+	err := w.Write([]Point{{Measurement: "a", Fields: map[string]interface{}{"v": 1.0}}, {Measurement: "b"}, {Measurement: "c", Fields: map[string]interface{}{"v": 2.0}}})
+	if err == nil {
+		t.Error("invalid point not returned as error")
+	}
+	if want := "a v=1\nc v=2\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config specifies the write endpoint and the batching, retry and buffer behaviour of a Writer
+type Config struct {
+	// URL is the base URL of the InfluxDB server, e.g. http://localhost:8086
+	URL string
+	// Version is the API version of the server, 1 or 2 (default: 2)
+	Version int
+
+	// Database, RetentionPolicy, Username and Password are used with InfluxDB 1.x
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// Org, Bucket and Token are used with InfluxDB 2.x
+	Org    string
+	Bucket string
+	Token  string
+
+	// BatchSize is the number of lines after which the batch is written (default: 5000)
+	BatchSize int
+	// MaxRetries is the number of retries of a failed request (default: 3, a negative value disables retries)
+	MaxRetries int
+	// RetryInterval is the wait time before the first retry, which is doubled with every retry (default: 1s)
+	RetryInterval time.Duration
+	// BufferFile is the name of a file to keep the lines in while the server is unreachable or refuses the requests, e.g. because of a
+	// wrong token. Lines rejected as invalid (400, 413, 422) are never kept. Without buffer file, lines which could not be written are dropped.
+	BufferFile string
+	// Timeout is the timeout of a request (default: 10s)
+	Timeout time.Duration
+}
+
+// Writer is a Sink which sends the points in batches to the write endpoint of InfluxDB
+type Writer struct {
+	config  Config
+	client  http.Client
+	mu      sync.Mutex
+	pending []string
+}
+
+// errPermanent marks errors which are not solved by a retry, e.g. a rejected line
+type errPermanent struct {
+	err error
+}
+
+func (e errPermanent) Error() string {
+	return e.err.Error()
+}
+
+// errNoRetry marks errors which are not solved by an immediate retry, but by fixing the configuration of the server, e.g. a wrong token
+// or a missing bucket. The lines are kept.
+type errNoRetry struct {
+	err error
+}
+
+func (e errNoRetry) Error() string {
+	return e.err.Error()
+}
+
+// NewWriter returns a Writer instance with the submitted configuration
+func NewWriter(config Config) (*Writer, error) {
+	if config.URL == "" {
+		return nil, errors.New("missing URL")
+	}
+	if config.Version == 0 {
+		config.Version = 2
+	}
+	switch config.Version {
+	case 1:
+		if config.Database == "" {
+			return nil, errors.New("missing database")
+		}
+	case 2:
+		if config.Bucket == "" {
+			return nil, errors.New("missing bucket")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported version %d", config.Version)
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 5000
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &Writer{config: config, client: http.Client{Timeout: config.Timeout}}, nil
+}
+
+// Write adds the points to the current batch and writes the batch if it reached the batch size
+func (w *Writer) Write(points []Point) error {
+	lines, encodeErr := encodeLines(points)
+
+	w.mu.Lock()
+	w.pending = append(w.pending, lines...)
+	full := len(w.pending) >= w.config.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return encodeErr
+}
+
+// Flush writes the lines of the buffer file and the current batch. If the server is unreachable, the lines are appended to the buffer file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := w.pending
+	w.pending = nil
+
+	if err := w.flushBuffer(); err != nil {
+		return w.keep(lines, err)
+	}
+
+	var rejected error
+	for start := 0; start < len(lines); start += w.config.BatchSize {
+		end := start + w.config.BatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := w.send(lines[start:end]); err != nil {
+			var permanent errPermanent
+			if errors.As(err, &permanent) {
+				// the server rejected the batch, so it doesn't make sense to keep it
+				rejected = fmt.Errorf("dropped %d line(s): %w", end-start, err)
+				continue
+			}
+			return w.keep(lines[start:], err)
+		}
+	}
+	return rejected
+}
+
+// Close writes the current batch
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// keep appends the lines to the buffer file and returns err, together with the error of the buffer file
+func (w *Writer) keep(lines []string, err error) error {
+	if len(lines) == 0 {
+		return err
+	}
+	if w.config.BufferFile == "" {
+		return fmt.Errorf("dropped %d line(s): %w", len(lines), err)
+	}
+	f, fileErr := os.OpenFile(w.config.BufferFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if fileErr != nil {
+		return fmt.Errorf("dropped %d line(s): %w (buffer file: %v)", len(lines), err, fileErr)
+	}
+	defer f.Close()
+	buffered := bufio.NewWriter(f)
+	for _, line := range lines {
+		buffered.WriteString(line + "\n")
+	}
+	if fileErr := buffered.Flush(); fileErr != nil {
+		return fmt.Errorf("dropped %d line(s): %w (buffer file: %v)", len(lines), err, fileErr)
+	}
+	return fmt.Errorf("buffered %d line(s): %w", len(lines), err)
+}
+
+// flushBuffer sends the lines of the buffer file in batches and removes the file afterwards.
+// If a batch fails, the remaining lines are kept in the buffer file.
+func (w *Writer) flushBuffer() error {
+	if w.config.BufferFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(w.config.BufferFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(lines); start += w.config.BatchSize {
+		end := start + w.config.BatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := w.send(lines[start:end]); err != nil {
+			var permanent errPermanent
+			if errors.As(err, &permanent) {
+				continue
+			}
+			if writeErr := os.WriteFile(w.config.BufferFile, []byte(strings.Join(lines[start:], "\n")+"\n"), 0600); writeErr != nil {
+				return fmt.Errorf("%w (buffer file: %v)", err, writeErr)
+			}
+			return err
+		}
+	}
+	return os.Remove(w.config.BufferFile)
+}
+
+// send writes a batch to the server and retries temporary failures with exponential backoff
+func (w *Writer) send(lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	wait := w.config.RetryInterval
+
+	var err error
+	for attempt := 0; attempt <= w.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		err = w.post(body)
+		var permanent errPermanent
+		var noRetry errNoRetry
+		if err == nil || errors.As(err, &permanent) || errors.As(err, &noRetry) {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends a single request to the write endpoint
+func (w *Writer) post(body string) error {
+	request, err := http.NewRequest("POST", w.writeUrl(), strings.NewReader(body))
+	if err != nil {
+		return errPermanent{err}
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.config.Version == 2 && w.config.Token != "" {
+		request.Header.Set("Authorization", "Token "+w.config.Token)
+	}
+	if w.config.Version == 1 && w.config.Username != "" {
+		request.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	err = fmt.Errorf("write request returned with http error %s: %s", response.Status, strings.TrimSpace(string(message)))
+	switch {
+	case response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusRequestEntityTooLarge || response.StatusCode == http.StatusUnprocessableEntity:
+		// the lines were rejected, e.g. because of a syntax error or a conflicting field type
+		return errPermanent{err}
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return err
+	}
+	return errNoRetry{err}
+}
+
+// writeUrl returns the URL of the write endpoint with the query parameters of the API version
+func (w *Writer) writeUrl() string {
+	query := url.Values{}
+	query.Set("precision", "ns")
+	base := strings.TrimSuffix(w.config.URL, "/")
+	if w.config.Version == 1 {
+		query.Set("db", w.config.Database)
+		if w.config.RetentionPolicy != "" {
+			query.Set("rp", w.config.RetentionPolicy)
+		}
+		return base + "/write?" + query.Encode()
+	}
+	if w.config.Org != "" {
+		query.Set("org", w.config.Org)
+	}
+	query.Set("bucket", w.config.Bucket)
+	return base + "/api/v2/write?" + query.Encode()
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is a write endpoint which answers with the configured status and records the accepted lines
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests int
+	lines    []string
+	query    string
+	auth     string
+}
+
+// startTestServer starts a write endpoint which accepts all requests
+func startTestServer(t *testing.T) *testServer {
+	s := &testServer{status: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		s.query = r.URL.Path + "?" + r.URL.RawQuery
+		s.auth = r.Header.Get("Authorization")
+		if s.status == http.StatusNoContent {
+			s.lines = append(s.lines, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// setStatus sets the status of the following responses and resets the number of requests
+func (s *testServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.requests = 0
+}
+
+func testPoints(values ...float64) []Point {
+	var points []Point
+	for _, v := range values {
+		points = append(points, Point{Measurement: "m", Fields: map[string]interface{}{"v": v}})
+	}
+	return points
+}
+
+func TestWriter(t *testing.T) {
+	server := startTestServer(t)
+	w, err := NewWriter(Config{URL: server.URL + "/", Org: "home", Bucket: "solar", Token: "secret", BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(testPoints(1)); err != nil {
+		t.Fatal(err)
+	}
+	if server.requests != 0 {
+		t.Error("incomplete batch was written")
+	}
+	if err := w.Write(testPoints(2, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(server.lines, "|") != "m v=1|m v=2|m v=3" || server.requests != 2 {
+		t.Errorf("got %d requests with %v", server.requests, server.lines)
+	}
+	if server.query != "/api/v2/write?bucket=solar&org=home&precision=ns" || server.auth != "Token secret" {
+		t.Errorf("wrong request %s with authorization %q", server.query, server.auth)
+	}
+
+	v1, err := NewWriter(Config{URL: server.URL, Version: 1, Database: "solar", RetentionPolicy: "week", Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.Write(testPoints(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if server.query != "/write?db=solar&precision=ns&rp=week" || !strings.HasPrefix(server.auth, "Basic ") {
+		t.Errorf("wrong request %s with authorization %q", server.query, server.auth)
+	}
+
+	for _, config := range []Config{{}, {URL: "http://x"}, {URL: "http://x", Version: 1}, {URL: "http://x", Version: 3, Bucket: "b"}} {
+		if _, err := NewWriter(config); err == nil {
+			t.Errorf("invalid config %+v accepted", config)
+		}
+	}
+}
+
+func TestWriterRetryAndBuffer(t *testing.T) {
+	server := startTestServer(t)
+	buffer := filepath.Join(t.TempDir(), "influx.buffer")
+	w, err := NewWriter(Config{URL: server.URL, Bucket: "solar", MaxRetries: 2, RetryInterval: time.Millisecond, BufferFile: buffer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status   int
+		requests int  // number of requests including retries
+		kept     bool // lines are kept in the buffer file
+	}{
+		{http.StatusServiceUnavailable, 3, true},
+		{http.StatusTooManyRequests, 3, true},
+		{http.StatusUnauthorized, 1, true},
+		{http.StatusForbidden, 1, true},
+		{http.StatusNotFound, 1, true},
+		{http.StatusBadRequest, 1, false},
+		{http.StatusRequestEntityTooLarge, 1, false},
+		{http.StatusUnprocessableEntity, 1, false},
+	}
+	for _, test := range tests {
+		os.Remove(buffer)
+		server.setStatus(test.status)
+		w.Write(testPoints(float64(test.status)))
+		if err := w.Flush(); err == nil {
+			t.Errorf("%d: no error", test.status)
+		}
+		if server.requests != test.requests {
+			t.Errorf("%d: got %d requests, want %d", test.status, server.requests, test.requests)
+		}
+		data, _ := os.ReadFile(buffer)
+		if kept := string(data) != ""; kept != test.kept {
+			t.Errorf("%d: got buffer %q", test.status, data)
+		}
+	}
+
+	// the buffered lines are sent before the new batch as soon as the server accepts them
+	os.WriteFile(buffer, []byte("m v=1\nm v=2\n"), 0600)
+	server.setStatus(http.StatusNoContent)
+	w.Write(testPoints(3))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(server.lines, "|") != "m v=1|m v=2|m v=3" {
+		t.Errorf("got %v", server.lines)
+	}
+	if _, err := os.Stat(buffer); !os.IsNotExist(err) {
+		t.Errorf("buffer file not removed: %v", err)
+	}
+
+	// without buffer file, the lines are dropped
+	noBuffer, _ := NewWriter(Config{URL: server.URL, Bucket: "solar", MaxRetries: -1})
+	server.setStatus(http.StatusInternalServerError)
+	noBuffer.Write(testPoints(4))
+	if err := noBuffer.Flush(); err == nil || !strings.Contains(err.Error(), "dropped 1 line(s)") || server.requests != 1 {
+		t.Errorf("got %v after %d requests", err, server.requests)
+	}
+}
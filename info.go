@@ -5,48 +5,75 @@
 package golrackpi
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"io"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	"net/http"
+	"github.com/geschke/golrackpi/api"
 )
 
-// Version returns information about the API; currently name, hostname, sw_version and api_version
-func (c *AuthClient) Version() (map[string]interface{}, error) {
-	var result map[string]interface{}
-	client := http.Client{}
+// Version returns information about the API, i.e. name, hostname, sw_version and api_version
+func (c *AuthClient) Version() (api.VersionInfo, error) {
+	return api.New(c).GetVersion(context.Background())
+}
 
-	request, err := http.NewRequest("GET", c.getUrl("/api/v1/info/version"), nil)
+// SerialNumber returns the serial number of the inverter from the devices:local settings
+func (c *AuthClient) SerialNumber() (string, error) {
+	serial, err := c.SettingsModuleSetting("devices:local", "Properties:SerialNo")
 	if err != nil {
-		return result, err
+		return "", err
 	}
-
-	request.Header.Add("authorization", "Session "+c.SessionId)
-
-	response, err := client.Do(request)
-	if err != nil {
-		return result, err
-
+	if len(serial) == 0 {
+		return "", errors.New("serial number not found")
 	}
+	return serial[0].Value, nil
+}
 
-	body, err := io.ReadAll(response.Body)
+// InverterLocation returns the time zone configured on the inverter. It's read from the settings of the "scb:time" module,
+// which contain the time zone as IANA name (e.g. "Europe/Berlin") or as offset to UTC (e.g. "UTC+01:00").
+func (c *AuthClient) InverterLocation() (*time.Location, error) {
+	values, err := c.SettingsModule("scb:time")
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	defer response.Body.Close()
-
-	var jsonResult interface{}
-	err = json.Unmarshal(body, &jsonResult)
-	if err != nil {
-		return result, err
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value.Id), "timezone") && value.Value != "" {
+			return ParseTimeZone(value.Value)
+		}
 	}
+	return nil, errors.New("time zone setting not available")
+}
 
-	m, mOk := jsonResult.(map[string]interface{})
-
-	if mOk {
-		return m, nil
+// ParseTimeZone returns the location of a time zone, which is either an IANA name like "Europe/Berlin", "UTC", "Local"
+// or an offset to UTC like "+01:00", "UTC+01:00" or "GMT+1".
+func ParseTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc, nil
 	}
-	return result, errors.New("could not read response")
 
+	offset := strings.TrimPrefix(strings.TrimPrefix(strings.ToUpper(name), "UTC"), "GMT")
+	if len(offset) < 2 || (offset[0] != '+' && offset[0] != '-') {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	sign := 1
+	if offset[0] == '-' {
+		sign = -1
+	}
+	hours, minutes, _ := strings.Cut(offset[1:], ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h > 14 {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	m := 0
+	if minutes != "" {
+		m, err = strconv.Atoi(minutes)
+		if err != nil || m > 59 {
+			return nil, fmt.Errorf("unknown time zone %q", name)
+		}
+	}
+	return time.FixedZone(name, sign*(h*3600+m*60)), nil
 }
@@ -0,0 +1,52 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi_test
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/geschke/golrackpi/simulator"
+)
+
+// failingTransport counts and fails the requests whose path contains the submitted part
+type failingTransport struct {
+	part  string
+	count atomic.Int32
+}
+
+func (t *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.Contains(r.URL.Path, t.part) {
+		t.count.Add(1)
+		return &http.Response{StatusCode: http.StatusInternalServerError, Status: "500 Internal Server Error", Body: http.NoBody, Request: r}, nil
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestInverterLocationReadOnce(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	transport := &failingTransport{part: "scb:time"}
+	client := sim.Client()
+	client.HTTPClient = &http.Client{Transport: transport}
+
+	// the time zone isn't requested again after a failed request
+	for i := 0; i < 3; i++ {
+		if _, err := client.Login(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Logout(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := transport.count.Load(); count != 1 {
+		t.Errorf("time zone requested %d times, want 1", count)
+	}
+}
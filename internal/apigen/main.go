@@ -0,0 +1,659 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Apigen generates Go types for the schemas and client methods for the operations of an OpenAPI 3 or Swagger 2 description
+// of the inverter's REST API. It's called by go generate in the api package:
+//
+//	go run ./internal/apigen -in api/openapi.json -out api/api_gen.go -package api
+//
+// The generated methods belong to the Client type of the target package, which has to provide a Doer field with the Do method
+// of golrackpi.AuthClient and a pathParam function for path parameters.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// document specifies the parts of an OpenAPI or Swagger document which are used by the generator
+type document struct {
+	Swagger  string `json:"swagger"`
+	OpenAPI  string `json:"openapi"`
+	BasePath string `json:"basePath"`
+	Servers  []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Produces    []string                              `json:"produces"`
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]*schema                    `json:"definitions"`
+	Parameters  map[string]parameter                  `json:"parameters"`
+	Responses   map[string]response                   `json:"responses"`
+	Components  struct {
+		Schemas    map[string]*schema   `json:"schemas"`
+		Parameters map[string]parameter `json:"parameters"`
+		Responses  map[string]response  `json:"responses"`
+	} `json:"components"`
+}
+
+// schema specifies a schema object, only the subset of JSON schema which is used by the inverter API is supported
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+}
+
+// mediaType specifies the content of a request or response body
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+// parameter specifies a parameter of an operation. Swagger 2 documents define the type in the parameter itself and the request body
+// as parameter in "body". Parameters can refer to the parameters of the document with $ref.
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Type        string  `json:"type"`
+	Format      string  `json:"format"`
+	Schema      *schema `json:"schema"`
+}
+
+// response specifies a response of an operation, which can refer to the responses of the document with $ref
+type response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+	Schema      *schema              `json:"schema"`
+}
+
+// operation specifies an operation, i.e. a method of a path
+type operation struct {
+	OperationId string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description"`
+	Produces    []string    `json:"produces"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]response `json:"responses"`
+
+	method string
+	path   string
+}
+
+// hasParameter returns true if the operation defines the parameter itself
+func (op *operation) hasParameter(p parameter) bool {
+	for _, own := range op.Parameters {
+		if own.Name == p.Name && own.In == p.In {
+			return true
+		}
+	}
+	return false
+}
+
+// methods are the http methods of a path item in the order of the generated code
+var methods = []string{"get", "put", "post", "delete", "patch"}
+
+func main() {
+	in := flag.String("in", "openapi.json", "OpenAPI or Swagger document in JSON format")
+	out := flag.String("out", "api_gen.go", "Generated Go file")
+	pkg := flag.String("package", "api", "Package name of the generated file")
+	flag.Parse()
+
+	if err := run(*in, *out, *pkg); err != nil {
+		fmt.Fprintln(os.Stderr, "apigen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the Go file out from the document in
+func run(in string, out string, pkg string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("could not parse %s: %w", in, err)
+	}
+	if doc.OpenAPI == "" && doc.Swagger == "" {
+		return fmt.Errorf("%s is not an OpenAPI or Swagger document", in)
+	}
+
+	g := newGenerator(&doc)
+	code, err := g.generate(pkg, filepath.Base(in))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, code, 0644)
+}
+
+// generator collects the declarations of the generated file
+type generator struct {
+	doc        *document
+	schemas    map[string]*schema
+	parameters map[string]parameter
+	responses  map[string]response
+	basePath   string
+	types      map[string]string // declarations by type name
+	usesQuery  bool
+	usesFmt    bool
+	methods    map[string]bool // names of the generated methods
+}
+
+// newGenerator returns a generator for the document
+func newGenerator(doc *document) *generator {
+	g := &generator{
+		doc:        doc,
+		schemas:    make(map[string]*schema),
+		parameters: make(map[string]parameter),
+		responses:  make(map[string]response),
+		types:      make(map[string]string),
+		methods:    make(map[string]bool),
+	}
+	for name, s := range doc.Definitions {
+		g.schemas[name] = s
+	}
+	for name, s := range doc.Components.Schemas {
+		g.schemas[name] = s
+	}
+	for name, p := range doc.Parameters {
+		g.parameters[name] = p
+	}
+	for name, p := range doc.Components.Parameters {
+		g.parameters[name] = p
+	}
+	for name, r := range doc.Responses {
+		g.responses[name] = r
+	}
+	for name, r := range doc.Components.Responses {
+		g.responses[name] = r
+	}
+	g.basePath = doc.BasePath
+	if len(doc.Servers) > 0 {
+		g.basePath = doc.Servers[0].URL
+		// only the path of absolute server URLs is used, the server is set in the client
+		if i := strings.Index(g.basePath, "://"); i >= 0 {
+			g.basePath = g.basePath[i+3:]
+			if j := strings.Index(g.basePath, "/"); j >= 0 {
+				g.basePath = g.basePath[j:]
+			} else {
+				g.basePath = ""
+			}
+		}
+	}
+	g.basePath = strings.TrimRight(g.basePath, "/")
+	return g
+}
+
+// generate returns the formatted Go source of all schemas and operations
+func (g *generator) generate(pkg string, source string) ([]byte, error) {
+	names := make([]string, 0, len(g.schemas))
+	for name := range g.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.declare(goName(name), name, g.schemas[name])
+	}
+
+	operations, err := g.operations()
+	if err != nil {
+		return nil, err
+	}
+	var methodCode bytes.Buffer
+	for _, op := range operations {
+		if err := g.method(&methodCode, op); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by apigen from %s; DO NOT EDIT.\n\npackage %s\n\n", source, pkg)
+	fmt.Fprintln(&buf, "import (")
+	if len(operations) > 0 {
+		fmt.Fprintln(&buf, `"context"`)
+	}
+	if g.usesFmt {
+		fmt.Fprintln(&buf, `"fmt"`)
+	}
+	if g.usesQuery {
+		fmt.Fprintln(&buf, `"net/url"`)
+	}
+	fmt.Fprintln(&buf, ")")
+
+	typeNames := make([]string, 0, len(g.types))
+	for name := range g.types {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		buf.WriteString(g.types[name])
+	}
+	buf.Write(methodCode.Bytes())
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code is invalid: %w", err)
+	}
+	return code, nil
+}
+
+// operations returns the operations of all paths, sorted by path and method
+func (g *generator) operations() ([]*operation, error) {
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var operations []*operation
+	var err error
+	for _, path := range paths {
+		// parameters of the path item apply to all operations of the path
+		var pathParameters []parameter
+		if raw, found := g.doc.Paths[path]["parameters"]; found {
+			if err := json.Unmarshal(raw, &pathParameters); err != nil {
+				return nil, fmt.Errorf("could not parse parameters of %s: %w", path, err)
+			}
+		}
+		for _, method := range methods {
+			raw, found := g.doc.Paths[path][method]
+			if !found {
+				continue
+			}
+			op := &operation{}
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, fmt.Errorf("could not parse %s %s: %w", strings.ToUpper(method), path, err)
+			}
+			op.method = strings.ToUpper(method)
+			op.path = path
+			for i, p := range op.Parameters {
+				if op.Parameters[i], err = g.resolveParameter(p); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", op.method, path, err)
+				}
+			}
+			for _, p := range pathParameters {
+				if p, err = g.resolveParameter(p); err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+				if !op.hasParameter(p) {
+					op.Parameters = append(op.Parameters, p)
+				}
+			}
+			for code, r := range op.Responses {
+				if op.Responses[code], err = g.resolveResponse(r); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", op.method, path, err)
+				}
+			}
+			operations = append(operations, op)
+		}
+	}
+	return operations, nil
+}
+
+// resolveParameter returns the parameter of the document which is referred by $ref, or the parameter itself
+func (g *generator) resolveParameter(p parameter) (parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	resolved, found := g.parameters[p.Ref[strings.LastIndex(p.Ref, "/")+1:]]
+	if !found {
+		return p, fmt.Errorf("undefined parameter %s", p.Ref)
+	}
+	return resolved, nil
+}
+
+// resolveResponse returns the response of the document which is referred by $ref, or the response itself
+func (g *generator) resolveResponse(r response) (response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	resolved, found := g.responses[r.Ref[strings.LastIndex(r.Ref, "/")+1:]]
+	if !found {
+		return r, fmt.Errorf("undefined response %s", r.Ref)
+	}
+	return resolved, nil
+}
+
+// declare adds the declaration of a named type for the schema
+func (g *generator) declare(name string, schemaName string, s *schema) {
+	if _, found := g.types[name]; found {
+		return
+	}
+	g.types[name] = "" // reserved, so recursive schemas terminate
+
+	var buf bytes.Buffer
+	if s.Description != "" {
+		fmt.Fprintf(&buf, "// %s specifies the %s schema: %s\n", name, schemaName, comment(s.Description))
+	} else {
+		fmt.Fprintf(&buf, "// %s specifies the %s schema\n", name, schemaName)
+	}
+	if !isStruct(s) {
+		fmt.Fprintf(&buf, "type %s %s\n\n", name, g.goType(s, name))
+		g.types[name] = buf.String()
+		return
+	}
+
+	required := make(map[string]bool)
+	for _, property := range s.Required {
+		required[property] = true
+	}
+	properties := make([]string, 0, len(s.Properties))
+	for property := range s.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for _, property := range properties {
+		ps := s.Properties[property]
+		fieldName := goName(property)
+		if ps.Description != "" {
+			fmt.Fprintf(&buf, "// %s\n", comment(ps.Description))
+		}
+		tag := property
+		if !required[property] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&buf, "%s %s `json:\"%s\"`\n", fieldName, g.goType(ps, name+fieldName), tag)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+	g.types[name] = buf.String()
+}
+
+// goType returns the Go type of a schema. Inline objects are declared as named types with the submitted name.
+func (g *generator) goType(s *schema, name string) string {
+	if s == nil {
+		return "interface{}"
+	}
+	if s.Ref != "" {
+		refName := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+		if _, found := g.schemas[refName]; !found {
+			return "interface{}"
+		}
+		return goName(refName)
+	}
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer":
+		if s.Format == "int32" || s.Format == "int64" {
+			return s.Format
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, name+"Item")
+	}
+	if isStruct(s) {
+		g.declare(name, name, s)
+		return name
+	}
+	if s.Type == "object" && len(s.AdditionalProperties) > 0 {
+		var values schema
+		if json.Unmarshal(s.AdditionalProperties, &values) == nil {
+			return "map[string]" + g.goType(&values, name+"Value")
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// isStruct returns true if the schema is an object with properties
+func isStruct(s *schema) bool {
+	return s.Ref == "" && (s.Type == "object" || s.Type == "") && len(s.Properties) > 0
+}
+
+// method writes the client method of an operation
+func (g *generator) method(buf *bytes.Buffer, op *operation) error {
+	name := goName(op.OperationId)
+	if op.OperationId == "" {
+		name = goName(strings.ToLower(op.method) + " " + strings.NewReplacer("{", "by ", "}", "").Replace(op.path))
+	}
+	if name == "" {
+		return fmt.Errorf("operation %s %s has no name", op.method, op.path)
+	}
+	if g.methods[name] {
+		return fmt.Errorf("operation name %s is not unique", name)
+	}
+	g.methods[name] = true
+
+	var args []string
+	var pathParams, queryParams []parameter
+	var bodySchema *schema
+	used := map[string]bool{"c": true, "ctx": true, "body": true, "result": true, "err": true, "query": true, "path": true}
+	argNames := make(map[string]string)
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path", "query":
+			argName := lowerName(p.Name)
+			for used[argName] || token.IsKeyword(argName) {
+				argName += "Param"
+			}
+			used[argName] = true
+			argNames[p.In+":"+p.Name] = argName
+			if p.In == "path" {
+				pathParams = append(pathParams, p)
+			} else {
+				queryParams = append(queryParams, p)
+			}
+		case "body":
+			bodySchema = p.Schema
+		}
+	}
+	// path parameters are followed by query parameters in the order of the document
+	for _, p := range append(append([]parameter{}, pathParams...), queryParams...) {
+		args = append(args, argNames[p.In+":"+p.Name]+" "+g.parameterType(p))
+	}
+	if op.RequestBody != nil {
+		if content, found := op.RequestBody.Content["application/json"]; found {
+			bodySchema = content.Schema
+		}
+	}
+	if bodySchema != nil {
+		args = append(args, "body "+g.goType(bodySchema, name+"Request"))
+	}
+
+	resultType, err := g.responseType(op, name)
+	if err != nil {
+		return err
+	}
+
+	// path with path parameters
+	path := `"` + g.basePath + op.path + `"`
+	for _, p := range pathParams {
+		placeholder := "{" + p.Name + "}"
+		if !strings.Contains(op.path, placeholder) {
+			return fmt.Errorf("path %s has no parameter %s", op.path, p.Name)
+		}
+		path = strings.Replace(path, placeholder, `" + pathParam(`+g.parameterString(p, argNames["path:"+p.Name])+`) + "`, 1)
+	}
+	path = strings.ReplaceAll(path, ` + ""`, "")
+	if strings.Contains(path, "{") {
+		return fmt.Errorf("path %s has undefined parameters", op.path)
+	}
+
+	summary := op.Summary
+	if summary == "" {
+		summary = op.Description
+	}
+	fmt.Fprintf(buf, "// %s sends %s %s", name, op.method, g.basePath+op.path)
+	if summary != "" {
+		fmt.Fprintf(buf, ": %s", comment(summary))
+	}
+	fmt.Fprintln(buf)
+	for _, p := range append(pathParams, queryParams...) {
+		if p.Description != "" {
+			fmt.Fprintf(buf, "// %s: %s\n", argNames[p.In+":"+p.Name], comment(p.Description))
+		}
+	}
+
+	signature := strings.Join(append([]string{"ctx context.Context"}, args...), ", ")
+	if resultType == "" {
+		fmt.Fprintf(buf, "func (c *Client) %s(%s) error {\n", name, signature)
+	} else {
+		fmt.Fprintf(buf, "func (c *Client) %s(%s) (%s, error) {\n", name, signature, resultType)
+		fmt.Fprintf(buf, "var result %s\n", resultType)
+	}
+	fmt.Fprintf(buf, "path := %s\n", path)
+	if len(queryParams) > 0 {
+		g.usesQuery = true
+		fmt.Fprintln(buf, "query := url.Values{}")
+		for _, p := range queryParams {
+			argName := argNames["query:"+p.Name]
+			condition := argName + " != " + zeroValue(g.parameterType(p))
+			if g.parameterType(p) == "bool" {
+				condition = argName
+			}
+			fmt.Fprintf(buf, "if %s {\nquery.Set(%q, %s)\n}\n", condition, p.Name, g.parameterString(p, argName))
+		}
+		fmt.Fprintln(buf, "if len(query) > 0 {\npath += \"?\" + query.Encode()\n}")
+	}
+	body := "nil"
+	if bodySchema != nil {
+		body = "body"
+	}
+	if resultType == "" {
+		fmt.Fprintf(buf, "return c.Doer.Do(ctx, %q, path, %s, nil)\n}\n\n", op.method, body)
+	} else {
+		fmt.Fprintf(buf, "err := c.Doer.Do(ctx, %q, path, %s, &result)\nreturn result, err\n}\n\n", op.method, body)
+	}
+	return nil
+}
+
+// responseType returns the Go type of the successful response of an operation. Responses which aren't JSON are returned as []byte,
+// an empty string is returned for responses without content.
+func (g *generator) responseType(op *operation, name string) (string, error) {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		if _, found := op.Responses["default"]; !found {
+			return "", errors.New("operation " + name + " has no successful response")
+		}
+		codes = append(codes, "default")
+	}
+	sort.Strings(codes)
+	r := op.Responses[codes[0]]
+
+	if r.Schema != nil {
+		// Swagger 2 declares the content type with produces, of the operation or the document
+		produces := op.Produces
+		if produces == nil {
+			produces = g.doc.Produces
+		}
+		if r.Schema.Type == "file" || (len(produces) > 0 && !containsJSON(produces)) {
+			return "[]byte", nil
+		}
+		return g.goType(r.Schema, name+"Response"), nil
+	}
+	if content, found := r.Content["application/json"]; found {
+		return g.goType(content.Schema, name+"Response"), nil
+	}
+	if len(r.Content) > 0 {
+		return "[]byte", nil
+	}
+	return "", nil
+}
+
+// containsJSON returns true if one of the content types is JSON
+func containsJSON(contentTypes []string) bool {
+	for _, contentType := range contentTypes {
+		if strings.HasPrefix(contentType, "application/json") {
+			return true
+		}
+	}
+	return false
+}
+
+// parameterType returns the Go type of a path or query parameter
+func (g *generator) parameterType(p parameter) string {
+	s := p.Schema
+	if s == nil {
+		s = &schema{Type: p.Type, Format: p.Format}
+	}
+	switch t := g.goType(s, ""); t {
+	case "int", "int32", "int64", "float64", "bool":
+		return t
+	}
+	return "string"
+}
+
+// parameterString returns the expression which converts the parameter argument to a string
+func (g *generator) parameterString(p parameter, argName string) string {
+	if g.parameterType(p) == "string" {
+		return argName
+	}
+	g.usesFmt = true
+	return "fmt.Sprint(" + argName + ")"
+}
+
+// zeroValue returns the zero value of a parameter type, query parameters with zero value are omitted
+func zeroValue(goType string) string {
+	if goType == "string" {
+		return `""`
+	}
+	return "0"
+}
+
+// goName returns the exported Go name of an identifier like "sw_version" or "getVersion"
+func goName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+// lowerName returns the unexported Go name of an identifier
+func lowerName(s string) string {
+	name := goName(s)
+	if name == "" {
+		return name
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// comment returns the description as single comment line
+func comment(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
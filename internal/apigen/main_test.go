@@ -0,0 +1,275 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// swagger2 is a Swagger 2 document in the format of the description published by the inverter's web server
+const swagger2 = `{
+  "swagger": "2.0",
+  "basePath": "/api/v1",
+  "produces": ["application/json"],
+  "paths": {
+    "/info/version": {
+      "get": {
+        "operationId": "getVersion",
+        "summary": "Returns the version",
+        "responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/VersionInfo"}}}
+      }
+    },
+    "/processdata/{moduleid}/{processdataids}": {
+      "parameters": [{"$ref": "#/parameters/moduleid"}],
+      "get": {
+        "parameters": [
+          {"name": "processdataids", "in": "path", "required": true, "type": "string"},
+          {"name": "max", "in": "query", "type": "integer", "format": "int32"},
+          {"name": "raw", "in": "query", "type": "boolean"}
+        ],
+        "responses": {"200": {"$ref": "#/responses/ProcessData"}, "404": {"description": "Not found"}}
+      }
+    },
+    "/events/latest": {
+      "post": {
+        "operationId": "getLatestEvents",
+        "parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/EventsRequest"}}],
+        "responses": {"200": {"description": "OK", "schema": {"type": "array", "items": {"$ref": "#/definitions/Event"}}}}
+      }
+    },
+    "/logdata/download": {
+      "post": {
+        "operationId": "downloadLogData",
+        "produces": ["text/plain"],
+        "parameters": [{"name": "body", "in": "body", "schema": {"type": "object", "properties": {"begin": {"type": "string"}, "end": {"type": "string"}}}}],
+        "responses": {"200": {"description": "OK", "schema": {"type": "string"}}}
+      }
+    },
+    "/auth/logout": {
+      "post": {"operationId": "authLogout", "responses": {"200": {"description": "OK"}}}
+    }
+  },
+  "parameters": {
+    "moduleid": {"name": "moduleid", "in": "path", "required": true, "type": "string", "description": "Module id"}
+  },
+  "responses": {
+    "ProcessData": {"description": "OK", "schema": {"type": "array", "items": {"$ref": "#/definitions/ProcessDataValues"}}}
+  },
+  "definitions": {
+    "VersionInfo": {"type": "object", "required": ["sw_version"], "properties": {"sw_version": {"type": "string"}, "api_version": {"type": "string"}}},
+    "ProcessDataValues": {"type": "object", "properties": {
+      "moduleid": {"type": "string"},
+      "processdata": {"type": "array", "items": {"type": "object", "properties": {"id": {"type": "string"}, "value": {"type": "number"}}}}
+    }},
+    "EventsRequest": {"type": "object", "properties": {"language": {"type": "string"}, "max": {"type": "integer"}}},
+    "Event": {"type": "object", "properties": {"code": {"type": "integer"}, "is_active": {"type": "boolean"}, "type": {"type": "string"}}}
+  }
+}`
+
+// openAPI3 is an OpenAPI 3 document with the same operations as swagger2
+const openAPI3 = `{
+  "openapi": "3.0.1",
+  "servers": [{"url": "http://192.168.1.10/api/v1/"}],
+  "paths": {
+    "/info/version": {
+      "get": {
+        "operationId": "getVersion",
+        "summary": "Returns the version",
+        "responses": {"200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/VersionInfo"}}}}}
+      }
+    },
+    "/processdata/{moduleid}/{processdataids}": {
+      "parameters": [{"$ref": "#/components/parameters/moduleid"}],
+      "get": {
+        "parameters": [
+          {"name": "processdataids", "in": "path", "required": true, "schema": {"type": "string"}},
+          {"name": "max", "in": "query", "schema": {"type": "integer", "format": "int32"}},
+          {"name": "raw", "in": "query", "schema": {"type": "boolean"}}
+        ],
+        "responses": {"200": {"$ref": "#/components/responses/ProcessData"}}
+      }
+    },
+    "/events/latest": {
+      "post": {
+        "operationId": "getLatestEvents",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/EventsRequest"}}}},
+        "responses": {"200": {"description": "OK", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Event"}}}}}}
+      }
+    },
+    "/logdata/download": {
+      "post": {
+        "operationId": "downloadLogData",
+        "requestBody": {"content": {"application/json": {"schema": {"type": "object", "properties": {"begin": {"type": "string"}, "end": {"type": "string"}}}}}},
+        "responses": {"200": {"description": "OK", "content": {"text/plain": {"schema": {"type": "string"}}}}}
+      }
+    },
+    "/auth/logout": {
+      "post": {"operationId": "authLogout", "responses": {"200": {"description": "OK"}}}
+    }
+  },
+  "components": {
+    "parameters": {
+      "moduleid": {"name": "moduleid", "in": "path", "required": true, "schema": {"type": "string"}, "description": "Module id"}
+    },
+    "responses": {
+      "ProcessData": {"description": "OK", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ProcessDataValues"}}}}}
+    },
+    "schemas": {
+      "VersionInfo": {"type": "object", "required": ["sw_version"], "properties": {"sw_version": {"type": "string"}, "api_version": {"type": "string"}}},
+      "ProcessDataValues": {"type": "object", "properties": {
+        "moduleid": {"type": "string"},
+        "processdata": {"type": "array", "items": {"type": "object", "properties": {"id": {"type": "string"}, "value": {"type": "number"}}}}
+      }},
+      "EventsRequest": {"type": "object", "properties": {"language": {"type": "string"}, "max": {"type": "integer"}}},
+      "Event": {"type": "object", "properties": {"code": {"type": "integer"}, "is_active": {"type": "boolean"}, "type": {"type": "string"}}}
+    }
+  }
+}`
+
+// clientStub contains the declarations of the api package which the generated code depends on
+const clientStub = `package api
+
+import "context"
+
+type Doer interface {
+	Do(ctx context.Context, method string, path string, body interface{}, out interface{}) error
+}
+
+type Client struct {
+	Doer Doer
+}
+
+func pathParam(s string) string { return s }
+`
+
+// generateAndCheck generates the code of the document and type-checks it together with the client stub
+func generateAndCheck(t *testing.T, doc string) (string, *types.Package) {
+	t.Helper()
+	dir := t.TempDir()
+	in := filepath.Join(dir, "openapi.json")
+	out := filepath.Join(dir, "api_gen.go")
+	if err := os.WriteFile(in, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(in, out, "api"); err != nil {
+		t.Fatal(err)
+	}
+	code, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, src := range map[string]string{"api_gen.go": string(code), "api.go": clientStub} {
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := config.Check("api", fset, files, nil)
+	if err != nil {
+		t.Fatalf("generated code doesn't compile: %v\n%s", err, code)
+	}
+	return string(code), pkg
+}
+
+// methodSignature returns the signature of a method of the Client type
+func methodSignature(t *testing.T, pkg *types.Package, name string) string {
+	t.Helper()
+	client := pkg.Scope().Lookup("Client").Type()
+	method, _, _ := types.LookupFieldOrMethod(types.NewPointer(client), true, pkg, name)
+	if method == nil {
+		t.Fatalf("method %s not generated", name)
+	}
+	return types.TypeString(method.Type(), types.RelativeTo(pkg))
+}
+
+func TestGenerate(t *testing.T) {
+	for name, doc := range map[string]string{"Swagger 2": swagger2, "OpenAPI 3": openAPI3} {
+		t.Run(name, func(t *testing.T) {
+			code, pkg := generateAndCheck(t, doc)
+
+			signatures := map[string]string{
+				"GetVersion": "func(ctx context.Context) (VersionInfo, error)",
+				"GetProcessdataByModuleidByProcessdataids": "func(ctx context.Context, processdataids string, moduleid string, max int32, raw bool) ([]ProcessDataValues, error)",
+				"GetLatestEvents":                          "func(ctx context.Context, body EventsRequest) ([]Event, error)",
+				"DownloadLogData":                          "func(ctx context.Context, body DownloadLogDataRequest) ([]byte, error)",
+				"AuthLogout":                               "func(ctx context.Context) error",
+			}
+			for method, want := range signatures {
+				if got := methodSignature(t, pkg, method); got != want {
+					t.Errorf("%s: got %s, want %s", method, got, want)
+				}
+			}
+
+			for _, want := range []string{
+				"// Code generated by apigen from openapi.json; DO NOT EDIT.",
+				`path := "/api/v1/processdata/" + pathParam(moduleid) + "/" + pathParam(processdataids)`,
+				`query.Set("max", fmt.Sprint(max))`,
+				"if raw {",
+				"SwVersion string `json:\"sw_version\"`",
+				"ApiVersion string `json:\"api_version,omitempty\"`",
+				"Processdata []ProcessDataValuesProcessdataItem",
+				"Type string `json:\"type,omitempty\"`",
+				"// moduleid: Module id",
+			} {
+				// gofmt aligns the fields of structs, so the whitespace is normalized
+				if !strings.Contains(strings.Join(strings.Fields(code), " "), strings.Join(strings.Fields(want), " ")) {
+					t.Errorf("generated code doesn't contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := map[string]string{
+		"no document":         `{"paths": {}}`,
+		"undefined parameter": `{"swagger": "2.0", "paths": {"/a/{id}": {"get": {"responses": {"200": {"description": "OK"}}}}}}`,
+		"undefined reference": `{"swagger": "2.0", "paths": {"/a": {"get": {"parameters": [{"$ref": "#/parameters/x"}], "responses": {"200": {"description": "OK"}}}}}}`,
+		"no response":         `{"openapi": "3.0.1", "paths": {"/a": {"get": {"operationId": "a", "responses": {"404": {"description": "Not found"}}}}}}`,
+		"duplicate name":      `{"openapi": "3.0.1", "paths": {"/a": {"get": {"operationId": "x", "responses": {"200": {"description": "OK"}}}}, "/b": {"get": {"operationId": "x", "responses": {"200": {"description": "OK"}}}}}}`,
+	}
+	for name, doc := range tests {
+		dir := t.TempDir()
+		in := filepath.Join(dir, "openapi.json")
+		if err := os.WriteFile(in, []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := run(in, filepath.Join(dir, "api_gen.go"), "api"); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "api_gen.go")
+	if err := run("../../api/openapi.json", out, "api"); err != nil {
+		t.Fatal(err)
+	}
+	generated, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../../api/api_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(generated) != string(committed) {
+		t.Error(`api/api_gen.go is outdated, please run "go generate ./api"`)
+	}
+}
@@ -9,25 +9,30 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	b64 "encoding/base64"
-	mrand "math/rand"
-	"time"
 
 	"golang.org/x/crypto/pbkdf2"
 )
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
-func init() {
-	mrand.Seed(time.Now().UnixNano())
-}
-
-// RandSeq returns a random sequence of letters as string value
-func RandSeq(n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letters[mrand.Intn(len(letters))]
+// RandSeq returns a random sequence of letters as string value. The letters are chosen by crypto/rand, so the sequence can be used
+// as nonce.
+func RandSeq(n int) (string, error) {
+	b := make([]rune, 0, n)
+	// bytes above the largest multiple of the number of letters are rejected, so all letters have the same probability
+	limit := byte(256 - 256%len(letters))
+	buffer := make([]byte, n)
+	for len(b) < n {
+		if _, err := rand.Read(buffer); err != nil {
+			return "", err
+		}
+		for _, r := range buffer {
+			if r < limit && len(b) < n {
+				b = append(b, letters[int(r)%len(letters)])
+			}
+		}
 	}
-	return string(b)
+	return string(b), nil
 }
 
 // GetPBKDF2Hash returns a key from the password, salt and iteration count, returning a []byte of length 32
@@ -56,12 +61,16 @@ func GetSHA256Hash(valueToHash []byte) []byte {
 	return hash[:]
 }
 
-// CreateClientProof returns the client proof computed by client and server signature as base64 encoded string
-func CreateClientProof(clientSignature []byte, serverSignature []byte) string {
-	clientSignatureLength := len(clientSignature)
-	result := make([]byte, clientSignatureLength)
-	for i := 0; i < len(clientSignature); i++ {
-		result[i] = (byte(0xff & (clientSignature[i] ^ serverSignature[i])))
+// CreateClientProof returns the client proof computed by client signature and client key as base64 encoded string, i.e. the
+// bytes of both XORed. If the lengths differ, the proof has the length of the shorter one.
+func CreateClientProof(clientSignature []byte, clientKey []byte) string {
+	length := len(clientSignature)
+	if len(clientKey) < length {
+		length = len(clientKey)
+	}
+	result := make([]byte, length)
+	for i := 0; i < length; i++ {
+		result[i] = clientSignature[i] ^ clientKey[i]
 	}
 	return b64.StdEncoding.EncodeToString(result)
 }
@@ -0,0 +1,152 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package helper
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestGetPBKDF2HashVectors(t *testing.T) {
+	// published PBKDF2-HMAC-SHA256 test vectors in the style of RFC 6070
+	tests := []struct {
+		password string
+		salt     string
+		rounds   int
+		want     string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, test := range tests {
+		if got := hex.EncodeToString(GetPBKDF2Hash(test.password, test.salt, test.rounds)); got != test.want {
+			t.Errorf("GetPBKDF2Hash(%q, %q, %d) = %s, want %s", test.password, test.salt, test.rounds, got, test.want)
+		}
+	}
+}
+
+func TestGetHMACSHA256Vector(t *testing.T) {
+	// RFC 4231 test case 2
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := hex.EncodeToString(GetHMACSHA256([]byte("Jefe"), "what do ya want for nothing?")); got != want {
+		t.Errorf("GetHMACSHA256 = %s, want %s", got, want)
+	}
+}
+
+func TestGetSHA256HashVector(t *testing.T) {
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := hex.EncodeToString(GetSHA256Hash([]byte("abc"))); got != want {
+		t.Errorf("GetSHA256Hash = %s, want %s", got, want)
+	}
+}
+
+func TestPBKDF2Properties(t *testing.T) {
+	property := func(password string, salt string, rounds uint8) bool {
+		n := int(rounds%8) + 1
+		key := GetPBKDF2Hash(password, salt, n)
+		return len(key) == 32 && bytes.Equal(key, GetPBKDF2Hash(password, salt, n))
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHMACProperties(t *testing.T) {
+	property := func(secret []byte, value string) bool {
+		mac := GetHMACSHA256(secret, value)
+		return len(mac) == 32 && bytes.Equal(mac, GetHMACSHA256(secret, value)) && !bytes.Equal(mac, GetHMACSHA256(secret, value+"x"))
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateClientProofProperties(t *testing.T) {
+	// the proof XORed with the client signature returns the client key
+	property := func(clientSignature []byte, clientKey []byte) bool {
+		proof, err := b64.StdEncoding.DecodeString(CreateClientProof(clientSignature, clientKey))
+		if err != nil {
+			return false
+		}
+		length := len(clientSignature)
+		if len(clientKey) < length {
+			length = len(clientKey)
+		}
+		if len(proof) != length {
+			return false
+		}
+		for i := range proof {
+			if proof[i]^clientSignature[i] != clientKey[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScramProofVerification(t *testing.T) {
+	// a server which knows only the stored key recovers the client key from the proof and verifies it
+	property := func(password string, salt []byte, authMessage string) bool {
+		saltedPassword := GetPBKDF2Hash(password, string(salt), 2)
+		clientKey := GetHMACSHA256(saltedPassword, "Client Key")
+		storedKey := GetSHA256Hash(clientKey)
+		clientSignature := GetHMACSHA256(storedKey, authMessage)
+
+		proof, err := b64.StdEncoding.DecodeString(CreateClientProof(clientSignature, clientKey))
+		if err != nil {
+			return false
+		}
+		recovered := make([]byte, len(proof))
+		for i := range proof {
+			recovered[i] = proof[i] ^ clientSignature[i]
+		}
+		if !bytes.Equal(GetSHA256Hash(recovered), storedKey) {
+			return false
+		}
+
+		// a proof of another password is rejected
+		otherKey := GetHMACSHA256(GetPBKDF2Hash(password+"x", string(salt), 2), "Client Key")
+		otherProof, _ := b64.StdEncoding.DecodeString(CreateClientProof(clientSignature, otherKey))
+		for i := range otherProof {
+			otherProof[i] ^= clientSignature[i]
+		}
+		return !bytes.Equal(GetSHA256Hash(otherProof), storedKey)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRandSeq(t *testing.T) {
+	property := func(n uint8) bool {
+		s, err := RandSeq(int(n))
+		if err != nil || len(s) != int(n) {
+			return false
+		}
+		return strings.Trim(s, string(letters)) == ""
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateRandomBytes(t *testing.T) {
+	a, err := GenerateRandomBytes(32)
+	if err != nil || len(a) != 32 {
+		t.Fatalf("GenerateRandomBytes(32) = %d bytes, %v", len(a), err)
+	}
+	b, _ := GenerateRandomBytes(32)
+	if bytes.Equal(a, b) {
+		t.Error("GenerateRandomBytes returned the same bytes twice")
+	}
+}
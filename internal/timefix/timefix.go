@@ -5,34 +5,88 @@
 package timefix
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
 
+// layoutWithoutOffset is the time format of the Kostal Inverter API, which differs from RFC3339 by the missing time zone offset
+const layoutWithoutOffset = "2006-01-02T15:04:05.999999999"
+
 // InterterTime defines a time.Time value
 type InverterTime struct {
 	time.Time
+
+	// withoutOffset is true if the time was sent without time zone offset, so its location is not known yet
+	withoutOffset bool
 }
 
-// UnmarshalJSON implements the json.Marshaler interface
+// UnmarshalJSON implements the json.Unmarshaler interface
 // At first it tries to use the RFC3339 format, but with the values returned from Kostal Inverter API it goes wrong,
-// because the trailing "Z" is missing. This differs from the generated API documentation. So the fix is to add the "Z"
-// character.
+// because the trailing "Z" is missing. This differs from the generated API documentation. So the time is parsed without
+// offset and interpreted as UTC, until the correct location is set by WithLocation. Values which are no JSON strings return
+// an error.
 func (m *InverterTime) UnmarshalJSON(data []byte) error {
 	// Ignore null, like in the main JSON package.
-	if string(data) == "null" || string(data) == `""` {
+	if string(data) == "null" {
+		*m = InverterTime{}
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("time is not a JSON string: %s", truncate(string(data), 40))
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		*m = InverterTime{}
 		return nil
 	}
 	// Fractional seconds are handled implicitly by Parse.
-	tt, err := time.Parse(`"`+time.RFC3339+`"`, string(data))
+	tt, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		*m = InverterTime{Time: tt}
+		return nil
+	}
+	tt, err = time.ParseInLocation(layoutWithoutOffset, value, time.UTC)
 	if err != nil {
-		// Append "Z" to data string
-		s := strings.TrimRight(string(data), "\"") + "Z\""
-		tt2, err := time.Parse(`"`+time.RFC3339+`"`, s)
-		*m = InverterTime{tt2}
-		return err
-	} else {
-		*m = InverterTime{tt}
-		return err
+		return fmt.Errorf("invalid time %q", truncate(value, 40))
+	}
+	*m = InverterTime{Time: tt, withoutOffset: true}
+	return nil
+}
+
+// truncate returns s shortened to at most n bytes, so malformed input doesn't flood error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// MarshalJSON implements the json.Marshaler interface. A zero time is written as null, a time without known offset is
+// written without offset like the inverter sends it, so the value can be unmarshaled without losing information.
+func (m InverterTime) MarshalJSON() ([]byte, error) {
+	if m.IsZero() {
+		return []byte("null"), nil
+	}
+	if m.withoutOffset {
+		return []byte(`"` + m.Time.Format(layoutWithoutOffset) + `"`), nil
+	}
+	return m.Time.MarshalJSON()
+}
+
+// HasOffset returns false if the inverter sent the time without time zone offset and no location was set by WithLocation
+func (m InverterTime) HasOffset() bool {
+	return !m.withoutOffset
+}
+
+// WithLocation returns the time interpreted as wall clock time in loc, if it was sent without time zone offset.
+// Times with offset are returned unchanged.
+func (m InverterTime) WithLocation(loc *time.Location) InverterTime {
+	if !m.withoutOffset || loc == nil || m.IsZero() {
+		return m
 	}
+	t := m.Time
+	return InverterTime{Time: time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)}
 }
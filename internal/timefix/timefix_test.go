@@ -0,0 +1,88 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package timefix
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input      string
+		want       time.Time
+		withOffset bool
+		fails      bool
+	}{
+		{input: `"2024-06-21T10:11:12.123456"`, want: time.Date(2024, 6, 21, 10, 11, 12, 123456000, time.UTC)},
+		{input: `"2024-06-21T10:11:12"`, want: time.Date(2024, 6, 21, 10, 11, 12, 0, time.UTC)},
+		{input: `"2024-06-21T10:11:12Z"`, want: time.Date(2024, 6, 21, 10, 11, 12, 0, time.UTC), withOffset: true},
+		{input: `"2024-06-21T10:11:12+02:00"`, want: time.Date(2024, 6, 21, 8, 11, 12, 0, time.UTC), withOffset: true},
+		{input: `"2024-06-21T10:11:12"`, want: time.Date(2024, 6, 21, 10, 11, 12, 0, time.UTC)},
+		{input: `null`},
+		{input: `""`},
+		{input: `12345`, fails: true},
+		{input: `"<html>Bad Gateway</html>"`, fails: true},
+		{input: `{"time":"2024-06-21T10:11:12"}`, fails: true},
+	}
+	for _, test := range tests {
+		var m InverterTime
+		err := json.Unmarshal([]byte(test.input), &m)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", test.input, m.Time)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.input, err)
+			continue
+		}
+		if !m.Time.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.input, m.Time, test.want)
+		}
+		if !m.IsZero() && m.HasOffset() != test.withOffset {
+			t.Errorf("%s: HasOffset() = %v, want %v", test.input, m.HasOffset(), test.withOffset)
+		}
+	}
+}
+
+func TestWithLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	var m InverterTime
+	if err := json.Unmarshal([]byte(`"2024-06-21T10:11:12"`), &m); err != nil {
+		t.Fatal(err)
+	}
+	localized := m.WithLocation(loc)
+	if want := time.Date(2024, 6, 21, 10, 11, 12, 0, loc); !localized.Time.Equal(want) || !localized.HasOffset() {
+		t.Errorf("WithLocation = %v, want %v with offset", localized.Time, want)
+	}
+}
+
+func FuzzUnmarshalJSON(f *testing.F) {
+	for _, seed := range []string{`"2024-06-21T10:11:12.123456"`, `"2024-06-21T10:11:12+02:00"`, `null`, `""`, `"x"`, `0`, `"9999-12-31T23:59:59.999999999"`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m InverterTime
+		if err := m.UnmarshalJSON(data); err != nil {
+			return
+		}
+		// a parsed time survives a round trip through MarshalJSON
+		encoded, err := m.MarshalJSON()
+		if err != nil {
+			return
+		}
+		var decoded InverterTime
+		if err := decoded.UnmarshalJSON(encoded); err != nil {
+			t.Fatalf("could not unmarshal %s, marshaled from %s: %v", encoded, data, err)
+		}
+		if !decoded.Time.Equal(m.Time) || (!m.IsZero() && decoded.HasOffset() != m.HasOffset()) {
+			t.Fatalf("round trip of %s changed %v to %v", data, m.Time, decoded.Time)
+		}
+		m.WithLocation(time.FixedZone("UTC-11", -11*60*60))
+	})
+}
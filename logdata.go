@@ -0,0 +1,157 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi/api"
+)
+
+// LogDataInterval is the interval of the log data records
+const LogDataInterval = 5 * time.Minute
+
+// LogDataColumn specifies a column of the log data with its name, e.g. "DC1 P", the quantity, e.g. "P", and the unit, e.g. "W"
+type LogDataColumn struct {
+	Name     string `json:"name"`
+	Quantity string `json:"quantity"`
+	Unit     string `json:"unit"`
+}
+
+// LogDataRecord specifies the values of a log data row by column name. Empty, non-numeric and non-finite values are missing.
+type LogDataRecord struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+// LogData specifies the parsed log data export of the inverter, with the lines of the file header (e.g. type, name and serial
+// number of the inverter), the columns without time column and the records in the order of the file.
+type LogData struct {
+	Header  map[string]string `json:"header"`
+	Columns []LogDataColumn   `json:"columns"`
+	Records []LogDataRecord   `json:"records"`
+}
+
+// Column returns the column with the submitted name
+func (d LogData) Column(name string) (LogDataColumn, bool) {
+	for _, column := range d.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return LogDataColumn{}, false
+}
+
+// unitPattern matches the unit definitions of the log data, e.g. "U[V]" or "Ain T[digit]"
+var unitPattern = regexp.MustCompile(`([^,\[\]]+)\[([^\]]*)\]`)
+
+// ParseLogData parses the tab separated log data export of the inverter. The export starts with header lines like
+// "Wechselrichter Nr.:<tab>12345", a line with the units of the quantities like "Logdaten U[V], I[mA], P[W], E[kWh]" and the
+// column headline, which starts with the time column "Zeit". The records contain the time in seconds since 1970 and the values
+// of the columns. Unknown header lines and rows without valid time, e.g. markers of an inverter restart, are skipped.
+func ParseLogData(r io.Reader) (LogData, error) {
+	data := LogData{Header: make(map[string]string)}
+	units := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	headline := false
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+
+		if !headline {
+			first := strings.TrimSpace(fields[0])
+			switch {
+			case strings.EqualFold(first, "Zeit") || strings.EqualFold(first, "Time"):
+				headline = true
+				for _, field := range fields[1:] {
+					data.Columns = append(data.Columns, logDataColumn(strings.TrimSpace(field), units))
+				}
+			case strings.HasPrefix(first, "Logdaten") || strings.HasPrefix(first, "Log data"):
+				for _, match := range unitPattern.FindAllStringSubmatch(text, -1) {
+					quantity := strings.TrimSpace(match[1])
+					quantity = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(quantity, "Logdaten"), "Log data"))
+					units[quantity] = strings.TrimSpace(match[2])
+				}
+			case strings.HasSuffix(first, ":"):
+				value := ""
+				if len(fields) > 1 {
+					value = strings.TrimSpace(strings.Join(fields[1:], " "))
+				}
+				data.Header[strings.TrimSuffix(first, ":")] = value
+			}
+			// other header lines, e.g. of other firmware versions, are skipped
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			continue
+		}
+		record := LogDataRecord{Time: time.Unix(seconds, 0), Values: make(map[string]float64)}
+		for i, field := range fields[1:] {
+			if i >= len(data.Columns) {
+				break
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			record.Values[data.Columns[i].Name] = value
+		}
+		data.Records = append(data.Records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return data, err
+	}
+	if !headline {
+		return data, errors.New("log data has no column headline")
+	}
+	return data, nil
+}
+
+// logDataColumn returns the column with the unit of its quantity, which is the last word of the column name, e.g. "P" of "DC1 P"
+func logDataColumn(name string, units map[string]string) LogDataColumn {
+	column := LogDataColumn{Name: name}
+	if unit, found := units[name]; found {
+		column.Quantity = name
+		column.Unit = unit
+		return column
+	}
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		column.Quantity = name[i+1:]
+		column.Unit = units[column.Quantity]
+	}
+	return column
+}
+
+// LogData downloads and parses the log data of the days from begin to end, both inclusive, in the time zone of the inverter.
+// The inverter keeps the log data in 5-minute resolution for a limited time, depending on the firmware.
+func (c *AuthClient) LogData(begin time.Time, end time.Time) (LogData, error) {
+	if end.Before(begin) {
+		return LogData{}, errors.New("end of log data range is before begin")
+	}
+	body, err := api.New(c).DownloadLogData(context.Background(), api.LogDataRequest{
+		Begin: begin.In(c.location()).Format("2006-01-02"),
+		End:   end.In(c.location()).Format("2006-01-02"),
+	})
+	if err != nil {
+		return LogData{}, err
+	}
+	return ParseLogData(bytes.NewReader(body))
+}
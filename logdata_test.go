@@ -0,0 +1,84 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const logDataExample = "Wechselrichter Typ:\tPLENTICORE plus 10\r\n" +
+	"Wechselrichter Nr.:\t12345\r\n" +
+	"akt. Zeit:\t1718884801\r\n" +
+	"KOSTAL Solar Electric GmbH\r\n" +
+	"\r\n" +
+	"Logdaten U[V], I[mA], P[W], E[kWh], F[Hz], R[kOhm], Ain T[digit], Zeit[sec]\r\n" +
+	"Zeit\tDC1 U\tDC1 I\tDC1 P\tAC F\ttotal E\tAin T\tSOC H\r\n" +
+	"1718755200\t527.2\t8950\t4720\t50.01\t28033.24\t12\t\r\n" +
+	"POWER ON\r\n" +
+	"1718755500\t0\t0\t0\t49.99\tx\tNaN\t30\r\n"
+
+func TestParseLogData(t *testing.T) {
+	data, err := ParseLogData(strings.NewReader(logDataExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Header["Wechselrichter Nr."] != "12345" || data.Header["Wechselrichter Typ"] != "PLENTICORE plus 10" {
+		t.Errorf("wrong header %v", data.Header)
+	}
+
+	units := map[string]string{"DC1 U": "V", "DC1 I": "mA", "DC1 P": "W", "AC F": "Hz", "total E": "kWh", "Ain T": "digit", "SOC H": ""}
+	if len(data.Columns) != len(units) {
+		t.Fatalf("got %d columns, want %d", len(data.Columns), len(units))
+	}
+	for name, unit := range units {
+		if column, found := data.Column(name); !found || column.Unit != unit {
+			t.Errorf("column %s: got %+v, want unit %q", name, column, unit)
+		}
+	}
+
+	if len(data.Records) != 2 {
+		t.Fatalf("got %d records, want 2", len(data.Records))
+	}
+	first, second := data.Records[0], data.Records[1]
+	if !first.Time.Equal(time.Unix(1718755200, 0)) || second.Time.Sub(first.Time) != LogDataInterval {
+		t.Errorf("wrong times %v, %v", first.Time, second.Time)
+	}
+	if first.Values["DC1 P"] != 4720 || first.Values["total E"] != 28033.24 || len(first.Values) != 6 {
+		t.Errorf("wrong values of first record %v", first.Values)
+	}
+	if _, found := second.Values["total E"]; found || second.Values["SOC H"] != 30 {
+		t.Errorf("wrong values of second record %v", second.Values)
+	}
+
+	for _, input := range []string{"", "<html>Bad Gateway</html>", "Wechselrichter Nr.:\t12345\n"} {
+		if _, err := ParseLogData(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: log data without headline accepted", input)
+		}
+	}
+}
+
+func FuzzParseLogData(f *testing.F) {
+	f.Add([]byte(logDataExample))
+	f.Add([]byte("Zeit\tA\n1\t1e999\tNaN\n"))
+	f.Fuzz(func(t *testing.T, input []byte) {
+		data, err := ParseLogData(strings.NewReader(string(input)))
+		if err != nil {
+			return
+		}
+		for _, record := range data.Records {
+			for name, value := range record.Values {
+				if _, found := data.Column(name); !found {
+					t.Fatalf("value of unknown column %q", name)
+				}
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					t.Fatalf("value %v of %s is not finite", value, name)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,262 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/geschke/golrackpi"
+)
+
+const (
+	// BatteryManagementModbus is the value of the battery management mode register for external battery management via Modbus
+	BatteryManagementModbus = 2
+
+	// ExternControlModbus is the value of the setting devices:local Battery:ExternControl for external battery management via Modbus
+	ExternControlModbus = "2"
+)
+
+// ErrExternControlDisabled is returned if external battery management via Modbus is not enabled on the inverter
+var ErrExternControlDisabled = errors.New("external battery management via Modbus is not enabled")
+
+// BatteryLimits specifies the limits for battery setpoints. The power limits are the lower of the configured limits and the limits
+// of the battery, a limit of zero does not allow charging or discharging.
+type BatteryLimits struct {
+	MaxChargePower    float64
+	MaxDischargePower float64
+	MinSoC            float64
+	MaxSoC            float64
+}
+
+// BatteryStatus specifies the result of writing a power setpoint
+type BatteryStatus struct {
+	Time      time.Time
+	Requested float64
+	Applied   float64
+	SoC       float64
+	Limits    BatteryLimits
+	Reason    string // reason why the applied setpoint differs from the requested one
+}
+
+// CheckExternControl checks by the REST API that external battery management via Modbus is enabled in the settings
+func CheckExternControl(client *golrackpi.AuthClient) error {
+	values, err := client.SettingsModuleSetting("devices:local", "Battery:ExternControl")
+	if err != nil {
+		return err
+	}
+	if len(values) != 1 || values[0].Value != ExternControlModbus {
+		return ErrExternControlDisabled
+	}
+	return nil
+}
+
+// readFloat reads a numeric register of the register map
+func (c *Client) readFloat(moduleId string, id string) (float64, error) {
+	r, err := LookupRegister(moduleId, id)
+	if err != nil {
+		return 0, err
+	}
+	value, err := c.ReadRegister(r)
+	if err != nil {
+		return 0, fmt.Errorf("could not read %s: %w", r.Description, err)
+	}
+	f, ok := value.(float64)
+	if !ok || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid value of %s", r.Description)
+	}
+	return f, nil
+}
+
+// BatteryManagementMode returns the battery management mode of the inverter, BatteryManagementModbus if the battery can be
+// controlled via Modbus
+func (c *Client) BatteryManagementMode() (int, error) {
+	mode, err := c.readFloat(ModuleControl, "BatteryManagementMode")
+	return int(mode), err
+}
+
+// BatteryLimits reads the power and SoC limits for battery setpoints
+func (c *Client) BatteryLimits() (BatteryLimits, error) {
+	var limits BatteryLimits
+	var err error
+	if limits.MaxChargePower, err = c.powerLimit("MaxChargePower", "BatteryMaxChargePower"); err != nil {
+		return limits, err
+	}
+	if limits.MaxDischargePower, err = c.powerLimit("MaxDischargePower", "BatteryMaxDischargePower"); err != nil {
+		return limits, err
+	}
+	if limits.MinSoC, err = c.readFloat(ModuleControl, "MinSoC"); err != nil {
+		return limits, err
+	}
+	if limits.MaxSoC, err = c.readFloat(ModuleControl, "MaxSoC"); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// powerLimit returns the lower of the configured and the battery power limit. A limit which the inverter does not provide is
+// ignored, but at least one of them is required.
+func (c *Client) powerLimit(configured string, battery string) (float64, error) {
+	limit := math.Inf(1)
+	for _, id := range []string{configured, battery} {
+		value, err := c.readFloat(ModuleControl, id)
+		if err != nil {
+			var exception ExceptionError
+			if errors.As(err, &exception) && exception.Code == ExceptionIllegalAddress {
+				continue
+			}
+			return 0, err
+		}
+		limit = math.Min(limit, math.Max(value, 0))
+	}
+	if math.IsInf(limit, 1) {
+		return 0, fmt.Errorf("no power limit available for %s", configured)
+	}
+	return limit, nil
+}
+
+// ClampBatteryPower returns the power setpoint (negative charges, positive discharges) within the limits. Charging stops at the
+// maximum SoC and discharging at the minimum SoC. The reason is empty if the power was not changed.
+func ClampBatteryPower(power float64, soc float64, limits BatteryLimits) (float64, string) {
+	switch {
+	case power < 0 && soc >= limits.MaxSoC:
+		return 0, fmt.Sprintf("SoC %.1f %% reached maximum %.1f %%", soc, limits.MaxSoC)
+	case power > 0 && soc <= limits.MinSoC:
+		return 0, fmt.Sprintf("SoC %.1f %% reached minimum %.1f %%", soc, limits.MinSoC)
+	case power < -limits.MaxChargePower:
+		return -limits.MaxChargePower, fmt.Sprintf("limited to max. charge power %.0f W", limits.MaxChargePower)
+	case power > limits.MaxDischargePower:
+		return limits.MaxDischargePower, fmt.Sprintf("limited to max. discharge power %.0f W", limits.MaxDischargePower)
+	}
+	return power, ""
+}
+
+// SetBatteryPower writes the DC power setpoint of the battery (negative charges, positive discharges) after checking the battery
+// management mode and clamping the power to the limits read from the inverter. The inverter falls back to its internal battery
+// management if the setpoint is not renewed within its timeout, so the setpoint has to be written periodically, see BatteryController.
+func (c *Client) SetBatteryPower(power float64) (BatteryStatus, error) {
+	status := BatteryStatus{Time: time.Now(), Requested: power}
+	if math.IsNaN(power) || math.IsInf(power, 0) {
+		return status, errors.New("power setpoint is not a finite number")
+	}
+	mode, err := c.BatteryManagementMode()
+	if err != nil {
+		return status, err
+	}
+	if mode != BatteryManagementModbus {
+		return status, ErrExternControlDisabled
+	}
+	if status.Limits, err = c.BatteryLimits(); err != nil {
+		return status, err
+	}
+	if status.SoC, err = c.readFloat("devices:local:battery", "SoC"); err != nil {
+		return status, err
+	}
+	status.Applied, status.Reason = ClampBatteryPower(power, status.SoC, status.Limits)
+
+	r, err := LookupRegister(ModuleControl, "DcPowerSetpoint")
+	if err != nil {
+		return status, err
+	}
+	return status, c.WriteRegister(r, status.Applied)
+}
+
+// SetBatterySoCLimits writes the minimum and maximum SoC in percent
+func (c *Client) SetBatterySoCLimits(min float64, max float64) error {
+	if min < 0 || max > 100 || min > max {
+		return fmt.Errorf("invalid SoC limits %v - %v %%", min, max)
+	}
+	for _, limit := range []struct {
+		id    string
+		value float64
+	}{{"MinSoC", min}, {"MaxSoC", max}} {
+		r, err := LookupRegister(ModuleControl, limit.id)
+		if err != nil {
+			return err
+		}
+		if err := c.WriteRegister(r, limit.value); err != nil {
+			return fmt.Errorf("could not write %s: %w", r.Description, err)
+		}
+	}
+	return nil
+}
+
+// BatteryController writes a battery power setpoint periodically as keepalive for the watchdog of the inverter. Limits, SoC and
+// battery management mode are checked before every write. If the controller stops, the inverter falls back to its internal battery
+// management after its timeout.
+type BatteryController struct {
+	Client   *Client
+	Interval time.Duration
+
+	// OnApply is called after every written setpoint, OnError after every failed write
+	OnApply func(status BatteryStatus)
+	OnError func(err error)
+
+	mu    sync.Mutex
+	power float64
+}
+
+// NewBatteryController returns a BatteryController instance with the initial power setpoint and a keepalive interval of 5 seconds
+func NewBatteryController(client *Client, power float64) *BatteryController {
+	return &BatteryController{Client: client, Interval: 5 * time.Second, power: power}
+}
+
+// SetPower changes the power setpoint, which is written with the next keepalive
+func (b *BatteryController) SetPower(power float64) {
+	b.mu.Lock()
+	b.power = power
+	b.mu.Unlock()
+}
+
+// Power returns the requested power setpoint
+func (b *BatteryController) Power() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.power
+}
+
+// Run writes the setpoint immediately and then every interval until ctx is cancelled. Failed writes are retried with the next
+// keepalive, except if external battery management is disabled, which ends Run with ErrExternControlDisabled. When ctx is
+// cancelled, a setpoint of 0 W is written, so the battery doesn't keep charging or discharging until the timeout of the inverter.
+// An error of this final write is returned.
+func (b *BatteryController) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	for {
+		status, err := b.Client.SetBatteryPower(b.Power())
+		switch {
+		case errors.Is(err, ErrExternControlDisabled):
+			return err
+		case err != nil:
+			if b.OnError != nil {
+				b.OnError(err)
+			}
+		case b.OnApply != nil:
+			b.OnApply(status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return b.stop()
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop writes a setpoint of 0 W without the checks of SetBatteryPower, because it is always within the limits
+func (b *BatteryController) stop() error {
+	r, err := LookupRegister(ModuleControl, "DcPowerSetpoint")
+	if err != nil {
+		return err
+	}
+	if err := b.Client.WriteRegister(r, 0); err != nil {
+		return fmt.Errorf("could not reset the power setpoint to 0 W: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mustLookup returns a register of the register map
+func mustLookup(t *testing.T, module string, id string) Register {
+	t.Helper()
+	r, err := LookupRegister(module, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// batteryMemory returns a memory with the registers of external battery management
+func batteryMemory(t *testing.T, values map[string]float64) *Memory {
+	t.Helper()
+	memory := NewMemory()
+	for id, value := range values {
+		module := ModuleControl
+		if id == "SoC" {
+			module = "devices:local:battery"
+		}
+		if err := memory.SetValue(mustLookup(t, module, id), value, LittleEndian); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return memory
+}
+
+func TestClampBatteryPower(t *testing.T) {
+	limits := BatteryLimits{MaxChargePower: 3000, MaxDischargePower: 2000, MinSoC: 10, MaxSoC: 90}
+	tests := []struct {
+		power, soc, want float64
+	}{
+		{-1000, 50, -1000},
+		{-5000, 50, -3000},
+		{5000, 50, 2000},
+		{-1000, 90, 0},
+		{1000, 10, 0},
+		{1000, 90, 1000},
+	}
+	for _, test := range tests {
+		got, reason := ClampBatteryPower(test.power, test.soc, limits)
+		if got != test.want || (reason == "") != (got == test.power) {
+			t.Errorf("%v W at %v %%: got %v W (%q), want %v W", test.power, test.soc, got, reason, test.want)
+		}
+	}
+}
+
+func TestBatteryController(t *testing.T) {
+	memory := batteryMemory(t, map[string]float64{
+		"BatteryManagementMode": BatteryManagementModbus,
+		"MaxChargePower":        3000,
+		"MaxDischargePower":     3000,
+		"MinSoC":                10,
+		"MaxSoC":                90,
+		"SoC":                   50,
+		"DcPowerSetpoint":       0,
+	})
+	setpoint := mustLookup(t, ModuleControl, "DcPowerSetpoint")
+	client := startServer(t, memory)
+
+	controller := NewBatteryController(client, -1500)
+	controller.Interval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	applied := make(chan BatteryStatus, 1)
+	controller.OnApply = func(status BatteryStatus) {
+		applied <- status
+	}
+	done := make(chan error)
+	go func() {
+		done <- controller.Run(ctx)
+	}()
+
+	if status := <-applied; status.Applied != -1500 || status.SoC != 50 {
+		t.Errorf("wrong status %+v", status)
+	}
+	if value, _ := client.ReadRegister(setpoint); value != float64(-1500) {
+		t.Errorf("setpoint %v written", value)
+	}
+
+	// the setpoint is reset when the controller stops
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := client.ReadRegister(setpoint); value != float64(0) {
+		t.Errorf("setpoint %v after stop", value)
+	}
+
+	// an error of the final write is returned
+	memory.OnWrite = func(address uint16, values []uint16) error {
+		return ExceptionError{Code: ExceptionServerDeviceFailure}
+	}
+	controller.OnError = func(err error) {}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := controller.Run(ctx); exceptionCode(err) != ExceptionServerDeviceFailure {
+		t.Errorf("failed reset: got %v", err)
+	}
+
+	memory.OnWrite = nil
+	if err := memory.SetValue(mustLookup(t, ModuleControl, "BatteryManagementMode"), 0, LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Run(context.Background()); !errors.Is(err, ErrExternControlDisabled) {
+		t.Errorf("internal battery management: got %v", err)
+	}
+}
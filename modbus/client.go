@@ -0,0 +1,263 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package modbus reads and writes Kostal Plenticore inverters over Modbus TCP, as alternative transport to the REST API.
+// It contains a client, the typed Kostal register map, SunSpec model discovery and a Modbus TCP server.
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPort is the Modbus TCP port of Plenticore inverters
+	DefaultPort = 1502
+	// DefaultUnitId is the Modbus unit id of Plenticore inverters
+	DefaultUnitId = 71
+
+	// maxRegisters is the maximum number of registers of a read request
+	maxRegisters = 125
+)
+
+// Modbus function codes
+const (
+	FuncReadHoldingRegisters   byte = 0x03
+	FuncReadInputRegisters     byte = 0x04
+	FuncWriteSingleRegister    byte = 0x06
+	FuncWriteMultipleRegisters byte = 0x10
+)
+
+// Modbus exception codes
+const (
+	ExceptionIllegalFunction     byte = 0x01
+	ExceptionIllegalAddress      byte = 0x02
+	ExceptionIllegalValue        byte = 0x03
+	ExceptionServerDeviceFailure byte = 0x04
+	ExceptionGatewayTargetFailed byte = 0x0B
+)
+
+// ExceptionError is returned if the server answers with a Modbus exception
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e ExceptionError) Error() string {
+	name := "unknown exception"
+	switch e.Code {
+	case ExceptionIllegalFunction:
+		name = "illegal function"
+	case ExceptionIllegalAddress:
+		name = "illegal data address"
+	case ExceptionIllegalValue:
+		name = "illegal data value"
+	case ExceptionServerDeviceFailure:
+		name = "server device failure"
+	case ExceptionGatewayTargetFailed:
+		name = "gateway target device failed to respond"
+	}
+	return fmt.Sprintf("modbus exception %d (%s) for function 0x%02x", e.Code, name, e.Function)
+}
+
+// Client is a Modbus TCP client. It keeps one connection, which is opened on the first request and after errors.
+// A Client can be used concurrently; the requests are sent one after another.
+type Client struct {
+	Address   string
+	UnitId    byte
+	ByteOrder ByteOrder
+	Timeout   time.Duration
+
+	mu            sync.Mutex
+	conn          net.Conn
+	transactionId uint16
+}
+
+// NewClient returns a Client instance for the address (host:port) and unit id. The byte order is the Kostal default
+// little-endian (CDAB) until it is changed or detected by DetectByteOrder.
+func NewClient(address string, unitId byte) *Client {
+	return &Client{Address: address, UnitId: unitId, ByteOrder: LittleEndian, Timeout: 5 * time.Second}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// ReadHoldingRegisters reads count holding registers starting at address
+func (c *Client) ReadHoldingRegisters(address uint16, count uint16) ([]uint16, error) {
+	return c.readRegisters(FuncReadHoldingRegisters, address, count)
+}
+
+// ReadInputRegisters reads count input registers starting at address
+func (c *Client) ReadInputRegisters(address uint16, count uint16) ([]uint16, error) {
+	return c.readRegisters(FuncReadInputRegisters, address, count)
+}
+
+// readRegisters sends a read request and returns the registers of the response
+func (c *Client) readRegisters(function byte, address uint16, count uint16) ([]uint16, error) {
+	if count == 0 || count > maxRegisters {
+		return nil, fmt.Errorf("invalid number of registers %d", count)
+	}
+	request := make([]byte, 5)
+	request[0] = function
+	binary.BigEndian.PutUint16(request[1:], address)
+	binary.BigEndian.PutUint16(request[3:], count)
+
+	response, err := c.send(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) < 2 || int(response[1]) != int(count)*2 || len(response) != 2+int(count)*2 {
+		return nil, errors.New("invalid length of read response")
+	}
+	registers := make([]uint16, count)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(response[2+i*2:])
+	}
+	return registers, nil
+}
+
+// WriteSingleRegister writes a value to a holding register
+func (c *Client) WriteSingleRegister(address uint16, value uint16) error {
+	request := make([]byte, 5)
+	request[0] = FuncWriteSingleRegister
+	binary.BigEndian.PutUint16(request[1:], address)
+	binary.BigEndian.PutUint16(request[3:], value)
+
+	response, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	if len(response) != 5 || binary.BigEndian.Uint16(response[1:]) != address || binary.BigEndian.Uint16(response[3:]) != value {
+		return errors.New("invalid write response")
+	}
+	return nil
+}
+
+// WriteMultipleRegisters writes values to consecutive holding registers starting at address
+func (c *Client) WriteMultipleRegisters(address uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > 123 {
+		return fmt.Errorf("invalid number of registers %d", len(values))
+	}
+	request := make([]byte, 6+len(values)*2)
+	request[0] = FuncWriteMultipleRegisters
+	binary.BigEndian.PutUint16(request[1:], address)
+	binary.BigEndian.PutUint16(request[3:], uint16(len(values)))
+	request[5] = byte(len(values) * 2)
+	for i, value := range values {
+		binary.BigEndian.PutUint16(request[6+i*2:], value)
+	}
+
+	response, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	if len(response) != 5 || binary.BigEndian.Uint16(response[1:]) != address || binary.BigEndian.Uint16(response[3:]) != uint16(len(values)) {
+		return errors.New("invalid write response")
+	}
+	return nil
+}
+
+// send sends a PDU and returns the PDU of the response. The connection is closed after network errors, so the next request reconnects.
+func (c *Client) send(pdu []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	response, err := c.exchange(pdu)
+	if err != nil {
+		var exception ExceptionError
+		if !errors.As(err, &exception) {
+			c.conn.Close()
+			c.conn = nil
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// exchange writes the request frame and reads the response frame
+func (c *Client) exchange(pdu []byte) ([]byte, error) {
+	c.transactionId++
+	frame := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], c.transactionId)
+	binary.BigEndian.PutUint16(frame[2:], 0)
+	binary.BigEndian.PutUint16(frame[4:], uint16(len(pdu)+1))
+	frame[6] = c.UnitId
+	copy(frame[7:], pdu)
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	for {
+		transactionId, unitId, response, err := readFrame(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		if transactionId != c.transactionId {
+			// response of an earlier request which timed out
+			continue
+		}
+		if unitId != c.UnitId {
+			return nil, fmt.Errorf("response of unit id %d instead of %d", unitId, c.UnitId)
+		}
+		if len(response) == 0 {
+			return nil, errors.New("empty response")
+		}
+		if response[0] == pdu[0]|0x80 {
+			if len(response) < 2 {
+				return nil, errors.New("invalid exception response")
+			}
+			return nil, ExceptionError{Function: pdu[0], Code: response[1]}
+		}
+		if response[0] != pdu[0] {
+			return nil, fmt.Errorf("response of function 0x%02x instead of 0x%02x", response[0], pdu[0])
+		}
+		return response, nil
+	}
+}
+
+// readFrame reads a Modbus TCP frame and returns transaction id, unit id and PDU
+func readFrame(r io.Reader) (uint16, byte, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	if protocolId := binary.BigEndian.Uint16(header[2:]); protocolId != 0 {
+		return 0, 0, nil, fmt.Errorf("invalid protocol id %d", protocolId)
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return 0, 0, nil, fmt.Errorf("invalid frame length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(r, pdu); err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint16(header[0:]), header[6], pdu, nil
+}
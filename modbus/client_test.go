@@ -0,0 +1,244 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startServer starts a server with the memory on a free local port and returns a client connected to it
+func startServer(t *testing.T, memory *Memory) *Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(DefaultUnitId, memory)
+	go server.Serve(l)
+	client := NewClient(l.Addr().String(), DefaultUnitId)
+	client.Timeout = 2 * time.Second
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client
+}
+
+// exceptionCode returns the code of a Modbus exception, 0 for other errors
+func exceptionCode(err error) byte {
+	var exception ExceptionError
+	if errors.As(err, &exception) {
+		return exception.Code
+	}
+	return 0
+}
+
+func TestClientServer(t *testing.T) {
+	memory := NewMemory()
+	memory.Set(100, 1, 2, 3, 4)
+	client := startServer(t, memory)
+
+	registers, err := client.ReadHoldingRegisters(100, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(registers, []uint16{1, 2, 3, 4}) {
+		t.Errorf("got %v", registers)
+	}
+	if registers, err := client.ReadInputRegisters(101, 2); err != nil || !reflect.DeepEqual(registers, []uint16{2, 3}) {
+		t.Errorf("input registers: got %v, %v", registers, err)
+	}
+
+	if err := client.WriteSingleRegister(100, 0xBEEF); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteMultipleRegisters(102, []uint16{7, 8}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := memory.Get(100, 4); !reflect.DeepEqual(values, []uint16{0xBEEF, 2, 7, 8}) {
+		t.Errorf("memory after writes: %v", values)
+	}
+
+	// the connection is kept after exceptions and reopened after it was closed
+	if _, err := client.ReadHoldingRegisters(103, 2); exceptionCode(err) != ExceptionIllegalAddress {
+		t.Errorf("read beyond the memory: got %v", err)
+	}
+	client.Close()
+	if _, err := client.ReadHoldingRegisters(100, 1); err != nil {
+		t.Errorf("read after reconnect: %v", err)
+	}
+}
+
+func TestServerExceptions(t *testing.T) {
+	memory := NewMemory()
+	memory.Set(10, 0)
+	rejected := errors.New("rejected")
+	memory.OnWrite = func(address uint16, values []uint16) error {
+		if values[0] > 100 {
+			return ExceptionError{Code: ExceptionIllegalValue}
+		}
+		if values[0] == 99 {
+			return rejected
+		}
+		return nil
+	}
+	client := startServer(t, memory)
+
+	tests := []struct {
+		name string
+		err  error
+		code byte
+	}{
+		{"unknown address", client.WriteSingleRegister(11, 1), ExceptionIllegalAddress},
+		{"value rejected by handler", client.WriteSingleRegister(10, 101), ExceptionIllegalValue},
+		{"handler error", client.WriteSingleRegister(10, 99), ExceptionServerDeviceFailure},
+	}
+	for _, test := range tests {
+		if code := exceptionCode(test.err); code != test.code {
+			t.Errorf("%s: got %v, want exception %d", test.name, test.err, test.code)
+		}
+	}
+	if values, _ := memory.Get(10, 1); values[0] != 0 {
+		t.Errorf("rejected value was written: %v", values)
+	}
+
+	// requests to other unit ids are answered by the server, but rejected
+	other := NewClient(client.Address, 1)
+	defer other.Close()
+	if _, err := other.ReadHoldingRegisters(10, 1); exceptionCode(err) != ExceptionGatewayTargetFailed {
+		t.Errorf("other unit id: got %v", err)
+	}
+
+	if _, err := client.ReadHoldingRegisters(10, 126); err == nil {
+		t.Error("too many registers accepted")
+	}
+	if err := (ExceptionError{Function: FuncReadHoldingRegisters, Code: ExceptionIllegalAddress}).Error(); err != "modbus exception 2 (illegal data address) for function 0x03" {
+		t.Errorf("wrong error message %q", err)
+	}
+}
+
+func TestRegisterByteOrder(t *testing.T) {
+	powerId, err := LookupRegister(ModuleInfo, "PowerId")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range []ByteOrder{LittleEndian, BigEndian} {
+		memory := NewMemory()
+		memory.Set(RegisterByteOrder, uint16(order))
+		if err := memory.SetValue(powerId, 0x00010002, order); err != nil {
+			t.Fatal(err)
+		}
+		client := startServer(t, memory)
+		client.ByteOrder = 1 - order
+
+		detected, err := client.DetectByteOrder()
+		if err != nil || detected != order || client.ByteOrder != order {
+			t.Errorf("%s: detected %s, %v", order, detected, err)
+		}
+		if value, err := client.ReadRegister(powerId); err != nil || value != float64(0x00010002) {
+			t.Errorf("%s: got %v, %v", order, value, err)
+		}
+	}
+
+	memory := NewMemory()
+	memory.Set(RegisterByteOrder, 7)
+	if _, err := startServer(t, memory).DetectByteOrder(); err == nil {
+		t.Error("unknown byte order accepted")
+	}
+}
+
+func TestWriteRegister(t *testing.T) {
+	var writable, readOnly Register
+	for _, r := range KostalRegisters {
+		if r.Writable && r.Type != String && writable.Id == "" {
+			writable = r
+		}
+		if !r.Writable && readOnly.Id == "" {
+			readOnly = r
+		}
+	}
+	memory := NewMemory()
+	memory.Set(writable.Address, make([]uint16, writable.Length())...)
+	memory.Set(readOnly.Address, make([]uint16, readOnly.Length())...)
+	client := startServer(t, memory)
+
+	if err := client.WriteRegister(writable, 42); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := client.ReadRegister(writable); err != nil || value != float64(42) {
+		t.Errorf("%s: got %v, %v", writable.Id, value, err)
+	}
+	if err := client.WriteRegister(readOnly, 1); err == nil {
+		t.Errorf("%s: read-only register was written", readOnly.Id)
+	}
+}
+
+// setSunSpecModel sets the header and the registers of a model at the address and returns the address of the next model
+func setSunSpecModel(memory *Memory, address uint16, id uint16, registers []uint16) uint16 {
+	memory.Set(address, id, uint16(len(registers)))
+	memory.Set(address+2, registers...)
+	return address + 2 + uint16(len(registers))
+}
+
+func TestDiscoverSunSpec(t *testing.T) {
+	memory := NewMemory()
+	marker, _ := EncodeString("SunS", 2)
+	memory.Set(SunSpecBase, marker...)
+
+	common := make([]uint16, 66)
+	manufacturer, _ := EncodeString("KOSTAL", 16)
+	serial, _ := EncodeString("12345", 16)
+	copy(common[0:], manufacturer)
+	copy(common[48:], serial)
+	common[64] = DefaultUnitId
+	address := setSunSpecModel(memory, SunSpecBase+2, 1, common)
+
+	inverter := make([]uint16, 50)
+	for i := range inverter {
+		inverter[i] = 0xFFFF
+	}
+	inverter[12], inverter[13] = 0xFF38, 0 // -200 W
+	inverter[14], inverter[15] = 5001, 0xFFFE
+	inverter[22], inverter[23], inverter[24] = 0x0001, 0x0000, 1
+	inverter[36] = 4
+	address = setSunSpecModel(memory, address, 103, inverter)
+	memory.Set(address, sunSpecEnd, 0)
+
+	client := startServer(t, memory)
+	models, err := client.DiscoverSunSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0].Id != 1 || models[1].Id != 103 || models[1].Address != SunSpecBase+2+2+66+2 || models[1].Name() != "Inverter (Three Phase)" {
+		t.Fatalf("wrong models %+v", models)
+	}
+
+	info, err := client.ReadCommon(models[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Manufacturer != "KOSTAL" || info.SerialNumber != "12345" || info.DeviceAddress != DefaultUnitId {
+		t.Errorf("wrong common model %+v", info)
+	}
+
+	values, err := client.ReadInverter(models[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values.Current != nil || *values.Power != -200 || *values.Frequency != 50.01 || *values.Energy != 655360 || values.State != 4 {
+		t.Errorf("wrong inverter model %+v", values)
+	}
+	if _, err := client.ReadInverter(models[0]); err == nil {
+		t.Error("common model read as inverter model")
+	}
+
+	if _, err := startServer(t, NewMemory()).DiscoverSunSpec(); !errors.Is(err, ErrNoSunSpec) {
+		t.Errorf("device without SunSpec: got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/geschke/golrackpi"
+)
+
+// Register specifies an entry of the Kostal register map. Registers with an equivalent REST process-data value use its
+// module and process-data id, all others use "modbus:*" modules.
+type Register struct {
+	Address     uint16
+	Type        DataType
+	Words       uint16 // number of registers of strings
+	Unit        string
+	ModuleId    string
+	Id          string
+	Description string
+	Writable    bool
+}
+
+// Length returns the number of registers of the value
+func (r Register) Length() uint16 {
+	if r.Type == String {
+		return r.Words
+	}
+	return r.Type.Words()
+}
+
+// Module ids of the registers without REST equivalent
+const (
+	ModuleInfo       = "modbus:info"
+	ModuleInverter   = "modbus:inverter"
+	ModuleBattery    = "modbus:battery"
+	ModulePowermeter = "modbus:powermeter"
+	ModuleControl    = "modbus:control"
+)
+
+// RegisterByteOrder is the address of the register with the byte order of 32 bit values (0 = little-endian, 1 = big-endian)
+const RegisterByteOrder uint16 = 5
+
+// KostalRegisters is the register map of Plenticore inverters as documented by Kostal
+var KostalRegisters = []Register{
+	{Address: 2, Type: U16, ModuleId: ModuleInfo, Id: "ModbusEnable", Description: "MODBUS Enable"},
+	{Address: 4, Type: U16, ModuleId: ModuleInfo, Id: "UnitId", Description: "MODBUS Unit-ID"},
+	{Address: 5, Type: U16, ModuleId: ModuleInfo, Id: "ByteOrder", Description: "MODBUS Byte Order Note"},
+	{Address: 6, Type: String, Words: 8, ModuleId: ModuleInfo, Id: "ArticleNumber", Description: "Inverter article number"},
+	{Address: 14, Type: String, Words: 8, ModuleId: ModuleInfo, Id: "SerialNumber", Description: "Inverter serial number"},
+	{Address: 30, Type: U16, ModuleId: ModuleInfo, Id: "BidirectionalConverters", Description: "Number of bidirectional converter"},
+	{Address: 32, Type: U16, ModuleId: ModuleInfo, Id: "Phases", Description: "Number of AC phases"},
+	{Address: 34, Type: U16, ModuleId: ModuleInfo, Id: "Strings", Description: "Number of PV strings"},
+	{Address: 36, Type: U16, ModuleId: ModuleInfo, Id: "HardwareVersion", Description: "Hardware-Version"},
+	{Address: 38, Type: String, Words: 8, ModuleId: ModuleInfo, Id: "SoftwareVersionMC", Description: "Software-Version Maincontroller (MC)"},
+	{Address: 46, Type: String, Words: 8, ModuleId: ModuleInfo, Id: "SoftwareVersionIOC", Description: "Software-Version IO-Controller (IOC)"},
+	{Address: 54, Type: U32, ModuleId: ModuleInfo, Id: "PowerId", Description: "Power-ID"},
+	{Address: 56, Type: U16, ModuleId: ModuleInverter, Id: "State", Description: "Inverter state"},
+	{Address: 768, Type: String, Words: 32, ModuleId: ModuleInfo, Id: "ProductName", Description: "Productname"},
+	{Address: 800, Type: String, Words: 32, ModuleId: ModuleInfo, Id: "PowerClass", Description: "Power class"},
+
+	{Address: 100, Type: Float32, Unit: "W", ModuleId: "devices:local", Id: "Dc_P", Description: "Total DC power"},
+	{Address: 104, Type: U32, ModuleId: ModuleInverter, Id: "EnergyManagerState", Description: "State of energy manager"},
+	{Address: 106, Type: Float32, Unit: "W", ModuleId: "devices:local", Id: "HomeBat_P", Description: "Home own consumption from battery"},
+	{Address: 108, Type: Float32, Unit: "W", ModuleId: "devices:local", Id: "HomeGrid_P", Description: "Home own consumption from grid"},
+	{Address: 110, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:EnergyHomeBat:Total", Description: "Total home consumption Battery"},
+	{Address: 112, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:EnergyHomeGrid:Total", Description: "Total home consumption Grid"},
+	{Address: 114, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:EnergyHomePv:Total", Description: "Total home consumption PV"},
+	{Address: 116, Type: Float32, Unit: "W", ModuleId: "devices:local", Id: "HomePv_P", Description: "Home own consumption from PV"},
+	{Address: 118, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:EnergyHome:Total", Description: "Total home consumption"},
+	{Address: 120, Type: Float32, Unit: "Ohm", ModuleId: ModuleInverter, Id: "IsolationResistance", Description: "Isolation resistance"},
+	{Address: 122, Type: Float32, Unit: "%", ModuleId: ModuleInverter, Id: "PowerLimitEVU", Description: "Power limit from EVU"},
+	{Address: 124, Type: Float32, Unit: "%", ModuleId: ModuleInverter, Id: "HomeConsumptionRate", Description: "Total home consumption rate"},
+	{Address: 144, Type: Float32, Unit: "s", ModuleId: ModuleInverter, Id: "Worktime", Description: "Worktime"},
+
+	{Address: 150, Type: Float32, ModuleId: "devices:local:ac", Id: "CosPhi", Description: "Actual cos phi"},
+	{Address: 152, Type: Float32, Unit: "Hz", ModuleId: "devices:local:ac", Id: "Frequency", Description: "Grid frequency"},
+	{Address: 154, Type: Float32, Unit: "A", ModuleId: "devices:local:ac", Id: "L1_I", Description: "Current Phase 1"},
+	{Address: 156, Type: Float32, Unit: "W", ModuleId: "devices:local:ac", Id: "L1_P", Description: "Active power Phase 1"},
+	{Address: 158, Type: Float32, Unit: "V", ModuleId: "devices:local:ac", Id: "L1_U", Description: "Voltage Phase 1"},
+	{Address: 160, Type: Float32, Unit: "A", ModuleId: "devices:local:ac", Id: "L2_I", Description: "Current Phase 2"},
+	{Address: 162, Type: Float32, Unit: "W", ModuleId: "devices:local:ac", Id: "L2_P", Description: "Active power Phase 2"},
+	{Address: 164, Type: Float32, Unit: "V", ModuleId: "devices:local:ac", Id: "L2_U", Description: "Voltage Phase 2"},
+	{Address: 166, Type: Float32, Unit: "A", ModuleId: "devices:local:ac", Id: "L3_I", Description: "Current Phase 3"},
+	{Address: 168, Type: Float32, Unit: "W", ModuleId: "devices:local:ac", Id: "L3_P", Description: "Active power Phase 3"},
+	{Address: 170, Type: Float32, Unit: "V", ModuleId: "devices:local:ac", Id: "L3_U", Description: "Voltage Phase 3"},
+	{Address: 172, Type: Float32, Unit: "W", ModuleId: "devices:local:ac", Id: "P", Description: "Total AC active power"},
+	{Address: 174, Type: Float32, Unit: "var", ModuleId: "devices:local:ac", Id: "Q", Description: "Total AC reactive power"},
+	{Address: 178, Type: Float32, Unit: "VA", ModuleId: "devices:local:ac", Id: "S", Description: "Total AC apparent power"},
+
+	{Address: 190, Type: Float32, Unit: "A", ModuleId: ModuleBattery, Id: "ChargeCurrent", Description: "Battery charge current"},
+	{Address: 194, Type: Float32, ModuleId: "devices:local:battery", Id: "Cycles", Description: "Number of battery cycles"},
+	{Address: 200, Type: Float32, Unit: "A", ModuleId: "devices:local:battery", Id: "I", Description: "Actual battery charge (-) / discharge (+) current"},
+	{Address: 202, Type: Float32, ModuleId: ModuleBattery, Id: "FuseState", Description: "PSSB fuse state"},
+	{Address: 208, Type: Float32, ModuleId: ModuleBattery, Id: "Ready", Description: "Battery ready flag"},
+	{Address: 210, Type: Float32, Unit: "%", ModuleId: "devices:local:battery", Id: "SoC", Description: "Act. state of charge"},
+	{Address: 214, Type: Float32, Unit: "°C", ModuleId: ModuleBattery, Id: "Temperature", Description: "Battery temperature"},
+	{Address: 216, Type: Float32, Unit: "V", ModuleId: "devices:local:battery", Id: "U", Description: "Battery voltage"},
+	{Address: 512, Type: U32, Unit: "Ah", ModuleId: ModuleBattery, Id: "GrossCapacity", Description: "Battery gross capacity"},
+	{Address: 514, Type: U16, Unit: "%", ModuleId: ModuleBattery, Id: "ActualSoC", Description: "Battery actual SOC"},
+	{Address: 517, Type: String, Words: 8, ModuleId: ModuleBattery, Id: "Manufacturer", Description: "Battery Manufacturer"},
+	{Address: 525, Type: U32, ModuleId: ModuleBattery, Id: "ModelId", Description: "Battery Model ID"},
+	{Address: 527, Type: U32, ModuleId: ModuleBattery, Id: "SerialNumber", Description: "Battery Serial Number"},
+	{Address: 529, Type: U32, Unit: "Wh", ModuleId: ModuleBattery, Id: "WorkCapacity", Description: "Work Capacity"},
+	{Address: 582, Type: S16, Unit: "W", ModuleId: "devices:local:battery", Id: "P", Description: "Actual battery charge/discharge power"},
+	{Address: 586, Type: U32, ModuleId: ModuleBattery, Id: "Firmware", Description: "Battery Firmware"},
+	{Address: 588, Type: U16, ModuleId: ModuleBattery, Id: "Type", Description: "Battery Type"},
+
+	{Address: 218, Type: Float32, ModuleId: ModulePowermeter, Id: "CosPhi", Description: "Cos phi (powermeter)"},
+	{Address: 220, Type: Float32, Unit: "Hz", ModuleId: ModulePowermeter, Id: "Frequency", Description: "Frequency (powermeter)"},
+	{Address: 222, Type: Float32, Unit: "A", ModuleId: ModulePowermeter, Id: "L1_I", Description: "Current phase 1 (powermeter)"},
+	{Address: 224, Type: Float32, Unit: "W", ModuleId: ModulePowermeter, Id: "L1_P", Description: "Active power phase 1 (powermeter)"},
+	{Address: 226, Type: Float32, Unit: "var", ModuleId: ModulePowermeter, Id: "L1_Q", Description: "Reactive power phase 1 (powermeter)"},
+	{Address: 228, Type: Float32, Unit: "VA", ModuleId: ModulePowermeter, Id: "L1_S", Description: "Apparent power phase 1 (powermeter)"},
+	{Address: 230, Type: Float32, Unit: "V", ModuleId: ModulePowermeter, Id: "L1_U", Description: "Voltage phase 1 (powermeter)"},
+	{Address: 232, Type: Float32, Unit: "A", ModuleId: ModulePowermeter, Id: "L2_I", Description: "Current phase 2 (powermeter)"},
+	{Address: 234, Type: Float32, Unit: "W", ModuleId: ModulePowermeter, Id: "L2_P", Description: "Active power phase 2 (powermeter)"},
+	{Address: 236, Type: Float32, Unit: "var", ModuleId: ModulePowermeter, Id: "L2_Q", Description: "Reactive power phase 2 (powermeter)"},
+	{Address: 238, Type: Float32, Unit: "VA", ModuleId: ModulePowermeter, Id: "L2_S", Description: "Apparent power phase 2 (powermeter)"},
+	{Address: 240, Type: Float32, Unit: "V", ModuleId: ModulePowermeter, Id: "L2_U", Description: "Voltage phase 2 (powermeter)"},
+	{Address: 242, Type: Float32, Unit: "A", ModuleId: ModulePowermeter, Id: "L3_I", Description: "Current phase 3 (powermeter)"},
+	{Address: 244, Type: Float32, Unit: "W", ModuleId: ModulePowermeter, Id: "L3_P", Description: "Active power phase 3 (powermeter)"},
+	{Address: 246, Type: Float32, Unit: "var", ModuleId: ModulePowermeter, Id: "L3_Q", Description: "Reactive power phase 3 (powermeter)"},
+	{Address: 248, Type: Float32, Unit: "VA", ModuleId: ModulePowermeter, Id: "L3_S", Description: "Apparent power phase 3 (powermeter)"},
+	{Address: 250, Type: Float32, Unit: "V", ModuleId: ModulePowermeter, Id: "L3_U", Description: "Voltage phase 3 (powermeter)"},
+	{Address: 252, Type: Float32, Unit: "W", ModuleId: ModulePowermeter, Id: "P", Description: "Total active power (powermeter)"},
+	{Address: 254, Type: Float32, Unit: "var", ModuleId: ModulePowermeter, Id: "Q", Description: "Total reactive power (powermeter)"},
+	{Address: 256, Type: Float32, Unit: "VA", ModuleId: ModulePowermeter, Id: "S", Description: "Total apparent power (powermeter)"},
+
+	{Address: 258, Type: Float32, Unit: "A", ModuleId: "devices:local:pv1", Id: "I", Description: "Current DC1"},
+	{Address: 260, Type: Float32, Unit: "W", ModuleId: "devices:local:pv1", Id: "P", Description: "Power DC1"},
+	{Address: 266, Type: Float32, Unit: "V", ModuleId: "devices:local:pv1", Id: "U", Description: "Voltage DC1"},
+	{Address: 268, Type: Float32, Unit: "A", ModuleId: "devices:local:pv2", Id: "I", Description: "Current DC2"},
+	{Address: 270, Type: Float32, Unit: "W", ModuleId: "devices:local:pv2", Id: "P", Description: "Power DC2"},
+	{Address: 276, Type: Float32, Unit: "V", ModuleId: "devices:local:pv2", Id: "U", Description: "Voltage DC2"},
+	{Address: 278, Type: Float32, Unit: "A", ModuleId: "devices:local:pv3", Id: "I", Description: "Current DC3"},
+	{Address: 280, Type: Float32, Unit: "W", ModuleId: "devices:local:pv3", Id: "P", Description: "Power DC3"},
+	{Address: 286, Type: Float32, Unit: "V", ModuleId: "devices:local:pv3", Id: "U", Description: "Voltage DC3"},
+
+	{Address: 320, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:Yield:Total", Description: "Total yield"},
+	{Address: 322, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:Yield:Day", Description: "Daily yield"},
+	{Address: 324, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:Yield:Year", Description: "Yearly yield"},
+	{Address: 326, Type: Float32, Unit: "Wh", ModuleId: "scb:statistic:EnergyFlow", Id: "Statistic:Yield:Month", Description: "Monthly yield"},
+
+	{Address: 531, Type: U16, Unit: "W", ModuleId: ModuleInverter, Id: "MaxPower", Description: "Inverter Max Power"},
+	{Address: 575, Type: S16, Unit: "W", ModuleId: ModuleInverter, Id: "GenerationPower", Description: "Inverter Generation Power (actual)"},
+	{Address: 577, Type: U32, Unit: "Wh", ModuleId: ModuleInverter, Id: "GenerationEnergy", Description: "Generation Energy"},
+
+	{Address: 1024, Type: S16, Unit: "W", ModuleId: ModuleControl, Id: "AcPowerSetpoint", Description: "Battery charge power (AC) setpoint", Writable: true},
+	{Address: 1026, Type: S16, ModuleId: ModuleControl, Id: "PowerScaleFactor", Description: "Power-Scale-Factor"},
+	{Address: 1034, Type: Float32, Unit: "W", ModuleId: ModuleControl, Id: "DcPowerSetpoint", Description: "Battery charge power (DC) setpoint, absolute", Writable: true},
+	{Address: 1038, Type: Float32, Unit: "W", ModuleId: ModuleControl, Id: "MaxChargePower", Description: "Battery max. charge power limit, absolute", Writable: true},
+	{Address: 1040, Type: Float32, Unit: "W", ModuleId: ModuleControl, Id: "MaxDischargePower", Description: "Battery max. discharge power limit, absolute", Writable: true},
+	{Address: 1042, Type: Float32, Unit: "%", ModuleId: ModuleControl, Id: "MinSoC", Description: "Minimum SOC", Writable: true},
+	{Address: 1044, Type: Float32, Unit: "%", ModuleId: ModuleControl, Id: "MaxSoC", Description: "Maximum SOC", Writable: true},
+	{Address: 1076, Type: Float32, Unit: "W", ModuleId: ModuleControl, Id: "BatteryMaxChargePower", Description: "Max. charge power limit of the battery"},
+	{Address: 1078, Type: Float32, Unit: "W", ModuleId: ModuleControl, Id: "BatteryMaxDischargePower", Description: "Max. discharge power limit of the battery"},
+	{Address: 1080, Type: U16, ModuleId: ModuleControl, Id: "BatteryManagementMode", Description: "Battery management mode"},
+}
+
+// ErrUnknownRegister is returned for module and process-data ids which are not part of the register map
+var ErrUnknownRegister = errors.New("unknown register")
+
+// LookupRegister returns the register with the module and process-data id
+func LookupRegister(moduleId string, id string) (Register, error) {
+	for _, r := range KostalRegisters {
+		if r.ModuleId == moduleId && r.Id == id {
+			return r, nil
+		}
+	}
+	return Register{}, fmt.Errorf("%w %s %s", ErrUnknownRegister, moduleId, id)
+}
+
+// ModuleRegisters returns all registers of the module
+func ModuleRegisters(moduleId string) []Register {
+	var registers []Register
+	for _, r := range KostalRegisters {
+		if r.ModuleId == moduleId {
+			registers = append(registers, r)
+		}
+	}
+	return registers
+}
+
+// ProcessData returns the modules with the process-data ids of the register map, analogous to AuthClient.ProcessData
+func ProcessData() []golrackpi.ProcessData {
+	var processData []golrackpi.ProcessData
+	index := make(map[string]int)
+	for _, r := range KostalRegisters {
+		i, found := index[r.ModuleId]
+		if !found {
+			index[r.ModuleId] = len(processData)
+			processData = append(processData, golrackpi.ProcessData{ModuleId: r.ModuleId})
+			i = len(processData) - 1
+		}
+		processData[i].ProcessDataIds = append(processData[i].ProcessDataIds, r.Id)
+	}
+	return processData
+}
+
+// DetectByteOrder reads the byte order of 32 bit values from the inverter and uses it for the following requests
+func (c *Client) DetectByteOrder() (ByteOrder, error) {
+	registers, err := c.ReadHoldingRegisters(RegisterByteOrder, 1)
+	if err != nil {
+		return c.ByteOrder, err
+	}
+	switch registers[0] {
+	case 0:
+		c.ByteOrder = LittleEndian
+	case 1:
+		c.ByteOrder = BigEndian
+	default:
+		return c.ByteOrder, fmt.Errorf("unknown byte order %d", registers[0])
+	}
+	return c.ByteOrder, nil
+}
+
+// ReadRegister returns the value of a register, as float64 for numbers and as string for strings
+func (c *Client) ReadRegister(r Register) (interface{}, error) {
+	registers, err := c.ReadHoldingRegisters(r.Address, r.Length())
+	if err != nil {
+		return nil, err
+	}
+	return Decode(registers, r.Type, c.ByteOrder)
+}
+
+// WriteRegister writes a numeric value to a writable register
+func (c *Client) WriteRegister(r Register, value float64) error {
+	if !r.Writable {
+		return fmt.Errorf("register %d (%s) is not writable", r.Address, r.Description)
+	}
+	registers, err := Encode(value, r.Type, c.ByteOrder)
+	if err != nil {
+		return err
+	}
+	if len(registers) == 1 {
+		return c.WriteSingleRegister(r.Address, registers[0])
+	}
+	return c.WriteMultipleRegisters(r.Address, registers)
+}
+
+// ReadValues reads the registers and returns their values grouped by module, in the structure of the REST API responses.
+// Registers which the inverter rejects with an illegal address exception, e.g. battery registers without battery, are omitted.
+func (c *Client) ReadValues(registers []Register) ([]golrackpi.ProcessDataValues, error) {
+	var values []golrackpi.ProcessDataValues
+	index := make(map[string]int)
+	for _, r := range registers {
+		value, err := c.ReadRegister(r)
+		if err != nil {
+			var exception ExceptionError
+			if errors.As(err, &exception) && exception.Code == ExceptionIllegalAddress {
+				continue
+			}
+			return nil, fmt.Errorf("could not read register %d (%s): %w", r.Address, r.Description, err)
+		}
+		i, found := index[r.ModuleId]
+		if !found {
+			index[r.ModuleId] = len(values)
+			values = append(values, golrackpi.ProcessDataValues{ModuleId: r.ModuleId})
+			i = len(values) - 1
+		}
+		values[i].ProcessData = append(values[i].ProcessData, golrackpi.ProcessDataValue{Unit: r.Unit, Id: r.Id, Value: value})
+	}
+	return values, nil
+}
+
+// ProcessDataValues returns the values of the requested modules and process-data ids, analogous to AuthClient.ProcessDataValues.
+// A module without process-data ids returns all registers of the module.
+func (c *Client) ProcessDataValues(processData []golrackpi.ProcessData) ([]golrackpi.ProcessDataValues, error) {
+	var registers []Register
+	for _, module := range processData {
+		if len(module.ProcessDataIds) == 0 {
+			moduleRegisters := ModuleRegisters(module.ModuleId)
+			if len(moduleRegisters) == 0 {
+				return nil, fmt.Errorf("%w module %s", ErrUnknownRegister, module.ModuleId)
+			}
+			registers = append(registers, moduleRegisters...)
+			continue
+		}
+		for _, id := range module.ProcessDataIds {
+			r, err := LookupRegister(module.ModuleId, id)
+			if err != nil {
+				return nil, err
+			}
+			registers = append(registers, r)
+		}
+	}
+	return c.ReadValues(registers)
+}
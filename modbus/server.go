@@ -0,0 +1,289 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("modbus: server closed")
+
+// Handler answers the requests of a Server. Errors of type ExceptionError are sent as the exception code,
+// all other errors as server device failure.
+type Handler interface {
+	ReadRegisters(function byte, address uint16, count uint16) ([]uint16, error)
+	WriteRegisters(address uint16, values []uint16) error
+}
+
+// Server is a Modbus TCP server which answers read and write requests for registers by a Handler.
+// It serves as the in-process counterpart of the Client, e.g. for tests and simulations.
+type Server struct {
+	UnitId  byte // requests to other unit ids are answered with an exception; 0 accepts all unit ids
+	Handler Handler
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server instance for the unit id and handler
+func NewServer(unitId byte, handler Handler) *Server {
+	return &Server{UnitId: unitId, Handler: handler}
+}
+
+// ListenAndServe listens on the TCP address and serves the connections until Close
+func (s *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and serves them until Close. The listener is closed on return.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close closes all listeners and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// serveConn answers the requests of a connection until it is closed
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		transactionId, unitId, request, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		var response []byte
+		if s.UnitId != 0 && unitId != s.UnitId {
+			response = []byte{request[0] | 0x80, ExceptionGatewayTargetFailed}
+		} else {
+			response = s.handle(request)
+		}
+
+		frame := make([]byte, 7+len(response))
+		binary.BigEndian.PutUint16(frame[0:], transactionId)
+		binary.BigEndian.PutUint16(frame[4:], uint16(len(response)+1))
+		frame[6] = unitId
+		copy(frame[7:], response)
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response PDU of a request PDU
+func (s *Server) handle(request []byte) []byte {
+	function := request[0]
+	exception := func(err error) []byte {
+		code := ExceptionServerDeviceFailure
+		var e ExceptionError
+		if errors.As(err, &e) {
+			code = e.Code
+		}
+		return []byte{function | 0x80, code}
+	}
+
+	switch function {
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if len(request) != 5 {
+			return exception(ExceptionError{Code: ExceptionIllegalValue})
+		}
+		address := binary.BigEndian.Uint16(request[1:])
+		count := binary.BigEndian.Uint16(request[3:])
+		if count == 0 || count > maxRegisters {
+			return exception(ExceptionError{Code: ExceptionIllegalValue})
+		}
+		registers, err := s.Handler.ReadRegisters(function, address, count)
+		if err != nil {
+			return exception(err)
+		}
+		if len(registers) != int(count) {
+			return exception(ExceptionError{Code: ExceptionServerDeviceFailure})
+		}
+		response := make([]byte, 2+len(registers)*2)
+		response[0] = function
+		response[1] = byte(len(registers) * 2)
+		for i, register := range registers {
+			binary.BigEndian.PutUint16(response[2+i*2:], register)
+		}
+		return response
+
+	case FuncWriteSingleRegister:
+		if len(request) != 5 {
+			return exception(ExceptionError{Code: ExceptionIllegalValue})
+		}
+		address := binary.BigEndian.Uint16(request[1:])
+		if err := s.Handler.WriteRegisters(address, []uint16{binary.BigEndian.Uint16(request[3:])}); err != nil {
+			return exception(err)
+		}
+		return append([]byte(nil), request...)
+
+	case FuncWriteMultipleRegisters:
+		if len(request) < 6 {
+			return exception(ExceptionError{Code: ExceptionIllegalValue})
+		}
+		address := binary.BigEndian.Uint16(request[1:])
+		count := binary.BigEndian.Uint16(request[3:])
+		if count == 0 || count > 123 || int(request[5]) != int(count)*2 || len(request) != 6+int(count)*2 {
+			return exception(ExceptionError{Code: ExceptionIllegalValue})
+		}
+		values := make([]uint16, count)
+		for i := range values {
+			values[i] = binary.BigEndian.Uint16(request[6+i*2:])
+		}
+		if err := s.Handler.WriteRegisters(address, values); err != nil {
+			return exception(err)
+		}
+		return append([]byte(nil), request[:5]...)
+	}
+	return exception(ExceptionError{Code: ExceptionIllegalFunction})
+}
+
+// Memory is a Handler which keeps the registers in memory. Only registers which were set can be read and written,
+// all other addresses are answered with an illegal address exception.
+type Memory struct {
+	// OnWrite is called before registers are written by a request. An error rejects the write.
+	OnWrite func(address uint16, values []uint16) error
+
+	mu        sync.Mutex
+	registers map[uint16]uint16
+}
+
+// NewMemory returns an empty Memory instance
+func NewMemory() *Memory {
+	return &Memory{registers: make(map[uint16]uint16)}
+}
+
+// Set sets the registers starting at address
+func (m *Memory) Set(address uint16, values ...uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, value := range values {
+		m.registers[address+uint16(i)] = value
+	}
+}
+
+// Get returns count registers starting at address. It returns false if one of the registers was not set.
+func (m *Memory) Get(address uint16, count uint16) ([]uint16, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make([]uint16, count)
+	for i := range values {
+		value, found := m.registers[address+uint16(i)]
+		if !found {
+			return nil, false
+		}
+		values[i] = value
+	}
+	return values, true
+}
+
+// SetValue sets a numeric value of a register of the register map in the byte order
+func (m *Memory) SetValue(r Register, value float64, order ByteOrder) error {
+	values, err := Encode(value, r.Type, order)
+	if err != nil {
+		return err
+	}
+	m.Set(r.Address, values...)
+	return nil
+}
+
+// SetString sets a string value of a register of the register map
+func (m *Memory) SetString(r Register, value string) error {
+	values, err := EncodeString(value, r.Length())
+	if err != nil {
+		return err
+	}
+	m.Set(r.Address, values...)
+	return nil
+}
+
+// ReadRegisters returns the registers for read requests, holding and input registers share the same memory
+func (m *Memory) ReadRegisters(function byte, address uint16, count uint16) ([]uint16, error) {
+	values, found := m.Get(address, count)
+	if !found {
+		return nil, ExceptionError{Function: function, Code: ExceptionIllegalAddress}
+	}
+	return values, nil
+}
+
+// WriteRegisters stores the registers of write requests
+func (m *Memory) WriteRegisters(address uint16, values []uint16) error {
+	if _, found := m.Get(address, uint16(len(values))); !found {
+		return ExceptionError{Code: ExceptionIllegalAddress}
+	}
+	if m.OnWrite != nil {
+		if err := m.OnWrite(address, values); err != nil {
+			return err
+		}
+	}
+	m.Set(address, values...)
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/geschke/golrackpi"
+)
+
+const (
+	// SunSpecBase is the address of the SunSpec marker "SunS", followed by the first model
+	SunSpecBase uint16 = 40000
+
+	// sunSpecEnd is the model id which ends the list of models
+	sunSpecEnd uint16 = 0xFFFF
+	// sunSpecMaxModels limits the discovery in case of a broken model list
+	sunSpecMaxModels = 64
+)
+
+// ErrNoSunSpec is returned if the device has no SunSpec marker at the SunSpec base address
+var ErrNoSunSpec = errors.New("SunSpec marker not found")
+
+// sunSpecModelNames contains the names of the common SunSpec models
+var sunSpecModelNames = map[uint16]string{
+	1:   "Common",
+	101: "Inverter (Single Phase)",
+	102: "Inverter (Split Phase)",
+	103: "Inverter (Three Phase)",
+	111: "Inverter (Single Phase) FLOAT",
+	112: "Inverter (Split Phase) FLOAT",
+	113: "Inverter (Three Phase) FLOAT",
+	120: "Nameplate",
+	121: "Basic Settings",
+	122: "Measurements_Status",
+	123: "Immediate Controls",
+	124: "Storage",
+	160: "Multiple MPPT Inverter Extension Model",
+	201: "Meter (Single Phase)",
+	202: "Meter (Split Single Phase)",
+	203: "Meter (Wye-Connect Three Phase)",
+	204: "Meter (Delta-Connect Three Phase)",
+	802: "Battery Base Model",
+}
+
+// Model specifies a SunSpec model found by DiscoverSunSpec. Address is the address of the first register after the model header.
+type Model struct {
+	Id      uint16
+	Length  uint16
+	Address uint16
+}
+
+// Name returns the name of the model or "unknown" for models which are not part of the name table
+func (m Model) Name() string {
+	if name, found := sunSpecModelNames[m.Id]; found {
+		return name
+	}
+	return "unknown"
+}
+
+// Common specifies the values of the SunSpec common model 1
+type Common struct {
+	Manufacturer  string
+	Model         string
+	Options       string
+	Version       string
+	SerialNumber  string
+	DeviceAddress uint16
+}
+
+// Inverter specifies the values of the SunSpec inverter models 101-103 with applied scale factors. Values which the device
+// does not implement are nil.
+type Inverter struct {
+	Current            *float64
+	CurrentL1          *float64
+	CurrentL2          *float64
+	CurrentL3          *float64
+	VoltageL1          *float64
+	VoltageL2          *float64
+	VoltageL3          *float64
+	Power              *float64
+	Frequency          *float64
+	ApparentPower      *float64
+	ReactivePower      *float64
+	PowerFactor        *float64
+	Energy             *float64
+	DCCurrent          *float64
+	DCVoltage          *float64
+	DCPower            *float64
+	CabinetTemperature *float64
+	State              uint16
+}
+
+// DiscoverSunSpec checks the SunSpec marker and returns the list of models. SunSpec values are always big-endian,
+// independent of the byte order of the Kostal registers.
+func (c *Client) DiscoverSunSpec() ([]Model, error) {
+	marker, err := c.ReadHoldingRegisters(SunSpecBase, 2)
+	if err != nil {
+		var exception ExceptionError
+		if errors.As(err, &exception) && exception.Code == ExceptionIllegalAddress {
+			return nil, ErrNoSunSpec
+		}
+		return nil, err
+	}
+	if decodeString(marker) != "SunS" {
+		return nil, ErrNoSunSpec
+	}
+
+	var models []Model
+	address := SunSpecBase + 2
+	for len(models) < sunSpecMaxModels {
+		header, err := c.ReadHoldingRegisters(address, 2)
+		if err != nil {
+			return nil, fmt.Errorf("could not read SunSpec model header at %d: %w", address, err)
+		}
+		if header[0] == sunSpecEnd {
+			return models, nil
+		}
+		models = append(models, Model{Id: header[0], Length: header[1], Address: address + 2})
+		next := uint32(address) + 2 + uint32(header[1])
+		if next > math.MaxUint16 {
+			return nil, errors.New("SunSpec model list exceeds the address space")
+		}
+		address = uint16(next)
+	}
+	return nil, fmt.Errorf("SunSpec model list has more than %d models", sunSpecMaxModels)
+}
+
+// readModel reads all registers of a model, in blocks of the maximum request size
+func (c *Client) readModel(model Model) ([]uint16, error) {
+	registers := make([]uint16, 0, model.Length)
+	for offset := uint16(0); offset < model.Length; offset += maxRegisters {
+		count := model.Length - offset
+		if count > maxRegisters {
+			count = maxRegisters
+		}
+		block, err := c.ReadHoldingRegisters(model.Address+offset, count)
+		if err != nil {
+			return nil, err
+		}
+		registers = append(registers, block...)
+	}
+	return registers, nil
+}
+
+// ReadCommon reads the SunSpec common model 1
+func (c *Client) ReadCommon(model Model) (Common, error) {
+	if model.Id != 1 || model.Length < 65 {
+		return Common{}, fmt.Errorf("model %d with length %d is not a common model", model.Id, model.Length)
+	}
+	registers, err := c.readModel(model)
+	if err != nil {
+		return Common{}, err
+	}
+	return Common{
+		Manufacturer:  decodeString(registers[0:16]),
+		Model:         decodeString(registers[16:32]),
+		Options:       decodeString(registers[32:40]),
+		Version:       decodeString(registers[40:48]),
+		SerialNumber:  decodeString(registers[48:64]),
+		DeviceAddress: registers[64],
+	}, nil
+}
+
+// ReadInverter reads one of the SunSpec inverter models 101-103 and applies the scale factors
+func (c *Client) ReadInverter(model Model) (Inverter, error) {
+	if model.Id < 101 || model.Id > 103 || model.Length < 50 {
+		return Inverter{}, fmt.Errorf("model %d with length %d is not an inverter model", model.Id, model.Length)
+	}
+	r, err := c.readModel(model)
+	if err != nil {
+		return Inverter{}, err
+	}
+	return Inverter{
+		Current:            scaleUnsigned(r[0], r[4]),
+		CurrentL1:          scaleUnsigned(r[1], r[4]),
+		CurrentL2:          scaleUnsigned(r[2], r[4]),
+		CurrentL3:          scaleUnsigned(r[3], r[4]),
+		VoltageL1:          scaleUnsigned(r[8], r[11]),
+		VoltageL2:          scaleUnsigned(r[9], r[11]),
+		VoltageL3:          scaleUnsigned(r[10], r[11]),
+		Power:              scaleSigned(r[12], r[13]),
+		Frequency:          scaleUnsigned(r[14], r[15]),
+		ApparentPower:      scaleSigned(r[16], r[17]),
+		ReactivePower:      scaleSigned(r[18], r[19]),
+		PowerFactor:        scaleSigned(r[20], r[21]),
+		Energy:             scaleAccumulator(r[22:24], r[24]),
+		DCCurrent:          scaleUnsigned(r[25], r[26]),
+		DCVoltage:          scaleUnsigned(r[27], r[28]),
+		DCPower:            scaleSigned(r[29], r[30]),
+		CabinetTemperature: scaleSigned(r[31], r[35]),
+		State:              r[36],
+	}, nil
+}
+
+// scale returns value * 10^sf, or nil if the scale factor is not implemented
+func scale(value float64, sf uint16) *float64 {
+	if sf == 0x8000 {
+		return nil
+	}
+	v := value * math.Pow10(int(int16(sf)))
+	return &v
+}
+
+// scaleUnsigned scales an uint16 value, the SunSpec "not implemented" value 0xFFFF returns nil
+func scaleUnsigned(value uint16, sf uint16) *float64 {
+	if value == 0xFFFF {
+		return nil
+	}
+	return scale(float64(value), sf)
+}
+
+// scaleSigned scales an int16 value, the SunSpec "not implemented" value 0x8000 returns nil
+func scaleSigned(value uint16, sf uint16) *float64 {
+	if value == 0x8000 {
+		return nil
+	}
+	return scale(float64(int16(value)), sf)
+}
+
+// scaleAccumulator scales an acc32 value, the SunSpec "not implemented" value 0 returns nil
+func scaleAccumulator(registers []uint16, sf uint16) *float64 {
+	value := join(registers, BigEndian)
+	if value == 0 {
+		return nil
+	}
+	return scale(float64(value), sf)
+}
+
+// Values returns the implemented values of the inverter model in the structure of the REST API responses,
+// with the module id "modbus:sunspec:<model id>"
+func (i Inverter) Values(model Model) golrackpi.ProcessDataValues {
+	values := golrackpi.ProcessDataValues{ModuleId: "modbus:sunspec:" + strconv.Itoa(int(model.Id))}
+	add := func(id string, unit string, value *float64) {
+		if value != nil {
+			values.ProcessData = append(values.ProcessData, golrackpi.ProcessDataValue{Unit: unit, Id: id, Value: *value})
+		}
+	}
+	add("A", "A", i.Current)
+	add("AphA", "A", i.CurrentL1)
+	add("AphB", "A", i.CurrentL2)
+	add("AphC", "A", i.CurrentL3)
+	add("PhVphA", "V", i.VoltageL1)
+	add("PhVphB", "V", i.VoltageL2)
+	add("PhVphC", "V", i.VoltageL3)
+	add("W", "W", i.Power)
+	add("Hz", "Hz", i.Frequency)
+	add("VA", "VA", i.ApparentPower)
+	add("VAr", "var", i.ReactivePower)
+	add("PF", "", i.PowerFactor)
+	add("WH", "Wh", i.Energy)
+	add("DCA", "A", i.DCCurrent)
+	add("DCV", "V", i.DCVoltage)
+	add("DCW", "W", i.DCPower)
+	add("TmpCab", "°C", i.CabinetTemperature)
+	state := float64(i.State)
+	add("St", "", &state)
+	return values
+}
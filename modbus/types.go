@@ -0,0 +1,195 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ByteOrder specifies the order of the 16 bit words of 32 bit values
+type ByteOrder int
+
+const (
+	// LittleEndian is the word order CDAB, i.e. the low word comes first. It is the default of Plenticore inverters.
+	LittleEndian ByteOrder = 0
+	// BigEndian is the word order ABCD, i.e. the high word comes first, as used by SunSpec
+	BigEndian ByteOrder = 1
+)
+
+func (o ByteOrder) String() string {
+	if o == BigEndian {
+		return "big-endian (ABCD)"
+	}
+	return "little-endian (CDAB)"
+}
+
+// DataType specifies the type of a register value
+type DataType int
+
+const (
+	U16 DataType = iota
+	S16
+	U32
+	S32
+	Float32
+	String
+)
+
+func (t DataType) String() string {
+	switch t {
+	case U16:
+		return "U16"
+	case S16:
+		return "S16"
+	case U32:
+		return "U32"
+	case S32:
+		return "S32"
+	case Float32:
+		return "Float"
+	case String:
+		return "String"
+	}
+	return "unknown"
+}
+
+// ParseDataType returns the data type of a name like "u16", "s32" or "float32"
+func ParseDataType(name string) (DataType, error) {
+	switch strings.ToLower(name) {
+	case "u16", "uint16":
+		return U16, nil
+	case "s16", "int16":
+		return S16, nil
+	case "u32", "uint32":
+		return U32, nil
+	case "s32", "int32":
+		return S32, nil
+	case "float", "float32":
+		return Float32, nil
+	case "string":
+		return String, nil
+	}
+	return U16, fmt.Errorf("unknown data type %q, please use u16, s16, u32, s32, float32 or string", name)
+}
+
+// Words returns the number of registers of a value of this type. Strings have a variable length.
+func (t DataType) Words() uint16 {
+	switch t {
+	case U32, S32, Float32:
+		return 2
+	case String:
+		return 0
+	}
+	return 1
+}
+
+// join returns the 32 bit value of two registers in the byte order
+func join(registers []uint16, order ByteOrder) uint32 {
+	if order == BigEndian {
+		return uint32(registers[0])<<16 | uint32(registers[1])
+	}
+	return uint32(registers[1])<<16 | uint32(registers[0])
+}
+
+// split returns the two registers of a 32 bit value in the byte order
+func split(value uint32, order ByteOrder) []uint16 {
+	if order == BigEndian {
+		return []uint16{uint16(value >> 16), uint16(value)}
+	}
+	return []uint16{uint16(value), uint16(value >> 16)}
+}
+
+// Decode returns the value of the registers as float64 for numeric types and string for strings
+func Decode(registers []uint16, t DataType, order ByteOrder) (interface{}, error) {
+	words := t.Words()
+	if len(registers) < int(words) || len(registers) == 0 {
+		return nil, fmt.Errorf("%d register(s) are too few for type %s", len(registers), t)
+	}
+	switch t {
+	case U16:
+		return float64(registers[0]), nil
+	case S16:
+		return float64(int16(registers[0])), nil
+	case U32:
+		return float64(join(registers, order)), nil
+	case S32:
+		return float64(int32(join(registers, order))), nil
+	case Float32:
+		return float64(math.Float32frombits(join(registers, order))), nil
+	case String:
+		return decodeString(registers), nil
+	}
+	return nil, fmt.Errorf("unknown data type %d", t)
+}
+
+// decodeString returns the string of the registers. Strings are stored with two characters per register, high byte first,
+// and are padded with zero bytes.
+func decodeString(registers []uint16) string {
+	b := make([]byte, 0, len(registers)*2)
+	for _, register := range registers {
+		b = append(b, byte(register>>8), byte(register))
+	}
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Encode returns the registers of a numeric value. Values of integer types are rounded, values out of range of the type return
+// an error.
+func Encode(value float64, t DataType, order ByteOrder) ([]uint16, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errors.New("value is not a finite number")
+	}
+	if t != Float32 {
+		// the range is checked after rounding, otherwise e.g. 65535.6 would pass as U16 and wrap to 0
+		value = math.Round(value)
+	}
+	switch t {
+	case U16:
+		if value < 0 || value > math.MaxUint16 {
+			return nil, fmt.Errorf("value %v out of range of type %s", value, t)
+		}
+		return []uint16{uint16(value)}, nil
+	case S16:
+		if value < math.MinInt16 || value > math.MaxInt16 {
+			return nil, fmt.Errorf("value %v out of range of type %s", value, t)
+		}
+		return []uint16{uint16(int16(value))}, nil
+	case U32:
+		if value < 0 || value > math.MaxUint32 {
+			return nil, fmt.Errorf("value %v out of range of type %s", value, t)
+		}
+		return split(uint32(value), order), nil
+	case S32:
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return nil, fmt.Errorf("value %v out of range of type %s", value, t)
+		}
+		return split(uint32(int32(value)), order), nil
+	case Float32:
+		if math.Abs(value) > math.MaxFloat32 {
+			return nil, fmt.Errorf("value %v out of range of type %s", value, t)
+		}
+		return split(math.Float32bits(float32(value)), order), nil
+	}
+	return nil, fmt.Errorf("type %s can not be encoded as number", t)
+}
+
+// EncodeString returns the registers of a string with the given number of registers, padded with zero bytes
+func EncodeString(value string, words uint16) ([]uint16, error) {
+	if len(value) > int(words)*2 {
+		return nil, fmt.Errorf("string %q is longer than %d characters", value, words*2)
+	}
+	b := make([]byte, int(words)*2)
+	copy(b, value)
+	registers := make([]uint16, words)
+	for i := range registers {
+		registers[i] = uint16(b[i*2])<<8 | uint16(b[i*2+1])
+	}
+	return registers, nil
+}
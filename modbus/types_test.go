@@ -0,0 +1,111 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package modbus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		value float64
+		t     DataType
+		order ByteOrder
+		want  []uint16
+	}{
+		{1234, U16, LittleEndian, []uint16{1234}},
+		{-2, S16, LittleEndian, []uint16{0xFFFE}},
+		{0x12345678, U32, LittleEndian, []uint16{0x5678, 0x1234}},
+		{0x12345678, U32, BigEndian, []uint16{0x1234, 0x5678}},
+		{-1000, S32, BigEndian, []uint16{0xFFFF, 0xFC18}},
+		{1.5, Float32, BigEndian, []uint16{0x3FC0, 0x0000}},
+		{1.5, Float32, LittleEndian, []uint16{0x0000, 0x3FC0}},
+	}
+	for _, test := range tests {
+		registers, err := Encode(test.value, test.t, test.order)
+		if err != nil {
+			t.Errorf("%v as %s: %v", test.value, test.t, err)
+			continue
+		}
+		if !reflect.DeepEqual(registers, test.want) {
+			t.Errorf("%v as %s %s: got %04x, want %04x", test.value, test.t, test.order, registers, test.want)
+		}
+		decoded, err := Decode(registers, test.t, test.order)
+		if err != nil || decoded != test.value {
+			t.Errorf("%v as %s %s: decoded %v, %v", test.value, test.t, test.order, decoded, err)
+		}
+	}
+}
+
+func TestEncodeRounding(t *testing.T) {
+	valid := []struct {
+		value float64
+		t     DataType
+		want  float64
+	}{
+		{65534.6, U16, 65535},
+		{-0.4, U16, 0},
+		{32766.6, S16, 32767},
+		{-32768.4, S16, -32768},
+		{-0.4, U32, 0},
+		{4294967294.6, U32, 4294967295},
+		{2147483647.4, S32, 2147483647},
+		{12.5, S16, 13},
+		{-12.5, S16, -13},
+	}
+	for _, test := range valid {
+		registers, err := Encode(test.value, test.t, BigEndian)
+		if err != nil {
+			t.Errorf("%v as %s: %v", test.value, test.t, err)
+			continue
+		}
+		if decoded, _ := Decode(registers, test.t, BigEndian); decoded != test.want {
+			t.Errorf("%v as %s: got %v, want %v", test.value, test.t, decoded, test.want)
+		}
+	}
+
+	invalid := []struct {
+		value float64
+		t     DataType
+	}{
+		{65535.6, U16},
+		{-0.6, U16},
+		{32767.6, S16},
+		{-32768.6, S16},
+		{4294967295.5, U32},
+		{2147483647.6, S32},
+		{-2147483648.6, S32},
+		{math.MaxFloat64, Float32},
+		{math.NaN(), U16},
+		{math.Inf(-1), Float32},
+		{1, String},
+	}
+	for _, test := range invalid {
+		if registers, err := Encode(test.value, test.t, BigEndian); err == nil {
+			t.Errorf("%v as %s: accepted as %04x", test.value, test.t, registers)
+		}
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	registers, err := EncodeString("KOSTAL", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x4B4F, 0x5354, 0x414C, 0}; !reflect.DeepEqual(registers, want) {
+		t.Errorf("got %04x, want %04x", registers, want)
+	}
+	if decoded, _ := Decode(registers, String, BigEndian); decoded != "KOSTAL" {
+		t.Errorf("decoded %q", decoded)
+	}
+	if _, err := EncodeString("too long", 2); err == nil {
+		t.Error("too long string accepted")
+	}
+	if _, err := Decode([]uint16{1}, U32, BigEndian); err == nil {
+		t.Error("too few registers accepted")
+	}
+}
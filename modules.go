@@ -20,7 +20,7 @@ type ModuleData struct {
 // Modules returns a list of modules with their type
 func (c *AuthClient) Modules() ([]ModuleData, error) {
 	moduleData := []ModuleData{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/modules"), nil)
 	if err != nil {
@@ -34,6 +34,9 @@ func (c *AuthClient) Modules() ([]ModuleData, error) {
 		return moduleData, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return moduleData, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
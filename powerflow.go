@@ -0,0 +1,77 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import "errors"
+
+// PowerFlow specifies the current power flow between PV generator, battery, grid and home in W.
+// Battery values are nil if the inverter has no battery.
+type PowerFlow struct {
+	PV           float64  `json:"pv"`
+	AC           float64  `json:"ac"`
+	Home         float64  `json:"home"`
+	HomeFromPV   float64  `json:"home_from_pv"`
+	HomeFromBat  float64  `json:"home_from_battery"`
+	HomeFromGrid float64  `json:"home_from_grid"`
+	Grid         float64  `json:"grid"`
+	Battery      *float64 `json:"battery"`
+	BatterySoC   *float64 `json:"battery_soc"`
+}
+
+// PowerFlow returns the current power flow. The signs of grid and battery power are returned as sent by the inverter.
+func (c *AuthClient) PowerFlow() (PowerFlow, error) {
+	var flow PowerFlow
+
+	values, err := c.ProcessDataValues([]ProcessData{
+		{ModuleId: "devices:local", ProcessDataIds: []string{"Dc_P", "Home_P", "HomePv_P", "HomeBat_P", "HomeGrid_P", "Grid_P"}},
+		{ModuleId: "devices:local:ac", ProcessDataIds: []string{"P"}},
+	})
+	if err != nil {
+		return flow, err
+	}
+	for _, module := range values {
+		for _, value := range module.ProcessData {
+			number, _ := value.Value.(float64)
+			switch module.ModuleId + "/" + value.Id {
+			case "devices:local/Dc_P":
+				flow.PV = number
+			case "devices:local/Home_P":
+				flow.Home = number
+			case "devices:local/HomePv_P":
+				flow.HomeFromPV = number
+			case "devices:local/HomeBat_P":
+				flow.HomeFromBat = number
+			case "devices:local/HomeGrid_P":
+				flow.HomeFromGrid = number
+			case "devices:local/Grid_P":
+				flow.Grid = number
+			case "devices:local:ac/P":
+				flow.AC = number
+			}
+		}
+	}
+
+	// the battery module is missing on inverters without battery, so errors are ignored
+	battery, err := c.ProcessDataModuleValues("devices:local:battery", "P", "SoC")
+	if err == nil {
+		for _, module := range battery {
+			for _, value := range module.ProcessData {
+				number, ok := value.Value.(float64)
+				if !ok {
+					continue
+				}
+				switch value.Id {
+				case "P":
+					flow.Battery = &number
+				case "SoC":
+					flow.BatterySoC = &number
+				}
+			}
+		}
+	} else if errors.Is(err, ErrUnauthorized) {
+		return flow, err
+	}
+	return flow, nil
+}
@@ -28,6 +28,50 @@ type ProcessDataValue struct {
 	Value interface{} `json:"value"`
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface. It decodes unexpected data leniently instead of failing the whole response:
+// unit and id which are no strings are kept as their JSON text, numeric values are decoded as float64 and numbers out of range of
+// float64 are kept as json.Number.
+func (v *ProcessDataValue) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Unit  json.RawMessage `json:"unit"`
+		Id    json.RawMessage `json:"id"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*v = ProcessDataValue{Unit: rawString(raw.Unit), Id: rawString(raw.Id)}
+	if len(raw.Value) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw.Value))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if number, ok := value.(json.Number); ok {
+		if f, err := number.Float64(); err == nil {
+			value = f
+		}
+	}
+	v.Value = value
+	return nil
+}
+
+// rawString returns a JSON string as string, null as empty string and other JSON values as their JSON text
+func rawString(data json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
 // ProcessDataValues specifies the structure of the response returned by a request for processdata with moduleid and
 // a slice of ProcessDataValue which contains the fields Unid, Id and Value
 type ProcessDataValues struct {
@@ -38,7 +82,7 @@ type ProcessDataValues struct {
 // ProcessData returns a slice of ProcessData type, i.e. a list of modules with a list of their process-data identifiers
 func (c *AuthClient) ProcessData() ([]ProcessData, error) {
 	processData := []ProcessData{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/processdata"), nil)
 
@@ -53,6 +97,9 @@ func (c *AuthClient) ProcessData() ([]ProcessData, error) {
 		return processData, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return processData, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -72,7 +119,7 @@ func (c *AuthClient) ProcessData() ([]ProcessData, error) {
 // It takes a moduleid and returns all processdata ids and their values according to the moduleid.
 func (c *AuthClient) ProcessDataModule(moduleId string) ([]ProcessDataValues, error) {
 	processDataValues := []ProcessDataValues{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/processdata/"+moduleId), nil)
 	if err != nil {
@@ -86,6 +133,9 @@ func (c *AuthClient) ProcessDataModule(moduleId string) ([]ProcessDataValues, er
 		return processDataValues, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return processDataValues, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -105,7 +155,7 @@ func (c *AuthClient) ProcessDataModule(moduleId string) ([]ProcessDataValues, er
 // belongs to the moduleid.
 func (c *AuthClient) ProcessDataModuleValues(moduleId string, processDataIds ...string) ([]ProcessDataValues, error) {
 	processDataValues := []ProcessDataValues{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	var processDataString string
 
@@ -128,6 +178,9 @@ func (c *AuthClient) ProcessDataModuleValues(moduleId string, processDataIds ...
 		return processDataValues, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return processDataValues, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -154,7 +207,7 @@ func (c *AuthClient) ProcessDataValues(v []ProcessData) ([]ProcessDataValues, er
 		return processDataValues, err
 	}
 
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("POST", c.getUrl("/api/v1/processdata"), bytes.NewBuffer(b))
 	if err != nil {
@@ -169,6 +222,9 @@ func (c *AuthClient) ProcessDataValues(v []ProcessData) ([]ProcessDataValues, er
 		return processDataValues, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return processDataValues, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
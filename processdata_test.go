@@ -0,0 +1,72 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestProcessDataValueUnmarshal(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ProcessDataValue
+	}{
+		{`{"unit":"W","id":"P","value":1234.5}`, ProcessDataValue{Unit: "W", Id: "P", Value: 1234.5}},
+		{`{"unit":null,"id":"State","value":"Feed-in"}`, ProcessDataValue{Id: "State", Value: "Feed-in"}},
+		{`{"unit":"","id":7,"value":true}`, ProcessDataValue{Id: "7", Value: true}},
+		{`{"id":"P","value":null}`, ProcessDataValue{Id: "P"}},
+		{`{"id":"P","value":1e400}`, ProcessDataValue{Id: "P", Value: json.Number("1e400")}},
+	}
+	for _, test := range tests {
+		var value ProcessDataValue
+		if err := json.Unmarshal([]byte(test.input), &value); err != nil {
+			t.Errorf("%s: unexpected error %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.input, value, test.want)
+		}
+	}
+
+	var values []ProcessDataValues
+	if err := json.Unmarshal([]byte(`<html>Bad Gateway</html>`), &values); err == nil {
+		t.Error("error page was accepted")
+	}
+}
+
+func FuzzProcessDataValuesUnmarshal(f *testing.F) {
+	f.Add([]byte(`[{"moduleid":"devices:local","processdata":[{"unit":"W","id":"Dc_P","value":4711}]}]`))
+	f.Add([]byte(`[{"moduleid":"devices:local","processdata":[{"unit":1,"id":null,"value":{"a":[1e999]}}]}]`))
+	f.Add([]byte(`{"message":"Bad Gateway"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var values []ProcessDataValues
+		if err := json.Unmarshal(data, &values); err != nil {
+			return
+		}
+		for _, module := range values {
+			for _, value := range module.ProcessData {
+				if f, ok := value.Value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+					t.Fatalf("value %v is not finite", f)
+				}
+			}
+		}
+
+		// decoded values are stable in a round trip
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			t.Fatalf("could not marshal %#v: %v", values, err)
+		}
+		var decoded []ProcessDataValues
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("could not unmarshal %s: %v", encoded, err)
+		}
+		if !reflect.DeepEqual(values, decoded) {
+			t.Fatalf("round trip changed %#v to %#v", values, decoded)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned by Do if the inverter answers a request with an http error other than 401 Unauthorized.
+// Message contains the error message of the inverter, if available.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+// Error returns the http status and the message of the inverter
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return "request returned with http error " + e.Status
+	}
+	return "request returned with http error " + e.Status + ": " + e.Message
+}
+
+// Do sends a request to an endpoint of the inverter API which is not wrapped by the library, e.g. Do(ctx, "GET", "/api/v1/info/version", nil, &result).
+// The path is relative to the server of the client and may contain a query string. The session id of the client is sent
+// in the authorization header, so Login has to be called before for endpoints which require a session.
+//
+// body is sent as is if it's a []byte, string or io.Reader and encoded as JSON otherwise; nil sends no body.
+// out receives the raw response body if it's a *[]byte and the decoded JSON response otherwise; if nil, the response body is discarded.
+// A rejected session returns ErrUnauthorized, all other http errors return an *APIError.
+func (c *AuthClient) Do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	if method == "" {
+		method = http.MethodGet
+	}
+	if strings.Contains(path, "://") {
+		return errors.New("path must not contain scheme and server: " + path)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	case string:
+		reader = strings.NewReader(b)
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not encode request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	if reader != nil && contentType == "" {
+		contentType = "application/json"
+	}
+
+	request, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), c.getUrl(path), reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Add("accept", "application/json")
+	if contentType != "" {
+		request.Header.Add("Content-Type", contentType)
+	}
+	if c.SessionId != "" {
+		request.Header.Add("authorization", "Session "+c.SessionId)
+	}
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return newAPIError(response, responseBody)
+	}
+
+	switch o := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*o = responseBody
+		return nil
+	}
+	if len(bytes.TrimSpace(responseBody)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return fmt.Errorf("could not decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// newAPIError returns an APIError with the status of the response and the message of the inverter's JSON error response
+func newAPIError(response *http.Response, body []byte) *APIError {
+	apiError := &APIError{StatusCode: response.StatusCode, Status: response.Status}
+	var message struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &message) == nil {
+		apiError.Message = message.Message
+	}
+	return apiError
+}
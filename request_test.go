@@ -0,0 +1,77 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/api"
+	"github.com/geschke/golrackpi/simulator"
+)
+
+func TestDo(t *testing.T) {
+	sim, err := simulator.Start(simulator.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	client := sim.Client()
+	ctx := context.Background()
+
+	if err := client.Do(ctx, "GET", "/api/v1/processdata", nil, nil); !errors.Is(err, golrackpi.ErrUnauthorized) {
+		t.Errorf("request without session: got %v", err)
+	}
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Logout()
+
+	// *[]byte receives the raw response, other types the decoded JSON
+	var raw []byte
+	if err := client.Do(ctx, "GET", "api/v1/info/version", nil, &raw); err != nil || !strings.HasPrefix(string(raw), "{") || !strings.Contains(string(raw), `"sw_version"`) {
+		t.Errorf("raw response: got %s, %v", raw, err)
+	}
+	var version api.VersionInfo
+	if err := client.Do(ctx, "", "/api/v1/info/version", nil, &version); err != nil || version.SwVersion == "" {
+		t.Errorf("decoded response: got %+v, %v", version, err)
+	}
+
+	bodies := map[string]interface{}{
+		"6": []byte(`[{"moduleid":"devices:local","settings":[{"id":"Battery:MinSoc","value":"6"}]}]`),
+		"7": `[{"moduleid":"devices:local","settings":[{"id":"Battery:MinSoc","value":"7"}]}]`,
+		"8": strings.NewReader(`[{"moduleid":"devices:local","settings":[{"id":"Battery:MinSoc","value":"8"}]}]`),
+		"9": []golrackpi.ModuleSettings{{ModuleId: "devices:local", Settings: []golrackpi.SettingsValues{{Id: "Battery:MinSoc", Value: "9"}}}},
+	}
+	for want, body := range bodies {
+		if err := client.Do(ctx, "put", "/api/v1/settings", body, nil); err != nil {
+			t.Errorf("body %T: %v", body, err)
+			continue
+		}
+		var values []golrackpi.SettingsValues
+		if err := client.Do(ctx, "GET", "/api/v1/settings/devices:local/Battery:MinSoc", nil, &values); err != nil || len(values) != 1 || values[0].Value != want {
+			t.Errorf("body %T: got %+v, %v", body, values, err)
+		}
+	}
+	if err := client.Do(ctx, "PUT", "/api/v1/settings", map[string]interface{}{"invalid": func() {}}, nil); err == nil {
+		t.Error("body which can't be encoded accepted")
+	}
+
+	var apiError *golrackpi.APIError
+	err = client.Do(ctx, "GET", "/api/v1/settings/unknown", nil, nil)
+	if !errors.As(err, &apiError) || apiError.StatusCode != 404 || apiError.Message != "Module not found" {
+		t.Errorf("unknown module: got %v", err)
+	}
+	if err := client.Do(ctx, "GET", "http://example.com/api/v1/info/version", nil, nil); err == nil {
+		t.Error("path with server accepted")
+	}
+	var invalid int
+	if err := client.Do(ctx, "GET", "/api/v1/info/version", nil, &invalid); err == nil {
+		t.Error("response decoded into wrong type")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrUnauthorized is returned by requests which are rejected by the inverter because the session is missing or expired
+var ErrUnauthorized = errors.New("session not authorized")
+
+// checkResponse returns ErrUnauthorized if the inverter rejected the session and an error with the http status for all other failed requests
+func checkResponse(response *http.Response) error {
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	}
+	return errors.New("request returned with http error " + response.Status)
+}
+
+// Session keeps a client logged in for long-running processes, so all requests share one inverter session.
+// It logs in before the first request and again if the inverter rejects the session, e.g. after a restart of the inverter.
+type Session struct {
+	Client *AuthClient
+
+	mu         sync.RWMutex
+	loggedIn   bool
+	generation int
+}
+
+// NewSession returns a Session instance for the client
+func NewSession(client *AuthClient) *Session {
+	return &Session{Client: client}
+}
+
+// login logs in if there is no session or if the session of the submitted generation was rejected. It returns the current generation.
+func (s *Session) login(rejected int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loggedIn && s.generation != rejected {
+		return s.generation, nil
+	}
+	if _, err := s.Client.Login(); err != nil {
+		s.loggedIn = false
+		return s.generation, err
+	}
+	s.loggedIn = true
+	s.generation++
+	return s.generation, nil
+}
+
+// Do calls fn with a logged in client. If fn returns ErrUnauthorized, the session is renewed and fn is called once again.
+// Do can be called concurrently; a rejected session is renewed only once, while no request is running.
+func (s *Session) Do(fn func(client *AuthClient) error) error {
+	generation, err := s.login(-1)
+	if err != nil {
+		return err
+	}
+	err = s.call(fn)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	if _, err := s.login(generation); err != nil {
+		return err
+	}
+	return s.call(fn)
+}
+
+// call runs fn while holding the read lock, so the session id is not changed during the request
+func (s *Session) call(fn func(client *AuthClient) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.Client)
+}
+
+// Close logs out if there is a session
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loggedIn {
+		return nil
+	}
+	s.loggedIn = false
+	_, err := s.Client.Logout()
+	return err
+}
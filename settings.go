@@ -7,7 +7,10 @@ package golrackpi
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"strings"
 
 	"errors"
@@ -26,6 +29,95 @@ type SettingsDataValues struct {
 	Default string      `json:"default"`
 }
 
+// TypeName returns the data type of the setting, e.g. "uint8", "float" or "string"
+func (s SettingsDataValues) TypeName() string {
+	if s.Type == nil {
+		return ""
+	}
+	return fmt.Sprint(s.Type)
+}
+
+// AccessName returns the access mode of the setting, i.e. "readonly" or "readwrite"
+func (s SettingsDataValues) AccessName() string {
+	if s.Access == nil {
+		return ""
+	}
+	return fmt.Sprint(s.Access)
+}
+
+// IsWritable returns true if the setting can be changed
+func (s SettingsDataValues) IsWritable() bool {
+	return strings.Contains(s.AccessName(), "write")
+}
+
+// isNumeric returns true if the setting has a numeric data type
+func (s SettingsDataValues) isNumeric() bool {
+	switch s.TypeName() {
+	case "byte", "bool", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float", "double":
+		return true
+	}
+	return false
+}
+
+// Validate checks if value is allowed for the setting according to its access mode, data type and min and max limits.
+// The limits of string settings are interpreted as minimum and maximum length.
+func (s SettingsDataValues) Validate(value string) error {
+	if !s.IsWritable() {
+		return fmt.Errorf("setting %s is %s", s.Id, s.AccessName())
+	}
+
+	if !s.isNumeric() {
+		if s.Min != "" {
+			if min, err := strconv.Atoi(s.Min); err == nil && len(value) < min {
+				return fmt.Errorf("value of %s must have at least %d characters", s.Id, min)
+			}
+		}
+		if s.Max != "" {
+			if max, err := strconv.Atoi(s.Max); err == nil && len(value) > max {
+				return fmt.Errorf("value of %s must have at most %d characters", s.Id, max)
+			}
+		}
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return fmt.Errorf("value %q of %s is not a number", value, s.Id)
+	}
+	typeName := s.TypeName()
+	if typeName != "float" && typeName != "double" && number != float64(int64(number)) {
+		return fmt.Errorf("value %q of %s must be an integer (%s)", value, s.Id, typeName)
+	}
+	if strings.HasPrefix(typeName, "uint") && number < 0 {
+		return fmt.Errorf("value %q of %s must not be negative (%s)", value, s.Id, typeName)
+	}
+	if s.Min != "" {
+		if min, err := strconv.ParseFloat(s.Min, 64); err == nil && number < min {
+			return fmt.Errorf("value %s of %s is lower than the minimum %s", value, s.Id, s.Min)
+		}
+	}
+	if s.Max != "" {
+		if max, err := strconv.ParseFloat(s.Max, 64); err == nil && number > max {
+			return fmt.Errorf("value %s of %s is greater than the maximum %s", value, s.Id, s.Max)
+		}
+	}
+	return nil
+}
+
+// EqualValues returns true if both values are equal according to the data type of the setting, e.g. "1" and "1.0" are equal values
+// of a numeric setting.
+func (s SettingsDataValues) EqualValues(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	if !s.isNumeric() {
+		return false
+	}
+	numberA, errA := strconv.ParseFloat(a, 64)
+	numberB, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && numberA == numberB
+}
+
 // SettingsData specifies the structure of the response returned by a request to the "settings" endpoint.
 // It embeds a slice of SettingsDataValues type.
 type SettingsData struct {
@@ -33,6 +125,16 @@ type SettingsData struct {
 	Settings []SettingsDataValues `json:"settings"`
 }
 
+// Setting returns the setting with the submitted id
+func (d SettingsData) Setting(id string) (SettingsDataValues, bool) {
+	for _, setting := range d.Settings {
+		if setting.Id == id {
+			return setting, true
+		}
+	}
+	return SettingsDataValues{}, false
+}
+
 // SettingsValues specifies the structure of the response returned by a request to the "settings/moduleid/..." endpoint.
 // The structure defines a settingid and its value.
 type SettingsValues struct {
@@ -44,7 +146,7 @@ type SettingsValues struct {
 // Warning: The request returns a lot of data, so it takes some time.
 func (c *AuthClient) Settings() ([]SettingsData, error) {
 	jsonResult := []SettingsData{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/settings"), nil)
 	if err != nil {
@@ -58,6 +160,9 @@ func (c *AuthClient) Settings() ([]SettingsData, error) {
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return jsonResult, err
+	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -75,7 +180,7 @@ func (c *AuthClient) Settings() ([]SettingsData, error) {
 // SettingsModule returns a list of settings with settingids and their values of a moduleid
 func (c *AuthClient) SettingsModule(moduleid string) ([]SettingsValues, error) {
 	jsonResult := []SettingsValues{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/settings/"+moduleid), nil)
 	if err != nil {
@@ -89,6 +194,9 @@ func (c *AuthClient) SettingsModule(moduleid string) ([]SettingsValues, error) {
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		return jsonResult, ErrUnauthorized
+	}
 	if response.StatusCode != 200 {
 		return jsonResult, errors.New("module or setting not found")
 	}
@@ -110,7 +218,7 @@ func (c *AuthClient) SettingsModule(moduleid string) ([]SettingsValues, error) {
 // moduleid and settingid parameter.
 func (c *AuthClient) SettingsModuleSetting(moduleid string, settingid string) ([]SettingsValues, error) {
 	jsonResult := []SettingsValues{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	request, err := http.NewRequest("GET", c.getUrl("/api/v1/settings/"+moduleid+"/"+settingid), nil)
 	if err != nil {
@@ -124,6 +232,9 @@ func (c *AuthClient) SettingsModuleSetting(moduleid string, settingid string) ([
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		return jsonResult, ErrUnauthorized
+	}
 	if response.StatusCode != 200 {
 		return jsonResult, errors.New("module or setting not found")
 	}
@@ -146,7 +257,7 @@ func (c *AuthClient) SettingsModuleSetting(moduleid string, settingid string) ([
 // moduleid and settingids parameter. This function takes an arbitrary number of setting ids as arguments.
 func (c *AuthClient) SettingsModuleSettings(moduleid string, settingids ...string) ([]SettingsValues, error) {
 	jsonResult := []SettingsValues{}
-	client := http.Client{}
+	client := c.httpClient()
 
 	for i, settingid := range settingids {
 		settingids[i] = strings.TrimSpace(settingid)
@@ -165,6 +276,9 @@ func (c *AuthClient) SettingsModuleSettings(moduleid string, settingids ...strin
 		return jsonResult, err
 	}
 	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		return jsonResult, ErrUnauthorized
+	}
 	if response.StatusCode != 200 {
 		return jsonResult, errors.New("module or setting not found")
 	}
@@ -189,7 +303,7 @@ type ModuleSettings struct {
 	ModuleId string           `json:"moduleid"`
 }
 
-// write settings
+// UpdateSettings writes the submitted setting values of one or more modules and returns the settings as confirmed by the inverter.
 func (c *AuthClient) UpdateSettings(settings []ModuleSettings) ([]ModuleSettings, error) {
 	jsonResult := []ModuleSettings{}
 	jsonPayload, err := json.Marshal(settings)
@@ -198,7 +312,7 @@ func (c *AuthClient) UpdateSettings(settings []ModuleSettings) ([]ModuleSettings
 		return jsonResult, err
 	}
 
-	client := http.Client{}
+	client := c.httpClient()
 	request, err := http.NewRequest("PUT", c.getUrl("/api/v1/settings"), bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return jsonResult, err
@@ -213,7 +327,7 @@ func (c *AuthClient) UpdateSettings(settings []ModuleSettings) ([]ModuleSettings
 	}
 	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
+	if err := checkResponse(response); err != nil {
 		return jsonResult, err
 	}
 
@@ -0,0 +1,87 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package golrackpi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	minSoc := SettingsDataValues{Id: "Battery:MinSoc", Type: "byte", Access: "readwrite", Min: "5", Max: "100"}
+	consumption := SettingsDataValues{Id: "Battery:MinHomeComsumption", Type: "float", Access: "readwrite", Min: "50", Max: "38000"}
+	power := SettingsDataValues{Id: "Power", Type: "uint16", Access: "readwrite"}
+	hostname := SettingsDataValues{Id: "Hostname", Type: "string", Access: "readwrite", Min: "1", Max: "8"}
+	readonly := SettingsDataValues{Id: "Inverter:MaxApparentPower", Type: "uint16", Access: "readonly"}
+
+	tests := []struct {
+		setting SettingsDataValues
+		value   string
+		valid   bool
+	}{
+		{minSoc, "5", true},
+		{minSoc, "100.0", true},
+		{minSoc, "4", false},
+		{minSoc, "101", false},
+		{minSoc, "50.5", false},
+		{minSoc, "abc", false},
+		{consumption, "50.5", true},
+		{consumption, "NaN", false},
+		{consumption, "Inf", false},
+		{consumption, "-Inf", false},
+		{consumption, "1e400", false},
+		{power, "0", true},
+		{power, "-1", false},
+		{hostname, "scb", true},
+		{hostname, "", false},
+		{hostname, "toolonghost", false},
+		{readonly, "1", false},
+	}
+	for _, test := range tests {
+		if err := test.setting.Validate(test.value); (err == nil) != test.valid {
+			t.Errorf("%s = %q: got %v, want valid %v", test.setting.Id, test.value, err, test.valid)
+		}
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	number := SettingsDataValues{Id: "Battery:MinSoc", Type: "byte"}
+	text := SettingsDataValues{Id: "Hostname", Type: "string"}
+
+	tests := []struct {
+		setting SettingsDataValues
+		a, b    string
+		want    bool
+	}{
+		{number, "5", "5", true},
+		{number, "5", "5.0", true},
+		{number, "05", "5", true},
+		{number, "5", "6", false},
+		{number, "5", "x", false},
+		{text, "scb", "scb", true},
+		{text, "01", "1", false},
+		{text, "1.0", "1", false},
+	}
+	for _, test := range tests {
+		if got := test.setting.EqualValues(test.a, test.b); got != test.want {
+			t.Errorf("%s %q and %q: got %v, want %v", test.setting.Id, test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSettingsUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Unauthorized"}`))
+	}))
+	defer server.Close()
+	client := NewWithParameter(AuthClient{Server: strings.TrimPrefix(server.URL, "http://")})
+	if _, err := client.Settings(); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v, want %v", err, ErrUnauthorized)
+	}
+}
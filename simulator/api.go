@@ -0,0 +1,337 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/geschke/golrackpi"
+)
+
+const (
+	softwareVersion = "01.26.09454"
+	apiVersion      = "0.2.0"
+	defaultMinSoC   = 5
+
+	// eventTimeLayout is the time format of events, which the inverter sends without time zone offset
+	eventTimeLayout = "2006-01-02T15:04:05.999999999"
+)
+
+// settingModules specifies the settings of the simulated inverter
+var settingModules = []golrackpi.SettingsData{
+	{ModuleId: "devices:local", Settings: []golrackpi.SettingsDataValues{
+		{Id: "Battery:ExternControl", Min: "0", Max: "2", Type: "byte", Access: "readwrite", Default: "0"},
+		{Id: "Battery:MinHomeComsumption", Min: "50", Max: "38000", Unit: "W", Type: "float", Access: "readwrite", Default: "50"},
+		{Id: "Battery:MinSoc", Min: "5", Max: "100", Unit: "%", Type: "byte", Access: "readwrite", Default: "5"},
+		{Id: "Inverter:MaxApparentPower", Min: "0", Max: "20000", Unit: "VA", Type: "uint32", Access: "readonly"},
+		{Id: "Properties:SerialNo", Type: "string", Access: "readonly"},
+		{Id: "Properties:VersionMC", Type: "string", Access: "readonly"},
+	}},
+	{ModuleId: "scb:network", Settings: []golrackpi.SettingsDataValues{
+		{Id: "Hostname", Min: "1", Max: "63", Type: "string", Access: "readwrite", Default: "scb"},
+	}},
+	{ModuleId: "scb:time", Settings: []golrackpi.SettingsDataValues{
+		{Id: "Time:TimeZone", Min: "1", Max: "64", Type: "string", Access: "readwrite", Default: "UTC"},
+	}},
+}
+
+// defaultSettingValues returns the initial setting values of the simulated inverter
+func defaultSettingValues(config Config) map[string]map[string]string {
+	values := make(map[string]map[string]string)
+	for _, module := range settingModules {
+		values[module.ModuleId] = make(map[string]string)
+		for _, setting := range module.Settings {
+			values[module.ModuleId][setting.Id] = setting.Default
+		}
+	}
+	values["devices:local"]["Inverter:MaxApparentPower"] = strconv.Itoa(int(config.PeakPower))
+	values["devices:local"]["Properties:SerialNo"] = config.SerialNumber
+	values["devices:local"]["Properties:VersionMC"] = softwareVersion
+	values["scb:time"]["Time:TimeZone"] = config.Location.String()
+	return values
+}
+
+// snapshot advances the plant to the simulated time and returns the process-data of all modules
+func (s *Simulator) snapshot() []golrackpi.ProcessDataValues {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	minSoC, err := strconv.ParseFloat(s.settings["devices:local"]["Battery:MinSoc"], 64)
+	if err != nil {
+		minSoC = defaultMinSoC
+	}
+	s.plant.advance(s.Now(), minSoC)
+	return s.plant.processData()
+}
+
+// version answers with name, hostname and versions of the inverter
+func (s *Simulator) version(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	hostname := s.settings["scb:network"]["Hostname"]
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"name":        "PUCK RESTful API",
+		"hostname":    hostname,
+		"sw_version":  softwareVersion,
+		"api_version": apiVersion,
+	})
+}
+
+// modules answers with the modules of process-data and settings
+func (s *Simulator) modules(w http.ResponseWriter, r *http.Request) {
+	modules := []golrackpi.ModuleData{}
+	for _, module := range s.snapshot() {
+		modules = append(modules, golrackpi.ModuleData{Id: module.ModuleId, Type: "device"})
+	}
+	for _, module := range settingModules {
+		if module.ModuleId != "devices:local" {
+			modules = append(modules, golrackpi.ModuleData{Id: module.ModuleId, Type: "config"})
+		}
+	}
+	writeJSON(w, modules)
+}
+
+// processData answers with the process-data ids of all modules (GET /processdata), the values of the requested modules
+// (POST /processdata) or the values of one module (GET /processdata/{module}[/{ids}])
+func (s *Simulator) processData(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/processdata"), "/")
+	modules := s.snapshot()
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			result := []golrackpi.ProcessData{}
+			for _, module := range modules {
+				ids := []string{}
+				for _, value := range module.ProcessData {
+					ids = append(ids, value.Id)
+				}
+				result = append(result, golrackpi.ProcessData{ModuleId: module.ModuleId, ProcessDataIds: ids})
+			}
+			writeJSON(w, result)
+		case http.MethodPost:
+			var request []golrackpi.ProcessData
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid request")
+				return
+			}
+			result := []golrackpi.ProcessDataValues{}
+			for _, selector := range request {
+				values, found := selectProcessData(modules, selector.ModuleId, selector.ProcessDataIds)
+				if !found {
+					writeError(w, http.StatusNotFound, "Requested module or processdata not found")
+					return
+				}
+				result = append(result, values)
+			}
+			writeJSON(w, result)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	moduleId, ids, _ := strings.Cut(path, "/")
+	var processDataIds []string
+	if ids != "" {
+		processDataIds = strings.Split(ids, ",")
+	}
+	values, found := selectProcessData(modules, moduleId, processDataIds)
+	if !found {
+		writeError(w, http.StatusNotFound, "Requested module or processdata not found")
+		return
+	}
+	writeJSON(w, []golrackpi.ProcessDataValues{values})
+}
+
+// selectProcessData returns the values of the module with the ids, all values if ids is empty
+func selectProcessData(modules []golrackpi.ProcessDataValues, moduleId string, ids []string) (golrackpi.ProcessDataValues, bool) {
+	for _, module := range modules {
+		if module.ModuleId != moduleId {
+			continue
+		}
+		if len(ids) == 0 {
+			return module, true
+		}
+		result := golrackpi.ProcessDataValues{ModuleId: moduleId}
+		for _, id := range ids {
+			found := false
+			for _, value := range module.ProcessData {
+				if value.Id == id {
+					result.ProcessData = append(result.ProcessData, value)
+					found = true
+				}
+			}
+			if !found {
+				return result, false
+			}
+		}
+		return result, true
+	}
+	return golrackpi.ProcessDataValues{}, false
+}
+
+// settingsHandler answers with the setting metadata (GET /settings), writes settings (PUT /settings) or answers with the values
+// of one module (GET /settings/{module}[/{ids}])
+func (s *Simulator) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/settings"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, settingModules)
+		case http.MethodPut:
+			s.updateSettings(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	moduleId, ids, _ := strings.Cut(path, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, found := s.settings[moduleId]
+	if !found {
+		writeError(w, http.StatusNotFound, "Module not found")
+		return
+	}
+	result := []golrackpi.SettingsValues{}
+	if ids == "" {
+		for id, value := range values {
+			result = append(result, golrackpi.SettingsValues{Id: id, Value: value})
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	} else {
+		for _, id := range strings.Split(ids, ",") {
+			value, found := values[id]
+			if !found {
+				writeError(w, http.StatusNotFound, "Setting not found")
+				return
+			}
+			result = append(result, golrackpi.SettingsValues{Id: id, Value: value})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// updateSettings validates all submitted settings before writing them, so invalid requests don't change anything
+func (s *Simulator) updateSettings(w http.ResponseWriter, r *http.Request) {
+	var request []golrackpi.ModuleSettings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	for _, module := range request {
+		definition, found := settingDefinition(module.ModuleId)
+		if !found {
+			writeError(w, http.StatusNotFound, "Module not found")
+			return
+		}
+		for _, value := range module.Settings {
+			setting, found := definition.Setting(value.Id)
+			if !found {
+				writeError(w, http.StatusNotFound, "Setting not found")
+				return
+			}
+			if err := setting.Validate(value.Value); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if setting.Id == "Time:TimeZone" {
+				if _, err := golrackpi.ParseTimeZone(value.Value); err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	for _, module := range request {
+		for _, value := range module.Settings {
+			s.settings[module.ModuleId][value.Id] = value.Value
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, request)
+}
+
+// settingDefinition returns the setting metadata of the module
+func settingDefinition(moduleId string) (golrackpi.SettingsData, bool) {
+	for _, module := range settingModules {
+		if module.ModuleId == moduleId {
+			return module, true
+		}
+	}
+	return golrackpi.SettingsData{}, false
+}
+
+// latestEvents answers with the events which started until the simulated time, latest first
+func (s *Simulator) latestEvents(w http.ResponseWriter, r *http.Request) {
+	max := 10
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var request struct {
+			Language string `json:"language"`
+			Max      int    `json:"max"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		if request.Max > 0 {
+			max = request.Max
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	now := s.Now()
+	s.mu.Lock()
+	events := append([]Event(nil), s.events...)
+	s.mu.Unlock()
+	sort.SliceStable(events, func(i, j int) bool { return events[i].After > events[j].After })
+
+	result := []map[string]interface{}{}
+	for _, event := range events {
+		start := s.config.Start.Add(event.After).In(s.config.Location)
+		if start.After(now) {
+			continue
+		}
+		var end interface{}
+		active := true
+		if event.For > 0 && !start.Add(event.For).After(now) {
+			end = start.Add(event.For).Format(eventTimeLayout)
+			active = false
+		}
+		result = append(result, map[string]interface{}{
+			"code":             event.Code,
+			"category":         event.Category,
+			"group":            event.Group,
+			"description":      event.Description,
+			"long_description": event.LongDescription,
+			"start_time":       start.Format(eventTimeLayout),
+			"end_time":         end,
+			"is_active":        active,
+		})
+		if len(result) >= max {
+			break
+		}
+	}
+	writeJSON(w, result)
+}
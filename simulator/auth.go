@@ -0,0 +1,217 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/geschke/golrackpi"
+	"github.com/geschke/golrackpi/internal/helper"
+)
+
+const (
+	userName = "user" // user name of the plant owner
+	rounds   = 29000  // PBKDF2 rounds as used by the inverter
+
+	transactionTimeout = time.Minute
+)
+
+// transaction is a started SCRAM authentication
+type transaction struct {
+	authMessage string
+	storedKey   []byte
+	serverKey   []byte
+	clientKey   []byte // set after the proof was verified
+	token       string
+	created     time.Time
+}
+
+// authStart answers the first step of the authentication with server nonce, salt and rounds
+func (s *Simulator) authStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var request golrackpi.AuthStartRequestType
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Nonce == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if request.Username != userName {
+		writeError(w, http.StatusBadRequest, "Unknown user")
+		return
+	}
+
+	salt, _ := helper.GenerateRandomBytes(16)
+	serverNonce := request.Nonce + b64.StdEncoding.EncodeToString([]byte(randomId(12)))
+	saltEncoded := b64.StdEncoding.EncodeToString(salt)
+
+	saltedPassword := helper.GetPBKDF2Hash(s.config.Password, string(salt), rounds)
+	clientKey := helper.GetHMACSHA256(saltedPassword, "Client Key")
+	t := &transaction{
+		authMessage: fmt.Sprintf("n=%s,r=%s,r=%s,s=%s,i=%d,c=biws,r=%s", userName, request.Nonce, serverNonce, saltEncoded, rounds, serverNonce),
+		storedKey:   helper.GetSHA256Hash(clientKey),
+		serverKey:   helper.GetHMACSHA256(saltedPassword, "Server Key"),
+		created:     time.Now(),
+	}
+	transactionId := randomId(16)
+
+	s.mu.Lock()
+	for id, old := range s.transactions {
+		if time.Since(old.created) > transactionTimeout {
+			delete(s.transactions, id)
+		}
+	}
+	s.transactions[transactionId] = t
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"nonce":         serverNonce,
+		"transactionId": transactionId,
+		"salt":          saltEncoded,
+		"rounds":        rounds,
+	})
+}
+
+// authFinish verifies the client proof and answers with server signature and token
+func (s *Simulator) authFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var request golrackpi.AuthFinishRequestType
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, found := s.transactions[request.TransactionId]
+	if !found || t.clientKey != nil {
+		writeError(w, http.StatusBadRequest, "Transaction not found")
+		return
+	}
+
+	// the proof is clientKey XOR clientSignature, so the client key is recovered and checked against the stored key
+	proof, err := b64.StdEncoding.DecodeString(request.Proof)
+	clientSignature := helper.GetHMACSHA256(t.storedKey, t.authMessage)
+	if err != nil || len(proof) != len(clientSignature) {
+		delete(s.transactions, request.TransactionId)
+		writeError(w, http.StatusBadRequest, "Authentication failed")
+		return
+	}
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	if !hmac.Equal(helper.GetSHA256Hash(clientKey), t.storedKey) {
+		delete(s.transactions, request.TransactionId)
+		writeError(w, http.StatusBadRequest, "Authentication failed")
+		return
+	}
+	t.clientKey = clientKey
+	t.token = randomId(16)
+
+	writeJSON(w, map[string]string{
+		"signature": b64.StdEncoding.EncodeToString(helper.GetHMACSHA256(t.serverKey, t.authMessage)),
+		"token":     t.token,
+	})
+}
+
+// authCreateSession decrypts the token and answers with a new session id
+func (s *Simulator) authCreateSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var request golrackpi.AuthCreateSessionType
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, found := s.transactions[request.TransactionId]
+	if !found || t.clientKey == nil {
+		writeError(w, http.StatusBadRequest, "Transaction not found")
+		return
+	}
+	delete(s.transactions, request.TransactionId)
+
+	h := hmac.New(sha256.New, t.storedKey)
+	h.Write([]byte("Session Key"))
+	h.Write([]byte(t.authMessage))
+	h.Write(t.clientKey)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	iv, errIv := b64.StdEncoding.DecodeString(request.Iv)
+	tag, errTag := b64.StdEncoding.DecodeString(request.Tag)
+	payload, errPayload := b64.StdEncoding.DecodeString(request.Payload)
+	if errIv != nil || errTag != nil || errPayload != nil || len(iv) != 16 {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	token, err := aesgcm.Open(nil, iv, append(payload, tag...), nil)
+	if err != nil || !bytes.Equal(token, []byte(t.token)) {
+		writeError(w, http.StatusBadRequest, "Authentication failed")
+		return
+	}
+
+	sessionId := randomId(32)
+	s.sessions[sessionId] = time.Now()
+	writeJSON(w, map[string]string{"sessionId": sessionId})
+}
+
+// logout deletes the session
+func (s *Simulator) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.mu.Lock()
+	delete(s.sessions, sessionId(r))
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{})
+}
+
+// me answers with the user of the session, or with the anonymous user for requests without valid session
+func (s *Simulator) me(w http.ResponseWriter, r *http.Request) {
+	if !s.validSession(r) {
+		writeJSON(w, map[string]interface{}{
+			"authenticated": false,
+			"role":          "NONE",
+			"anonymous":     true,
+			"locked":        false,
+			"permissions":   []string{},
+			"active":        false,
+		})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"authenticated": true,
+		"role":          "USER",
+		"anonymous":     false,
+		"locked":        false,
+		"permissions":   []string{},
+		"active":        true,
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+)
+
+// Fault specifies an error which is injected into matching requests. After and For refer to the simulated time since start.
+type Fault struct {
+	Path          string        // path prefix of matching requests, empty for all requests
+	Rate          float64       // probability of the fault per request, 1 for every request
+	Status        int           // HTTP status which is answered instead of the response, 0 to answer normally
+	Delay         time.Duration // latency added to the response
+	ExpireSession bool          // the session of the request is deleted, so the request is answered with 401 Unauthorized
+	After         time.Duration // the fault starts after this simulated duration
+	For           time.Duration // the fault ends after this simulated duration, 0 for no end
+}
+
+// matches returns true if the fault applies to the path at the simulated offset since start
+func (f Fault) matches(path string, offset time.Duration) bool {
+	if !strings.HasPrefix(path, f.Path) || offset < f.After {
+		return false
+	}
+	return f.For <= 0 || offset < f.After+f.For
+}
+
+// Event specifies an inverter event, which becomes active After the simulated start and is active For its duration
+type Event struct {
+	Code            int
+	Category        golrackpi.EventCategory
+	Group           golrackpi.EventGroup
+	Description     string
+	LongDescription string
+	After           time.Duration
+	For             time.Duration // 0 for an event which stays active
+}
+
+// ParseFault returns the fault of a specification like "path=/api/v1/processdata,status=503,rate=0.1,after=2h,for=30m".
+// Further keys are "delay" with a duration and "expire-session" without value.
+func ParseFault(spec string) (Fault, error) {
+	fault := Fault{Rate: 1}
+	err := parseSpec(spec, func(key string, value string) error {
+		var err error
+		switch key {
+		case "path":
+			fault.Path = value
+		case "rate":
+			fault.Rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (fault.Rate <= 0 || fault.Rate > 1) {
+				err = fmt.Errorf("rate %v is not between 0 and 1", fault.Rate)
+			}
+		case "status":
+			fault.Status, err = strconv.Atoi(value)
+			if err == nil && (fault.Status < 100 || fault.Status > 599) {
+				err = fmt.Errorf("invalid HTTP status %d", fault.Status)
+			}
+		case "delay":
+			fault.Delay, err = time.ParseDuration(value)
+		case "expire-session":
+			fault.ExpireSession = true
+		case "after":
+			fault.After, err = time.ParseDuration(value)
+		case "for":
+			fault.For, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		return err
+	})
+	if err != nil {
+		return fault, fmt.Errorf("invalid fault %q: %w", spec, err)
+	}
+	if fault.Status == 0 && fault.Delay == 0 && !fault.ExpireSession {
+		return fault, fmt.Errorf("invalid fault %q: status, delay or expire-session required", spec)
+	}
+	return fault, nil
+}
+
+// ParseEvent returns the event of a specification like "code=5014,category=error,description=Grid fault,after=1h,for=15m".
+// Further keys are "group" and "long-description". Values must not contain commas.
+func ParseEvent(spec string) (Event, error) {
+	event := Event{Category: golrackpi.EventCategoryInfo}
+	err := parseSpec(spec, func(key string, value string) error {
+		var err error
+		switch key {
+		case "code":
+			event.Code, err = strconv.Atoi(value)
+		case "category":
+			event.Category = golrackpi.EventCategory(value)
+			switch event.Category {
+			case golrackpi.EventCategoryInfo, golrackpi.EventCategoryWarning, golrackpi.EventCategoryError:
+			default:
+				err = fmt.Errorf("unknown category %q, please use info, warning or error", value)
+			}
+		case "group":
+			event.Group = golrackpi.EventGroup(value)
+		case "description":
+			event.Description = value
+		case "long-description":
+			event.LongDescription = value
+		case "after":
+			event.After, err = time.ParseDuration(value)
+		case "for":
+			event.For, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		return err
+	})
+	if err != nil {
+		return event, fmt.Errorf("invalid event %q: %w", spec, err)
+	}
+	if event.Code == 0 {
+		return event, fmt.Errorf("invalid event %q: code required", spec)
+	}
+	if event.Description == "" {
+		event.Description = fmt.Sprintf("Event %d", event.Code)
+	}
+	return event, nil
+}
+
+// parseSpec calls fn with key and value of every comma separated "key=value" element
+func parseSpec(spec string, fn func(key string, value string) error) error {
+	for _, element := range strings.Split(spec, ",") {
+		element = strings.TrimSpace(element)
+		if element == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(element, "=")
+		if err := fn(strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
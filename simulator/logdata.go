@@ -0,0 +1,140 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/golrackpi"
+)
+
+// maxLogDataDays is the maximum number of days of a log data download
+const maxLogDataDays = 366
+
+// logDataColumns are the columns of the log data export after the time column
+var logDataColumns = []string{
+	"DC1 U", "DC1 I", "DC1 P", "DC2 U", "DC2 I", "DC2 P",
+	"AC1 U", "AC1 I", "AC1 P", "AC2 U", "AC2 I", "AC2 P", "AC3 U", "AC3 I", "AC3 P", "AC F",
+	"total E", "Iso R", "HC1 P", "HC2 P", "HC3 P", "SOC H", "BAT I", "BAT U", "BAT Cycles",
+}
+
+// logData answers with the log data of the requested days in 5-minute resolution as tab separated values, until the simulated time.
+// The values are simulated from midnight of the first day, so they don't match the process-data of the running plant.
+func (s *Simulator) logData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var request struct {
+		Begin string `json:"begin"`
+		End   string `json:"end"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	begin, err := time.ParseInLocation("2006-01-02", request.Begin, s.config.Location)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid begin date")
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", request.End, s.config.Location)
+	if err != nil || end.Before(begin) {
+		writeError(w, http.StatusBadRequest, "Invalid end date")
+		return
+	}
+	if end.Sub(begin) > maxLogDataDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("At most %d days can be downloaded", maxLogDataDays))
+		return
+	}
+
+	s.mu.Lock()
+	minSoC, err := strconv.ParseFloat(s.settings["devices:local"]["Battery:MinSoc"], 64)
+	if err != nil {
+		minSoC = defaultMinSoC
+	}
+	hostname := s.settings["scb:network"]["Hostname"]
+	s.mu.Unlock()
+
+	now := s.Now()
+	until := end.AddDate(0, 0, 1)
+	if now.Before(until) {
+		until = now
+	}
+	config := s.config
+	config.Start = begin
+	p := newPlant(&config)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	fmt.Fprintf(out, "Wechselrichter Typ:\tPLENTICORE plus %.0f (simulator)\n", s.config.PeakPower/1000)
+	fmt.Fprintf(out, "Wechselrichter Name:\t%s\n", hostname)
+	fmt.Fprintf(out, "Wechselrichter Nr.:\t%s\n", s.config.SerialNumber)
+	fmt.Fprintf(out, "Version:\tMC:%s\n", softwareVersion)
+	fmt.Fprintf(out, "akt. Zeit:\t%d\n\n", now.Unix())
+	fmt.Fprintln(out, "Logdaten U[V], I[mA], P[W], E[kWh], F[Hz], R[kOhm], Ain T[digit], Zeit[sec]")
+	fmt.Fprintf(out, "Zeit\t%s\n", strings.Join(logDataColumns, "\t"))
+	for t := begin; t.Before(until); t = t.Add(golrackpi.LogDataInterval) {
+		p.advance(t, minSoC)
+		fmt.Fprintf(out, "%d\t%s\n", t.Unix(), strings.Join(p.logDataRow(), "\t"))
+	}
+}
+
+// logDataRow returns the values of the log data columns at the time of the plant. The battery columns are empty without battery.
+func (p *plant) logDataRow() []string {
+	values := make(map[string]float64)
+	for _, module := range p.processData() {
+		for _, value := range module.ProcessData {
+			if number, ok := value.Value.(float64); ok {
+				values[module.ModuleId+"/"+value.Id] = number
+			}
+		}
+	}
+	milliAmpere := func(power float64, voltage float64) float64 {
+		return math.Round(1000 * safeDivide(power, voltage))
+	}
+
+	row := map[string]float64{
+		"DC1 U":   values["devices:local:pv1/U"],
+		"DC1 I":   math.Round(1000 * values["devices:local:pv1/I"]),
+		"DC1 P":   values["devices:local:pv1/P"],
+		"DC2 U":   values["devices:local:pv2/U"],
+		"DC2 I":   math.Round(1000 * values["devices:local:pv2/I"]),
+		"DC2 P":   values["devices:local:pv2/P"],
+		"AC F":    values["devices:local:ac/Frequency"],
+		"total E": round2(p.energy["Yield:Total"] / 1000),
+		"Iso R":   math.Round(3000 + 2000*smoothNoise(p.config.Seed, 13, float64(p.time.Unix())/86400)),
+		"HC1 P":   values["devices:local/HomePv_P"],
+		"HC2 P":   values["devices:local/HomeBat_P"],
+		"HC3 P":   values["devices:local/HomeGrid_P"],
+	}
+	for i := 1; i <= 3; i++ {
+		phase := fmt.Sprintf("AC%d ", i)
+		u, power := values[fmt.Sprintf("devices:local:ac/L%d_U", i)], values[fmt.Sprintf("devices:local:ac/L%d_P", i)]
+		row[phase+"U"], row[phase+"I"], row[phase+"P"] = u, milliAmpere(power, u), power
+	}
+	if p.hasBattery() {
+		row["SOC H"] = values["devices:local:battery/SoC"]
+		row["BAT I"] = math.Round(1000 * values["devices:local:battery/I"])
+		row["BAT U"] = values["devices:local:battery/U"]
+		row["BAT Cycles"] = values["devices:local:battery/Cycles"]
+	}
+
+	fields := make([]string, len(logDataColumns))
+	for i, column := range logDataColumns {
+		if value, found := row[column]; found {
+			fields[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return fields
+}
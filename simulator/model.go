@@ -0,0 +1,302 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/geschke/golrackpi"
+)
+
+const (
+	step       = time.Minute         // simulated integration step
+	maxCatchUp = 31 * 24 * time.Hour // longer gaps between requests are skipped
+
+	inverterEfficiency = 0.97
+	batteryVoltage     = 400.0 // nominal battery voltage in V
+	gridVoltage        = 230.0
+
+	// inverter states as reported by Inverter:State
+	stateFeedIn  = 6
+	stateStandby = 10
+)
+
+var periods = []string{"Day", "Month", "Year", "Total"}
+
+// plant is the state of the simulated PV plant with battery and home consumption. Power values are in W, energy values in Wh.
+// Battery power is positive when discharging, grid power is positive when importing.
+type plant struct {
+	config *Config
+	time   time.Time
+
+	pv       float64
+	home     float64
+	battery  float64
+	grid     float64
+	homePv   float64
+	homeBat  float64
+	homeGrid float64
+	soc      float64
+	cycles   float64
+
+	energy map[string]float64 // energy per statistic id without prefix, e.g. "Yield:Day"
+	feedIn map[string]float64 // energy fed into the grid per period
+}
+
+// newPlant returns the plant simulated from midnight of the start day until the start time, so the daily statistics are plausible
+func newPlant(config *Config) *plant {
+	start := config.Start.In(config.Location)
+	p := &plant{
+		config: config,
+		time:   time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, config.Location),
+		soc:    30,
+		energy: make(map[string]float64),
+		feedIn: make(map[string]float64),
+	}
+	if !p.hasBattery() {
+		p.soc = 0
+	}
+	// plausible lifetime counters of a plant running for some years
+	p.energy["Yield:Total"] = config.PeakPower * 2800
+	p.energy["EnergyHome:Total"] = config.BaseLoad * 24 * 365 * 3
+	p.energy["EnergyHomePv:Total"] = p.energy["EnergyHome:Total"] * 0.35
+	p.energy["EnergyHomeBat:Total"] = p.energy["EnergyHome:Total"] * 0.25
+	p.energy["EnergyHomeGrid:Total"] = p.energy["EnergyHome:Total"] * 0.4
+	p.feedIn["Total"] = p.energy["Yield:Total"] - p.energy["EnergyHomePv:Total"] - p.energy["EnergyHomeBat:Total"]
+	p.cycles = 250
+
+	p.update(p.time, defaultMinSoC)
+	p.advance(config.Start, defaultMinSoC)
+	return p
+}
+
+// hasBattery returns true if the plant has a battery
+func (p *plant) hasBattery() bool {
+	return p.config.BatteryCapacity > 0
+}
+
+// advance integrates the energy flows in steps until the simulated time
+func (p *plant) advance(to time.Time, minSoC float64) {
+	if to.Sub(p.time) > maxCatchUp {
+		p.time = to.Add(-maxCatchUp)
+	}
+	for p.time.Before(to) {
+		next := p.time.Add(step)
+		if next.After(to) {
+			next = to
+		}
+		p.resetPeriods(p.time, next)
+		p.update(next, minSoC)
+		p.integrate(next.Sub(p.time).Hours())
+		p.time = next
+	}
+}
+
+// resetPeriods resets the statistics of the periods which end between the times
+func (p *plant) resetPeriods(from time.Time, to time.Time) {
+	a, b := from.In(p.config.Location), to.In(p.config.Location)
+	reset := map[string]bool{
+		"Day":   a.YearDay() != b.YearDay() || a.Year() != b.Year(),
+		"Month": a.Month() != b.Month() || a.Year() != b.Year(),
+		"Year":  a.Year() != b.Year(),
+	}
+	for period, ok := range reset {
+		if !ok {
+			continue
+		}
+		for _, name := range []string{"Yield", "EnergyHome", "EnergyHomePv", "EnergyHomeBat", "EnergyHomeGrid"} {
+			p.energy[name+":"+period] = 0
+		}
+		p.feedIn[period] = 0
+	}
+}
+
+// update sets the power values at the simulated time
+func (p *plant) update(t time.Time, minSoC float64) {
+	p.pv = pvPower(p.config, t)
+	p.home = homePower(p.config, t)
+
+	ac := p.pv * inverterEfficiency
+	surplus := ac - p.home
+	p.battery = 0
+	if p.hasBattery() {
+		maxPower := p.config.BatteryCapacity / 2
+		switch {
+		case surplus > 0 && p.soc < 100:
+			p.battery = -math.Min(surplus, maxPower)
+		case surplus < 0 && p.soc > minSoC:
+			p.battery = math.Min(-surplus, maxPower)
+		}
+	}
+	p.grid = p.home - ac - p.battery
+	p.homePv = math.Min(p.home, ac)
+	p.homeBat = math.Min(p.home-p.homePv, math.Max(p.battery, 0))
+	p.homeGrid = p.home - p.homePv - p.homeBat
+}
+
+// integrate adds the energy of the current power values over the hours
+func (p *plant) integrate(hours float64) {
+	if p.hasBattery() {
+		p.soc -= p.battery * hours / p.config.BatteryCapacity * 100
+		p.soc = math.Max(0, math.Min(100, p.soc))
+		p.cycles += math.Abs(p.battery) * hours / (2 * p.config.BatteryCapacity)
+	}
+	for _, period := range periods {
+		p.energy["Yield:"+period] += p.pv * inverterEfficiency * hours
+		p.energy["EnergyHome:"+period] += p.home * hours
+		p.energy["EnergyHomePv:"+period] += p.homePv * hours
+		p.energy["EnergyHomeBat:"+period] += p.homeBat * hours
+		p.energy["EnergyHomeGrid:"+period] += p.homeGrid * hours
+		p.feedIn[period] += math.Max(-p.grid, 0) * hours
+	}
+}
+
+// processData returns the process-data of all modules
+func (p *plant) processData() []golrackpi.ProcessDataValues {
+	t := p.time
+	ac := p.pv * inverterEfficiency
+	state := stateStandby
+	if p.pv > 0 {
+		state = stateFeedIn
+	}
+	voltage := gridVoltage + 3*(smoothNoise(p.config.Seed, 11, float64(t.Unix())/300)-0.5)
+	frequency := 50 + 0.04*(smoothNoise(p.config.Seed, 12, float64(t.Unix())/60)-0.5)
+
+	modules := []golrackpi.ProcessDataValues{
+		{ModuleId: "devices:local", ProcessData: []golrackpi.ProcessDataValue{
+			{Id: "Dc_P", Unit: "W", Value: round(p.pv)},
+			{Id: "Grid_P", Unit: "W", Value: round(p.grid)},
+			{Id: "HomeBat_P", Unit: "W", Value: round(p.homeBat)},
+			{Id: "HomeGrid_P", Unit: "W", Value: round(p.homeGrid)},
+			{Id: "HomePv_P", Unit: "W", Value: round(p.homePv)},
+			{Id: "Home_P", Unit: "W", Value: round(p.home)},
+			{Id: "Inverter:State", Unit: "", Value: state},
+		}},
+		{ModuleId: "devices:local:ac", ProcessData: []golrackpi.ProcessDataValue{
+			{Id: "Frequency", Unit: "Hz", Value: round2(frequency)},
+			{Id: "L1_P", Unit: "W", Value: round(ac / 3)},
+			{Id: "L1_U", Unit: "V", Value: round2(voltage)},
+			{Id: "L2_P", Unit: "W", Value: round(ac / 3)},
+			{Id: "L2_U", Unit: "V", Value: round2(voltage + 0.8)},
+			{Id: "L3_P", Unit: "W", Value: round(ac / 3)},
+			{Id: "L3_U", Unit: "V", Value: round2(voltage - 0.6)},
+			{Id: "P", Unit: "W", Value: round(ac)},
+		}},
+	}
+	if p.hasBattery() {
+		modules = append(modules, golrackpi.ProcessDataValues{ModuleId: "devices:local:battery", ProcessData: []golrackpi.ProcessDataValue{
+			{Id: "Cycles", Unit: "", Value: math.Floor(p.cycles)},
+			{Id: "I", Unit: "A", Value: round2(p.battery / batteryVoltage)},
+			{Id: "P", Unit: "W", Value: round(p.battery)},
+			{Id: "SoC", Unit: "%", Value: math.Round(p.soc)},
+			{Id: "U", Unit: "V", Value: round2(batteryVoltage - 20 + 0.4*p.soc)},
+		}})
+	}
+	for i, share := range []float64{0.6, 0.4} {
+		power := p.pv * share
+		u := 0.0
+		if power > 0 {
+			u = 480 + 60*math.Min(power/(p.config.PeakPower*share), 1)
+		}
+		modules = append(modules, golrackpi.ProcessDataValues{ModuleId: fmt.Sprintf("devices:local:pv%d", i+1), ProcessData: []golrackpi.ProcessDataValue{
+			{Id: "I", Unit: "A", Value: round2(safeDivide(power, u))},
+			{Id: "P", Unit: "W", Value: round(power)},
+			{Id: "U", Unit: "V", Value: round2(u)},
+		}})
+	}
+
+	statistics := golrackpi.ProcessDataValues{ModuleId: "scb:statistic:EnergyFlow"}
+	for _, period := range periods {
+		home := p.energy["EnergyHome:"+period]
+		yield := p.energy["Yield:"+period]
+		statistics.ProcessData = append(statistics.ProcessData,
+			golrackpi.ProcessDataValue{Id: "Statistic:Autarky:" + period, Unit: "%", Value: round2(100 * safeDivide(home-p.energy["EnergyHomeGrid:"+period], home))},
+			golrackpi.ProcessDataValue{Id: "Statistic:EnergyHome:" + period, Unit: "Wh", Value: round2(home)},
+			golrackpi.ProcessDataValue{Id: "Statistic:EnergyHomeBat:" + period, Unit: "Wh", Value: round2(p.energy["EnergyHomeBat:"+period])},
+			golrackpi.ProcessDataValue{Id: "Statistic:EnergyHomeGrid:" + period, Unit: "Wh", Value: round2(p.energy["EnergyHomeGrid:"+period])},
+			golrackpi.ProcessDataValue{Id: "Statistic:EnergyHomePv:" + period, Unit: "Wh", Value: round2(p.energy["EnergyHomePv:"+period])},
+			golrackpi.ProcessDataValue{Id: "Statistic:OwnConsumptionRate:" + period, Unit: "%", Value: round2(100 * safeDivide(yield-p.feedIn[period], yield))},
+			golrackpi.ProcessDataValue{Id: "Statistic:Yield:" + period, Unit: "Wh", Value: round2(yield)},
+		)
+	}
+	return append(modules, statistics)
+}
+
+// pvPower returns the DC power of the PV generator at the time. The day length and the peak follow the season, clouds reduce the
+// power by a random amount per day which varies in 15 minute intervals.
+func pvPower(config *Config, t time.Time) float64 {
+	local := t.In(config.Location)
+	season := math.Sin(2 * math.Pi * float64(local.YearDay()-80) / 365)
+	dayLength := 12 + 4*season
+	sunrise := 13 - dayLength/2
+	hour := float64(local.Hour()) + float64(local.Minute())/60 + float64(local.Second())/3600
+	if hour <= sunrise || hour >= sunrise+dayLength {
+		return 0
+	}
+	elevation := math.Sin(math.Pi * (hour - sunrise) / dayLength)
+
+	day := local.Year()*1000 + local.YearDay()
+	cloudiness := math.Pow(noise(config.Seed, int64(day)), 2)
+	clouds := 1 - 0.8*cloudiness*smoothNoise(config.Seed, 1, float64(t.Unix())/900)
+
+	return config.PeakPower * (0.7 + 0.3*season) * math.Pow(elevation, 1.2) * clouds
+}
+
+// homePower returns the home consumption at the time, i.e. the base load with peaks in the morning, at noon and in the evening
+// and occasional appliances
+func homePower(config *Config, t time.Time) float64 {
+	local := t.In(config.Location)
+	hour := float64(local.Hour()) + float64(local.Minute())/60 + float64(local.Second())/3600
+	peak := func(at float64, width float64, power float64) float64 {
+		return power * math.Exp(-math.Pow((hour-at)/width, 2))
+	}
+	power := config.BaseLoad * (0.9 + 0.2*smoothNoise(config.Seed, 2, float64(t.Unix())/600))
+	power += peak(7, 0.7, 800) + peak(12.5, 0.8, 1200) + peak(19, 1.5, 1500)
+	if n := smoothNoise(config.Seed, 3, float64(t.Unix())/300); n > 0.85 {
+		power += 2000 * (n - 0.85) / 0.15
+	}
+	return power
+}
+
+// noise returns a deterministic pseudo random number in [0, 1) for the key
+func noise(seed int64, key int64) float64 {
+	x := uint64(seed)*0x9e3779b97f4a7c15 ^ uint64(key)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
+
+// smoothNoise returns noise which is interpolated between integer positions
+func smoothNoise(seed int64, salt int64, position float64) float64 {
+	i := math.Floor(position)
+	f := position - i
+	f = f * f * (3 - 2*f)
+	a := noise(seed+salt<<32, int64(i))
+	b := noise(seed+salt<<32, int64(i)+1)
+	return a + (b-a)*f
+}
+
+// safeDivide returns a / b, or 0 if b is 0
+func safeDivide(a float64, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// round returns the value rounded to integers, as the inverter sends power values
+func round(value float64) float64 {
+	return math.Round(value)
+}
+
+// round2 returns the value rounded to two decimals
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 Ralf Geschke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package simulator provides an HTTP server which behaves like the REST API of a Kostal Plenticore inverter, with SCRAM login,
+// modules, process-data, settings, events, log data and version. The process-data follow daily PV, battery and home consumption curves in a
+// simulated time, which can run faster than real time. Faults and events can be injected. The package is used by the simulate
+// command and serves as test fixture for clients of the API.
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geschke/golrackpi"
+)
+
+// Config specifies the simulated inverter. Zero values are replaced by the defaults.
+type Config struct {
+	Password        string         // password of the plant owner "user", default "simulator"
+	Start           time.Time      // simulated time at start, default now
+	Speed           float64        // simulated seconds per real second, default 1
+	Location        *time.Location // time zone of the inverter, default UTC
+	PeakPower       float64        // peak PV power in W, default 10000
+	BatteryCapacity float64        // battery capacity in Wh, default 10000, negative for an inverter without battery
+	BaseLoad        float64        // base load of the home in W, default 300
+	SerialNumber    string         // default "SIM000000001"
+	Seed            int64          // seed of weather and load variation
+	SessionTimeout  time.Duration  // real idle time after which sessions expire, default 10 minutes
+	Faults          []Fault
+	Events          []Event
+}
+
+// Simulator is the http.Handler of the simulated REST API
+type Simulator struct {
+	config    Config
+	realStart time.Time
+	mux       *http.ServeMux
+
+	mu           sync.Mutex
+	plant        *plant
+	settings     map[string]map[string]string
+	sessions     map[string]time.Time
+	transactions map[string]*transaction
+	events       []Event
+	random       *mrand.Rand
+}
+
+// New returns a Simulator instance
+func New(config Config) *Simulator {
+	if config.Password == "" {
+		config.Password = "simulator"
+	}
+	if config.Start.IsZero() {
+		config.Start = time.Now()
+	}
+	if config.Speed <= 0 {
+		config.Speed = 1
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.PeakPower <= 0 {
+		config.PeakPower = 10000
+	}
+	if config.BatteryCapacity == 0 {
+		config.BatteryCapacity = 10000
+	}
+	if config.BaseLoad <= 0 {
+		config.BaseLoad = 300
+	}
+	if config.SerialNumber == "" {
+		config.SerialNumber = "SIM000000001"
+	}
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = 10 * time.Minute
+	}
+
+	s := &Simulator{
+		config:       config,
+		realStart:    time.Now(),
+		settings:     defaultSettingValues(config),
+		sessions:     make(map[string]time.Time),
+		transactions: make(map[string]*transaction),
+		events:       append([]Event(nil), config.Events...),
+		random:       mrand.New(mrand.NewSource(config.Seed)),
+	}
+	s.plant = newPlant(&s.config)
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/api/v1/auth/start", s.authStart)
+	s.mux.HandleFunc("/api/v1/auth/finish", s.authFinish)
+	s.mux.HandleFunc("/api/v1/auth/create_session", s.authCreateSession)
+	s.mux.HandleFunc("/api/v1/auth/logout", s.authorized(s.logout))
+	s.mux.HandleFunc("/api/v1/auth/me", s.me)
+	s.mux.HandleFunc("/api/v1/info/version", s.version)
+	s.mux.HandleFunc("/api/v1/modules", s.authorized(s.modules))
+	s.mux.HandleFunc("/api/v1/processdata", s.authorized(s.processData))
+	s.mux.HandleFunc("/api/v1/processdata/", s.authorized(s.processData))
+	s.mux.HandleFunc("/api/v1/settings", s.authorized(s.settingsHandler))
+	s.mux.HandleFunc("/api/v1/settings/", s.authorized(s.settingsHandler))
+	s.mux.HandleFunc("/api/v1/events/latest", s.authorized(s.latestEvents))
+	s.mux.HandleFunc("/api/v1/logdata/download", s.authorized(s.logData))
+	return s
+}
+
+// Now returns the simulated time
+func (s *Simulator) Now() time.Time {
+	elapsed := time.Since(s.realStart)
+	return s.config.Start.Add(time.Duration(float64(elapsed) * s.config.Speed)).In(s.config.Location)
+}
+
+// Password returns the password of the plant owner
+func (s *Simulator) Password() string {
+	return s.config.Password
+}
+
+// AddEvent adds an event, which becomes active After the current simulated time
+func (s *Simulator) AddEvent(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.After += s.Now().Sub(s.config.Start)
+	s.events = append(s.events, event)
+}
+
+// ExpireSessions deletes all sessions, so the next requests are answered with 401 Unauthorized
+func (s *Simulator) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]time.Time)
+}
+
+// ServeHTTP injects the configured faults and answers the request
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	offset := s.Now().Sub(s.config.Start)
+	for _, fault := range s.config.Faults {
+		if !fault.matches(r.URL.Path, offset) {
+			continue
+		}
+		s.mu.Lock()
+		hit := fault.Rate >= 1 || s.random.Float64() < fault.Rate
+		if hit && fault.ExpireSession {
+			delete(s.sessions, sessionId(r))
+		}
+		s.mu.Unlock()
+		if !hit {
+			continue
+		}
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status != 0 {
+			writeError(w, fault.Status, "injected fault")
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// sessionId returns the session id of the authorization header
+func sessionId(r *http.Request) string {
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("authorization"), "Session "))
+}
+
+// validSession returns true if the request has a valid session and updates the last use of the session
+func (s *Simulator) validSession(r *http.Request) bool {
+	id := sessionId(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastUse, found := s.sessions[id]
+	valid := found && time.Since(lastUse) < s.config.SessionTimeout
+	if valid {
+		s.sessions[id] = time.Now()
+	} else {
+		delete(s.sessions, id)
+	}
+	return valid
+}
+
+// authorized answers requests without valid session with 401 Unauthorized
+func (s *Simulator) authorized(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.validSession(r) {
+			writeError(w, http.StatusUnauthorized, "Session does not exist or is expired.")
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// writeJSON writes the value as JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error response in the format of the inverter
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// randomId returns a random hex string of n bytes
+func randomId(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Server is a running simulator, e.g. as test fixture
+type Server struct {
+	*Simulator
+	Addr string // host:port, to be used as server of a client
+	URL  string
+
+	server *http.Server
+}
+
+// Start starts a simulator on a free port of localhost
+func Start(config Config) (*Server, error) {
+	return Listen("127.0.0.1:0", config)
+}
+
+// Listen starts a simulator on the address
+func Listen(address string, config Config) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Simulator: New(config), Addr: listener.Addr().String()}
+	s.URL = "http://" + s.Addr
+	s.server = &http.Server{Handler: s.Simulator}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			listener.Close()
+		}
+	}()
+	return s, nil
+}
+
+// Client returns a client instance with server and password of the simulator
+func (s *Server) Client() *golrackpi.AuthClient {
+	return golrackpi.NewWithParameter(golrackpi.AuthClient{Scheme: "http", Server: s.Addr, Password: s.config.Password})
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.server.Close()
+}